@@ -2,59 +2,72 @@ package main
 
 import (
 	"context"
-	"net/http"
+	"flag"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
-	"time"
 
 	"rbac/pkg/kubernetes"
+	"rbac/pkg/listcache"
 	"rbac/pkg/server"
+	"rbac/pkg/tracing"
 
 	"github.com/labstack/echo/v4"
-	"github.com/rs/cors"
 )
 
 func main() {
-	// Create Kubernetes clientset
-	clientset, err := kubernetes.NewClientset()
+	configPath := flag.String("config", os.Getenv("CONFIG_PATH"), "path to a YAML configuration file")
+	flag.Parse()
+
+	// Load server configuration; environment variables override the file
+	serverConfig, err := server.LoadConfig(*configPath)
+	if err != nil {
+		panic("Error loading configuration: " + err.Error())
+	}
+
+	// Structured JSON logs
+	slog.SetDefault(slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: serverConfig.SlogLevel()})))
+	slog.Debug("Effective configuration", "config", serverConfig.Redacted())
+
+	// Tracing is a no-op unless an OTLP endpoint is configured
+	shutdownTracing, err := tracing.Setup(context.Background())
+	if err != nil {
+		panic("Error configuring tracing: " + err.Error())
+	}
+
+	// Create Kubernetes clientset; repeated LIST calls are answered from a short-lived cache
+	listCache := listcache.New(serverConfig.ListCacheTTL.Duration)
+	kubeOptions := serverConfig.KubernetesOptions()
+	kubeOptions.ListCache = listCache
+	clientset, err := kubernetes.NewClientset(kubeOptions)
 	if err != nil {
 		panic("Error creating Kubernetes clientset: " + err.Error())
 	}
 
 	// Create Echo instance
 	e := echo.New()
+	e.HideBanner = true
+	e.HidePort = true
+
+	// Register routes; fails before serving anything if TLS is misconfigured
+	srv, err := server.New(e, clientset, listCache, serverConfig)
+	if err != nil {
+		panic("Error creating server: " + err.Error())
+	}
+
+	// Serve until SIGINT or SIGTERM, then drain requests, streams and workers
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	runErr := srv.Run(ctx)
 
-	// CORS
-	e.Use(echo.WrapMiddleware(cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"*"},
-		AllowCredentials: true,
-	}).Handler))
-
-	// Load server configuration
-	serverConfig := server.NewConfig()
-
-	// Register routes
-	server.RegisterRoutes(e, clientset, serverConfig)
-
-	// Start server
-	go func() {
-		if err := e.Start(":" + serverConfig.Port); err != nil && err != http.ErrServerClosed {
-			panic("Shutting down the server: " + err.Error())
-		}
-	}()
-
-	// Graceful shutdown
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
-	<-quit
-	println("Shutting down server...")
-
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	flushCtx, cancel := context.WithTimeout(context.Background(), serverConfig.ShutdownTimeout.Duration)
 	defer cancel()
-	if err := e.Shutdown(ctx); err != nil {
-		panic("Error during server shutdown: " + err.Error())
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("Error flushing traces", "error", err)
+	}
+	if runErr != nil {
+		slog.Error("Server exited with error", "error", runErr)
+		os.Exit(1)
 	}
 }
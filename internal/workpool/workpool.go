@@ -0,0 +1,59 @@
+// Package workpool runs the per-namespace steps of cluster-wide scans with bounded concurrency, so a scan
+// is neither serial nor a burst that API server priority and fairness throttles.
+package workpool
+
+import (
+	"context"
+	"sync"
+)
+
+// Result is the outcome of running a step for one item.
+type Result[I, R any] struct {
+	Item  I
+	Value R
+	// Err is the step's error, or the context's error when the scan was cancelled before the item was run.
+	Err error
+}
+
+// Run calls fn for every item using at most concurrency goroutines and returns the results in the order
+// of items. A failing item does not stop the others; once ctx is cancelled no further items are started,
+// and fn is expected to return promptly since it is given ctx.
+func Run[I, R any](ctx context.Context, concurrency int, items []I, fn func(context.Context, I) (R, error)) []Result[I, R] {
+	results := make([]Result[I, R], len(items))
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > len(items) {
+		concurrency = len(items)
+	}
+
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				value, err := fn(ctx, items[i])
+				results[i] = Result[I, R]{Item: items[i], Value: value, Err: err}
+			}
+		}()
+	}
+
+	i := 0
+feed:
+	for ; i < len(items); i++ {
+		select {
+		case next <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	for ; i < len(items); i++ {
+		results[i] = Result[I, R]{Item: items[i], Err: ctx.Err()}
+	}
+	return results
+}
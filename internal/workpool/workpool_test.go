@@ -0,0 +1,109 @@
+package workpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRunKeepsOrderAndPartialResults(t *testing.T) {
+	items := []string{"default", "kube-system", "prod", "staging"}
+	results := Run(context.Background(), 2, items, func(_ context.Context, namespace string) (int, error) {
+		if namespace == "kube-system" {
+			return 0, errors.New("forbidden")
+		}
+		return len(namespace), nil
+	})
+
+	if len(results) != len(items) {
+		t.Fatalf("%d results, want %d", len(results), len(items))
+	}
+	for i, result := range results {
+		if result.Item != items[i] {
+			t.Errorf("result %d is for %s, want %s", i, result.Item, items[i])
+		}
+		if items[i] == "kube-system" {
+			if result.Err == nil {
+				t.Error("kube-system has no error")
+			}
+			continue
+		}
+		if result.Err != nil || result.Value != len(items[i]) {
+			t.Errorf("result for %s = %+v", items[i], result)
+		}
+	}
+}
+
+func TestRunBoundsConcurrency(t *testing.T) {
+	tests := []struct {
+		concurrency int
+		items       int
+		wantMax     int32
+	}{
+		{4, 40, 4},
+		{0, 5, 1},
+		{-1, 5, 1},
+		{10, 3, 3},
+		{3, 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d workers for %d items", tt.concurrency, tt.items), func(t *testing.T) {
+			var running, peak, calls atomic.Int32
+			results := Run(context.Background(), tt.concurrency, make([]int, tt.items), func(context.Context, int) (struct{}, error) {
+				calls.Add(1)
+				n := running.Add(1)
+				for {
+					p := peak.Load()
+					if n <= p || peak.CompareAndSwap(p, n) {
+						break
+					}
+				}
+				time.Sleep(5 * time.Millisecond)
+				running.Add(-1)
+				return struct{}{}, nil
+			})
+			if len(results) != tt.items || int(calls.Load()) != tt.items {
+				t.Errorf("%d results from %d calls, want %d", len(results), calls.Load(), tt.items)
+			}
+			if got := peak.Load(); got != tt.wantMax {
+				t.Errorf("at most %d ran at once, want %d", got, tt.wantMax)
+			}
+		})
+	}
+}
+
+func TestRunStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var started atomic.Int32
+	go func() {
+		for started.Load() < 2 {
+			time.Sleep(time.Millisecond)
+		}
+		cancel()
+	}()
+
+	start := time.Now()
+	results := Run(ctx, 2, make([]int, 100), func(ctx context.Context, _ int) (int, error) {
+		started.Add(1)
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-time.After(time.Minute):
+			return 1, nil
+		}
+	})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run returned %v after cancellation", elapsed)
+	}
+	if n := started.Load(); n == 100 {
+		t.Error("every item was started despite the cancellation")
+	}
+	for i, result := range results {
+		if !errors.Is(result.Err, context.Canceled) {
+			t.Errorf("result %d = %+v, want cancelled", i, result)
+		}
+	}
+}
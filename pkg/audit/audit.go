@@ -0,0 +1,299 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contextKeyRecorded marks a request whose audit entry was already written by its handler.
+const contextKeyRecorded = "audit.recorded"
+
+// contextKeyAuditor holds the auditor serving the request.
+const contextKeyAuditor = "audit.auditor"
+
+// contextKeyAnnotation holds resource identifiers and object snapshots supplied by the handler.
+const contextKeyAnnotation = "audit.annotation"
+
+// contextKeyOverride marks a request that overrode the protection of a system object.
+const contextKeyOverride = "audit.override"
+
+// maxSnapshotSize caps the encoded size of each before/after snapshot.
+const maxSnapshotSize = 64 * 1024
+
+// truncatedMarker replaces snapshots larger than maxSnapshotSize.
+var truncatedMarker = json.RawMessage(`"<truncated>"`)
+
+// The categories of audit entry.
+const (
+	// CategoryRBAC entries record changes made through the API, and are the default.
+	CategoryRBAC = "rbac"
+	// CategoryAuth entries record authentication events.
+	CategoryAuth = "auth"
+)
+
+// ActionAuthFailed is the action of an entry recording a request refused for its credentials.
+const ActionAuthFailed = "auth_failed"
+
+// anonymousActor is recorded when the request carries no authenticated identity.
+const anonymousActor = "anonymous"
+
+// Entry represents a single audit record.
+type Entry struct {
+	Time         time.Time `json:"time"`
+	Category     string    `json:"category"`
+	RequestID    string    `json:"requestId,omitempty"`
+	Actor        string    `json:"actor"`
+	SourceIP     string    `json:"sourceIP,omitempty"`
+	Action       string    `json:"action"`
+	Method       string    `json:"method"`
+	Route        string    `json:"route"`
+	Resource     string    `json:"resource,omitempty"`
+	Namespace    string    `json:"namespace,omitempty"`
+	ResourceName string    `json:"resourceName,omitempty"`
+	Status       int       `json:"status"`
+	Details      *Details  `json:"details,omitempty"`
+	// ProtectionOverridden is set when an admin changed a protected object.
+	ProtectionOverridden bool `json:"protectionOverridden,omitempty"`
+	// UserAgent is recorded for authentication events.
+	UserAgent string `json:"userAgent,omitempty"`
+	// Reason is why an authentication failed, such as missing_token or invalid_token.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Details holds snapshots of the object before and after a mutation.
+type Details struct {
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	Truncated bool            `json:"truncated,omitempty"`
+}
+
+// annotation is what a handler attaches to the request for the middleware's entry.
+type annotation struct {
+	namespace string
+	name      string
+	details   *Details
+}
+
+// Sink receives audit entries.
+type Sink interface {
+	Write(entry Entry)
+}
+
+// Auditor fans audit entries out to its sinks.
+type Auditor struct {
+	sinks []Sink
+}
+
+// New creates an auditor writing to the given sinks.
+func New(sinks ...Sink) *Auditor {
+	return &Auditor{sinks: sinks}
+}
+
+// Record writes an entry to every sink, filling in the timestamp and category if they are missing.
+func (a *Auditor) Record(entry Entry) {
+	if entry.Time.IsZero() {
+		entry.Time = time.Now().UTC()
+	}
+	if entry.Category == "" {
+		entry.Category = CategoryRBAC
+	}
+	for _, sink := range a.sinks {
+		sink.Write(entry)
+	}
+}
+
+// Middleware records an audit entry for every successful mutating request,
+// unless the handler already recorded one itself.
+func (a *Auditor) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(contextKeyAuditor, a)
+
+			err := next(c)
+			if err != nil || !isMutating(c.Request().Method) || c.Get(contextKeyRecorded) != nil {
+				return err
+			}
+			if status := c.Response().Status; status >= http.StatusBadRequest {
+				return nil
+			}
+
+			entry := EntryFromContext(c)
+			if ann, ok := c.Get(contextKeyAnnotation).(annotation); ok {
+				entry.Namespace = ann.namespace
+				entry.ResourceName = ann.name
+				entry.Details = ann.details
+			}
+			entry.ProtectionOverridden = c.Get(contextKeyOverride) != nil
+			a.Record(entry)
+			return nil
+		}
+	}
+}
+
+// Attach makes the auditor available to a request without auditing it, so routes outside the audited API,
+// such as /metrics, record their failed authentications.
+func (a *Auditor) Attach() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(contextKeyAuditor, a)
+			return next(c)
+		}
+	}
+}
+
+// RecordFromHandler writes a handler-built entry and marks the request so the
+// middleware does not write a duplicate.
+func RecordFromHandler(c echo.Context, entry Entry) {
+	auditor, ok := c.Get(contextKeyAuditor).(*Auditor)
+	if !ok {
+		return
+	}
+	auditor.Record(entry)
+	c.Set(contextKeyRecorded, true)
+}
+
+// RecordAuthFailure writes an entry for a request refused for its credentials, whatever its method, with
+// the reason it failed. The credentials presented are never recorded.
+func RecordAuthFailure(c echo.Context, reason string) {
+	auditor, ok := c.Get(contextKeyAuditor).(*Auditor)
+	if !ok {
+		return
+	}
+	entry := EntryFromContext(c)
+	entry.Category = CategoryAuth
+	entry.Action = ActionAuthFailed
+	entry.Status = http.StatusUnauthorized
+	entry.UserAgent = c.Request().UserAgent()
+	entry.Reason = reason
+	auditor.Record(entry)
+}
+
+// Skip marks a request that changes nothing despite its method, such as a render or a dry run, so the
+// middleware writes no entry for it.
+func Skip(c echo.Context) {
+	c.Set(contextKeyRecorded, true)
+}
+
+// Annotate attaches the affected object's identity and before/after snapshots
+// to the request, to be included in the entry written by the middleware.
+// Either snapshot may be nil, for creations and deletions respectively.
+func Annotate(c echo.Context, namespace, name string, before, after interface{}) {
+	c.Set(contextKeyAnnotation, annotation{namespace: namespace, name: name, details: NewDetails(before, after)})
+}
+
+// MarkProtectionOverridden flags the request's audit entry as having overridden the protection of a
+// system object.
+func MarkProtectionOverridden(c echo.Context) {
+	c.Set(contextKeyOverride, true)
+}
+
+// NewDetails encodes before and after snapshots for an entry, truncating oversized ones.
+func NewDetails(before, after interface{}) *Details {
+	beforeData, beforeTruncated := encodeSnapshot(before)
+	afterData, afterTruncated := encodeSnapshot(after)
+	return &Details{
+		Before:    beforeData,
+		After:     afterData,
+		Truncated: beforeTruncated || afterTruncated,
+	}
+}
+
+// encodeSnapshot marshals a snapshot, replacing it with a marker when it is too large.
+func encodeSnapshot(v interface{}) (json.RawMessage, bool) {
+	if v == nil {
+		return nil, false
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	if len(data) > maxSnapshotSize {
+		return truncatedMarker, true
+	}
+	return data, false
+}
+
+// Actor returns the identity responsible for the request. Requests are not authenticated yet, so this is
+// always the anonymous actor.
+func Actor(c echo.Context) string {
+	return anonymousActor
+}
+
+// EntryFromContext builds an entry from the request's method, route and query parameters.
+func EntryFromContext(c echo.Context) Entry {
+	req := c.Request()
+	resource := routeResource(c.Path())
+	return Entry{
+		RequestID:    c.Response().Header().Get(echo.HeaderXRequestID),
+		Actor:        Actor(c),
+		SourceIP:     c.RealIP(),
+		Action:       actionFor(req.Method, resource),
+		Method:       req.Method,
+		Route:        c.Path(),
+		Resource:     resource,
+		Namespace:    c.QueryParam("namespace"),
+		ResourceName: c.QueryParam("name"),
+		Status:       c.Response().Status,
+	}
+}
+
+// isMutating reports whether the HTTP method changes state.
+func isMutating(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// routeResource extracts the resource segment from a route such as /api/roles.
+func routeResource(route string) string {
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	for i := len(segments) - 1; i >= 0; i-- {
+		if segments[i] != "" && !strings.HasPrefix(segments[i], ":") && segments[i] != "api" {
+			return segments[i]
+		}
+	}
+	return ""
+}
+
+// actionFor derives an action name such as update_role from the method and resource.
+func actionFor(method, resource string) string {
+	verb := strings.ToLower(method)
+	switch method {
+	case http.MethodPost:
+		verb = "create"
+	case http.MethodPut:
+		verb = "update"
+	}
+	if resource == "" {
+		return verb
+	}
+	return verb + "_" + strings.TrimSuffix(resource, "s")
+}
+
+// LogSink writes audit entries as JSON lines.
+type LogSink struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewLogSink creates a sink writing JSON lines to w.
+func NewLogSink(w io.Writer) *LogSink {
+	return &LogSink{enc: json.NewEncoder(w)}
+}
+
+// Write encodes the entry as a single JSON line.
+func (s *LogSink) Write(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(struct {
+		Audit Entry `json:"audit"`
+	}{entry})
+}
@@ -0,0 +1,194 @@
+package audit
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// memorySink keeps the entries written to it.
+type memorySink struct {
+	mu      sync.Mutex
+	entries []Entry
+}
+
+func (s *memorySink) Write(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+// audited serves one request to handler, routed as /api/roles or /api/roles/:name behind the auditor, and
+// returns the entries written.
+func audited(method, target string, handler echo.HandlerFunc) []Entry {
+	sink := &memorySink{}
+	e := echo.New()
+	api := e.Group("/api", New(sink).Middleware())
+	api.Add(method, "/roles", handler)
+	api.Add(method, "/roles/:name", handler)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(method, target, nil))
+	return sink.entries
+}
+
+func TestMiddlewareRecordsOnePerMutation(t *testing.T) {
+	respond := func(status int) echo.HandlerFunc {
+		return func(c echo.Context) error { return c.NoContent(status) }
+	}
+	tests := []struct {
+		name    string
+		method  string
+		target  string
+		handler echo.HandlerFunc
+		want    []Entry
+	}{
+		{
+			name:    "create",
+			method:  http.MethodPost,
+			target:  "/api/roles?namespace=prod&name=deployer",
+			handler: respond(http.StatusCreated),
+			want: []Entry{{
+				Category: CategoryRBAC, Actor: anonymousActor, Action: "create_role", Method: http.MethodPost,
+				Route: "/api/roles", Resource: "roles", Namespace: "prod", ResourceName: "deployer", Status: http.StatusCreated,
+			}},
+		},
+		{
+			name:    "path parameter",
+			method:  http.MethodDelete,
+			target:  "/api/roles/deployer?namespace=prod",
+			handler: respond(http.StatusOK),
+			want: []Entry{{
+				Category: CategoryRBAC, Actor: anonymousActor, Action: "delete_role", Method: http.MethodDelete,
+				Route: "/api/roles/:name", Resource: "roles", Namespace: "prod", Status: http.StatusOK,
+			}},
+		},
+		{name: "read", method: http.MethodGet, target: "/api/roles", handler: respond(http.StatusOK)},
+		{name: "head", method: http.MethodHead, target: "/api/roles", handler: respond(http.StatusOK)},
+		{
+			name:    "handler error",
+			method:  http.MethodPut,
+			target:  "/api/roles",
+			handler: func(echo.Context) error { return echo.NewHTTPError(http.StatusConflict, "conflict") },
+		},
+		{
+			name:    "plain error",
+			method:  http.MethodPut,
+			target:  "/api/roles",
+			handler: func(echo.Context) error { return errors.New("boom") },
+		},
+		{name: "error status", method: http.MethodPost, target: "/api/roles", handler: respond(http.StatusBadRequest)},
+		{
+			name:   "skipped",
+			method: http.MethodPost,
+			target: "/api/roles",
+			handler: func(c echo.Context) error {
+				Skip(c)
+				return c.NoContent(http.StatusOK)
+			},
+		},
+		{
+			name:   "recorded by the handler",
+			method: http.MethodPost,
+			target: "/api/roles",
+			handler: func(c echo.Context) error {
+				RecordFromHandler(c, Entry{Action: "apply_template", Status: http.StatusCreated})
+				return c.NoContent(http.StatusCreated)
+			},
+			want: []Entry{{Category: CategoryRBAC, Action: "apply_template", Status: http.StatusCreated}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := audited(tt.method, tt.target, tt.handler)
+			if len(entries) != len(tt.want) {
+				t.Fatalf("%d entries, want %d: %+v", len(entries), len(tt.want), entries)
+			}
+			for i, entry := range entries {
+				if entry.Time.IsZero() {
+					t.Error("entry has no time")
+				}
+				entry.Time = tt.want[i].Time
+				entry.SourceIP = ""
+				if entry != tt.want[i] {
+					t.Errorf("entry = %+v, want %+v", entry, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMiddlewareAnnotations(t *testing.T) {
+	entries := audited(http.MethodPut, "/api/roles/deployer", func(c echo.Context) error {
+		Annotate(c, "prod", "deployer", map[string]string{"verbs": "get"}, map[string]string{"verbs": "list"})
+		MarkProtectionOverridden(c)
+		return c.NoContent(http.StatusOK)
+	})
+	if len(entries) != 1 {
+		t.Fatalf("%d entries, want 1", len(entries))
+	}
+	entry := entries[0]
+	if entry.Namespace != "prod" || entry.ResourceName != "deployer" || !entry.ProtectionOverridden {
+		t.Errorf("entry = %+v, want prod/deployer with the protection overridden", entry)
+	}
+	if entry.Details == nil || string(entry.Details.Before) != `{"verbs":"get"}` || string(entry.Details.After) != `{"verbs":"list"}` {
+		t.Errorf("details = %+v", entry.Details)
+	}
+}
+
+func TestRecordAuthFailure(t *testing.T) {
+	sink := &memorySink{}
+	e := echo.New()
+	e.GET("/metrics", func(c echo.Context) error {
+		RecordAuthFailure(c, "invalid_token")
+		return echo.ErrUnauthorized
+	}, New(sink).Attach())
+	e.GET("/unaudited", func(c echo.Context) error {
+		RecordAuthFailure(c, "missing_token")
+		return echo.ErrUnauthorized
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("User-Agent", "prometheus")
+	req.Header.Set(echo.HeaderAuthorization, "Bearer secret")
+	e.ServeHTTP(httptest.NewRecorder(), req)
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/unaudited", nil))
+
+	if len(sink.entries) != 1 {
+		t.Fatalf("%d entries, want 1 for the route with an auditor", len(sink.entries))
+	}
+	entry := sink.entries[0]
+	if entry.Category != CategoryAuth || entry.Action != ActionAuthFailed || entry.Reason != "invalid_token" ||
+		entry.Status != http.StatusUnauthorized || entry.UserAgent != "prometheus" || entry.Route != "/metrics" {
+		t.Errorf("entry = %+v", entry)
+	}
+}
+
+func TestNewDetailsTruncates(t *testing.T) {
+	details := NewDetails(nil, strings.Repeat("x", maxSnapshotSize))
+	if details.Before != nil {
+		t.Errorf("Before = %s, want nil for a creation", details.Before)
+	}
+	if string(details.After) != string(truncatedMarker) || !details.Truncated {
+		t.Errorf("details = %+v, want the oversized snapshot truncated", details)
+	}
+}
+
+func TestActionFor(t *testing.T) {
+	tests := []struct {
+		method, route, want string
+	}{
+		{http.MethodPost, "/api/roles", "create_role"},
+		{http.MethodPut, "/api/clusterrolebindings/:name", "update_clusterrolebinding"},
+		{http.MethodDelete, "/api/namespaces", "delete_namespace"},
+		{http.MethodPatch, "/api", "patch"},
+	}
+	for _, tt := range tests {
+		if got := actionFor(tt.method, routeResource(tt.route)); got != tt.want {
+			t.Errorf("action of %s %s = %q, want %q", tt.method, tt.route, got, tt.want)
+		}
+	}
+}
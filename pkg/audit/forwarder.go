@@ -0,0 +1,341 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rbac/pkg/version"
+)
+
+// Forwarder formats.
+const (
+	FormatCEF  = "cef"
+	FormatJSON = "json"
+)
+
+const (
+	// forwarderDialTimeout bounds connecting to the collector.
+	forwarderDialTimeout = 5 * time.Second
+	// forwarderWriteTimeout bounds sending a single message.
+	forwarderWriteTimeout = 5 * time.Second
+	// forwarderRedialBackoff is how long to wait after a failed dial before trying again.
+	forwarderRedialBackoff = 5 * time.Second
+	// syslogPriority is facility log audit (13) with severity notice (5).
+	syslogPriority = 13*8 + 5
+)
+
+// signatureIDs maps audit actions to stable CEF signature ids.
+var signatureIDs = map[string]string{
+	"create_role":               "100",
+	"update_role":               "101",
+	"delete_role":               "102",
+	"create_rolebinding":        "110",
+	"update_rolebinding":        "111",
+	"delete_rolebinding":        "112",
+	"create_clusterrole":        "120",
+	"update_clusterrole":        "121",
+	"delete_clusterrole":        "122",
+	"create_clusterrolebinding": "130",
+	"update_clusterrolebinding": "131",
+	"delete_clusterrolebinding": "132",
+	"create_namespace":          "140",
+	"delete_namespace":          "142",
+	"create_serviceaccount":     "150",
+	"delete_serviceaccount":     "152",
+	"apply_template":            "160",
+	"apply_consolidation":       "170",
+	"expire_binding":            "180",
+	ActionAuthFailed:            "200",
+	"flush_cache":               "300",
+	"enable_read_only":          "310",
+	"disable_read_only":         "311",
+	"git_sync":                  "320",
+}
+
+// ForwarderStatus reports the health of the forwarder.
+type ForwarderStatus struct {
+	Enabled       bool       `json:"enabled"`
+	Address       string     `json:"address,omitempty"`
+	Format        string     `json:"format,omitempty"`
+	QueueDepth    int        `json:"queueDepth"`
+	QueueCapacity int        `json:"queueCapacity"`
+	Sent          uint64     `json:"sent"`
+	Dropped       uint64     `json:"dropped"`
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// Forwarder is a sink that sends audit entries to a syslog collector asynchronously.
+// Entries are queued in memory and dropped, with a counter, when the queue is full,
+// so writers are never blocked on the collector.
+type Forwarder struct {
+	network  string
+	address  string
+	format   string
+	hostname string
+	queue    chan Entry
+
+	sent    atomic.Uint64
+	dropped atomic.Uint64
+
+	mu            sync.Mutex
+	lastError     string
+	lastErrorTime time.Time
+
+	conn       net.Conn
+	lastDialAt time.Time
+}
+
+// NewForwarder creates a forwarder for a collector URL such as udp://siem:514 or tcp://siem:601.
+func NewForwarder(collectorURL, format string, queueSize int) (*Forwarder, error) {
+	u, err := url.Parse(collectorURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid collector address: %w", err)
+	}
+	if u.Scheme != "udp" && u.Scheme != "tcp" {
+		return nil, fmt.Errorf("unsupported collector scheme %q, expected udp or tcp", u.Scheme)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("collector address %q has no host", collectorURL)
+	}
+	if format != FormatCEF && format != FormatJSON {
+		return nil, fmt.Errorf("unsupported format %q, expected %s or %s", format, FormatCEF, FormatJSON)
+	}
+	if queueSize <= 0 {
+		return nil, fmt.Errorf("queue size must be positive")
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "-"
+	}
+
+	return &Forwarder{
+		network:  u.Scheme,
+		address:  u.Host,
+		format:   format,
+		hostname: hostname,
+		queue:    make(chan Entry, queueSize),
+	}, nil
+}
+
+// Write enqueues the entry without blocking, dropping it if the queue is full.
+func (f *Forwarder) Write(entry Entry) {
+	select {
+	case f.queue <- entry:
+	default:
+		f.dropped.Add(1)
+	}
+}
+
+// Run sends queued entries until ctx is cancelled, then flushes whatever is still queued.
+func (f *Forwarder) Run(ctx context.Context) {
+	defer f.closeConn()
+	for {
+		select {
+		case <-ctx.Done():
+			f.flush()
+			return
+		case entry := <-f.queue:
+			if err := f.send(entry); err != nil {
+				f.dropped.Add(1)
+				f.recordError(err)
+				continue
+			}
+			f.sent.Add(1)
+		}
+	}
+}
+
+// flush sends the entries still queued at shutdown, giving up on the rest at the first failure
+// so a dead collector can't hold up the exit.
+func (f *Forwarder) flush() {
+	for {
+		select {
+		case entry := <-f.queue:
+			if err := f.send(entry); err != nil {
+				f.dropped.Add(uint64(1 + len(f.queue)))
+				f.recordError(err)
+				return
+			}
+			f.sent.Add(1)
+		default:
+			return
+		}
+	}
+}
+
+// Status returns a snapshot of the forwarder's health.
+func (f *Forwarder) Status() ForwarderStatus {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	status := ForwarderStatus{
+		Enabled:       true,
+		Address:       f.network + "://" + f.address,
+		Format:        f.format,
+		QueueDepth:    len(f.queue),
+		QueueCapacity: cap(f.queue),
+		Sent:          f.sent.Load(),
+		Dropped:       f.dropped.Load(),
+		LastError:     f.lastError,
+	}
+	if !f.lastErrorTime.IsZero() {
+		errorTime := f.lastErrorTime
+		status.LastErrorTime = &errorTime
+	}
+	return status
+}
+
+// send formats the entry and writes it to the collector, connecting if necessary.
+func (f *Forwarder) send(entry Entry) error {
+	message, err := f.formatMessage(entry)
+	if err != nil {
+		return err
+	}
+
+	if f.conn == nil {
+		if time.Since(f.lastDialAt) < forwarderRedialBackoff {
+			return fmt.Errorf("collector unavailable, waiting before reconnecting")
+		}
+		f.lastDialAt = time.Now()
+		conn, err := net.DialTimeout(f.network, f.address, forwarderDialTimeout)
+		if err != nil {
+			return err
+		}
+		f.conn = conn
+	}
+
+	if err := f.conn.SetWriteDeadline(time.Now().Add(forwarderWriteTimeout)); err != nil {
+		f.closeConn()
+		return err
+	}
+	if _, err := f.conn.Write([]byte(message)); err != nil {
+		f.closeConn()
+		return err
+	}
+	return nil
+}
+
+// formatMessage renders the entry as an RFC 5424 syslog line carrying a CEF or JSON payload.
+func (f *Forwarder) formatMessage(entry Entry) (string, error) {
+	var payload string
+	switch f.format {
+	case FormatCEF:
+		payload = FormatCEFEntry(entry)
+	default:
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return "", err
+		}
+		payload = string(data)
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s kubeberus - audit - %s\n",
+		syslogPriority, entry.Time.UTC().Format(time.RFC3339Nano), f.hostname, payload), nil
+}
+
+// recordError remembers the most recent delivery failure.
+func (f *Forwarder) recordError(err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.lastError = err.Error()
+	f.lastErrorTime = time.Now().UTC()
+}
+
+// closeConn closes the collector connection, if any.
+func (f *Forwarder) closeConn() {
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+}
+
+// FormatCEFEntry renders an audit entry as an ArcSight Common Event Format record.
+func FormatCEFEntry(entry Entry) string {
+	signatureID, ok := signatureIDs[entry.Action]
+	if !ok {
+		signatureID = entry.Action
+	}
+
+	header := []string{
+		"CEF:0",
+		cefHeaderEscape("AutoReiv"),
+		cefHeaderEscape("Kubeberus"),
+		cefHeaderEscape(version.Version),
+		cefHeaderEscape(signatureID),
+		cefHeaderEscape(entry.Action),
+		strconv.Itoa(cefSeverity(entry)),
+	}
+
+	extensions := []string{
+		"rt=" + strconv.FormatInt(entry.Time.UnixMilli(), 10),
+		"suser=" + cefExtensionEscape(entry.Actor),
+		"requestMethod=" + cefExtensionEscape(entry.Method),
+		"request=" + cefExtensionEscape(entry.Route),
+		"cn1Label=status",
+		"cn1=" + strconv.Itoa(entry.Status),
+	}
+	if entry.SourceIP != "" {
+		extensions = append(extensions, "src="+cefExtensionEscape(entry.SourceIP))
+	}
+	if entry.Resource != "" {
+		extensions = append(extensions, "cs1Label=resource", "cs1="+cefExtensionEscape(entry.Resource))
+	}
+	if entry.Namespace != "" {
+		extensions = append(extensions, "cs2Label=namespace", "cs2="+cefExtensionEscape(entry.Namespace))
+	}
+	if entry.ResourceName != "" {
+		extensions = append(extensions, "cs3Label=resourceName", "cs3="+cefExtensionEscape(entry.ResourceName))
+	}
+	if entry.ProtectionOverridden {
+		extensions = append(extensions, "cs4Label=protectionOverridden", "cs4=true")
+	}
+	if entry.Reason != "" {
+		extensions = append(extensions, "reason="+cefExtensionEscape(entry.Reason))
+	}
+	if entry.UserAgent != "" {
+		extensions = append(extensions, "requestClientApplication="+cefExtensionEscape(entry.UserAgent))
+	}
+
+	return strings.Join(header, "|") + "|" + strings.Join(extensions, " ")
+}
+
+// cefSeverity maps the HTTP method to a CEF severity between 0 and 10. Overriding the protection of a
+// system object is always the highest, and a failed authentication ranks with a deletion.
+func cefSeverity(entry Entry) int {
+	if entry.ProtectionOverridden {
+		return 10
+	}
+	if entry.Action == ActionAuthFailed {
+		return 7
+	}
+	switch entry.Method {
+	case "DELETE":
+		return 7
+	case "PUT", "PATCH":
+		return 5
+	case "POST":
+		return 4
+	}
+	return 3
+}
+
+// cefHeaderEscape escapes backslashes and pipes in a CEF header field.
+func cefHeaderEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ").Replace(value)
+}
+
+// cefExtensionEscape escapes backslashes, equals signs and line breaks in a CEF extension value.
+func cefExtensionEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`).Replace(value)
+}
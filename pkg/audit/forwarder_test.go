@@ -0,0 +1,109 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"rbac/pkg/version"
+)
+
+func TestSignatureIDs(t *testing.T) {
+	actions := []string{
+		"apply_template",
+		"apply_consolidation",
+		"expire_binding",
+		ActionAuthFailed,
+		"flush_cache",
+		"enable_read_only",
+		"disable_read_only",
+		"git_sync",
+	}
+	// The middleware names the changes made through each resource's routes
+	for _, resource := range []string{"roles", "rolebindings", "clusterroles", "clusterrolebindings"} {
+		for _, method := range []string{"POST", "PUT", "DELETE"} {
+			actions = append(actions, actionFor(method, resource))
+		}
+	}
+	for _, resource := range []string{"namespaces", "serviceaccounts"} {
+		for _, method := range []string{"POST", "DELETE"} {
+			actions = append(actions, actionFor(method, resource))
+		}
+	}
+
+	seen := make(map[string]string)
+	for _, action := range actions {
+		id, ok := signatureIDs[action]
+		if !ok {
+			t.Errorf("%s has no signature id", action)
+			continue
+		}
+		if other, taken := seen[id]; taken {
+			t.Errorf("%s and %s share signature id %s", action, other, id)
+		}
+		seen[id] = action
+	}
+}
+
+func TestFormatCEFEntry(t *testing.T) {
+	entry := Entry{
+		Time:         time.UnixMilli(1700000000123),
+		Actor:        "anonymous",
+		SourceIP:     "10.0.0.7",
+		Action:       "delete_rolebinding",
+		Method:       "DELETE",
+		Route:        "/api/rolebindings",
+		Resource:     "rolebindings",
+		Namespace:    "prod",
+		ResourceName: "ci=deploy",
+		Status:       200,
+	}
+	want := "CEF:0|AutoReiv|Kubeberus|" + version.Version + "|112|delete_rolebinding|7|" +
+		`rt=1700000000123 suser=anonymous requestMethod=DELETE request=/api/rolebindings cn1Label=status cn1=200 ` +
+		`src=10.0.0.7 cs1Label=resource cs1=rolebindings cs2Label=namespace cs2=prod cs3Label=resourceName cs3=ci\=deploy`
+	if got := FormatCEFEntry(entry); got != want {
+		t.Errorf("FormatCEFEntry =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestFormatCEFEntrySeverity(t *testing.T) {
+	tests := []struct {
+		name     string
+		entry    Entry
+		severity string
+	}{
+		{"create", Entry{Action: "create_role", Method: "POST"}, "|4|"},
+		{"update", Entry{Action: "update_role", Method: "PUT"}, "|5|"},
+		{"delete", Entry{Action: "delete_role", Method: "DELETE"}, "|7|"},
+		{"auth failure", Entry{Action: ActionAuthFailed, Method: "GET"}, "|7|"},
+		{"protection overridden", Entry{Action: "delete_clusterrole", Method: "DELETE", ProtectionOverridden: true}, "|10|"},
+	}
+	for _, tt := range tests {
+		if got := FormatCEFEntry(tt.entry); !strings.Contains(got, tt.severity) {
+			t.Errorf("%s: %s lacks severity %s", tt.name, got, tt.severity)
+		}
+	}
+}
+
+func TestFormatCEFEntryEscapes(t *testing.T) {
+	entry := Entry{
+		Action:    "custom|action",
+		Method:    "POST",
+		Actor:     `domain\alice`,
+		Reason:    "invalid_token",
+		UserAgent: "curl/8.0\nforged=line",
+	}
+	got := FormatCEFEntry(entry)
+	// Unknown actions are their own signature id, with pipes escaped in the header
+	if !strings.Contains(got, `|custom\|action|custom\|action|4|`) {
+		t.Errorf("header not escaped: %s", got)
+	}
+	for _, want := range []string{`suser=domain\\alice`, `reason=invalid_token`, `requestClientApplication=curl/8.0\nforged\=line`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("%s lacks %s", got, want)
+		}
+	}
+	if strings.Contains(got, "\n") {
+		t.Errorf("record contains a line break: %q", got)
+	}
+}
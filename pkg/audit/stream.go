@@ -0,0 +1,156 @@
+package audit
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// streamSubscriberBuffer is the number of entries buffered per subscriber before it is dropped.
+const streamSubscriberBuffer = 64
+
+// Filter selects audit entries by exact field values, a time range and an optional search query;
+// empty fields match anything.
+type Filter struct {
+	Category     string
+	Action       string
+	Namespace    string
+	ResourceName string
+	Actor        string
+	// From and To bound the entry time; From is inclusive and To exclusive.
+	From, To time.Time
+	// Query is matched case-insensitively as a substring of the action, resource name,
+	// namespace, actor and details.
+	Query string
+}
+
+// Matches reports whether the entry satisfies the filter.
+func (f Filter) Matches(entry Entry) bool {
+	return (f.Category == "" || f.Category == entry.Category) &&
+		(f.Action == "" || f.Action == entry.Action) &&
+		(f.Namespace == "" || f.Namespace == entry.Namespace) &&
+		(f.ResourceName == "" || f.ResourceName == entry.ResourceName) &&
+		(f.Actor == "" || f.Actor == entry.Actor) &&
+		(f.From.IsZero() || !entry.Time.Before(f.From)) &&
+		(f.To.IsZero() || entry.Time.Before(f.To)) &&
+		(f.Query == "" || matchesQuery(entry, strings.ToLower(f.Query)))
+}
+
+// matchesQuery reports whether any searchable field of the entry contains the lower-cased query.
+func matchesQuery(entry Entry, query string) bool {
+	fields := []string{entry.Action, entry.ResourceName, entry.Namespace, entry.Actor}
+	if entry.Details != nil {
+		fields = append(fields, string(entry.Details.Before), string(entry.Details.After))
+	}
+	for _, field := range fields {
+		if strings.Contains(strings.ToLower(field), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// Stream is a sink that keeps the most recent entries and publishes new ones to subscribers.
+type Stream struct {
+	mu          sync.Mutex
+	backlog     []Entry
+	size        int
+	subscribers map[chan Entry]Filter
+	// dropped is set once an entry has fallen out of the backlog.
+	dropped bool
+}
+
+// NewStream creates a stream that retains up to size recent entries.
+func NewStream(size int) *Stream {
+	return &Stream{
+		size:        size,
+		subscribers: make(map[chan Entry]Filter),
+	}
+}
+
+// Write appends the entry to the backlog and delivers it to matching subscribers.
+func (s *Stream) Write(entry Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.size > 0 {
+		if len(s.backlog) >= s.size {
+			s.backlog = s.backlog[1:]
+			s.dropped = true
+		}
+		s.backlog = append(s.backlog, entry)
+	} else {
+		s.dropped = true
+	}
+
+	for ch, filter := range s.subscribers {
+		if !filter.Matches(entry) {
+			continue
+		}
+		select {
+		case ch <- entry:
+		default:
+			// Drop subscribers that cannot keep up rather than blocking audit writes.
+			delete(s.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe returns the matching backlog and a channel of new matching entries,
+// together with a function that cancels the subscription.
+func (s *Stream) Subscribe(filter Filter) ([]Entry, <-chan Entry, func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var backlog []Entry
+	for _, entry := range s.backlog {
+		if filter.Matches(entry) {
+			backlog = append(backlog, entry)
+		}
+	}
+
+	ch := make(chan Entry, streamSubscriberBuffer)
+	s.subscribers[ch] = filter
+
+	return backlog, ch, func() { s.unsubscribe(ch) }
+}
+
+// Subscribers returns the number of open subscriptions.
+func (s *Stream) Subscribers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.subscribers)
+}
+
+// Retention returns how many entries the stream retains, and whether older entries have been dropped to
+// stay within that.
+func (s *Stream) Retention() (int, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return max(s.size, 0), s.dropped
+}
+
+// Entries returns the retained entries matching the filter, newest first.
+func (s *Stream) Entries(filter Filter) []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []Entry
+	for i := len(s.backlog) - 1; i >= 0; i-- {
+		if filter.Matches(s.backlog[i]) {
+			entries = append(entries, s.backlog[i])
+		}
+	}
+	return entries
+}
+
+// unsubscribe removes a subscriber and closes its channel.
+func (s *Stream) unsubscribe(ch chan Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.subscribers[ch]; exists {
+		delete(s.subscribers, ch)
+		close(ch)
+	}
+}
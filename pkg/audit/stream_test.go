@@ -0,0 +1,106 @@
+package audit
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// receive returns the next entry of ch, failing when none arrives.
+func receive(t *testing.T, ch <-chan Entry) Entry {
+	t.Helper()
+	select {
+	case entry, ok := <-ch:
+		if !ok {
+			t.Fatal("subscription closed")
+		}
+		return entry
+	case <-time.After(time.Second):
+		t.Fatal("no entry delivered")
+	}
+	return Entry{}
+}
+
+// idle fails if ch delivers an entry.
+func idle(t *testing.T, ch <-chan Entry) {
+	t.Helper()
+	select {
+	case entry := <-ch:
+		t.Fatalf("unexpected entry %+v", entry)
+	default:
+	}
+}
+
+func TestStreamFiltersSubscribers(t *testing.T) {
+	stream := NewStream(10)
+	_, prod, cancelProd := stream.Subscribe(Filter{Namespace: "prod"})
+	defer cancelProd()
+	_, auth, cancelAuth := stream.Subscribe(Filter{Category: CategoryAuth})
+	defer cancelAuth()
+
+	stream.Write(Entry{Category: CategoryRBAC, Action: "create", Namespace: "prod", ResourceName: "ci"})
+	stream.Write(Entry{Category: CategoryAuth, Action: ActionAuthFailed, Reason: "invalid_token"})
+	stream.Write(Entry{Category: CategoryRBAC, Action: "delete", Namespace: "staging", ResourceName: "ci"})
+
+	if entry := receive(t, prod); entry.Action != "create" {
+		t.Errorf("prod subscriber got %+v", entry)
+	}
+	idle(t, prod)
+	if entry := receive(t, auth); entry.Action != ActionAuthFailed {
+		t.Errorf("auth subscriber got %+v", entry)
+	}
+	idle(t, auth)
+}
+
+func TestStreamReplaysBacklog(t *testing.T) {
+	stream := NewStream(3)
+	for i := 0; i < 5; i++ {
+		stream.Write(Entry{Action: "update", Namespace: "prod", ResourceName: fmt.Sprint(i)})
+	}
+	stream.Write(Entry{Action: "update", Namespace: "staging", ResourceName: "5"})
+
+	backlog, _, cancel := stream.Subscribe(Filter{Namespace: "prod"})
+	defer cancel()
+	// Only the last three entries are retained, and staging's is filtered out
+	if len(backlog) != 2 || backlog[0].ResourceName != "3" || backlog[1].ResourceName != "4" {
+		t.Errorf("backlog = %+v, want entries 3 and 4 oldest first", backlog)
+	}
+	if entries := stream.Entries(Filter{}); len(entries) != 3 || entries[0].ResourceName != "5" {
+		t.Errorf("entries = %+v, want the three retained, newest first", entries)
+	}
+}
+
+func TestStreamUnsubscribe(t *testing.T) {
+	stream := NewStream(0)
+	_, ch, cancel := stream.Subscribe(Filter{})
+	if stream.Subscribers() != 1 {
+		t.Fatalf("%d subscribers, want 1", stream.Subscribers())
+	}
+	cancel()
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("channel still open after unsubscribing")
+	}
+	if stream.Subscribers() != 0 {
+		t.Errorf("%d subscribers after unsubscribing, want 0", stream.Subscribers())
+	}
+	stream.Write(Entry{Action: "create"})
+}
+
+func TestStreamDropsSlowSubscribers(t *testing.T) {
+	stream := NewStream(0)
+	_, slow, cancel := stream.Subscribe(Filter{})
+	defer cancel()
+	for i := 0; i <= streamSubscriberBuffer; i++ {
+		stream.Write(Entry{Action: "create"})
+	}
+	if stream.Subscribers() != 0 {
+		t.Fatal("subscriber that stopped reading is still subscribed")
+	}
+	for i := 0; i < streamSubscriberBuffer; i++ {
+		receive(t, slow)
+	}
+	if _, ok := <-slow; ok {
+		t.Error("dropped subscriber's channel is still open")
+	}
+}
@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"rbac/pkg/audit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// The reasons a bearer token is refused, as recorded in audit entries and metrics.
+const (
+	ReasonMissingToken = "missing_token"
+	ReasonInvalidToken = "invalid_token"
+)
+
+// RequireBearerToken rejects requests that do not present token as a bearer token, recording each refusal
+// as an authentication event of the audit trail.
+func RequireBearerToken(token string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if reason := BearerTokenFailure(c.Request(), token); reason != "" {
+				audit.RecordAuthFailure(c, reason)
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid or missing bearer token")
+			}
+			return next(c)
+		}
+	}
+}
+
+// ValidBearerToken reports whether the request carries token in its Authorization header.
+// An empty token never matches.
+func ValidBearerToken(req *http.Request, token string) bool {
+	return BearerTokenFailure(req, token) == ""
+}
+
+// BearerTokenFailure returns why the request's Authorization header does not carry token, or "" when it does.
+func BearerTokenFailure(req *http.Request, token string) string {
+	presented, ok := strings.CutPrefix(req.Header.Get(echo.HeaderAuthorization), "Bearer ")
+	if !ok || presented == "" {
+		return ReasonMissingToken
+	}
+	if token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+		return ReasonInvalidToken
+	}
+	return ""
+}
@@ -0,0 +1,200 @@
+// Package cache reads the cluster's roles and bindings from shared informers, so handlers read them from
+// memory, with bindings indexed by subject, instead of listing every one of them on each request. Until the
+// informers have synced, and on clusters where the service may list but not watch, handlers keep listing
+// from the API server.
+package cache
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"rbac/pkg/listcache"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/informers"
+	toolscache "k8s.io/client-go/tools/cache"
+)
+
+// Response headers telling clients an answer came from the cache, and how fresh it is.
+const (
+	// HeaderCache is set to informer on responses read from the cache.
+	HeaderCache = "X-Cache"
+	// HeaderUpdated is when the cache last saw a change, or synced, in RFC 3339.
+	HeaderUpdated = "X-Cache-Updated"
+)
+
+// cacheKey is the echo context key the cache is stored under.
+const cacheKey = "rbac.informerCache"
+
+// subjectIndex indexes bindings by the kind and name of each of their subjects.
+const subjectIndex = "subject"
+
+// Cache holds the RBAC objects of the cluster, kept current by shared informers.
+type Cache struct {
+	roles               toolscache.SharedIndexInformer
+	clusterRoles        toolscache.SharedIndexInformer
+	roleBindings        toolscache.SharedIndexInformer
+	clusterRoleBindings toolscache.SharedIndexInformer
+
+	synced atomic.Bool
+	// updated is the Unix time in nanoseconds of the last change seen, or of the sync.
+	updated atomic.Int64
+}
+
+// New creates a cache reading the RBAC informers of factory, which are shared with the other users of
+// factory and indexed by subject here. It must be called before factory is started, which its owner does.
+func New(factory informers.SharedInformerFactory) *Cache {
+	rbac := factory.Rbac().V1()
+	c := &Cache{
+		roles:               rbac.Roles().Informer(),
+		clusterRoles:        rbac.ClusterRoles().Informer(),
+		roleBindings:        rbac.RoleBindings().Informer(),
+		clusterRoleBindings: rbac.ClusterRoleBindings().Informer(),
+	}
+
+	indexers := toolscache.Indexers{subjectIndex: indexBySubject}
+	for _, informer := range []toolscache.SharedIndexInformer{c.roleBindings, c.clusterRoleBindings} {
+		if err := informer.AddIndexers(indexers); err != nil {
+			// only fails once the informer has started, which it can't have yet
+			panic(err)
+		}
+	}
+	for _, informer := range []toolscache.SharedIndexInformer{c.roles, c.clusterRoles, c.roleBindings, c.clusterRoleBindings} {
+		informer.AddEventHandler(toolscache.ResourceEventHandlerFuncs{
+			AddFunc:    func(interface{}) { c.touch() },
+			UpdateFunc: func(interface{}, interface{}) { c.touch() },
+			DeleteFunc: func(interface{}) { c.touch() },
+		})
+	}
+	return c
+}
+
+// Run waits for the informers to sync, or ctx to be cancelled. Requests are served from the cache once
+// every informer has synced.
+func (c *Cache) Run(ctx context.Context) {
+	start := time.Now()
+	if !toolscache.WaitForCacheSync(ctx.Done(), c.roles.HasSynced, c.clusterRoles.HasSynced, c.roleBindings.HasSynced, c.clusterRoleBindings.HasSynced) {
+		return
+	}
+	c.touch()
+	c.synced.Store(true)
+	slog.Info("Informer cache synced", "duration", time.Since(start).String())
+}
+
+// Synced reports whether every informer has synced, so the cache can answer requests.
+func (c *Cache) Synced() bool {
+	return c.synced.Load()
+}
+
+// Updated returns when the cache last saw a change, or synced.
+func (c *Cache) Updated() time.Time {
+	return time.Unix(0, c.updated.Load())
+}
+
+// touch records a change.
+func (c *Cache) touch() {
+	c.updated.Store(time.Now().UnixNano())
+}
+
+// Middleware makes the cache available to From.
+func (c *Cache) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(cacheKey, c)
+			return next(ctx)
+		}
+	}
+}
+
+// From returns the cache a request may read from, setting the headers that say so, or nil when it must
+// list from the API server: the cache is disabled or hasn't synced, or the request asked for ?noCache=true.
+func From(ctx echo.Context) *Cache {
+	c, ok := ctx.Get(cacheKey).(*Cache)
+	if !ok || !c.Synced() || listcache.Bypassed(ctx.Request().Context()) {
+		return nil
+	}
+	header := ctx.Response().Header()
+	header.Set(HeaderCache, "informer")
+	header.Set(HeaderUpdated, c.Updated().UTC().Format(time.RFC3339))
+	return c
+}
+
+// Roles returns the roles of namespace, or of every namespace when it is "".
+func (c *Cache) Roles(namespace string) []rbacv1.Role {
+	return copies[rbacv1.Role](byNamespace(c.roles, namespace))
+}
+
+// ClusterRoles returns every cluster role.
+func (c *Cache) ClusterRoles() []rbacv1.ClusterRole {
+	return copies[rbacv1.ClusterRole](c.clusterRoles.GetStore().List())
+}
+
+// RoleBindings returns the role bindings of namespace, or of every namespace when it is "".
+func (c *Cache) RoleBindings(namespace string) []rbacv1.RoleBinding {
+	return copies[rbacv1.RoleBinding](byNamespace(c.roleBindings, namespace))
+}
+
+// ClusterRoleBindings returns every cluster role binding.
+func (c *Cache) ClusterRoleBindings() []rbacv1.ClusterRoleBinding {
+	return copies[rbacv1.ClusterRoleBinding](c.clusterRoleBindings.GetStore().List())
+}
+
+// RoleBindingsNaming returns the role bindings with a subject of kind named name, in any namespace.
+func (c *Cache) RoleBindingsNaming(kind, name string) []rbacv1.RoleBinding {
+	objs, _ := c.roleBindings.GetIndexer().ByIndex(subjectIndex, subjectKey(kind, name))
+	return copies[rbacv1.RoleBinding](objs)
+}
+
+// ClusterRoleBindingsNaming returns the cluster role bindings with a subject of kind named name.
+func (c *Cache) ClusterRoleBindingsNaming(kind, name string) []rbacv1.ClusterRoleBinding {
+	objs, _ := c.clusterRoleBindings.GetIndexer().ByIndex(subjectIndex, subjectKey(kind, name))
+	return copies[rbacv1.ClusterRoleBinding](objs)
+}
+
+// byNamespace lists the objects of informer in namespace, or all of them when it is "".
+func byNamespace(informer toolscache.SharedIndexInformer, namespace string) []interface{} {
+	if namespace == "" {
+		return informer.GetStore().List()
+	}
+	objs, _ := informer.GetIndexer().ByIndex(toolscache.NamespaceIndex, namespace)
+	return objs
+}
+
+// copies deep-copies cached objects, which are shared with the informer and must not be changed.
+func copies[T any, P interface {
+	*T
+	DeepCopy() *T
+}](objs []interface{}) []T {
+	items := make([]T, 0, len(objs))
+	for _, obj := range objs {
+		if item, ok := obj.(P); ok {
+			items = append(items, *item.DeepCopy())
+		}
+	}
+	return items
+}
+
+// indexBySubject returns the subject keys of a binding.
+func indexBySubject(obj interface{}) ([]string, error) {
+	var subjects []rbacv1.Subject
+	switch binding := obj.(type) {
+	case *rbacv1.RoleBinding:
+		subjects = binding.Subjects
+	case *rbacv1.ClusterRoleBinding:
+		subjects = binding.Subjects
+	}
+	keys := make([]string, 0, len(subjects))
+	for _, subject := range subjects {
+		keys = append(keys, subjectKey(subject.Kind, subject.Name))
+	}
+	return keys, nil
+}
+
+// subjectKey is the index key of a subject. Service accounts are indexed by name only, as role bindings
+// may leave their namespace out.
+func subjectKey(kind, name string) string {
+	return kind + "/" + name
+}
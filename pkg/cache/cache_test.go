@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"rbac/pkg/watch"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestSharesInformersWithHub(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: "prod"}},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "prod"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "deployer"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}},
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "admins"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "admin"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "ops"}},
+		},
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	c := New(factory)
+	factory.Start(ctx.Done())
+	defer func() {
+		cancel()
+		factory.Shutdown()
+	}()
+	c.Run(ctx)
+	if !c.Synced() {
+		t.Fatal("cache did not sync")
+	}
+
+	hub := watch.NewHub(ctx, factory)
+	if objects := hub.Snapshot(map[string]bool{watch.KindRole: true, watch.KindRoleBinding: true}); len(objects) != 2 {
+		t.Errorf("hub snapshot has %d objects, want 2", len(objects))
+	}
+	if roles := c.Roles("prod"); len(roles) != 1 || roles[0].Name != "deployer" {
+		t.Errorf("Roles(prod) = %v, want deployer", roles)
+	}
+	if bindings := c.RoleBindingsNaming(rbacv1.UserKind, "alice"); len(bindings) != 1 || bindings[0].Name != "ci" {
+		t.Errorf("RoleBindingsNaming(User, alice) = %v, want ci", bindings)
+	}
+	if bindings := c.ClusterRoleBindingsNaming(rbacv1.GroupKind, "ops"); len(bindings) != 1 || bindings[0].Name != "admins" {
+		t.Errorf("ClusterRoleBindingsNaming(Group, ops) = %v, want admins", bindings)
+	}
+
+	lists := make(map[string]int)
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "list" {
+			lists[action.GetResource().Resource]++
+		}
+	}
+	for _, resource := range []string{"roles", "clusterroles", "rolebindings", "clusterrolebindings"} {
+		if lists[resource] != 1 {
+			t.Errorf("%s listed %d times, want once for the cache and the hub together", resource, lists[resource])
+		}
+	}
+}
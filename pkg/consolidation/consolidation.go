@@ -0,0 +1,289 @@
+// Package consolidation finds roles that could be merged: roles granting the same permissions as another,
+// and roles whose permissions another role already includes. Each suggestion names the role that stays, the
+// bindings to re-point at it and what the merge would change, so nothing is merged blindly.
+package consolidation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+
+	"rbac/pkg/protection"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// The types of suggestion.
+const (
+	// TypeIdentical merges roles granting exactly the same permissions, which changes nobody's access.
+	TypeIdentical = "identical"
+	// TypeSubset merges a role into one granting everything it does and more, so its subjects gain the rest.
+	TypeSubset = "subset"
+)
+
+// aggregationLabelPrefix starts the labels that aggregate a ClusterRole's rules into another.
+const aggregationLabelPrefix = "rbac.authorization.k8s.io/aggregate-to-"
+
+// RoleRef identifies a Role or ClusterRole.
+type RoleRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// String names the role as Kind namespace/name.
+func (r RoleRef) String() string {
+	if r.Namespace == "" {
+		return r.Kind + " " + r.Name
+	}
+	return r.Kind + " " + r.Namespace + "/" + r.Name
+}
+
+// BindingEdit is a binding to re-point from a merged role to the role that stays. The role of a binding
+// can't be changed, so applying it recreates the binding under the same name.
+type BindingEdit struct {
+	Kind      string  `json:"kind"`
+	Namespace string  `json:"namespace,omitempty"`
+	Name      string  `json:"name"`
+	From      RoleRef `json:"from"`
+	To        RoleRef `json:"to"`
+}
+
+// AffectedSubject is a subject gaining permissions, in the namespace of Scope or, when it is "", cluster-wide.
+type AffectedSubject struct {
+	rbacv1.Subject `json:",inline"`
+	Scope          string `json:"scope,omitempty"`
+}
+
+// Impact is what a merge changes for the subjects of the re-pointed bindings.
+type Impact struct {
+	// PermissionChange is set when some subjects gain permissions.
+	PermissionChange bool   `json:"permissionChange"`
+	Statement        string `json:"statement"`
+	// AdditionalRules are the permissions the role that stays grants beyond the merged roles.
+	AdditionalRules []rbacv1.PolicyRule `json:"additionalRules"`
+	// Subjects are who gains them.
+	Subjects []AffectedSubject `json:"subjects"`
+}
+
+// Suggestion is one proposed merge.
+type Suggestion struct {
+	// ID is derived from the roles involved and their rules, so it stays the same until they change.
+	ID     string  `json:"id"`
+	Type   string  `json:"type"`
+	Target RoleRef `json:"target"`
+	// Replaced are the roles merged into Target, deleted once their bindings are re-pointed.
+	Replaced     []RoleRef     `json:"replaced"`
+	BindingEdits []BindingEdit `json:"bindingEdits"`
+	Impact       Impact        `json:"impact"`
+}
+
+// role is a candidate for merging.
+type role struct {
+	ref         RoleRef
+	permissions []permission
+	// key identifies the set of permissions, equal for roles granting the same ones.
+	key      string
+	bindings []BindingEdit
+	subjects []AffectedSubject
+}
+
+// Suggest returns the merges possible among roles and clusterRoles, the bindings given being those that
+// would be re-pointed. System roles, aggregated ClusterRoles and roles without rules are never suggested,
+// as their rules are maintained by the cluster or grant nothing to compare.
+func Suggest(roles []rbacv1.Role, clusterRoles []rbacv1.ClusterRole, roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding) []Suggestion {
+	scopes := make(map[string][]*role)
+	byRef := make(map[RoleRef]*role)
+	add := func(ref RoleRef, rules []rbacv1.PolicyRule) {
+		perms := expand(rules)
+		if len(perms) == 0 {
+			return
+		}
+		r := &role{ref: ref, permissions: perms, key: key(perms)}
+		scopes[ref.Namespace] = append(scopes[ref.Namespace], r)
+		byRef[ref] = r
+	}
+	for _, item := range roles {
+		if !protection.IsSystem(item.ObjectMeta) {
+			add(RoleRef{Kind: "Role", Namespace: item.Namespace, Name: item.Name}, item.Rules)
+		}
+	}
+	for _, item := range clusterRoles {
+		if !protection.IsSystem(item.ObjectMeta) && !aggregated(item) {
+			add(RoleRef{Kind: "ClusterRole", Name: item.Name}, item.Rules)
+		}
+	}
+
+	for _, binding := range roleBindings {
+		ref := RoleRef{Kind: binding.RoleRef.Kind, Name: binding.RoleRef.Name}
+		if ref.Kind == "Role" {
+			ref.Namespace = binding.Namespace
+		}
+		if r := byRef[ref]; r != nil {
+			r.bindings = append(r.bindings, BindingEdit{Kind: "RoleBinding", Namespace: binding.Namespace, Name: binding.Name, From: ref})
+			for _, subject := range binding.Subjects {
+				r.subjects = append(r.subjects, AffectedSubject{Subject: subject, Scope: binding.Namespace})
+			}
+		}
+	}
+	for _, binding := range clusterRoleBindings {
+		ref := RoleRef{Kind: binding.RoleRef.Kind, Name: binding.RoleRef.Name}
+		if r := byRef[ref]; r != nil && ref.Kind == "ClusterRole" {
+			r.bindings = append(r.bindings, BindingEdit{Kind: "ClusterRoleBinding", Name: binding.Name, From: ref})
+			for _, subject := range binding.Subjects {
+				r.subjects = append(r.subjects, AffectedSubject{Subject: subject})
+			}
+		}
+	}
+
+	var suggestions []Suggestion
+	scopeNames := make([]string, 0, len(scopes))
+	for scope := range scopes {
+		scopeNames = append(scopeNames, scope)
+	}
+	sort.Strings(scopeNames)
+	for _, scope := range scopeNames {
+		suggestions = append(suggestions, suggestScope(scopes[scope])...)
+	}
+	return suggestions
+}
+
+// suggestScope suggests the merges among the roles of one namespace, or among ClusterRoles.
+func suggestScope(roles []*role) []Suggestion {
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ref.Name < roles[j].ref.Name })
+
+	// roles granting the same permissions merge into the one with the most bindings
+	groups := make(map[string][]*role)
+	var keys []string
+	for _, r := range roles {
+		if _, ok := groups[r.key]; !ok {
+			keys = append(keys, r.key)
+		}
+		groups[r.key] = append(groups[r.key], r)
+	}
+
+	var suggestions []Suggestion
+	var representatives []*role
+	for _, k := range keys {
+		group := groups[k]
+		sort.SliceStable(group, func(i, j int) bool { return len(group[i].bindings) > len(group[j].bindings) })
+		representatives = append(representatives, group[0])
+		if len(group) > 1 {
+			suggestions = append(suggestions, merge(TypeIdentical, group[0], group[1:]))
+		}
+	}
+
+	// a role whose permissions another includes merges into the smallest such role. Roles covering each other
+	// through wildcards are identical too, and merge into the first of them only. Every role is a subset of
+	// one granting full control, which is never worth merging into.
+	for i, r := range representatives {
+		var target *role
+		equivalent := false
+		for j, other := range representatives {
+			if other == r || !includes(other.permissions, r.permissions) {
+				continue
+			}
+			if includes(r.permissions, other.permissions) {
+				if j < i && !equivalent {
+					target, equivalent = other, true
+				}
+				continue
+			}
+			if !equivalent && !fullControl(other.permissions) && (target == nil || len(other.permissions) < len(target.permissions)) {
+				target = other
+			}
+		}
+		switch {
+		case equivalent:
+			suggestions = append(suggestions, merge(TypeIdentical, target, []*role{r}))
+		case target != nil:
+			suggestions = append(suggestions, merge(TypeSubset, target, []*role{r}))
+		}
+	}
+	return suggestions
+}
+
+// merge builds the suggestion of merging replaced into target.
+func merge(kind string, target *role, replaced []*role) Suggestion {
+	s := Suggestion{Type: kind, Target: target.ref, Replaced: []RoleRef{}, BindingEdits: []BindingEdit{}}
+	// the rules are part of the ID, so a suggestion made stale by a change to its roles is never applied
+	ids := []string{kind, target.ref.String(), target.key}
+	var subjects []AffectedSubject
+	var replacedPermissions []permission
+	for _, r := range replaced {
+		s.Replaced = append(s.Replaced, r.ref)
+		ids = append(ids, r.ref.String(), r.key)
+		for _, edit := range r.bindings {
+			edit.To = target.ref
+			s.BindingEdits = append(s.BindingEdits, edit)
+		}
+		subjects = append(subjects, r.subjects...)
+		replacedPermissions = append(replacedPermissions, r.permissions...)
+	}
+	sum := sha256.Sum256([]byte(strings.Join(ids, "\n")))
+	s.ID = hex.EncodeToString(sum[:6])
+
+	s.Impact = Impact{AdditionalRules: []rbacv1.PolicyRule{}, Subjects: []AffectedSubject{}}
+	var additional []permission
+	for _, p := range target.permissions {
+		if !covered(replacedPermissions, p) {
+			additional = append(additional, p)
+		}
+	}
+	switch {
+	case len(additional) == 0:
+		s.Impact.Statement = "No permission change: " + target.ref.String() + " grants exactly what the merged roles grant"
+	case len(subjects) == 0:
+		s.Impact.AdditionalRules = compact(additional)
+		s.Impact.Statement = fmt.Sprintf("No permission change: the merged roles are not bound, although %s grants %d additional permissions", target.ref.String(), len(additional))
+	default:
+		s.Impact.PermissionChange = true
+		s.Impact.AdditionalRules = compact(additional)
+		s.Impact.Subjects = uniqueSubjects(subjects)
+		s.Impact.Statement = fmt.Sprintf("%d subjects gain %d permissions that %s grants beyond the merged roles",
+			len(s.Impact.Subjects), len(additional), target.ref.String())
+	}
+	return s
+}
+
+// aggregated reports whether a ClusterRole's rules are aggregated from others, or aggregated into others,
+// by the controller; merging either would change what the controller maintains.
+func aggregated(clusterRole rbacv1.ClusterRole) bool {
+	if clusterRole.AggregationRule != nil {
+		return true
+	}
+	for label := range clusterRole.Labels {
+		if strings.HasPrefix(label, aggregationLabelPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// uniqueSubjects returns subjects without duplicates, sorted.
+func uniqueSubjects(subjects []AffectedSubject) []AffectedSubject {
+	seen := make(map[AffectedSubject]bool)
+	var unique []AffectedSubject
+	for _, subject := range subjects {
+		if !seen[subject] {
+			seen[subject] = true
+			unique = append(unique, subject)
+		}
+	}
+	sort.Slice(unique, func(i, j int) bool {
+		a, b := unique[i], unique[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Scope < b.Scope
+	})
+	return unique
+}
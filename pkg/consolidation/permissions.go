@@ -0,0 +1,136 @@
+package consolidation
+
+import (
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// permission is a single verb on a resource, or on a non-resource URL, that a rule grants. A rule expands
+// into one permission per combination of its verbs, API groups, resources and resource names.
+type permission struct {
+	verb     string
+	group    string
+	resource string
+	// name is a resource name, "" for every object.
+	name string
+	url  string
+}
+
+// expand returns the permissions rules grant, without duplicates.
+func expand(rules []rbacv1.PolicyRule) []permission {
+	seen := make(map[permission]bool)
+	var perms []permission
+	add := func(p permission) {
+		if !seen[p] {
+			seen[p] = true
+			perms = append(perms, p)
+		}
+	}
+	for _, rule := range rules {
+		for _, verb := range rule.Verbs {
+			for _, url := range rule.NonResourceURLs {
+				add(permission{verb: verb, url: url})
+			}
+			for _, group := range rule.APIGroups {
+				for _, resource := range rule.Resources {
+					if len(rule.ResourceNames) == 0 {
+						add(permission{verb: verb, group: group, resource: resource})
+					}
+					for _, name := range rule.ResourceNames {
+						add(permission{verb: verb, group: group, resource: resource, name: name})
+					}
+				}
+			}
+		}
+	}
+	return perms
+}
+
+// key identifies a set of permissions regardless of how its rules were written.
+func key(perms []permission) string {
+	lines := make([]string, len(perms))
+	for i, p := range perms {
+		lines[i] = strings.Join([]string{p.verb, p.group, p.resource, p.name, p.url}, "\x00")
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+// includes reports whether have covers every permission of want.
+func includes(have, want []permission) bool {
+	for _, p := range want {
+		if !covered(have, p) {
+			return false
+		}
+	}
+	return true
+}
+
+// covered reports whether one of have grants p, following the wildcards of RBAC: * for verbs, groups and
+// resources, no resource names for every object, and a trailing * in non-resource URLs.
+func covered(have []permission, p permission) bool {
+	for _, h := range have {
+		if h.verb != p.verb && h.verb != rbacv1.VerbAll {
+			continue
+		}
+		if p.url != "" || h.url != "" {
+			if h.url == p.url || h.url == rbacv1.NonResourceAll ||
+				(strings.HasSuffix(h.url, "*") && p.url != "" && strings.HasPrefix(p.url, strings.TrimSuffix(h.url, "*"))) {
+				return true
+			}
+			continue
+		}
+		if (h.group == p.group || h.group == rbacv1.APIGroupAll) &&
+			(h.resource == p.resource || h.resource == rbacv1.ResourceAll) &&
+			(h.name == p.name || h.name == "") {
+			return true
+		}
+	}
+	return false
+}
+
+// fullControl reports whether perms grant every verb on every resource.
+func fullControl(perms []permission) bool {
+	for _, p := range perms {
+		if p.verb == rbacv1.VerbAll && p.group == rbacv1.APIGroupAll && p.resource == rbacv1.ResourceAll && p.name == "" {
+			return true
+		}
+	}
+	return false
+}
+
+// compact turns permissions back into rules, one per resource or URL, listing its verbs.
+func compact(perms []permission) []rbacv1.PolicyRule {
+	type target struct{ group, resource, name, url string }
+	verbs := make(map[target][]string)
+	var targets []target
+	for _, p := range perms {
+		t := target{p.group, p.resource, p.name, p.url}
+		if _, ok := verbs[t]; !ok {
+			targets = append(targets, t)
+		}
+		verbs[t] = append(verbs[t], p.verb)
+	}
+	sort.Slice(targets, func(i, j int) bool {
+		a, b := targets[i], targets[j]
+		return strings.Join([]string{a.url, a.group, a.resource, a.name}, "\x00") < strings.Join([]string{b.url, b.group, b.resource, b.name}, "\x00")
+	})
+
+	rules := make([]rbacv1.PolicyRule, 0, len(targets))
+	for _, t := range targets {
+		vs := verbs[t]
+		sort.Strings(vs)
+		if t.url != "" {
+			rules = append(rules, rbacv1.PolicyRule{Verbs: vs, NonResourceURLs: []string{t.url}})
+			continue
+		}
+		rule := rbacv1.PolicyRule{Verbs: vs, APIGroups: []string{t.group}, Resources: []string{t.resource}}
+		if t.name != "" {
+			rule.ResourceNames = []string{t.name}
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
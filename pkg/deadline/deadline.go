@@ -0,0 +1,130 @@
+// Package deadline gives every API request a time budget by class of route, cancelling its context once the
+// budget is spent, and logs the requests that came close.
+package deadline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"rbac/pkg/logging"
+	"rbac/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Class is the budget class of a route.
+type Class string
+
+const (
+	// Default is the class of routes that read or change a handful of objects.
+	Default Class = "default"
+	// List is the class of routes that list every binding, role or namespace of the cluster.
+	List Class = "list"
+	// Report is the class of reports and exports, which can take minutes on large clusters.
+	Report Class = "report"
+	// Unbounded is the class of long-lived streams, which have no budget.
+	Unbounded Class = "unbounded"
+)
+
+// errBudgetExceeded is the cause of contexts cancelled by the middleware, telling them apart from requests
+// cancelled by the client or by a deadline of the caller.
+var errBudgetExceeded = errors.New("request budget exceeded")
+
+// Budgets are the time budgets of the classes; zero leaves a class without one.
+type Budgets struct {
+	Default time.Duration
+	List    time.Duration
+	Report  time.Duration
+}
+
+// Deadlines enforces the budgets of the routes assigned to each class.
+type Deadlines struct {
+	budgets Budgets
+	slow    time.Duration
+
+	mu      sync.RWMutex
+	classes map[string]Class
+}
+
+// New returns deadlines enforcing budgets. Requests taking slow or longer are logged as warnings even when
+// they completed; zero disables the log.
+func New(budgets Budgets, slow time.Duration) *Deadlines {
+	return &Deadlines{budgets: budgets, slow: slow, classes: make(map[string]Class)}
+}
+
+// Assign puts routes in class. Routes that are never assigned are in the Default class.
+func (d *Deadlines) Assign(class Class, routes ...*echo.Route) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, route := range routes {
+		d.classes[route.Method+" "+route.Path] = class
+	}
+}
+
+// classOf returns the class of the route of method and path.
+func (d *Deadlines) classOf(method, path string) Class {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if class, ok := d.classes[method+" "+path]; ok {
+		return class
+	}
+	return Default
+}
+
+// budget returns the budget of class, zero meaning none.
+func (d *Deadlines) budget(class Class) time.Duration {
+	switch class {
+	case Default:
+		return d.budgets.Default
+	case List:
+		return d.budgets.List
+	case Report:
+		return d.budgets.Report
+	}
+	return 0
+}
+
+// Middleware runs each request with its context cancelled once the budget of its route is spent. A request
+// still unanswered by then fails with 504 naming the budget and the time it took; handlers stop early as the
+// Kubernetes calls they make fail with the cancelled context.
+func (d *Deadlines) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			class := d.classOf(c.Request().Method, c.Path())
+			budget := d.budget(class)
+
+			ctx := c.Request().Context()
+			if budget > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeoutCause(ctx, budget, errBudgetExceeded)
+				defer cancel()
+				c.SetRequest(c.Request().WithContext(ctx))
+			}
+
+			err := next(c)
+			elapsed := time.Since(start)
+
+			if budget > 0 && errors.Is(context.Cause(ctx), errBudgetExceeded) && !c.Response().Committed {
+				err = echo.NewHTTPError(http.StatusGatewayTimeout, fmt.Sprintf("Request exceeded its %s budget of %s after %s",
+					class, budget, elapsed.Round(time.Millisecond))).SetInternal(err)
+			}
+			if d.slow > 0 && elapsed >= d.slow && class != Unbounded {
+				logging.FromContext(ctx).Warn("slow request",
+					slog.String("method", c.Request().Method),
+					slog.String("route", c.Path()),
+					slog.String("class", string(class)),
+					slog.Int("status", utils.ResponseStatus(c, err)),
+					slog.Float64("latencyMs", float64(elapsed.Microseconds())/1000),
+					slog.Float64("budgetMs", float64(budget.Microseconds())/1000),
+				)
+			}
+			return err
+		}
+	}
+}
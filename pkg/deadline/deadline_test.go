@@ -0,0 +1,182 @@
+package deadline
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// logs holds the JSON records of a logger.
+type logs struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (l *logs) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+// records returns the captured records with the message msg.
+func (l *logs) records(t *testing.T, msg string) []map[string]any {
+	t.Helper()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(l.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]any
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["msg"] == msg {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// captureLogs sends the default logger's records to the returned logs for the rest of the test.
+func captureLogs(t *testing.T) *logs {
+	l := &logs{}
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(l, nil)))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+	return l
+}
+
+// sleep waits for d or until the request is cancelled, recording whether it was.
+func sleep(d time.Duration, cancelled *bool) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		select {
+		case <-time.After(d):
+			return c.NoContent(http.StatusOK)
+		case <-c.Request().Context().Done():
+			*cancelled = true
+			return c.Request().Context().Err()
+		}
+	}
+}
+
+// router serves handler on a route of each class behind deadlines with short budgets.
+func router(slow time.Duration, handler echo.HandlerFunc) *echo.Echo {
+	d := New(Budgets{Default: 50 * time.Millisecond, List: 20 * time.Millisecond}, slow)
+	e := echo.New()
+	e.Use(d.Middleware())
+	e.GET("/roles", handler)
+	d.Assign(List, e.GET("/roles/all", handler))
+	d.Assign(Report, e.GET("/export", handler))
+	d.Assign(Unbounded, e.GET("/stream", handler))
+	return e
+}
+
+func TestBudgetCancelsRequest(t *testing.T) {
+	tests := []struct {
+		name          string
+		target        string
+		sleep         time.Duration
+		wantStatus    int
+		wantCancelled bool
+		wantMessage   string
+	}{
+		{"list budget spent", "/roles/all", time.Second, http.StatusGatewayTimeout, true, "list budget of 20ms"},
+		{"default budget spent", "/roles", time.Second, http.StatusGatewayTimeout, true, "default budget of 50ms"},
+		{"within the default budget", "/roles", 30 * time.Millisecond, http.StatusOK, false, ""},
+		// longer than the list budget, but reports have none configured
+		{"report without a budget", "/export", 30 * time.Millisecond, http.StatusOK, false, ""},
+		{"stream", "/stream", 60 * time.Millisecond, http.StatusOK, false, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cancelled := false
+			e := router(0, sleep(tt.sleep, &cancelled))
+			rec := httptest.NewRecorder()
+			start := time.Now()
+			e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if cancelled != tt.wantCancelled {
+				t.Errorf("handler cancelled = %v, want %v", cancelled, tt.wantCancelled)
+			}
+			if tt.wantCancelled && time.Since(start) > 500*time.Millisecond {
+				t.Errorf("request took %v despite its budget", time.Since(start))
+			}
+			if !strings.Contains(rec.Body.String(), tt.wantMessage) {
+				t.Errorf("body = %s, want a message naming the %s", rec.Body.String(), tt.wantMessage)
+			}
+		})
+	}
+}
+
+func TestClientCancellationIsNotBudget(t *testing.T) {
+	cancelled := false
+	e := router(0, sleep(time.Second, &cancelled))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/roles/all", nil).WithContext(ctx))
+	if rec.Code == http.StatusGatewayTimeout {
+		t.Errorf("request cancelled by the client answered %d", rec.Code)
+	}
+}
+
+func TestCommittedResponseKept(t *testing.T) {
+	e := router(0, func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusOK)
+		<-c.Request().Context().Done()
+		return nil
+	})
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/roles/all", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want the %d already sent", rec.Code, http.StatusOK)
+	}
+}
+
+func TestSlowRequestLogged(t *testing.T) {
+	tests := []struct {
+		name     string
+		target   string
+		sleep    time.Duration
+		wantLogs int
+	}{
+		{"slow but within budget", "/roles", 30 * time.Millisecond, 1},
+		{"cancelled by its budget", "/roles/all", time.Second, 1},
+		{"fast", "/roles", 0, 0},
+		{"stream", "/stream", 30 * time.Millisecond, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := captureLogs(t)
+			cancelled := false
+			e := router(15*time.Millisecond, sleep(tt.sleep, &cancelled))
+			e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.target, nil))
+
+			records := l.records(t, "slow request")
+			if len(records) != tt.wantLogs {
+				t.Fatalf("%d slow request logs, want %d", len(records), tt.wantLogs)
+			}
+			if tt.wantLogs == 0 {
+				return
+			}
+			record := records[0]
+			if record["level"] != "WARN" || record["route"] != tt.target || record["latencyMs"].(float64) < 15 {
+				t.Errorf("log = %v", record)
+			}
+		})
+	}
+}
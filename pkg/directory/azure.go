@@ -0,0 +1,126 @@
+package directory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	azureLoginURL = "https://login.microsoftonline.com/"
+	azureGraphURL = "https://graph.microsoft.com/v1.0/groups"
+	azureScope    = "https://graph.microsoft.com/.default"
+	// azureTokenSlack renews the access token this long before it expires.
+	azureTokenSlack = time.Minute
+)
+
+// azureClient searches groups with Microsoft Graph using the client credentials flow.
+type azureClient struct {
+	httpClient   *http.Client
+	tenantID     string
+	clientID     string
+	clientSecret string
+
+	mu          sync.Mutex
+	token       string
+	tokenExpiry time.Time
+}
+
+// newAzureClient creates a Graph client for the app registration in tenantID.
+func newAzureClient(httpClient *http.Client, tenantID, clientID, clientSecret string) *azureClient {
+	return &azureClient{httpClient: httpClient, tenantID: tenantID, clientID: clientID, clientSecret: clientSecret}
+}
+
+// SearchGroups returns groups whose display name starts with query.
+func (a *azureClient) SearchGroups(ctx context.Context, query string) ([]Group, error) {
+	token, err := a.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	params := url.Values{}
+	params.Set("$select", "id,displayName")
+	params.Set("$top", strconv.Itoa(maxResults))
+	if query != "" {
+		// OData string literals escape a single quote by doubling it
+		params.Set("$filter", "startswith(displayName,'"+strings.ReplaceAll(query, "'", "''")+"')")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, azureGraphURL+"?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/json")
+
+	var body struct {
+		Value []struct {
+			ID          string `json:"id"`
+			DisplayName string `json:"displayName"`
+		} `json:"value"`
+	}
+	if err := doJSON(a.httpClient, req, &body); err != nil {
+		return nil, fmt.Errorf("searching Microsoft Graph groups: %w", err)
+	}
+
+	groups := make([]Group, 0, len(body.Value))
+	for _, group := range body.Value {
+		groups = append(groups, Group{ID: group.ID, Name: group.DisplayName})
+	}
+	return groups, nil
+}
+
+// accessToken returns a cached Graph access token, requesting a new one when it is about to expire.
+func (a *azureClient) accessToken(ctx context.Context) (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.token != "" && time.Now().Before(a.tokenExpiry) {
+		return a.token, nil
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", a.clientID)
+	form.Set("client_secret", a.clientSecret)
+	form.Set("scope", azureScope)
+
+	tokenURL := azureLoginURL + url.PathEscape(a.tenantID) + "/oauth2/v2.0/token"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := doJSON(a.httpClient, req, &body); err != nil {
+		return "", fmt.Errorf("requesting Microsoft Graph token: %w", err)
+	}
+
+	a.token = body.AccessToken
+	a.tokenExpiry = time.Now().Add(time.Duration(body.ExpiresIn)*time.Second - azureTokenSlack)
+	return a.token, nil
+}
+
+// doJSON sends req and decodes a successful JSON response into out.
+func doJSON(client *http.Client, req *http.Request, out interface{}) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,122 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// ProviderAzure looks groups up in Microsoft Entra ID (Azure AD) through Microsoft Graph.
+	ProviderAzure = "azure"
+	// ProviderSCIM looks groups up through a SCIM 2.0 /Groups endpoint.
+	ProviderSCIM = "scim"
+)
+
+const (
+	// maxResults bounds the groups returned for one query.
+	maxResults = 20
+	// requestTimeout bounds a single request to the directory.
+	requestTimeout = 10 * time.Second
+	// maxCachedQueries bounds the cache; it is cleared when full.
+	maxCachedQueries = 1000
+)
+
+// Group is a group known to the identity provider.
+type Group struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// Client searches an identity provider's groups.
+type Client interface {
+	// SearchGroups returns groups whose name starts with query.
+	SearchGroups(ctx context.Context, query string) ([]Group, error)
+}
+
+// Config selects and configures a directory provider.
+type Config struct {
+	Provider string
+	// URL is the SCIM base URL, e.g. https://idp.example.com/scim/v2.
+	URL string
+	// Token is the SCIM bearer token.
+	Token string
+	// TenantID, ClientID and ClientSecret identify the Azure app registration, which needs the
+	// GroupMember.Read.All or Group.Read.All application permission.
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+	// CacheTTL is how long results for a query are reused.
+	CacheTTL time.Duration
+}
+
+// New creates the client for config.Provider wrapped in a cache, or returns nil when no provider is configured.
+func New(config Config) (Client, error) {
+	httpClient := &http.Client{Timeout: requestTimeout}
+
+	var client Client
+	switch config.Provider {
+	case "":
+		return nil, nil
+	case ProviderAzure:
+		if config.TenantID == "" || config.ClientID == "" || config.ClientSecret == "" {
+			return nil, fmt.Errorf("the azure directory needs a tenant id, client id and client secret")
+		}
+		client = newAzureClient(httpClient, config.TenantID, config.ClientID, config.ClientSecret)
+	case ProviderSCIM:
+		if config.URL == "" {
+			return nil, fmt.Errorf("the scim directory needs a base URL")
+		}
+		client = newSCIMClient(httpClient, config.URL, config.Token)
+	default:
+		return nil, fmt.Errorf("unsupported directory provider %q, expected %s or %s", config.Provider, ProviderAzure, ProviderSCIM)
+	}
+
+	if config.CacheTTL <= 0 {
+		return client, nil
+	}
+	return &cachedClient{client: client, ttl: config.CacheTTL, entries: make(map[string]cacheEntry)}, nil
+}
+
+// cachedClient reuses recent successful results so autocomplete keystrokes don't each reach the directory.
+type cachedClient struct {
+	client Client
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is a cached result and when it expires.
+type cacheEntry struct {
+	groups  []Group
+	expires time.Time
+}
+
+// SearchGroups returns a cached result for query, or asks the directory and caches the answer.
+func (c *cachedClient) SearchGroups(ctx context.Context, query string) ([]Group, error) {
+	key := strings.ToLower(query)
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.groups, nil
+	}
+
+	groups, err := c.client.SearchGroups(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	if len(c.entries) >= maxCachedQueries {
+		c.entries = make(map[string]cacheEntry)
+	}
+	c.entries[key] = cacheEntry{groups: groups, expires: time.Now().Add(c.ttl)}
+	c.mu.Unlock()
+	return groups, nil
+}
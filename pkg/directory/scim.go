@@ -0,0 +1,59 @@
+package directory
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// scimClient searches groups through a SCIM 2.0 service provider.
+type scimClient struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+}
+
+// newSCIMClient creates a client for the SCIM service at baseURL, authenticating with token when set.
+func newSCIMClient(httpClient *http.Client, baseURL, token string) *scimClient {
+	return &scimClient{httpClient: httpClient, baseURL: strings.TrimRight(baseURL, "/"), token: token}
+}
+
+// SearchGroups returns groups whose display name starts with query.
+func (s *scimClient) SearchGroups(ctx context.Context, query string) ([]Group, error) {
+	params := url.Values{}
+	params.Set("attributes", "displayName")
+	params.Set("count", strconv.Itoa(maxResults))
+	if query != "" {
+		// SCIM filter strings are JSON strings, so quotes and backslashes are escaped
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(query)
+		params.Set("filter", `displayName sw "`+escaped+`"`)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.baseURL+"/Groups?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/scim+json")
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	var body struct {
+		Resources []struct {
+			ID          string `json:"id"`
+			DisplayName string `json:"displayName"`
+		} `json:"Resources"`
+	}
+	if err := doJSON(s.httpClient, req, &body); err != nil {
+		return nil, fmt.Errorf("searching SCIM groups: %w", err)
+	}
+
+	groups := make([]Group, 0, len(body.Resources))
+	for _, group := range body.Resources {
+		groups = append(groups, Group{ID: group.ID, Name: group.DisplayName})
+	}
+	return groups, nil
+}
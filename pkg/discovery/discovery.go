@@ -0,0 +1,147 @@
+package discovery
+
+import (
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kdiscovery "k8s.io/client-go/discovery"
+)
+
+// Resource is an API resource or subresource, such as pods/log, and the verbs it supports.
+type Resource struct {
+	Name       string   `json:"name"`
+	Namespaced bool     `json:"namespaced"`
+	Verbs      []string `json:"verbs"`
+}
+
+// Group is an API group and the resources it serves across all its versions. The core group is "".
+type Group struct {
+	Name      string     `json:"name"`
+	Resources []Resource `json:"resources"`
+}
+
+// Catalog describes everything the API server serves, in stable order.
+type Catalog struct {
+	Groups    []Group   `json:"groups"`
+	FetchedAt time.Time `json:"fetchedAt"`
+	// Partial is set when some groups, typically unavailable aggregated APIs, could not be discovered.
+	Partial bool `json:"partial,omitempty"`
+
+	index map[string]map[string]Resource
+}
+
+// Lookup returns the resource called name in group.
+func (c *Catalog) Lookup(group, name string) (Resource, bool) {
+	resource, ok := c.index[group][name]
+	return resource, ok
+}
+
+// HasGroup reports whether the server serves group.
+func (c *Catalog) HasGroup(group string) bool {
+	_, ok := c.index[group]
+	return ok
+}
+
+// GroupsServing returns the groups serving a resource called name.
+func (c *Catalog) GroupsServing(name string) []string {
+	var groups []string
+	for _, group := range c.Groups {
+		if _, ok := c.index[group.Name][name]; ok {
+			groups = append(groups, group.Name)
+		}
+	}
+	return groups
+}
+
+// Cache holds the catalog of an API server, fetching it again once it is older than the TTL.
+type Cache struct {
+	client kdiscovery.DiscoveryInterface
+	ttl    time.Duration
+
+	mu      sync.Mutex
+	catalog *Catalog
+}
+
+// NewCache creates a cache reusing a fetched catalog for ttl.
+func NewCache(client kdiscovery.DiscoveryInterface, ttl time.Duration) *Cache {
+	return &Cache{client: client, ttl: ttl}
+}
+
+// Catalog returns the cached catalog, fetching it when it is missing, expired or refresh is set. If fetching
+// fails the previous catalog is returned while there is one, since a stale answer beats none.
+func (c *Cache) Catalog(refresh bool) (*Catalog, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.catalog != nil && !refresh && time.Since(c.catalog.FetchedAt) < c.ttl {
+		return c.catalog, nil
+	}
+
+	catalog, err := fetch(c.client)
+	if err != nil {
+		if c.catalog != nil {
+			slog.Warn("Error refreshing API discovery, serving the previous result", "error", err)
+			return c.catalog, nil
+		}
+		return nil, err
+	}
+	c.catalog = catalog
+	return catalog, nil
+}
+
+// fetch builds a catalog from every version of every group the server serves.
+func fetch(client kdiscovery.DiscoveryInterface) (*Catalog, error) {
+	_, lists, err := client.ServerGroupsAndResources()
+	partial := err != nil && kdiscovery.IsGroupDiscoveryFailedError(err)
+	if err != nil && !partial {
+		return nil, err
+	}
+
+	index := make(map[string]map[string]Resource)
+	for _, list := range lists {
+		gv, err := schema.ParseGroupVersion(list.GroupVersion)
+		if err != nil {
+			continue
+		}
+		if index[gv.Group] == nil {
+			index[gv.Group] = make(map[string]Resource)
+		}
+		for _, r := range list.APIResources {
+			index[gv.Group][r.Name] = merge(index[gv.Group][r.Name], r)
+		}
+	}
+
+	catalog := &Catalog{FetchedAt: time.Now(), Partial: partial, index: index}
+	for name, resources := range index {
+		group := Group{Name: name}
+		for _, resource := range resources {
+			group.Resources = append(group.Resources, resource)
+		}
+		sort.Slice(group.Resources, func(i, j int) bool { return group.Resources[i].Name < group.Resources[j].Name })
+		catalog.Groups = append(catalog.Groups, group)
+	}
+	sort.Slice(catalog.Groups, func(i, j int) bool { return catalog.Groups[i].Name < catalog.Groups[j].Name })
+	return catalog, nil
+}
+
+// merge adds the verbs a version of a resource supports to what other versions support.
+func merge(existing Resource, r metav1.APIResource) Resource {
+	verbs := make(map[string]bool)
+	for _, verb := range existing.Verbs {
+		verbs[verb] = true
+	}
+	for _, verb := range r.Verbs {
+		verbs[verb] = true
+	}
+
+	merged := Resource{Name: r.Name, Namespaced: r.Namespaced, Verbs: make([]string, 0, len(verbs))}
+	for verb := range verbs {
+		merged.Verbs = append(merged.Verbs, verb)
+	}
+	sort.Strings(merged.Verbs)
+	return merged
+}
@@ -0,0 +1,170 @@
+package discovery
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	kdiscovery "k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// cluster returns a fake clientset serving core, apps in two versions, and a CRD group.
+func cluster() *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.Resources = []*metav1.APIResourceList{
+		{
+			GroupVersion: "v1",
+			APIResources: []metav1.APIResource{
+				{Name: "pods", Namespaced: true, Verbs: []string{"get", "list", "watch", "create", "delete"}},
+				{Name: "pods/log", Namespaced: true, Verbs: []string{"get"}},
+				{Name: "namespaces", Verbs: []string{"get", "list"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Namespaced: true, Verbs: []string{"get", "list", "update"}},
+				{Name: "deployments/scale", Namespaced: true, Verbs: []string{"get", "patch", "update"}},
+			},
+		},
+		{
+			GroupVersion: "apps/v1beta2",
+			APIResources: []metav1.APIResource{
+				{Name: "deployments", Namespaced: true, Verbs: []string{"get", "patch"}},
+			},
+		},
+		{
+			GroupVersion: "widgets.example.com/v1alpha1",
+			APIResources: []metav1.APIResource{
+				{Name: "widgets", Namespaced: true, Verbs: []string{"get", "list"}},
+			},
+		},
+	}
+	return clientset
+}
+
+// discoveries counts the discovery requests clientset received.
+func discoveries(clientset *fake.Clientset) int {
+	n := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "get" && action.GetResource().Resource == "group" {
+			n++
+		}
+	}
+	return n
+}
+
+func TestCatalog(t *testing.T) {
+	catalog, err := NewCache(cluster().Discovery(), time.Minute).Catalog(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Group{
+		{Name: "", Resources: []Resource{
+			{Name: "namespaces", Verbs: []string{"get", "list"}},
+			{Name: "pods", Namespaced: true, Verbs: []string{"create", "delete", "get", "list", "watch"}},
+			{Name: "pods/log", Namespaced: true, Verbs: []string{"get"}},
+		}},
+		{Name: "apps", Resources: []Resource{
+			{Name: "deployments", Namespaced: true, Verbs: []string{"get", "list", "patch", "update"}},
+			{Name: "deployments/scale", Namespaced: true, Verbs: []string{"get", "patch", "update"}},
+		}},
+		{Name: "widgets.example.com", Resources: []Resource{
+			{Name: "widgets", Namespaced: true, Verbs: []string{"get", "list"}},
+		}},
+	}
+	if !reflect.DeepEqual(catalog.Groups, want) {
+		t.Errorf("groups = %+v\nwant %+v", catalog.Groups, want)
+	}
+
+	if r, ok := catalog.Lookup("apps", "deployments/scale"); !ok || !r.Namespaced {
+		t.Errorf("Lookup(apps, deployments/scale) = %+v, %v", r, ok)
+	}
+	if _, ok := catalog.Lookup("", "deployments"); ok {
+		t.Error("deployments found in the core group")
+	}
+	if !catalog.HasGroup("widgets.example.com") || catalog.HasGroup("batch") {
+		t.Error("HasGroup doesn't match the served groups")
+	}
+	if groups := catalog.GroupsServing("deployments"); !reflect.DeepEqual(groups, []string{"apps"}) {
+		t.Errorf("GroupsServing(deployments) = %v, want [apps]", groups)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	clientset := cluster()
+	cache := NewCache(clientset.Discovery(), 50*time.Millisecond)
+
+	first, err := cache.Catalog(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := cache.Catalog(false); again != first || discoveries(clientset) != 1 {
+		t.Errorf("catalog fetched %d times within the TTL, want 1", discoveries(clientset))
+	}
+	if refreshed, _ := cache.Catalog(true); refreshed == first || discoveries(clientset) != 2 {
+		t.Errorf("refresh fetched %d times in total, want 2", discoveries(clientset))
+	}
+	time.Sleep(60 * time.Millisecond)
+	cache.Catalog(false)
+	if n := discoveries(clientset); n != 3 {
+		t.Errorf("catalog fetched %d times in total after the TTL, want 3", n)
+	}
+}
+
+// failing fails discovery when err is set.
+type failing struct {
+	kdiscovery.DiscoveryInterface
+	err error
+}
+
+func (f *failing) ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	return f.DiscoveryInterface.ServerGroupsAndResources()
+}
+
+func TestCacheServesStaleCatalogOnError(t *testing.T) {
+	client := &failing{DiscoveryInterface: cluster().Discovery(), err: errors.New("connection refused")}
+	cache := NewCache(client, time.Minute)
+	if _, err := cache.Catalog(false); err == nil {
+		t.Fatal("Catalog succeeded without a catalog to fall back on")
+	}
+
+	client.err = nil
+	fetched, err := cache.Catalog(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client.err = errors.New("connection refused")
+	if stale, err := cache.Catalog(true); err != nil || stale != fetched {
+		t.Errorf("Catalog(true) = %p, %v; want the previous catalog", stale, err)
+	}
+}
+
+// partial reports an unavailable aggregated API alongside the groups it did discover.
+type partial struct {
+	kdiscovery.DiscoveryInterface
+}
+
+func (p *partial) ServerGroupsAndResources() ([]*metav1.APIGroup, []*metav1.APIResourceList, error) {
+	groups, lists, _ := p.DiscoveryInterface.ServerGroupsAndResources()
+	return groups, lists, &kdiscovery.ErrGroupDiscoveryFailed{Groups: map[schema.GroupVersion]error{
+		{Group: "metrics.k8s.io", Version: "v1beta1"}: errors.New("service unavailable"),
+	}}
+}
+
+func TestCatalogPartial(t *testing.T) {
+	catalog, err := NewCache(&partial{DiscoveryInterface: cluster().Discovery()}, time.Minute).Catalog(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !catalog.Partial || !catalog.HasGroup("apps") {
+		t.Errorf("catalog = %+v, want the discovered groups marked partial", catalog)
+	}
+}
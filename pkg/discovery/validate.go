@@ -0,0 +1,170 @@
+package discovery
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// cacheKey is the context key holding the discovery cache.
+const cacheKey = "discovery.cache"
+
+// verbsOutsideDiscovery are verbs RBAC authorizes that discovery never advertises.
+var verbsOutsideDiscovery = map[string]bool{
+	"bind":        true,
+	"escalate":    true,
+	"impersonate": true,
+	"use":         true,
+	"approve":     true,
+	"sign":        true,
+	"attest":      true,
+}
+
+// Warning describes a part of a rule that grants nothing on this cluster.
+type Warning struct {
+	// Rule is the index of the rule in the role.
+	Rule    int    `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Validate checks rules against what the server serves. A wildcard skips the check for its dimension.
+// The results are warnings, not errors, because a CRD may be installed after the role that uses it.
+func (c *Catalog) Validate(rules []rbacv1.PolicyRule) []Warning {
+	var warnings []Warning
+	for i, rule := range rules {
+		warn := func(format string, args ...interface{}) {
+			warnings = append(warnings, Warning{Rule: i, Message: fmt.Sprintf(format, args...)})
+		}
+
+		anyGroup := false
+		for _, group := range rule.APIGroups {
+			if group == rbacv1.APIGroupAll {
+				anyGroup = true
+			} else if !c.HasGroup(group) {
+				warn("unknown API group %q", group)
+			}
+		}
+
+		for _, url := range rule.NonResourceURLs {
+			if url == rbacv1.NonResourceAll {
+				continue
+			}
+			if !strings.HasPrefix(url, "/") {
+				warn("non-resource URL %q must start with /", url)
+			}
+			if star := strings.Index(url, "*"); star >= 0 && star != len(url)-1 {
+				warn("non-resource URL %q has a * that is not trailing, so it is matched literally", url)
+			}
+		}
+
+		var matched []Resource
+		var matchedNames []string
+		for _, name := range rule.Resources {
+			if strings.Contains(name, "*") {
+				continue
+			}
+			groups := rule.APIGroups
+			if anyGroup {
+				groups = c.GroupsServing(name)
+			}
+			found := false
+			for _, group := range groups {
+				if resource, ok := c.Lookup(group, name); ok {
+					matched = append(matched, resource)
+					matchedNames = append(matchedNames, qualified(group, name))
+					found = true
+				}
+			}
+			if found {
+				continue
+			}
+
+			if others := c.GroupsServing(name); len(others) > 0 {
+				warn("resource %q is not served by %s but by %s", name, describeGroups(rule.APIGroups), describeGroups(others))
+			} else if plural := name + "s"; len(c.GroupsServing(plural)) > 0 {
+				warn("unknown resource %q, did you mean %q?", name, plural)
+			} else {
+				warn("unknown resource %q in %s", name, describeGroups(rule.APIGroups))
+			}
+		}
+
+		for _, verb := range rule.Verbs {
+			if verb == rbacv1.VerbAll || verbsOutsideDiscovery[verb] {
+				continue
+			}
+			for j, resource := range matched {
+				if !contains(resource.Verbs, verb) {
+					warn("verb %q is not supported by %s", verb, matchedNames[j])
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// qualified names a resource the way kubectl does, such as deployments.apps.
+func qualified(group, name string) string {
+	if group == "" {
+		return name
+	}
+	return name + "." + group
+}
+
+// describeGroups lists API groups for a message, naming the core group explicitly.
+func describeGroups(groups []string) string {
+	described := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if group == "" {
+			described = append(described, "the core group")
+		} else {
+			described = append(described, fmt.Sprintf("%q", group))
+		}
+	}
+	if len(described) == 0 {
+		return "no API group"
+	}
+	return strings.Join(described, ", ")
+}
+
+// contains reports whether values includes value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Middleware makes the cache available to Warn.
+func (c *Cache) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			ctx.Set(cacheKey, c)
+			return next(ctx)
+		}
+	}
+}
+
+// Warn validates rules and adds a Warning header to the response for each problem found. Rules are not
+// checked when discovery is unavailable, so a create never fails for want of a lint.
+func Warn(ctx echo.Context, rules []rbacv1.PolicyRule) {
+	cache, ok := ctx.Get(cacheKey).(*Cache)
+	if !ok {
+		return
+	}
+	catalog, err := cache.Catalog(false)
+	if err != nil {
+		slog.Debug("Skipping rule validation, API discovery failed", "error", err)
+		return
+	}
+
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	for _, warning := range catalog.Validate(rules) {
+		message := fmt.Sprintf("rule %d: %s", warning.Rule, warning.Message)
+		ctx.Response().Header().Add("Warning", `199 kubeberus "`+escape.Replace(message)+`"`)
+	}
+}
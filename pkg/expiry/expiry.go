@@ -0,0 +1,182 @@
+package expiry
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/managed"
+	"rbac/pkg/watch"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// Annotation records when a temporary binding expires, in RFC 3339.
+	Annotation = "k-rbac.io/expires-at"
+	// reaperActor is recorded as the actor of expiry audit entries.
+	reaperActor = "system:k-rbac:binding-reaper"
+	// reapAction is the audit action of a binding removed because it expired.
+	reapAction = "expire_binding"
+)
+
+// Stamp marks meta as a managed object expiring at expiresAt.
+func Stamp(meta *metav1.ObjectMeta, expiresAt time.Time) {
+	if meta.Labels == nil {
+		meta.Labels = make(map[string]string)
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	meta.Labels[managed.Label] = managed.Value
+	meta.Annotations[Annotation] = expiresAt.UTC().Format(time.RFC3339)
+}
+
+// ExpiresAt returns the expiry recorded on a managed object. Objects not managed by this tool never expire,
+// whatever they are annotated with, so the reaper only ever deletes bindings it created.
+func ExpiresAt(meta metav1.ObjectMeta) (time.Time, bool) {
+	expiresAt, _ := Inspect(meta)
+	if expiresAt == nil {
+		return time.Time{}, false
+	}
+	return *expiresAt, true
+}
+
+// Inspect returns the expiry ExpiresAt reads from meta, or nil when there is none, explaining why when meta
+// carries an expiry annotation that is ignored.
+func Inspect(meta metav1.ObjectMeta) (*time.Time, string) {
+	value, ok := meta.Annotations[Annotation]
+	if !ok {
+		return nil, ""
+	}
+	expiresAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Sprintf("%s %q is not an RFC 3339 time and is ignored", Annotation, value)
+	}
+	if managed.Owner(meta) != managed.Value {
+		return nil, fmt.Sprintf("%s is ignored as the object is not managed by %s", Annotation, managed.Value)
+	}
+	return &expiresAt, ""
+}
+
+// Parse reads an expiry given either as an RFC 3339 time or as a duration from now such as "8h".
+// An empty value means no expiry.
+func Parse(expiresAt, expiresIn string, now time.Time) (*time.Time, error) {
+	var t time.Time
+	switch {
+	case expiresAt != "" && expiresIn != "":
+		return nil, fmt.Errorf("specify only one of expiresAt and expiresIn")
+	case expiresAt != "":
+		parsed, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil {
+			return nil, fmt.Errorf("expiresAt must be an RFC 3339 time such as 2024-05-01T18:00:00Z")
+		}
+		t = parsed
+	case expiresIn != "":
+		d, err := time.ParseDuration(expiresIn)
+		if err != nil {
+			return nil, fmt.Errorf("expiresIn must be a duration such as 8h or 30m")
+		}
+		t = now.Add(d)
+	default:
+		return nil, nil
+	}
+	if !t.After(now) {
+		return nil, fmt.Errorf("expiry must be in the future")
+	}
+	return &t, nil
+}
+
+// Reaper deletes managed bindings whose expiry has passed.
+type Reaper struct {
+	clientset kubernetes.Interface
+	auditor   *audit.Auditor
+	interval  time.Duration
+}
+
+// NewReaper creates a reaper checking for expired bindings every interval and recording deletions with auditor.
+func NewReaper(clientset kubernetes.Interface, auditor *audit.Auditor, interval time.Duration) *Reaper {
+	return &Reaper{clientset: clientset, auditor: auditor, interval: interval}
+}
+
+// Run reaps expired bindings every interval until ctx is cancelled.
+func (r *Reaper) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.reap(ctx, time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// reap deletes every managed RoleBinding and ClusterRoleBinding that expired before now.
+func (r *Reaper) reap(ctx context.Context, now time.Time) {
+	rbac := r.clientset.RbacV1()
+
+	roleBindings, err := rbac.RoleBindings("").List(ctx, metav1.ListOptions{LabelSelector: managed.Selector})
+	if err != nil {
+		slog.Error("Error listing role bindings to reap", "error", err)
+	} else {
+		for i := range roleBindings.Items {
+			rb := &roleBindings.Items[i]
+			r.reapOne(ctx, now, "rolebindings", rb.ObjectMeta, rb, func(opts metav1.DeleteOptions) error {
+				return rbac.RoleBindings(rb.Namespace).Delete(ctx, rb.Name, opts)
+			})
+		}
+	}
+
+	clusterRoleBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{LabelSelector: managed.Selector})
+	if err != nil {
+		slog.Error("Error listing cluster role bindings to reap", "error", err)
+	} else {
+		for i := range clusterRoleBindings.Items {
+			crb := &clusterRoleBindings.Items[i]
+			r.reapOne(ctx, now, "clusterrolebindings", crb.ObjectMeta, crb, func(opts metav1.DeleteOptions) error {
+				return rbac.ClusterRoleBindings().Delete(ctx, crb.Name, opts)
+			})
+		}
+	}
+}
+
+// reapOne deletes a single binding if it has expired. The delete is conditioned on the binding's UID so a
+// binding recreated under the same name is left alone, and one already gone is skipped silently.
+func (r *Reaper) reapOne(ctx context.Context, now time.Time, resource string, meta metav1.ObjectMeta, obj interface{}, deleteFunc func(metav1.DeleteOptions) error) {
+	expiresAt, ok := ExpiresAt(meta)
+	if !ok || expiresAt.After(now) || ctx.Err() != nil {
+		return
+	}
+
+	uid := meta.UID
+	err := deleteFunc(metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}})
+	if apierrors.IsNotFound(err) || apierrors.IsConflict(err) {
+		return
+	}
+	if err != nil {
+		slog.Error("Error deleting expired binding", "resource", resource, "namespace", meta.Namespace, "name", meta.Name, "error", err)
+		return
+	}
+
+	var before interface{}
+	if lite, ok := watch.ToLite(obj); ok {
+		before = lite
+	}
+	slog.Info("Deleted expired binding", "resource", resource, "namespace", meta.Namespace, "name", meta.Name, "expiresAt", expiresAt)
+	r.auditor.Record(audit.Entry{
+		Actor:        reaperActor,
+		Action:       reapAction,
+		Resource:     resource,
+		Namespace:    meta.Namespace,
+		ResourceName: meta.Name,
+		Details:      audit.NewDetails(before, nil),
+	})
+}
@@ -0,0 +1,112 @@
+package expiry
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"rbac/pkg/managed"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// annotated returns metadata managed by manager, or unmanaged when it is empty, carrying an expiry
+// annotation of value unless it is empty.
+func annotated(manager, value string) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{Name: "temp", Namespace: "prod"}
+	if manager != "" {
+		meta.Labels = map[string]string{managed.Label: manager}
+	}
+	if value != "" {
+		meta.Annotations = map[string]string{Annotation: value}
+	}
+	return meta
+}
+
+func TestInspect(t *testing.T) {
+	expiresAt := time.Date(2024, 5, 1, 18, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		meta    metav1.ObjectMeta
+		want    *time.Time
+		warning string
+	}{
+		{"no annotation", annotated(managed.Value, ""), nil, ""},
+		{"managed", annotated(managed.Value, "2024-05-01T18:00:00Z"), &expiresAt, ""},
+		{"offset", annotated(managed.Value, "2024-05-01T20:00:00+02:00"), &expiresAt, ""},
+		{"malformed", annotated(managed.Value, "tomorrow"), nil, `k-rbac.io/expires-at "tomorrow" is not an RFC 3339 time`},
+		{"date only", annotated(managed.Value, "2024-05-01"), nil, "is not an RFC 3339 time"},
+		{"unmanaged", annotated("", "2024-05-01T18:00:00Z"), nil, "not managed by k-rbac"},
+		{"managed by another tool", annotated("argocd", "2024-05-01T18:00:00Z"), nil, "not managed by k-rbac"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, warning := Inspect(tt.meta)
+			if (got == nil) != (tt.want == nil) || (got != nil && !got.Equal(*tt.want)) {
+				t.Errorf("expiry = %v, want %v", got, tt.want)
+			}
+			if tt.warning == "" && warning != "" || !strings.Contains(warning, tt.warning) {
+				t.Errorf("warning = %q, want %q", warning, tt.warning)
+			}
+
+			// ExpiresAt agrees with Inspect, so the reaper never deletes what the listing calls permanent
+			expiresAt, ok := ExpiresAt(tt.meta)
+			if ok != (tt.want != nil) || (ok && !expiresAt.Equal(*tt.want)) {
+				t.Errorf("ExpiresAt = %v, %v, want %v", expiresAt, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestStamp(t *testing.T) {
+	var meta metav1.ObjectMeta
+	Stamp(&meta, time.Date(2024, 5, 1, 20, 0, 0, 0, time.FixedZone("CEST", 2*60*60)))
+	if got, want := meta.Annotations[Annotation], "2024-05-01T18:00:00Z"; got != want {
+		t.Errorf("annotation = %q, want %q", got, want)
+	}
+	if _, warning := Inspect(meta); warning != "" {
+		t.Errorf("stamped object warns %q", warning)
+	}
+}
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name                 string
+		expiresAt, expiresIn string
+		want                 time.Time
+		err                  string
+	}{
+		{name: "none"},
+		{name: "time", expiresAt: "2024-05-01T18:00:00Z", want: now.Add(6 * time.Hour)},
+		{name: "duration", expiresIn: "8h", want: now.Add(8 * time.Hour)},
+		{name: "both", expiresAt: "2024-05-01T18:00:00Z", expiresIn: "8h", err: "only one"},
+		{name: "malformed time", expiresAt: "tomorrow", err: "RFC 3339"},
+		{name: "malformed duration", expiresIn: "a day", err: "duration"},
+		{name: "now", expiresAt: "2024-05-01T12:00:00Z", err: "future"},
+		{name: "past", expiresIn: "-1h", err: "future"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.expiresAt, tt.expiresIn, now)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("error = %v, want it to mention %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.want.IsZero() {
+				if got != nil {
+					t.Errorf("expiry = %v, want none", got)
+				}
+				return
+			}
+			if got == nil || !got.Equal(tt.want) {
+				t.Errorf("expiry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
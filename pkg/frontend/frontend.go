@@ -0,0 +1,122 @@
+// Package frontend serves the built single-page frontend, so deployments don't need a separate web server
+// in front of the API. Paths without a file of their own get index.html, leaving routing to the client.
+package frontend
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// indexFile is the page served for client-side routes.
+const indexFile = "index.html"
+
+const (
+	// immutableCache is sent with assets whose names change with their content, so they are never revalidated.
+	immutableCache = "public, max-age=31536000, immutable"
+	// revalidateCache is sent with pages, which name the current assets and so must always be revalidated.
+	revalidateCache = "no-cache"
+	// assetCache is sent with other files, such as icons, that keep their name across builds.
+	assetCache = "public, max-age=3600"
+)
+
+// reservedPrefixes are the server's own paths, which never fall back to the frontend.
+var reservedPrefixes = []string{"/api", "/auth", "/health", "/healthz", "/readyz", "/metrics", "/debug"}
+
+// hashedName matches file names carrying a content hash, such as main.3f9a1c2e.js.
+var hashedName = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[A-Za-z0-9]+$`)
+
+// Frontend serves the files of a built frontend.
+type Frontend struct {
+	files fs.FS
+}
+
+// New returns a frontend serving files, an embedded build or a directory from os.DirFS. It fails when files
+// has no index.html.
+func New(files fs.FS) (*Frontend, error) {
+	if _, err := fs.Stat(files, indexFile); err != nil {
+		return nil, fmt.Errorf("frontend has no %s: %w", indexFile, err)
+	}
+	return &Frontend{files: files}, nil
+}
+
+// Handler serves the file at the request path, the page of a statically exported route, or index.html. It is
+// meant to be registered for unmatched routes; reserved paths and methods other than GET and HEAD get a 404.
+func (f *Frontend) Handler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		method := c.Request().Method
+		if (method != http.MethodGet && method != http.MethodHead) || reserved(c.Request().URL.Path) {
+			return echo.ErrNotFound
+		}
+
+		name := f.resolve(c.Request().URL.Path)
+		if name == "" {
+			return echo.ErrNotFound
+		}
+		file, err := f.files.Open(name)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		// both embed.FS and os.DirFS files can seek, which ServeContent needs for ranges and conditional requests
+		content, ok := file.(io.ReadSeeker)
+		if !ok {
+			return fmt.Errorf("frontend file %s cannot seek", name)
+		}
+		c.Response().Header().Set(echo.HeaderCacheControl, cacheControl(name))
+		http.ServeContent(c.Response(), c.Request(), info.Name(), info.ModTime(), content)
+		return nil
+	}
+}
+
+// resolve maps a request path to the file served: the file itself, the page of an exported route such as
+// /dashboard/roles.html or /dashboard/roles/index.html, or index.html. Missing files with an extension, such
+// as the asset of an older build, resolve to "" rather than to a page the browser would misread.
+func (f *Frontend) resolve(requestPath string) string {
+	name := strings.TrimPrefix(path.Clean("/"+requestPath), "/")
+	if name == "" {
+		return indexFile
+	}
+	for _, candidate := range []string{name, name + ".html", path.Join(name, indexFile)} {
+		if info, err := fs.Stat(f.files, candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+	if ext := path.Ext(name); ext != "" && ext != ".html" {
+		return ""
+	}
+	return indexFile
+}
+
+// reserved reports whether requestPath belongs to the server rather than the frontend.
+func reserved(requestPath string) bool {
+	for _, prefix := range reservedPrefixes {
+		if requestPath == prefix || strings.HasPrefix(requestPath, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// cacheControl returns the Cache-Control header of the file name.
+func cacheControl(name string) string {
+	switch {
+	case strings.HasSuffix(name, ".html"):
+		return revalidateCache
+	case strings.HasPrefix(name, "_next/static/") || hashedName.MatchString(path.Base(name)):
+		return immutableCache
+	default:
+		return assetCache
+	}
+}
@@ -0,0 +1,113 @@
+package frontend
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+)
+
+// build is a statically exported frontend with hashed and unhashed assets and an exported route.
+var build = fstest.MapFS{
+	"index.html":                       {Data: []byte("<html>index</html>")},
+	"dashboard/roles.html":             {Data: []byte("<html>roles</html>")},
+	"settings/index.html":              {Data: []byte("<html>settings</html>")},
+	"favicon.ico":                      {Data: []byte("icon")},
+	"_next/static/chunks/app.js":       {Data: []byte("app")},
+	"assets/main.3f9a1c2e.js":          {Data: []byte("main")},
+	"assets/logo.svg":                  {Data: []byte("<svg/>")},
+	"assets/vendor-0123456789abcdef.c": {Data: []byte("vendor")},
+}
+
+// get serves a request for target from the frontend, routed as Echo routes unmatched paths.
+func get(t *testing.T, method, target string) *httptest.ResponseRecorder {
+	t.Helper()
+	site, err := New(build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.RouteNotFound("/*", site.Handler())
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(method, target, nil))
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	type test struct {
+		name         string
+		method       string
+		target       string
+		wantBody     string
+		wantCache    string
+		wantNotFound bool
+	}
+	tests := []test{
+		{name: "root", target: "/", wantBody: "<html>index</html>", wantCache: revalidateCache},
+		{name: "client-side route", target: "/bindings/prod/ci", wantBody: "<html>index</html>", wantCache: revalidateCache},
+		{name: "exported page", target: "/dashboard/roles", wantBody: "<html>roles</html>", wantCache: revalidateCache},
+		{name: "exported directory page", target: "/settings", wantBody: "<html>settings</html>", wantCache: revalidateCache},
+		{name: "next.js asset", target: "/_next/static/chunks/app.js", wantBody: "app", wantCache: immutableCache},
+		{name: "hashed asset", target: "/assets/main.3f9a1c2e.js", wantBody: "main", wantCache: immutableCache},
+		{name: "hashed asset with a dash", target: "/assets/vendor-0123456789abcdef.c", wantBody: "vendor", wantCache: immutableCache},
+		{name: "unhashed asset", target: "/assets/logo.svg", wantBody: "<svg/>", wantCache: assetCache},
+		{name: "head", method: http.MethodHead, target: "/bindings", wantCache: revalidateCache},
+		{name: "asset of an older build", target: "/assets/main.00000000.js", wantNotFound: true},
+		{name: "traversal stays inside the build", target: "/../../etc/passwd", wantBody: "<html>index</html>", wantCache: revalidateCache},
+		{name: "post", method: http.MethodPost, target: "/bindings", wantNotFound: true},
+	}
+	for _, reserved := range reservedPrefixes {
+		tests = append(tests, test{name: "reserved " + reserved, target: reserved + "/missing", wantNotFound: true})
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			rec := get(t, method, tt.target)
+			if tt.wantNotFound {
+				if rec.Code != http.StatusNotFound {
+					t.Errorf("status = %d, want %d", rec.Code, http.StatusNotFound)
+				}
+				return
+			}
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+			}
+			if method == http.MethodGet && rec.Body.String() != tt.wantBody {
+				t.Errorf("body = %q, want %q", rec.Body.String(), tt.wantBody)
+			}
+			if got := rec.Header().Get(echo.HeaderCacheControl); got != tt.wantCache {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.wantCache)
+			}
+		})
+	}
+}
+
+func TestNewRequiresIndex(t *testing.T) {
+	if _, err := New(fstest.MapFS{"app.js": {Data: []byte("app")}}); err == nil {
+		t.Error("New accepted a build without index.html")
+	}
+}
+
+func TestReserved(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/api", true},
+		{"/api/roles", true},
+		{"/healthz", true},
+		{"/apis", false},
+		{"/healthcheck", false},
+		{"/dashboard", false},
+	}
+	for _, tt := range tests {
+		if got := reserved(tt.path); got != tt.want {
+			t.Errorf("reserved(%q) = %v, want %v", tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package gitops
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// commitAuthor is the identity of the mirror's commits; the actor is named in the message.
+	commitAuthorName  = "k-rbac"
+	commitAuthorEmail = "k-rbac@localhost"
+	// pushBackoff is the wait before the first retry of a rejected push, doubling with each attempt.
+	pushBackoff = 2 * time.Second
+	// gitTimeout bounds a single git command.
+	gitTimeout = 2 * time.Minute
+)
+
+// repository runs git in a clone of the mirrored repository.
+type repository struct {
+	url    string
+	branch string
+	dir    string
+	env    []string
+}
+
+func newRepository(config Config, dir string) *repository {
+	// credentials go through the environment rather than the command line or .git/config, where they'd be
+	// visible to other processes and left on disk
+	env := append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var settings [][2]string
+	if config.Token != "" {
+		basic := base64.StdEncoding.EncodeToString([]byte("x-access-token:" + config.Token))
+		settings = append(settings, [2]string{"http.extraHeader", "Authorization: Basic " + basic})
+	}
+	settings = append(settings, [2]string{"user.name", commitAuthorName}, [2]string{"user.email", commitAuthorEmail})
+	env = append(env, "GIT_CONFIG_COUNT="+strconv.Itoa(len(settings)))
+	for i, setting := range settings {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_KEY_%d=%s", i, setting[0]), fmt.Sprintf("GIT_CONFIG_VALUE_%d=%s", i, setting[1]))
+	}
+	if config.SSHKeyFile != "" {
+		env = append(env, "GIT_SSH_COMMAND=ssh -i '"+strings.ReplaceAll(config.SSHKeyFile, "'", `'\''`)+"' -o IdentitiesOnly=yes -o StrictHostKeyChecking=accept-new")
+	}
+	return &repository{url: config.RepoURL, branch: config.Branch, dir: dir, env: env}
+}
+
+// prepare clones the branch into the work directory, or resets an existing clone to the remote branch.
+func (r *repository) prepare(ctx context.Context) error {
+	if _, err := os.Stat(r.dir + "/.git"); err == nil {
+		if _, err := r.git(ctx, "fetch", "origin", r.branch); err != nil {
+			return err
+		}
+		_, err := r.git(ctx, "reset", "--hard", "origin/"+r.branch)
+		return err
+	}
+	_, err := r.gitIn(ctx, "", "clone", "--branch", r.branch, "--single-branch", r.url, r.dir)
+	return err
+}
+
+// commit stages everything under prefix and commits it, returning the new commit, or "" when nothing changed.
+func (r *repository) commit(ctx context.Context, prefix, message string) (string, error) {
+	if prefix == "" {
+		prefix = "."
+	}
+	if _, err := r.git(ctx, "add", "--all", "--", prefix); err != nil {
+		return "", err
+	}
+	if _, err := r.git(ctx, "diff", "--cached", "--quiet"); err == nil {
+		return "", nil
+	}
+	if _, err := r.git(ctx, "commit", "--quiet", "--message", message); err != nil {
+		return "", err
+	}
+	out, err := r.git(ctx, "rev-parse", "HEAD")
+	return strings.TrimSpace(out), err
+}
+
+// push pushes to the remote branch. When the push is rejected, because someone else pushed meanwhile, the
+// local commits are rebased onto the remote branch, preferring the mirror's version of conflicting files,
+// and pushed again up to retries times. It returns the number of attempts made.
+func (r *repository) push(ctx context.Context, retries int) (int, error) {
+	backoff := pushBackoff
+	for attempt := 1; ; attempt++ {
+		_, err := r.git(ctx, "push", "origin", "HEAD:refs/heads/"+r.branch)
+		if err == nil || attempt > retries {
+			return attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+
+		// during a rebase "theirs" is the commit being replayed, which is the mirror's own
+		if _, err := r.git(ctx, "pull", "--rebase", "--strategy-option=theirs", "origin", r.branch); err != nil {
+			_, _ = r.git(ctx, "rebase", "--abort")
+			return attempt, fmt.Errorf("rebasing onto origin/%s: %w", r.branch, err)
+		}
+	}
+}
+
+func (r *repository) git(ctx context.Context, args ...string) (string, error) {
+	return r.gitIn(ctx, r.dir, args...)
+}
+
+// gitIn runs git in dir, returning its output; errors include what git printed.
+func (r *repository) gitIn(ctx context.Context, dir string, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, gitTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = r.env
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %s", args[0], message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return stdout.String(), nil
+}
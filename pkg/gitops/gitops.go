@@ -0,0 +1,306 @@
+// Package gitops mirrors the RBAC objects changed through the service into a git repository, so a GitOps
+// repo stays in step with changes made by hand. Every audited change to a Role, ClusterRole or binding is
+// written as cleaned YAML, committed with the actor and audit entry id, and pushed in the background.
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/watch"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// queueCapacity bounds the changes waiting to be committed; a full sync repairs any that are dropped.
+	queueCapacity = 1000
+	// prepareBackoff is how long to wait before cloning again after a failed clone.
+	prepareBackoff = 30 * time.Second
+	// pushRetryInterval is how often commits that failed to push are pushed again.
+	pushRetryInterval = time.Minute
+	// syncAction is the action of a full export.
+	syncAction = "sync"
+)
+
+// Config configures the repository changes are mirrored to.
+type Config struct {
+	// RepoURL is the repository to clone and push to, over HTTPS or SSH.
+	RepoURL string
+	// Branch is the branch committed to.
+	Branch string
+	// PathPrefix is the directory of the repository the objects are written under.
+	PathPrefix string
+	// Token authenticates HTTPS remotes; SSHKeyFile is the private key for SSH remotes.
+	Token      string
+	SSHKeyFile string
+	// WorkDir is where the repository is cloned; empty uses a temporary directory.
+	WorkDir string
+	// PushRetries bounds how many times a rejected push is rebased and retried.
+	PushRetries int
+}
+
+// Status reports the state of the mirror.
+type Status struct {
+	Enabled    bool   `json:"enabled"`
+	Repository string `json:"repository,omitempty"`
+	Branch     string `json:"branch,omitempty"`
+	// Ready is set once the repository has been cloned.
+	Ready bool `json:"ready"`
+	// Pending is the number of changes waiting to be committed.
+	Pending int `json:"pending"`
+	// Unpushed is set when commits are waiting to be pushed.
+	Unpushed bool `json:"unpushed"`
+	// Dropped counts changes lost to a full queue since startup; a sync writes them anyway.
+	Dropped    uint64      `json:"dropped"`
+	LastCommit string      `json:"lastCommit,omitempty"`
+	LastPush   *PushResult `json:"lastPush,omitempty"`
+	// LastError is the most recent failure to clone, write or commit.
+	LastError     string     `json:"lastError,omitempty"`
+	LastErrorTime *time.Time `json:"lastErrorTime,omitempty"`
+}
+
+// PushResult is the outcome of the latest push.
+type PushResult struct {
+	Time     time.Time `json:"time"`
+	Success  bool      `json:"success"`
+	Attempts int       `json:"attempts"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// change is a queued object to mirror, or a full sync when kind is empty.
+type change struct {
+	kind      string
+	namespace string
+	name      string
+	action    string
+	actor     string
+	entryID   string
+}
+
+// Mirror commits changed objects to the repository. It is an audit sink.
+type Mirror struct {
+	config    Config
+	clientset kubernetes.Interface
+	repo      *repository
+	queue     chan change
+	dropped   atomic.Uint64
+
+	mu            sync.Mutex
+	ready         bool
+	unpushed      bool
+	lastCommit    string
+	lastPush      *PushResult
+	lastError     string
+	lastErrorTime time.Time
+}
+
+// New creates a mirror of the objects clientset reads into the repository of config. It does nothing until
+// Run is started.
+func New(config Config, clientset kubernetes.Interface) (*Mirror, error) {
+	if config.RepoURL == "" {
+		return nil, fmt.Errorf("a repository URL is required")
+	}
+	if config.Branch == "" {
+		return nil, fmt.Errorf("a branch is required")
+	}
+	if config.Token != "" && config.SSHKeyFile != "" {
+		return nil, fmt.Errorf("a token and an SSH key cannot both be set")
+	}
+	if strings.HasPrefix(config.PathPrefix, "/") || strings.Contains(config.PathPrefix, "..") {
+		return nil, fmt.Errorf("path prefix %q must be relative to the repository root", config.PathPrefix)
+	}
+	if config.PushRetries < 0 {
+		return nil, fmt.Errorf("push retries must not be negative")
+	}
+	return &Mirror{config: config, clientset: clientset, queue: make(chan change, queueCapacity)}, nil
+}
+
+// Write queues the object an audit entry changed. Entries for anything other than RBAC objects are ignored.
+func (m *Mirror) Write(entry audit.Entry) {
+	switch {
+	case entry.Action == "apply_template" && entry.Details != nil:
+		// a template application creates a role and a binding, whose identities are in the snapshot
+		var applied map[string]*watch.ObjectLite
+		if json.Unmarshal(entry.Details.After, &applied) != nil {
+			return
+		}
+		for _, key := range []string{"role", "roleBinding"} {
+			if object := applied[key]; object != nil {
+				m.enqueue(change{kind: object.Kind, namespace: object.Namespace, name: object.Name, action: entry.Action, actor: entry.Actor, entryID: entry.RequestID})
+			}
+		}
+	case entry.ResourceName != "":
+		if kind, ok := kinds[entry.Resource]; ok {
+			m.enqueue(change{kind: kind, namespace: entry.Namespace, name: entry.ResourceName, action: entry.Action, actor: entry.Actor, entryID: entry.RequestID})
+		}
+	}
+}
+
+// Sync queues an export of every RBAC object, which also removes files of objects that no longer exist.
+func (m *Mirror) Sync(actor, entryID string) bool {
+	return m.enqueue(change{action: syncAction, actor: actor, entryID: entryID})
+}
+
+func (m *Mirror) enqueue(c change) bool {
+	select {
+	case m.queue <- c:
+		return true
+	default:
+		m.dropped.Add(1)
+		return false
+	}
+}
+
+// Run clones the repository, retrying until it succeeds, then commits queued changes and pushes them until
+// ctx is cancelled. Changes arriving together are pushed together.
+func (m *Mirror) Run(ctx context.Context) {
+	workDir := m.config.WorkDir
+	if workDir == "" {
+		dir, err := os.MkdirTemp("", "k-rbac-gitops-")
+		if err != nil {
+			m.recordError(fmt.Errorf("creating work directory: %w", err))
+			return
+		}
+		defer os.RemoveAll(dir)
+		workDir = dir
+	}
+	m.repo = newRepository(m.config, workDir)
+
+	for {
+		err := m.repo.prepare(ctx)
+		if err == nil {
+			break
+		}
+		m.recordError(fmt.Errorf("cloning %s: %w", m.config.RepoURL, err))
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(prepareBackoff):
+		}
+	}
+	m.mu.Lock()
+	m.ready = true
+	m.mu.Unlock()
+
+	ticker := time.NewTicker(pushRetryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case c := <-m.queue:
+			m.apply(ctx, c)
+			for drained := false; !drained; {
+				select {
+				case c := <-m.queue:
+					m.apply(ctx, c)
+				default:
+					drained = true
+				}
+			}
+			m.push(ctx)
+		case <-ticker.C:
+			if m.Status().Unpushed {
+				m.push(ctx)
+			}
+		}
+	}
+}
+
+// apply writes one change to the working tree and commits it.
+func (m *Mirror) apply(ctx context.Context, c change) {
+	var err error
+	var subject string
+	if c.action == syncAction {
+		subject = "Sync the RBAC state of the cluster"
+		err = m.writeAll(ctx)
+	} else {
+		subject = fmt.Sprintf("%s %s %s", c.action, c.kind, objectRef(c.namespace, c.name))
+		err = m.writeObject(ctx, c.kind, c.namespace, c.name)
+	}
+	if err != nil {
+		m.recordError(fmt.Errorf("%s: %w", subject, err))
+		return
+	}
+
+	message := subject + "\n\nActor: " + c.actor + "\n"
+	if c.entryID != "" {
+		message += "Audit-Entry: " + c.entryID + "\n"
+	}
+	commit, err := m.repo.commit(ctx, m.config.PathPrefix, message)
+	if err != nil {
+		m.recordError(fmt.Errorf("committing %s: %w", subject, err))
+		return
+	}
+	if commit != "" {
+		m.mu.Lock()
+		m.lastCommit = commit
+		m.unpushed = true
+		m.mu.Unlock()
+	}
+}
+
+// push pushes the commits made so far, rebasing onto the remote branch when the push is rejected.
+func (m *Mirror) push(ctx context.Context) {
+	attempts, err := m.repo.push(ctx, m.config.PushRetries)
+	result := &PushResult{Time: time.Now().UTC(), Success: err == nil, Attempts: attempts}
+	if err != nil {
+		result.Error = err.Error()
+		slog.Error("Error pushing RBAC changes to git", "repository", m.config.RepoURL, "attempts", attempts, "error", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastPush = result
+	m.unpushed = err != nil
+}
+
+// Status returns a snapshot of the mirror's state.
+func (m *Mirror) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := Status{
+		Enabled:    true,
+		Repository: m.config.RepoURL,
+		Branch:     m.config.Branch,
+		Ready:      m.ready,
+		Pending:    len(m.queue),
+		Unpushed:   m.unpushed,
+		Dropped:    m.dropped.Load(),
+		LastCommit: m.lastCommit,
+		LastPush:   m.lastPush,
+		LastError:  m.lastError,
+	}
+	if !m.lastErrorTime.IsZero() {
+		errorTime := m.lastErrorTime
+		status.LastErrorTime = &errorTime
+	}
+	return status
+}
+
+// recordError logs and remembers the most recent failure.
+func (m *Mirror) recordError(err error) {
+	slog.Error("Error mirroring RBAC changes to git", "repository", m.config.RepoURL, "error", err)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.lastError = err.Error()
+	m.lastErrorTime = time.Now().UTC()
+}
+
+// objectRef names an object as namespace/name, or name when it is cluster-scoped.
+func objectRef(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return namespace + "/" + name
+}
@@ -0,0 +1,271 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/watch"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// run runs git in dir as someone other than the mirror, returning its trimmed output.
+func run(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=someone", "-c", "user.email=someone@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// remote creates a bare repository whose main branch has one commit, returning its path.
+func remote(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	bare := filepath.Join(t.TempDir(), "remote.git")
+	run(t, "", "init", "--quiet", "--bare", "--initial-branch=main", bare)
+	seed := clone(t, bare)
+	writeFile(t, filepath.Join(seed, "README.md"), "RBAC\n")
+	run(t, seed, "add", "README.md")
+	run(t, seed, "commit", "--quiet", "--message", "Initial commit")
+	run(t, seed, "push", "--quiet", "origin", "HEAD:refs/heads/main")
+	return bare
+}
+
+// clone clones the main branch of bare into a new directory.
+func clone(t *testing.T, bare string) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "clone")
+	run(t, "", "clone", "--quiet", bare, dir)
+	run(t, dir, "checkout", "--quiet", "-B", "main")
+	return dir
+}
+
+func writeFile(t *testing.T, file, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// cloned returns a mirror of objects whose repository, bare, has been cloned, as Run would.
+func cloned(t *testing.T, bare string, retries int, objects ...runtime.Object) *Mirror {
+	t.Helper()
+	m, err := New(Config{RepoURL: bare, Branch: "main", PathPrefix: "rbac", PushRetries: retries}, fake.NewSimpleClientset(objects...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.repo = newRepository(m.config, filepath.Join(t.TempDir(), "work"))
+	if err := m.repo.prepare(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// queued returns the changes waiting in the mirror's queue.
+func queued(m *Mirror) []change {
+	var changes []change
+	for len(m.queue) > 0 {
+		changes = append(changes, <-m.queue)
+	}
+	return changes
+}
+
+func TestWrite(t *testing.T) {
+	applied, err := json.Marshal(map[string]*watch.ObjectLite{
+		"role":        {Kind: "Role", Namespace: "prod", Name: "viewer"},
+		"roleBinding": {Kind: "RoleBinding", Namespace: "prod", Name: "viewer-alice"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		entry audit.Entry
+		want  []change
+	}{
+		{
+			name:  "namespaced object",
+			entry: audit.Entry{Action: "update_role", Actor: "alice", RequestID: "req-1", Resource: "roles", Namespace: "prod", ResourceName: "reader"},
+			want:  []change{{kind: "Role", namespace: "prod", name: "reader", action: "update_role", actor: "alice", entryID: "req-1"}},
+		},
+		{
+			name:  "cluster-scoped object",
+			entry: audit.Entry{Action: "delete_clusterrolebinding", Actor: "bob", Resource: "clusterrolebindings", ResourceName: "admins"},
+			want:  []change{{kind: "ClusterRoleBinding", name: "admins", action: "delete_clusterrolebinding", actor: "bob"}},
+		},
+		{
+			name:  "template application",
+			entry: audit.Entry{Action: "apply_template", Actor: "alice", RequestID: "req-2", Details: &audit.Details{After: applied}},
+			want: []change{
+				{kind: "Role", namespace: "prod", name: "viewer", action: "apply_template", actor: "alice", entryID: "req-2"},
+				{kind: "RoleBinding", namespace: "prod", name: "viewer-alice", action: "apply_template", actor: "alice", entryID: "req-2"},
+			},
+		},
+		{
+			name:  "template application without a snapshot",
+			entry: audit.Entry{Action: "apply_template", Actor: "alice", Details: &audit.Details{After: json.RawMessage(`"truncated"`)}},
+		},
+		{
+			name:  "not an RBAC object",
+			entry: audit.Entry{Action: "delete_namespace", Resource: "namespaces", ResourceName: "prod"},
+		},
+		{
+			name:  "no object",
+			entry: audit.Entry{Action: "flush_cache"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New(Config{RepoURL: "unused", Branch: "main"}, fake.NewSimpleClientset())
+			if err != nil {
+				t.Fatal(err)
+			}
+			m.Write(tt.entry)
+			got := queued(m)
+			if len(got) != len(tt.want) {
+				t.Fatalf("queued %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("change %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestApplyCommitsObject(t *testing.T) {
+	role := &rbacv1.Role{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "reader", Namespace: "prod", UID: "1234", ResourceVersion: "42",
+			Annotations: map[string]string{lastAppliedAnnotation: "{}"},
+		},
+		Rules: []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+	}
+	m := cloned(t, remote(t), 0, role)
+	ctx := context.Background()
+
+	m.apply(ctx, change{kind: "Role", namespace: "prod", name: "reader", action: "update_role", actor: "alice", entryID: "req-1"})
+	status := m.Status()
+	if status.LastError != "" || status.LastCommit == "" || !status.Unpushed {
+		t.Fatalf("status after apply = %+v, want an unpushed commit", status)
+	}
+
+	data, err := os.ReadFile(filepath.Join(m.repo.dir, "rbac", "prod", "role-reader.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `apiVersion: rbac.authorization.k8s.io/v1
+kind: Role
+metadata:
+  name: reader
+  namespace: prod
+rules:
+- apiGroups:
+  - ""
+  resources:
+  - pods
+  verbs:
+  - get
+`
+	if string(data) != want {
+		t.Errorf("role file =\n%s\nwant\n%s", data, want)
+	}
+
+	if got, want := run(t, m.repo.dir, "log", "-1", "--format=%B"), "update_role Role prod/reader\n\nActor: alice\nAudit-Entry: req-1"; got != want {
+		t.Errorf("commit message = %q, want %q", got, want)
+	}
+	if got, want := run(t, m.repo.dir, "log", "-1", "--format=%an <%ae>"), commitAuthorName+" <"+commitAuthorEmail+">"; got != want {
+		t.Errorf("commit author = %q, want %q", got, want)
+	}
+
+	// writing an unchanged object makes no commit
+	m.apply(ctx, change{kind: "Role", namespace: "prod", name: "reader", action: "update_role", actor: "alice"})
+	if got := m.Status().LastCommit; got != status.LastCommit {
+		t.Errorf("unchanged object committed %s", got)
+	}
+
+	// a deleted object's file is removed, and the commit has no audit entry when there was none
+	if err := m.clientset.RbacV1().Roles("prod").Delete(ctx, "reader", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	m.apply(ctx, change{kind: "Role", namespace: "prod", name: "reader", action: "delete_role", actor: "bob"})
+	if _, err := os.Stat(filepath.Join(m.repo.dir, "rbac", "prod", "role-reader.yaml")); !os.IsNotExist(err) {
+		t.Errorf("file of deleted role: %v, want it removed", err)
+	}
+	if got, want := run(t, m.repo.dir, "log", "-1", "--format=%B"), "delete_role Role prod/reader\n\nActor: bob"; got != want {
+		t.Errorf("commit message = %q, want %q", got, want)
+	}
+}
+
+func TestPushRebasesWhenRejected(t *testing.T) {
+	bare := remote(t)
+	m := cloned(t, bare, 1, &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}})
+	ctx := context.Background()
+	m.apply(ctx, change{kind: "ClusterRole", name: "viewer", action: "update_clusterrole", actor: "alice"})
+
+	// someone else pushes meanwhile, changing an unrelated file and the mirror's own
+	other := clone(t, bare)
+	writeFile(t, filepath.Join(other, "README.md"), "RBAC, edited\n")
+	writeFile(t, filepath.Join(other, "rbac", clusterDir, "clusterrole-viewer.yaml"), "edited: by hand\n")
+	run(t, other, "add", "--all")
+	run(t, other, "commit", "--quiet", "--message", "Edit by hand")
+	run(t, other, "push", "--quiet", "origin", "HEAD:refs/heads/main")
+
+	m.push(ctx)
+	status := m.Status()
+	if status.LastPush == nil || !status.LastPush.Success || status.LastPush.Attempts != 2 || status.Unpushed {
+		t.Fatalf("status after push = %+v, want a push succeeding on the second attempt", status)
+	}
+
+	run(t, other, "pull", "--quiet", "origin", "main")
+	if got, want := run(t, other, "log", "--format=%s"), "update_clusterrole ClusterRole viewer\nEdit by hand\nInitial commit"; got != want {
+		t.Errorf("remote history =\n%s\nwant\n%s", got, want)
+	}
+	if data, _ := os.ReadFile(filepath.Join(other, "README.md")); string(data) != "RBAC, edited\n" {
+		t.Errorf("README.md = %q, want the other push's edit kept", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(other, "rbac", clusterDir, "clusterrole-viewer.yaml")); !strings.Contains(string(data), "name: viewer") {
+		t.Errorf("conflicting file = %q, want the mirror's version", data)
+	}
+}
+
+func TestPushGivesUpAfterRetries(t *testing.T) {
+	bare := remote(t)
+	m := cloned(t, bare, 0, &rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "viewer"}})
+	ctx := context.Background()
+	m.apply(ctx, change{kind: "ClusterRole", name: "viewer", action: "update_clusterrole", actor: "alice"})
+
+	other := clone(t, bare)
+	writeFile(t, filepath.Join(other, "README.md"), "RBAC, edited\n")
+	run(t, other, "commit", "--quiet", "--all", "--message", "Edit by hand")
+	run(t, other, "push", "--quiet", "origin", "HEAD:refs/heads/main")
+
+	m.push(ctx)
+	status := m.Status()
+	if status.LastPush == nil || status.LastPush.Success || status.LastPush.Attempts != 1 || status.LastPush.Error == "" {
+		t.Fatalf("last push = %+v, want one failed attempt", status.LastPush)
+	}
+	if !status.Unpushed {
+		t.Error("commits are not marked unpushed after a failed push")
+	}
+}
@@ -0,0 +1,176 @@
+package gitops
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// clusterDir holds cluster-scoped objects; the underscore keeps it from colliding with a namespace.
+const clusterDir = "_cluster"
+
+// lastAppliedAnnotation is kubectl's copy of the applied configuration, which the repository supersedes.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// kinds maps the audited resources to the kinds mirrored.
+var kinds = map[string]string{
+	"roles":               "Role",
+	"rolebindings":        "RoleBinding",
+	"clusterroles":        "ClusterRole",
+	"clusterrolebindings": "ClusterRoleBinding",
+}
+
+// volatileMetadata are the metadata fields the API server maintains, left out of the repository.
+var volatileMetadata = []string{"uid", "resourceVersion", "generation", "creationTimestamp", "managedFields", "selfLink"}
+
+// path returns the file of an object relative to the repository root.
+func (m *Mirror) path(kind, namespace, name string) string {
+	dir := namespace
+	if dir == "" {
+		dir = clusterDir
+	}
+	return filepath.Join(m.config.PathPrefix, dir, strings.ToLower(kind)+"-"+name+".yaml")
+}
+
+// writeObject writes the current state of an object to its file, or removes the file when the object no
+// longer exists.
+func (m *Mirror) writeObject(ctx context.Context, kind, namespace, name string) error {
+	if strings.ContainsAny(namespace+name, `/\`) || namespace == ".." || name == ".." {
+		return fmt.Errorf("invalid object name %q", objectRef(namespace, name))
+	}
+	object, err := m.get(ctx, kind, namespace, name)
+	file := filepath.Join(m.repo.dir, m.path(kind, namespace, name))
+	if apierrors.IsNotFound(err) {
+		if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return writeYAML(file, kind, object)
+}
+
+// writeAll writes every RBAC object and removes the files of objects that no longer exist.
+func (m *Mirror) writeAll(ctx context.Context) error {
+	rbac := m.clientset.RbacV1()
+	written := make(map[string]bool)
+	write := func(kind, namespace, name string, object interface{}) error {
+		relative := m.path(kind, namespace, name)
+		written[relative] = true
+		return writeYAML(filepath.Join(m.repo.dir, relative), kind, object)
+	}
+
+	roles, err := rbac.Roles("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing roles: %w", err)
+	}
+	for i := range roles.Items {
+		if err := write("Role", roles.Items[i].Namespace, roles.Items[i].Name, &roles.Items[i]); err != nil {
+			return err
+		}
+	}
+	bindings, err := rbac.RoleBindings("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing role bindings: %w", err)
+	}
+	for i := range bindings.Items {
+		if err := write("RoleBinding", bindings.Items[i].Namespace, bindings.Items[i].Name, &bindings.Items[i]); err != nil {
+			return err
+		}
+	}
+	clusterRoles, err := rbac.ClusterRoles().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing cluster roles: %w", err)
+	}
+	for i := range clusterRoles.Items {
+		if err := write("ClusterRole", "", clusterRoles.Items[i].Name, &clusterRoles.Items[i]); err != nil {
+			return err
+		}
+	}
+	clusterBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing cluster role bindings: %w", err)
+	}
+	for i := range clusterBindings.Items {
+		if err := write("ClusterRoleBinding", "", clusterBindings.Items[i].Name, &clusterBindings.Items[i]); err != nil {
+			return err
+		}
+	}
+
+	root := filepath.Join(m.repo.dir, m.config.PathPrefix)
+	return filepath.WalkDir(root, func(file string, entry fs.DirEntry, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil || entry.IsDir() || filepath.Ext(file) != ".yaml" {
+			return err
+		}
+		relative, err := filepath.Rel(m.repo.dir, file)
+		if err != nil || written[relative] {
+			return err
+		}
+		return os.Remove(file)
+	})
+}
+
+// get reads an object of one of the mirrored kinds.
+func (m *Mirror) get(ctx context.Context, kind, namespace, name string) (interface{}, error) {
+	rbac := m.clientset.RbacV1()
+	switch kind {
+	case "Role":
+		return rbac.Roles(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "RoleBinding":
+		return rbac.RoleBindings(namespace).Get(ctx, name, metav1.GetOptions{})
+	case "ClusterRole":
+		return rbac.ClusterRoles().Get(ctx, name, metav1.GetOptions{})
+	case "ClusterRoleBinding":
+		return rbac.ClusterRoleBindings().Get(ctx, name, metav1.GetOptions{})
+	}
+	return nil, fmt.Errorf("unsupported kind %q", kind)
+}
+
+// writeYAML writes object to file as YAML, with its type set and the metadata the API server maintains
+// removed, so the file only changes when the object does.
+func writeYAML(file, kind string, object interface{}) error {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	fields["apiVersion"] = rbacv1.SchemeGroupVersion.String()
+	fields["kind"] = kind
+	if metadata, ok := fields["metadata"].(map[string]interface{}); ok {
+		for _, key := range volatileMetadata {
+			delete(metadata, key)
+		}
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+			delete(annotations, lastAppliedAnnotation)
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+
+	out, err := yaml.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, out, 0o644)
+}
@@ -0,0 +1,210 @@
+// Package graph models RBAC as a graph of subjects, roles and namespaces for visualization: subjects are
+// bound to roles, roles grant access in namespaces, and namespaced objects are scoped in their namespace.
+package graph
+
+import (
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Node kinds besides the subject kinds User, Group and ServiceAccount.
+const (
+	KindRole        = "Role"
+	KindClusterRole = "ClusterRole"
+	KindNamespace   = "Namespace"
+)
+
+// Edge types.
+const (
+	// EdgeBoundTo joins a subject to the role a binding grants it.
+	EdgeBoundTo = "bound-to"
+	// EdgeGrants joins a ClusterRole to the namespace a role binding grants it in.
+	EdgeGrants = "grants"
+	// EdgeScopedIn joins a Role or ServiceAccount to its namespace.
+	EdgeScopedIn = "scoped-in"
+)
+
+// Node is a subject, role or namespace.
+type Node struct {
+	ID        string `json:"id"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// BindingRef names the binding an edge comes from.
+type BindingRef struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// Edge joins two nodes by their ids.
+type Edge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+	// Binding is the binding that creates a bound-to or grants edge.
+	Binding *BindingRef `json:"binding,omitempty"`
+}
+
+// Graph is a set of nodes and the edges between them.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+	// Truncated is set when nodes, and the edges reaching them, were left out to stay under a limit.
+	Truncated bool `json:"truncated"`
+}
+
+// NodeID returns the id of the node of kind, name and, for namespaced kinds, namespace.
+func NodeID(kind, namespace, name string) string {
+	if namespace == "" {
+		return kind + ":" + name
+	}
+	return kind + ":" + namespace + "/" + name
+}
+
+// builder collects nodes without duplicates.
+type builder struct {
+	graph *Graph
+	seen  map[string]bool
+}
+
+func (b *builder) node(kind, namespace, name string) string {
+	id := NodeID(kind, namespace, name)
+	if !b.seen[id] {
+		b.seen[id] = true
+		b.graph.Nodes = append(b.graph.Nodes, Node{ID: id, Kind: kind, Name: name, Namespace: namespace})
+		if namespace != "" {
+			b.graph.Edges = append(b.graph.Edges, Edge{From: id, To: b.node(KindNamespace, "", namespace), Type: EdgeScopedIn})
+		}
+	}
+	return id
+}
+
+// subject adds the node of a subject of a binding in bindingNamespace, where service accounts default to.
+func (b *builder) subject(subject rbacv1.Subject, bindingNamespace string) string {
+	switch subject.Kind {
+	case rbacv1.ServiceAccountKind:
+		namespace := subject.Namespace
+		if namespace == "" {
+			namespace = bindingNamespace
+		}
+		return b.node(subject.Kind, namespace, subject.Name)
+	default:
+		return b.node(subject.Kind, "", subject.Name)
+	}
+}
+
+// role adds the node of the role a binding in bindingNamespace references.
+func (b *builder) role(ref rbacv1.RoleRef, bindingNamespace string) string {
+	if ref.Kind == KindClusterRole {
+		return b.node(KindClusterRole, "", ref.Name)
+	}
+	return b.node(KindRole, bindingNamespace, ref.Name)
+}
+
+// Build makes the graph of the given objects in a single pass. Every namespace, role and subject they mention
+// is a node, including roles that are referenced but don't exist. Nodes come in the order Limit keeps them:
+// namespaces, then what bindings join, then unbound roles.
+func Build(namespaces []string, roles []rbacv1.Role, clusterRoles []rbacv1.ClusterRole, roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding) *Graph {
+	b := builder{graph: &Graph{Nodes: []Node{}, Edges: []Edge{}}, seen: make(map[string]bool)}
+	for _, namespace := range namespaces {
+		b.node(KindNamespace, "", namespace)
+	}
+
+	for _, rb := range roleBindings {
+		ref := &BindingRef{Kind: "RoleBinding", Namespace: rb.Namespace, Name: rb.Name}
+		role := b.role(rb.RoleRef, rb.Namespace)
+		if rb.RoleRef.Kind == KindClusterRole {
+			b.graph.Edges = append(b.graph.Edges, Edge{From: role, To: b.node(KindNamespace, "", rb.Namespace), Type: EdgeGrants, Binding: ref})
+		}
+		for _, subject := range rb.Subjects {
+			b.graph.Edges = append(b.graph.Edges, Edge{From: b.subject(subject, rb.Namespace), To: role, Type: EdgeBoundTo, Binding: ref})
+		}
+	}
+	for _, crb := range clusterRoleBindings {
+		ref := &BindingRef{Kind: "ClusterRoleBinding", Name: crb.Name}
+		role := b.role(crb.RoleRef, "")
+		for _, subject := range crb.Subjects {
+			b.graph.Edges = append(b.graph.Edges, Edge{From: b.subject(subject, ""), To: role, Type: EdgeBoundTo, Binding: ref})
+		}
+	}
+
+	for _, role := range roles {
+		b.node(KindRole, role.Namespace, role.Name)
+	}
+	for _, clusterRole := range clusterRoles {
+		b.node(KindClusterRole, "", clusterRole.Name)
+	}
+	return b.graph
+}
+
+// Neighborhood returns the part of g within depth edges of the seed nodes, following edges in either
+// direction, nearest nodes first. Namespaces are not passed through, as nearly everything is scoped in one.
+func (g *Graph) Neighborhood(seeds []string, depth int) *Graph {
+	adjacent := make(map[string][]string)
+	for _, edge := range g.Edges {
+		adjacent[edge.From] = append(adjacent[edge.From], edge.To)
+		adjacent[edge.To] = append(adjacent[edge.To], edge.From)
+	}
+	nodes := make(map[string]Node, len(g.Nodes))
+	for _, node := range g.Nodes {
+		nodes[node.ID] = node
+	}
+
+	// the queue doubles as the visiting order
+	distance := make(map[string]int)
+	var queue []string
+	for _, seed := range seeds {
+		if _, ok := nodes[seed]; ok && !containsKey(distance, seed) {
+			distance[seed] = 0
+			queue = append(queue, seed)
+		}
+	}
+	for i := 0; i < len(queue); i++ {
+		id := queue[i]
+		if distance[id] == depth || (nodes[id].Kind == KindNamespace && distance[id] > 0) {
+			continue
+		}
+		for _, next := range adjacent[id] {
+			if !containsKey(distance, next) {
+				distance[next] = distance[id] + 1
+				queue = append(queue, next)
+			}
+		}
+	}
+
+	out := &Graph{Nodes: make([]Node, 0, len(queue)), Edges: []Edge{}, Truncated: g.Truncated}
+	for _, id := range queue {
+		out.Nodes = append(out.Nodes, nodes[id])
+	}
+	for _, edge := range g.Edges {
+		if containsKey(distance, edge.From) && containsKey(distance, edge.To) {
+			out.Edges = append(out.Edges, edge)
+		}
+	}
+	return out
+}
+
+// Limit returns g with at most maxNodes nodes, the first ones, marking it truncated when any were dropped.
+func (g *Graph) Limit(maxNodes int) *Graph {
+	if len(g.Nodes) <= maxNodes {
+		return g
+	}
+	kept := make(map[string]bool, maxNodes)
+	for _, node := range g.Nodes[:maxNodes] {
+		kept[node.ID] = true
+	}
+	limited := &Graph{Nodes: g.Nodes[:maxNodes], Edges: []Edge{}, Truncated: true}
+	for _, edge := range g.Edges {
+		if kept[edge.From] && kept[edge.To] {
+			limited.Edges = append(limited.Edges, edge)
+		}
+	}
+	return limited
+}
+
+func containsKey(m map[string]int, key string) bool {
+	_, ok := m[key]
+	return ok
+}
@@ -0,0 +1,187 @@
+package graph
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// dotShapes are the Graphviz shapes of each node kind.
+var dotShapes = map[string]string{
+	"User":           "ellipse",
+	"Group":          "doubleoctagon",
+	"ServiceAccount": "hexagon",
+	KindRole:         "box",
+	KindClusterRole:  "box3d",
+	KindNamespace:    "folder",
+}
+
+// sorted returns the nodes and edges of g in a stable order, so renderings of equal graphs are identical.
+func (g *Graph) sorted() ([]Node, []Edge) {
+	nodes := append([]Node{}, g.Nodes...)
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
+
+	edges := append([]Edge{}, g.Edges...)
+	sort.Slice(edges, func(i, j int) bool {
+		a, b := edges[i], edges[j]
+		if a.From != b.From {
+			return a.From < b.From
+		}
+		if a.To != b.To {
+			return a.To < b.To
+		}
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.bindingLabel() < b.bindingLabel()
+	})
+	return nodes, edges
+}
+
+// clusterScoped reports whether the edge comes from a cluster role binding, applying in every namespace.
+func (e Edge) clusterScoped() bool {
+	return e.Binding != nil && e.Binding.Kind == "ClusterRoleBinding"
+}
+
+// bindingLabel names the binding of the edge as Kind namespace/name, or "" when it has none.
+func (e Edge) bindingLabel() string {
+	if e.Binding == nil {
+		return ""
+	}
+	if e.Binding.Namespace == "" {
+		return e.Binding.Kind + " " + e.Binding.Name
+	}
+	return e.Binding.Kind + " " + e.Binding.Namespace + "/" + e.Binding.Name
+}
+
+// RenderDOT renders g in the Graphviz DOT language. Subject kinds are shaped differently and edges from
+// cluster role bindings are dashed.
+func RenderDOT(g *Graph) []byte {
+	nodes, edges := g.sorted()
+
+	var buf bytes.Buffer
+	buf.WriteString("digraph rbac {\n")
+	buf.WriteString("  rankdir=LR;\n")
+	buf.WriteString("  node [fontname=\"Helvetica\", fontsize=10];\n")
+	buf.WriteString("  edge [fontname=\"Helvetica\", fontsize=8];\n")
+	if g.Truncated {
+		buf.WriteString("  label=\"truncated\";\n")
+	}
+	for _, node := range nodes {
+		label := node.Kind + "\n" + node.Name
+		if node.Namespace != "" {
+			label += "\n" + node.Namespace
+		}
+		shape := dotShapes[node.Kind]
+		if shape == "" {
+			shape = "box"
+		}
+		fmt.Fprintf(&buf, "  %s [label=%s, shape=%s];\n", dotID(node.ID), dotID(label), shape)
+	}
+	for _, edge := range edges {
+		attrs := []string{"label=" + dotID(edge.Type)}
+		if binding := edge.bindingLabel(); binding != "" {
+			attrs = append(attrs, "tooltip="+dotID(binding))
+		}
+		if edge.clusterScoped() {
+			attrs = append(attrs, "style=dashed")
+		}
+		fmt.Fprintf(&buf, "  %s -> %s [%s];\n", dotID(edge.From), dotID(edge.To), strings.Join(attrs, ", "))
+	}
+	buf.WriteString("}\n")
+	return buf.Bytes()
+}
+
+// dotID quotes s as a DOT identifier. Backslashes are escaped too, as Graphviz reads escapes such as \N in
+// labels, and newlines become the \n line break.
+func dotID(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+	return `"` + replacer.Replace(s) + `"`
+}
+
+// graphML is the document of a GraphML rendering.
+type graphML struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   graphMLGraph `xml:"graph"`
+}
+
+type graphMLKey struct {
+	ID       string `xml:"id,attr"`
+	For      string `xml:"for,attr"`
+	AttrName string `xml:"attr.name,attr"`
+	AttrType string `xml:"attr.type,attr"`
+}
+
+type graphMLGraph struct {
+	ID          string        `xml:"id,attr"`
+	EdgeDefault string        `xml:"edgedefault,attr"`
+	Data        []graphMLData `xml:"data"`
+	Nodes       []graphMLNode `xml:"node"`
+	Edges       []graphMLEdge `xml:"edge"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	ID     string        `xml:"id,attr"`
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+// RenderGraphML renders g as GraphML, with the kind, name and namespace of nodes and the type and binding of
+// edges as data.
+func RenderGraphML(g *Graph) ([]byte, error) {
+	nodes, edges := g.sorted()
+
+	doc := graphML{
+		Xmlns: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []graphMLKey{
+			{ID: "truncated", For: "graph", AttrName: "truncated", AttrType: "boolean"},
+			{ID: "kind", For: "node", AttrName: "kind", AttrType: "string"},
+			{ID: "name", For: "node", AttrName: "name", AttrType: "string"},
+			{ID: "namespace", For: "node", AttrName: "namespace", AttrType: "string"},
+			{ID: "type", For: "edge", AttrName: "type", AttrType: "string"},
+			{ID: "binding", For: "edge", AttrName: "binding", AttrType: "string"},
+			{ID: "clusterScoped", For: "edge", AttrName: "clusterScoped", AttrType: "boolean"},
+		},
+		Graph: graphMLGraph{
+			ID:          "rbac",
+			EdgeDefault: "directed",
+			Data:        []graphMLData{{Key: "truncated", Value: fmt.Sprint(g.Truncated)}},
+		},
+	}
+	for _, node := range nodes {
+		data := []graphMLData{{Key: "kind", Value: node.Kind}, {Key: "name", Value: node.Name}}
+		if node.Namespace != "" {
+			data = append(data, graphMLData{Key: "namespace", Value: node.Namespace})
+		}
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: node.ID, Data: data})
+	}
+	for i, edge := range edges {
+		data := []graphMLData{{Key: "type", Value: edge.Type}}
+		if binding := edge.bindingLabel(); binding != "" {
+			data = append(data, graphMLData{Key: "binding", Value: binding})
+		}
+		data = append(data, graphMLData{Key: "clusterScoped", Value: fmt.Sprint(edge.clusterScoped())})
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{ID: fmt.Sprintf("e%d", i), Source: edge.From, Target: edge.To, Data: data})
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), append(out, '\n')...), nil
+}
@@ -0,0 +1,108 @@
+package graph
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixture is a small graph with a subject of each kind, a service account named as a user, and a cluster role
+// granted both in a namespace and cluster-wide.
+func fixture() *Graph {
+	roles := []rbacv1.Role{{ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: "prod"}}}
+	clusterRoles := []rbacv1.ClusterRole{{ObjectMeta: metav1.ObjectMeta{Name: "view"}}}
+	roleBindings := []rbacv1.RoleBinding{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "prod"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "deployer"},
+			Subjects: []rbacv1.Subject{
+				{Kind: rbacv1.ServiceAccountKind, Name: "builder"},
+				{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "system:serviceaccount:ci:runner"},
+			},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "viewers", Namespace: "prod"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "alice@example.com"}},
+		},
+	}
+	clusterRoleBindings := []rbacv1.ClusterRoleBinding{{
+		ObjectMeta: metav1.ObjectMeta{Name: "auditors"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+		Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: `team "audit" \ ops`}},
+	}}
+	return Build([]string{"prod"}, roles, clusterRoles, roleBindings, clusterRoleBindings)
+}
+
+// checkGolden compares got with testdata/name, or rewrites the file when -update is set.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs from the golden file; rerun with -update if the change is intended\ngot:\n%s", name, got)
+	}
+}
+
+func TestRenderDOT(t *testing.T) {
+	checkGolden(t, "graph.dot.golden", RenderDOT(fixture()))
+}
+
+func TestRenderGraphML(t *testing.T) {
+	out, err := RenderGraphML(fixture())
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGolden(t, "graph.graphml.golden", out)
+}
+
+func TestRenderTruncated(t *testing.T) {
+	g := fixture().Limit(2)
+	checkGolden(t, "truncated.dot.golden", RenderDOT(g))
+}
+
+func TestRenderIsStable(t *testing.T) {
+	g := fixture()
+	reversed := &Graph{Truncated: g.Truncated}
+	for i := len(g.Nodes) - 1; i >= 0; i-- {
+		reversed.Nodes = append(reversed.Nodes, g.Nodes[i])
+	}
+	for i := len(g.Edges) - 1; i >= 0; i-- {
+		reversed.Edges = append(reversed.Edges, g.Edges[i])
+	}
+	if string(RenderDOT(reversed)) != string(RenderDOT(g)) {
+		t.Error("DOT rendering depends on the order of nodes and edges")
+	}
+}
+
+func TestDotID(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", `"plain"`},
+		{"User:system:serviceaccount:ci:runner", `"User:system:serviceaccount:ci:runner"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\N`, `"C:\\N"`},
+		{"Role\ndeployer\r\nprod", `"Role\ndeployer\nprod"`},
+		{"", `""`},
+	}
+	for _, tt := range tests {
+		if got := dotID(tt.in); got != tt.want {
+			t.Errorf("dotID(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
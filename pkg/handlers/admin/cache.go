@@ -0,0 +1,28 @@
+package admin
+
+import (
+	"net/http"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/listcache"
+
+	"github.com/labstack/echo/v4"
+)
+
+// FlushCacheResponse reports how many cached LIST responses were dropped.
+type FlushCacheResponse struct {
+	Flushed int `json:"flushed"`
+}
+
+// FlushCacheHandler drops every cached LIST response and records the flush in the audit log.
+func FlushCacheHandler(cache *listcache.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		flushed := cache.Flush()
+
+		entry := audit.EntryFromContext(c)
+		entry.Action = "flush_cache"
+		audit.RecordFromHandler(c, entry)
+
+		return c.JSON(http.StatusOK, FlushCacheResponse{Flushed: flushed})
+	}
+}
@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"net/http"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/gitops"
+
+	"github.com/labstack/echo/v4"
+)
+
+// GitSyncResponse reports that a full export to the git mirror was queued.
+type GitSyncResponse struct {
+	Queued bool `json:"queued"`
+}
+
+// GitStatusHandler reports the state of the git mirror, or that it is disabled when mirror is nil.
+func GitStatusHandler(mirror *gitops.Mirror) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if mirror == nil {
+			return c.JSON(http.StatusOK, gitops.Status{Enabled: false})
+		}
+		return c.JSON(http.StatusOK, mirror.Status())
+	}
+}
+
+// GitSyncHandler queues an export of every RBAC object to the git mirror, committed in the name of the
+// caller, and records the request in the audit log.
+func GitSyncHandler(mirror *gitops.Mirror) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if mirror == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "Git mirroring is not configured")
+		}
+
+		entry := audit.EntryFromContext(c)
+		entry.Action = "git_sync"
+		if !mirror.Sync(entry.Actor, entry.RequestID) {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "The git mirror queue is full, try again later")
+		}
+		audit.RecordFromHandler(c, entry)
+
+		return c.JSON(http.StatusAccepted, GitSyncResponse{Queued: true})
+	}
+}
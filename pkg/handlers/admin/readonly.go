@@ -0,0 +1,55 @@
+package admin
+
+import (
+	"net/http"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/readonly"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ReadOnlyRequest switches read-only mode on or off.
+type ReadOnlyRequest struct {
+	Enabled *bool `json:"enabled"`
+	// By names the person enabling the mode; it is shown to anyone whose change is refused.
+	By     string `json:"by"`
+	Reason string `json:"reason"`
+}
+
+// ReadOnlyStatusHandler reports whether read-only mode is on.
+func ReadOnlyStatusHandler(mode *readonly.Mode) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, mode.State())
+	}
+}
+
+// ReadOnlyHandler switches read-only mode and records the change in the audit log.
+func ReadOnlyHandler(mode *readonly.Mode) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		var req ReadOnlyRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid request body: "+err.Error())
+		}
+		if req.Enabled == nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "enabled is required")
+		}
+
+		by := req.By
+		if by == "" {
+			by = "an administrator"
+		}
+		previous := mode.Set(*req.Enabled, by, req.Reason)
+		current := mode.State()
+
+		entry := audit.EntryFromContext(c)
+		entry.Action = "disable_read_only"
+		if current.Enabled {
+			entry.Action = "enable_read_only"
+		}
+		entry.Details = audit.NewDetails(previous, current)
+		audit.RecordFromHandler(c, entry)
+
+		return c.JSON(http.StatusOK, current)
+	}
+}
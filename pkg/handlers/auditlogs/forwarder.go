@@ -0,0 +1,19 @@
+package auditlogs
+
+import (
+	"net/http"
+
+	"rbac/pkg/audit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ForwarderStatusHandler reports the health of the audit forwarder, or that it is disabled when forwarder is nil.
+func ForwarderStatusHandler(forwarder *audit.Forwarder) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if forwarder == nil {
+			return c.JSON(http.StatusOK, audit.ForwarderStatus{Enabled: false})
+		}
+		return c.JSON(http.StatusOK, forwarder.Status())
+	}
+}
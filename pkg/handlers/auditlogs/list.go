@@ -0,0 +1,113 @@
+package auditlogs
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"rbac/pkg/audit"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// defaultPageSize is the number of entries returned when ?limit= is not given.
+	defaultPageSize = 100
+	// maxPageSize bounds ?limit=.
+	maxPageSize = 1000
+)
+
+// Page is a page of retained audit entries, newest first.
+type Page struct {
+	// Total is the number of retained entries matching the filter.
+	Total   int           `json:"total"`
+	Offset  int           `json:"offset"`
+	Limit   int           `json:"limit"`
+	Entries []audit.Entry `json:"entries"`
+	// Retained is the most entries the server keeps, whether they match or not.
+	Retained int `json:"retained"`
+	// Truncated is set once older entries have been dropped to stay within Retained, so Total doesn't count
+	// every matching entry ever recorded.
+	Truncated bool `json:"truncated"`
+}
+
+// ListHandler returns the retained audit entries matching ?category=, ?action=, ?namespace=,
+// ?resourceName=, ?actor=, ?q= and the RFC 3339 range ?from= to ?to=, newest first. ?offset= and ?limit=
+// page through them. Only the stream backlog is kept, so older entries must come from the audit sinks.
+// Object snapshots are omitted unless ?includeDetails=true is set.
+func ListHandler(stream *audit.Stream) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter, err := parseFilter(c)
+		if err != nil {
+			return err
+		}
+		offset, err := pageParam(c, "offset", 0, 0, -1)
+		if err != nil {
+			return err
+		}
+		limit, err := pageParam(c, "limit", defaultPageSize, 1, maxPageSize)
+		if err != nil {
+			return err
+		}
+		includeDetails := c.QueryParam("includeDetails") == "true"
+
+		entries := stream.Entries(filter)
+		retained, truncated := stream.Retention()
+		page := Page{Total: len(entries), Offset: offset, Limit: limit, Entries: []audit.Entry{}, Retained: retained, Truncated: truncated}
+		if offset < len(entries) {
+			entries = entries[offset:min(offset+limit, len(entries))]
+			for _, entry := range entries {
+				if !includeDetails {
+					entry.Details = nil
+				}
+				page.Entries = append(page.Entries, entry)
+			}
+		}
+		return c.JSON(http.StatusOK, page)
+	}
+}
+
+// parseFilter reads the audit filter shared by the list and the stream.
+func parseFilter(c echo.Context) (audit.Filter, error) {
+	filter := audit.Filter{
+		Category:     c.QueryParam("category"),
+		Action:       c.QueryParam("action"),
+		Namespace:    c.QueryParam("namespace"),
+		ResourceName: c.QueryParam("resourceName"),
+		Actor:        c.QueryParam("actor"),
+		Query:        c.QueryParam("q"),
+	}
+	for name, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		value := c.QueryParam(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, name+" must be an RFC 3339 time")
+		}
+		*bound = parsed
+	}
+	if !filter.From.IsZero() && !filter.To.IsZero() && !filter.From.Before(filter.To) {
+		return filter, echo.NewHTTPError(http.StatusBadRequest, "from must be before to")
+	}
+	return filter, nil
+}
+
+// pageParam reads the integer query parameter name, which must lie between min and max; a negative max
+// leaves it unbounded.
+func pageParam(c echo.Context, name string, def, min, max int) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return def, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < min || (max >= 0 && parsed > max) {
+		if max < 0 {
+			return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a number of at least %d", name, min))
+		}
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a number between %d and %d", name, min, max))
+	}
+	return parsed, nil
+}
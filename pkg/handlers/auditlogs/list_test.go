@@ -0,0 +1,115 @@
+package auditlogs
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"rbac/pkg/audit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// list requests target from ListHandler over stream and decodes the page, returning the status.
+func list(t *testing.T, stream *audit.Stream, target string) (int, Page) {
+	t.Helper()
+	e := echo.New()
+	e.GET("/", ListHandler(stream))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	var page Page
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code, page
+}
+
+// filled returns a stream retaining size entries with n written, one a minute from start, alternating between
+// the prod and staging namespaces.
+func filled(size, n int, start time.Time) *audit.Stream {
+	stream := audit.NewStream(size)
+	for i := 0; i < n; i++ {
+		namespace := "prod"
+		if i%2 == 1 {
+			namespace = "staging"
+		}
+		stream.Write(audit.Entry{
+			Time:         start.Add(time.Duration(i) * time.Minute),
+			Action:       "update_role",
+			Namespace:    namespace,
+			ResourceName: fmt.Sprint(i),
+			Details:      &audit.Details{After: json.RawMessage(`{}`)},
+		})
+	}
+	return stream
+}
+
+func TestListPageLimits(t *testing.T) {
+	stream := filled(2000, 1500, time.Now())
+	tests := []struct {
+		target string
+		code   int
+		limit  int
+		count  int
+	}{
+		{"/", http.StatusOK, 100, 100},
+		{"/?limit=1000", http.StatusOK, 1000, 1000},
+		{"/?limit=1001", http.StatusBadRequest, 0, 0},
+		{"/?limit=0", http.StatusBadRequest, 0, 0},
+		{"/?offset=1450&limit=100", http.StatusOK, 100, 50},
+		{"/?offset=2000", http.StatusOK, 100, 0},
+		{"/?offset=-1", http.StatusBadRequest, 0, 0},
+	}
+	for _, tt := range tests {
+		code, page := list(t, stream, tt.target)
+		if code != tt.code || page.Limit != tt.limit || len(page.Entries) != tt.count {
+			t.Errorf("%s: status %d, limit %d, %d entries; want %d, %d, %d", tt.target, code, page.Limit, len(page.Entries), tt.code, tt.limit, tt.count)
+		}
+		if code == http.StatusOK && page.Total != 1500 {
+			t.Errorf("%s: total = %d, want 1500", tt.target, page.Total)
+		}
+	}
+}
+
+func TestListFilters(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	stream := filled(10, 10, start)
+
+	_, page := list(t, stream, "/?namespace=prod&from=2026-01-01T00:02:00Z&to=2026-01-01T00:08:00Z")
+	var names []string
+	for _, entry := range page.Entries {
+		names = append(names, entry.ResourceName)
+		if entry.Details != nil {
+			t.Errorf("entry %s has details without includeDetails", entry.ResourceName)
+		}
+	}
+	if fmt.Sprint(names) != "[6 4 2]" || page.Total != 3 {
+		t.Errorf("entries = %v of %d, want [6 4 2] newest first", names, page.Total)
+	}
+	if _, page := list(t, stream, "/?includeDetails=true&limit=1"); page.Entries[0].Details == nil {
+		t.Error("includeDetails=true dropped the details")
+	}
+
+	for _, target := range []string{"/?from=yesterday", "/?to=2026-01-01", "/?from=2026-01-02T00:00:00Z&to=2026-01-01T00:00:00Z"} {
+		if code, _ := list(t, stream, target); code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", target, code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestListReportsRetention(t *testing.T) {
+	_, page := list(t, filled(10, 4, time.Now()), "/")
+	if page.Retained != 10 || page.Truncated {
+		t.Errorf("retained %d, truncated %v; want 10 without truncation", page.Retained, page.Truncated)
+	}
+
+	_, page = list(t, filled(10, 25, time.Now()), "/?namespace=prod")
+	if page.Retained != 10 || !page.Truncated || page.Total != 5 {
+		t.Errorf("retained %d, truncated %v, total %d; want 10, truncated and the 5 retained prod entries", page.Retained, page.Truncated, page.Total)
+	}
+}
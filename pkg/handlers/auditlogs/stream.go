@@ -0,0 +1,67 @@
+package auditlogs
+
+import (
+	"time"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// StreamHandler pushes audit entries to the client as server-sent events, starting with the retained backlog;
+// ?category=auth selects authentication events, and the filters of ListHandler apply. The stream ends when the
+// client disconnects or done is closed. Object snapshots are omitted unless ?includeDetails=true is set.
+func StreamHandler(stream *audit.Stream, done <-chan struct{}) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		filter, err := parseFilter(c)
+		if err != nil {
+			return err
+		}
+
+		includeDetails := c.QueryParam("includeDetails") == "true"
+
+		backlog, entries, unsubscribe := stream.Subscribe(filter)
+		defer unsubscribe()
+
+		res := c.Response()
+		utils.StartSSE(res)
+
+		for _, entry := range backlog {
+			if err := writeEntry(res, entry, includeDetails); err != nil {
+				return nil
+			}
+		}
+
+		heartbeat := time.NewTicker(utils.SSEHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case <-done:
+				return nil
+			case <-heartbeat.C:
+				if err := utils.WriteSSEHeartbeat(res); err != nil {
+					return nil
+				}
+			case entry, ok := <-entries:
+				if !ok {
+					return nil
+				}
+				if err := writeEntry(res, entry, includeDetails); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// writeEntry sends an audit entry as an SSE event, dropping its details unless requested.
+func writeEntry(res *echo.Response, entry audit.Entry, includeDetails bool) error {
+	if !includeDetails {
+		entry.Details = nil
+	}
+	return utils.WriteSSEEvent(res, "audit", entry)
+}
@@ -0,0 +1,139 @@
+package auditlogs
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"rbac/pkg/audit"
+
+	"github.com/labstack/echo/v4"
+)
+
+// sseClient reads the audit events of a stream.
+type sseClient struct {
+	resp   *http.Response
+	events chan audit.Entry
+}
+
+// subscribe opens the stream at url and reads its events in the background.
+func subscribe(t *testing.T, url string) *sseClient {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	client := &sseClient{resp: resp, events: make(chan audit.Entry, 16)}
+	go func() {
+		defer close(client.events)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var entry audit.Entry
+			if err := json.Unmarshal([]byte(data), &entry); err == nil {
+				client.events <- entry
+			}
+		}
+	}()
+	t.Cleanup(func() { resp.Body.Close() })
+	return client
+}
+
+// next returns the next event, failing when none arrives.
+func (c *sseClient) next(t *testing.T) audit.Entry {
+	t.Helper()
+	select {
+	case entry, ok := <-c.events:
+		if !ok {
+			t.Fatal("stream ended")
+		}
+		return entry
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event received")
+	}
+	return audit.Entry{}
+}
+
+// waitFor polls condition until it holds, failing after a while.
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); !condition(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+}
+
+func TestStreamHandler(t *testing.T) {
+	stream := audit.NewStream(10)
+	stream.Write(audit.Entry{Action: "create", Namespace: "prod", ResourceName: "backlog", Details: &audit.Details{After: json.RawMessage(`{}`)}})
+	done := make(chan struct{})
+	e := echo.New()
+	e.GET("/stream", StreamHandler(stream, done))
+	server := httptest.NewServer(e)
+	defer server.Close()
+
+	prod := subscribe(t, server.URL+"/stream?namespace=prod&includeDetails=true")
+	bob := subscribe(t, server.URL+"/stream?actor=bob")
+	waitFor(t, "both subscribers", func() bool { return stream.Subscribers() == 2 })
+
+	t.Run("backlog replayed", func(t *testing.T) {
+		if entry := prod.next(t); entry.ResourceName != "backlog" || entry.Details == nil {
+			t.Errorf("first prod event = %+v, want the backlog entry with its details", entry)
+		}
+	})
+
+	t.Run("each subscriber gets its own entries", func(t *testing.T) {
+		stream.Write(audit.Entry{Action: "update", Namespace: "staging", Actor: "bob", ResourceName: "bob-staging"})
+		stream.Write(audit.Entry{Action: "update", Namespace: "prod", Actor: "alice", ResourceName: "alice-prod"})
+		stream.Write(audit.Entry{Action: "delete", Namespace: "prod", Actor: "bob", ResourceName: "bob-prod", Details: &audit.Details{Before: json.RawMessage(`{}`)}})
+
+		for _, want := range []string{"alice-prod", "bob-prod"} {
+			if entry := prod.next(t); entry.ResourceName != want {
+				t.Errorf("prod event = %s, want %s", entry.ResourceName, want)
+			}
+		}
+		for _, want := range []string{"bob-staging", "bob-prod"} {
+			entry := bob.next(t)
+			if entry.ResourceName != want {
+				t.Errorf("bob event = %s, want %s", entry.ResourceName, want)
+			}
+			if entry.Details != nil {
+				t.Errorf("bob event %s has details without includeDetails", entry.ResourceName)
+			}
+		}
+	})
+
+	t.Run("disconnect unsubscribes", func(t *testing.T) {
+		bob.resp.Body.Close()
+		waitFor(t, "the disconnected subscriber to go", func() bool { return stream.Subscribers() == 1 })
+	})
+
+	t.Run("shutdown ends the stream", func(t *testing.T) {
+		close(done)
+		waitFor(t, "the stream to end", func() bool { return stream.Subscribers() == 0 })
+		for range prod.events {
+		}
+	})
+}
+
+func TestStreamHandlerRefusesBadFilter(t *testing.T) {
+	stream := audit.NewStream(10)
+	e := echo.New()
+	e.GET("/stream", StreamHandler(stream, nil))
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/stream?from=yesterday", nil))
+	if rec.Code != http.StatusBadRequest || stream.Subscribers() != 0 {
+		t.Errorf("status = %d with %d subscribers, want %d and none", rec.Code, stream.Subscribers(), http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,57 @@
+package lookup
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"rbac/pkg/directory"
+	"rbac/pkg/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	// lookupTimeout bounds a directory search so autocomplete never hangs the UI.
+	lookupTimeout = 5 * time.Second
+	// maxQueryLength bounds the search prefix sent to the directory.
+	maxQueryLength = 256
+)
+
+// GroupsResponse lists directory groups matching a query.
+type GroupsResponse struct {
+	Groups []directory.Group `json:"groups"`
+}
+
+// DirectoryGroupsHandler suggests identity provider groups whose name starts with ?query=. When no directory
+// is configured or it can't be reached, it returns an empty list with a Warning header rather than failing,
+// since suggestions are only an aid to typing a group name.
+func DirectoryGroupsHandler(client directory.Client) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if client == nil {
+			return emptyWithWarning(c, "Directory lookup is not configured")
+		}
+
+		query := strings.TrimSpace(c.QueryParam("query"))
+		if len(query) > maxQueryLength {
+			return echo.NewHTTPError(http.StatusBadRequest, "Query is too long")
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request().Context(), lookupTimeout)
+		defer cancel()
+
+		groups, err := client.SearchGroups(ctx, query)
+		if err != nil {
+			logging.FromContext(c.Request().Context()).Warn("Directory lookup failed", "error", err)
+			return emptyWithWarning(c, "Directory unavailable")
+		}
+		return c.JSON(http.StatusOK, GroupsResponse{Groups: groups})
+	}
+}
+
+// emptyWithWarning responds with no groups and an RFC 7234 miscellaneous warning explaining why.
+func emptyWithWarning(c echo.Context, message string) error {
+	c.Response().Header().Set("Warning", `199 kubeberus "`+message+`"`)
+	return c.JSON(http.StatusOK, GroupsResponse{Groups: []directory.Group{}})
+}
@@ -0,0 +1,131 @@
+package rbac
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"rbac/pkg/httperror"
+	"rbac/pkg/permissions"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// AccessPath is a binding subject through which a rule is granted, with the binding and role.
+type AccessPath struct {
+	// Subject is the identity the binding names: the user, one of their groups or their service account.
+	Subject rbacv1.Subject `json:"subject"`
+	permissions.Grant
+}
+
+// EffectiveRule is a rule a user is granted, with every path that grants it.
+type EffectiveRule struct {
+	// Namespace is where the rule applies; empty means every namespace and the cluster.
+	Namespace string            `json:"namespace,omitempty"`
+	Rule      rbacv1.PolicyRule `json:"rule"`
+	GrantedBy []AccessPath      `json:"grantedBy"`
+}
+
+// EffectiveAccessResponse is everything a user may do, merged across the user and their groups.
+type EffectiveAccessResponse struct {
+	User string `json:"user"`
+	// Groups are the supplied groups and those the API server adds, which bindings were matched against.
+	Groups    []string        `json:"groups"`
+	Namespace string          `json:"namespace,omitempty"`
+	Rules     []EffectiveRule `json:"rules"`
+}
+
+// EffectiveAccessHandler returns the rules ?user= is granted directly, through each of ?groups=
+// (comma-separated) and through the groups the API server adds, such as system:authenticated. A user named
+// system:serviceaccount:<namespace>:<name> also gets the access of that service account. ?namespace=
+// narrows role bindings to one namespace; cluster role bindings always apply.
+func EffectiveAccessHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := c.QueryParam("user")
+		if user == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "user is required")
+		}
+		var supplied []string
+		for _, group := range strings.Split(c.QueryParam("groups"), ",") {
+			if group = strings.TrimSpace(group); group != "" {
+				supplied = append(supplied, group)
+			}
+		}
+		groups := permissions.Groups(user, supplied)
+		namespace := c.QueryParam("namespace")
+
+		snapshot, err := loadPermissions(c, clientset, namespace)
+		if err != nil {
+			return httperror.Wrap(err, "Error loading RBAC objects: ")
+		}
+
+		return c.JSON(http.StatusOK, EffectiveAccessResponse{
+			User:      user,
+			Groups:    groups,
+			Namespace: namespace,
+			Rules:     effectiveRules(snapshot, user, groups),
+		})
+	}
+}
+
+// effectiveRules merges the rules of every binding in snapshot naming user or one of groups. A rule granted
+// several times in the same scope appears once, with each path that grants it. Cluster-wide rules come first.
+func effectiveRules(snapshot *permissions.Snapshot, user string, groups []string) []EffectiveRule {
+	rules := []EffectiveRule{}
+	index := make(map[string]int)
+	add := func(namespace string, subjects []rbacv1.Subject, ref rbacv1.RoleRef, grant permissions.Grant) {
+		var matched []rbacv1.Subject
+		for _, subject := range subjects {
+			if permissions.AppliesTo(subject, namespace, user, groups) {
+				matched = append(matched, subject)
+			}
+		}
+		if len(matched) == 0 {
+			return
+		}
+
+		for _, rule := range snapshot.Rules(namespace, ref) {
+			// non-resource URLs are not namespaced, so role bindings don't grant them
+			if namespace != "" && len(rule.NonResourceURLs) > 0 {
+				continue
+			}
+			encoded, _ := json.Marshal(rule)
+			key := namespace + "\x00" + string(encoded)
+			i, ok := index[key]
+			if !ok {
+				i = len(rules)
+				index[key] = i
+				rules = append(rules, EffectiveRule{Namespace: namespace, Rule: rule})
+			}
+			for _, subject := range matched {
+				rules[i].GrantedBy = append(rules[i].GrantedBy, AccessPath{Subject: subject, Grant: grant})
+			}
+		}
+	}
+
+	for _, crb := range snapshot.ClusterRoleBindings {
+		add("", crb.Subjects, crb.RoleRef, permissions.Grant{
+			BindingKind: "ClusterRoleBinding",
+			BindingName: crb.Name,
+			RoleKind:    crb.RoleRef.Kind,
+			RoleName:    crb.RoleRef.Name,
+		})
+	}
+	for _, rb := range snapshot.RoleBindings {
+		add(rb.Namespace, rb.Subjects, rb.RoleRef, permissions.Grant{
+			BindingKind:      "RoleBinding",
+			BindingNamespace: rb.Namespace,
+			BindingName:      rb.Name,
+			RoleKind:         rb.RoleRef.Kind,
+			RoleName:         rb.RoleRef.Name,
+		})
+	}
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		return rules[i].Namespace < rules[j].Namespace
+	})
+	return rules
+}
@@ -0,0 +1,80 @@
+package rbac
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// bindingFilter narrows a list of bindings to those referencing a role and naming a subject. Empty fields
+// match anything.
+type bindingFilter struct {
+	roleName    string
+	roleKind    string
+	subjectKind string
+	subjectName string
+	// subjectContains is a substring of the subject's name, compared ignoring case and lowercased here.
+	subjectContains string
+	// expired, when set, keeps only bindings whose expiry has or hasn't passed.
+	expired *bool
+}
+
+// parseBindingFilter reads ?roleName=, ?roleKind=, ?subjectKind=, ?subjectName=, ?subjectContains= and
+// ?expired=.
+func parseBindingFilter(c echo.Context) (bindingFilter, error) {
+	filter := bindingFilter{
+		roleName:        c.QueryParam("roleName"),
+		subjectName:     c.QueryParam("subjectName"),
+		subjectContains: strings.ToLower(c.QueryParam("subjectContains")),
+	}
+
+	switch kind := c.QueryParam("roleKind"); kind {
+	case "", "Role", "ClusterRole":
+		filter.roleKind = kind
+	default:
+		return filter, echo.NewHTTPError(http.StatusBadRequest, "roleKind must be Role or ClusterRole")
+	}
+
+	if kind := c.QueryParam("subjectKind"); kind != "" {
+		canonical, ok := subjectKinds[strings.ToLower(kind)]
+		if !ok {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "Unknown subject kind "+kind+", expected User, Group or ServiceAccount")
+		}
+		filter.subjectKind = canonical
+	}
+
+	if value := c.QueryParam("expired"); value != "" {
+		expired, err := strconv.ParseBool(value)
+		if err != nil {
+			return filter, echo.NewHTTPError(http.StatusBadRequest, "expired must be true or false")
+		}
+		filter.expired = &expired
+	}
+	return filter, nil
+}
+
+// matches reports whether a binding with roleRef and subjects passes the filter. With several subject filters
+// set, a single subject must match all of them.
+func (f bindingFilter) matches(roleRef rbacv1.RoleRef, subjects []rbacv1.Subject) bool {
+	if (f.roleName != "" && roleRef.Name != f.roleName) || (f.roleKind != "" && roleRef.Kind != f.roleKind) {
+		return false
+	}
+	if f.subjectKind == "" && f.subjectName == "" && f.subjectContains == "" {
+		return true
+	}
+	for _, subject := range subjects {
+		if (f.subjectKind == "" || subject.Kind == f.subjectKind) && (f.subjectName == "" || subject.Name == f.subjectName) &&
+			strings.Contains(strings.ToLower(subject.Name), f.subjectContains) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesStatus reports whether a binding with status passes the expiry filter.
+func (f bindingFilter) matchesStatus(status BindingStatus) bool {
+	return f.expired == nil || status.Expired == *f.expired
+}
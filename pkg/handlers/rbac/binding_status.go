@@ -0,0 +1,87 @@
+package rbac
+
+import (
+	"net/http"
+	"time"
+
+	"rbac/pkg/expiry"
+	"rbac/pkg/listing"
+	"rbac/pkg/managed"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// BindingStatus is what the labels and annotations of a binding say about its lifetime and owner.
+type BindingStatus struct {
+	// ExpiresAt is when the binding is removed, or null when it is permanent.
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// Expired is set once ExpiresAt has passed and the binding is waiting to be removed.
+	Expired   bool   `json:"expired"`
+	ManagedBy string `json:"managedBy"`
+	CreatedBy string `json:"createdBy"`
+	// Warnings describe annotations that are present but ignored, such as a malformed expiry.
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// RoleBindingWithStatus is a role binding with its expiry and ownership.
+type RoleBindingWithStatus struct {
+	rbacv1.RoleBinding
+	BindingStatus
+}
+
+// ClusterRoleBindingWithStatus is a cluster role binding with its expiry and ownership.
+type ClusterRoleBindingWithStatus struct {
+	rbacv1.ClusterRoleBinding
+	BindingStatus
+}
+
+// BindingList is a Kubernetes binding list whose items carry their status.
+type BindingList[T any] struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []T `json:"items"`
+}
+
+// bindingStatus derives the status of a binding from its metadata at now.
+func bindingStatus(meta metav1.ObjectMeta, now time.Time) BindingStatus {
+	status := BindingStatus{
+		ManagedBy: managed.Owner(meta),
+		CreatedBy: meta.Annotations[managed.CreatedByAnnotation],
+	}
+	expiresAt, warning := expiry.Inspect(meta)
+	if expiresAt != nil {
+		status.ExpiresAt = expiresAt
+		status.Expired = !expiresAt.After(now)
+	}
+	if warning != "" {
+		status.Warnings = append(status.Warnings, warning)
+	}
+	return status
+}
+
+// respondBindings writes bindings taken from a Kubernetes list, in the shape of that list under /api and in
+// the list envelope, with the warnings of every item, under /api/v2.
+func respondBindings[T any](c echo.Context, list BindingList[T], warnings []string) error {
+	if listing.Enveloped(c) {
+		return listing.Respond(c, list.Items, listing.Meta{Continue: list.Continue, Warnings: warnings})
+	}
+	if list.Items == nil {
+		list.Items = []T{}
+	}
+	return c.JSON(http.StatusOK, list)
+}
+
+// statusWarnings prefixes the warnings of a binding's status with the binding they concern.
+func statusWarnings(meta metav1.ObjectMeta, status BindingStatus) []string {
+	name := meta.Name
+	if meta.Namespace != "" {
+		name = meta.Namespace + "/" + name
+	}
+	var warnings []string
+	for _, warning := range status.Warnings {
+		warnings = append(warnings, name+": "+warning)
+	}
+	return warnings
+}
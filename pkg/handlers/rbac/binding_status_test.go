@@ -0,0 +1,205 @@
+package rbac
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"rbac/pkg/expiry"
+	"rbac/pkg/listing"
+	"rbac/pkg/managed"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// expiringMeta returns metadata managed by manager, or unmanaged when it is empty, expiring at value unless
+// it is empty.
+func expiringMeta(namespace, name, manager, value string) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{Name: name, Namespace: namespace}
+	if manager != "" {
+		meta.Labels = map[string]string{managed.Label: manager}
+	}
+	if value != "" {
+		meta.Annotations = map[string]string{expiry.Annotation: value}
+	}
+	return meta
+}
+
+func TestBindingStatus(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		value   string
+		manager string
+		expires bool
+		expired bool
+		warning string
+	}{
+		{name: "permanent", manager: managed.Value},
+		{name: "future", value: "2024-05-01T12:00:01Z", manager: managed.Value, expires: true},
+		{name: "now", value: "2024-05-01T12:00:00Z", manager: managed.Value, expires: true, expired: true},
+		{name: "past", value: "2024-04-30T12:00:00Z", manager: managed.Value, expires: true, expired: true},
+		{name: "malformed", value: "tomorrow", manager: managed.Value, warning: "is not an RFC 3339 time"},
+		{name: "unmanaged", value: "2024-04-30T12:00:00Z", warning: "not managed by k-rbac"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			meta := expiringMeta("prod", "temp", tt.manager, tt.value)
+			status := bindingStatus(meta, now)
+			if (status.ExpiresAt != nil) != tt.expires || status.Expired != tt.expired {
+				t.Errorf("expiresAt = %v, expired = %v, want expiring %v, expired %v", status.ExpiresAt, status.Expired, tt.expires, tt.expired)
+			}
+			if status.ManagedBy != tt.manager {
+				t.Errorf("managedBy = %q, want %q", status.ManagedBy, tt.manager)
+			}
+			if data, _ := json.Marshal(status); !tt.expires && !strings.Contains(string(data), `"expiresAt":null`) {
+				t.Errorf("status = %s, want a null expiresAt", data)
+			}
+
+			warnings := statusWarnings(meta, status)
+			if tt.warning == "" {
+				if len(warnings) != 0 {
+					t.Errorf("warnings = %q, want none", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || !strings.HasPrefix(warnings[0], "prod/temp: "+expiry.Annotation) || !strings.Contains(warnings[0], tt.warning) {
+				t.Errorf("warnings = %q, want one for prod/temp mentioning %q", warnings, tt.warning)
+			}
+		})
+	}
+}
+
+// expiringBindings is a cluster with role bindings in prod and cluster role bindings that are expired,
+// expiring, permanent, annotated with a malformed expiry, or annotated but owned by another tool.
+func expiringBindings() *fake.Clientset {
+	past := time.Now().Add(-time.Hour).UTC().Format(time.RFC3339)
+	future := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	metas := []struct{ name, manager, value string }{
+		{"expired", managed.Value, past},
+		{"expiring", managed.Value, future},
+		{"permanent", managed.Value, ""},
+		{"malformed", managed.Value, "tomorrow"},
+		{"foreign", "argocd", past},
+	}
+	var objects []runtime.Object
+	for _, m := range metas {
+		roleRef := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"}
+		objects = append(objects,
+			&rbacv1.RoleBinding{ObjectMeta: expiringMeta("prod", m.name, m.manager, m.value), RoleRef: roleRef},
+			&rbacv1.ClusterRoleBinding{ObjectMeta: expiringMeta("", m.name, m.manager, m.value), RoleRef: roleRef})
+	}
+	return fake.NewSimpleClientset(objects...)
+}
+
+// bindingItem is the part of a listed binding the tests look at.
+type bindingItem struct {
+	Metadata  metav1.ObjectMeta `json:"metadata"`
+	ExpiresAt *time.Time        `json:"expiresAt"`
+	Expired   bool              `json:"expired"`
+	ManagedBy string            `json:"managedBy"`
+}
+
+// listBindings lists bindings through the router, in the /api or the enveloped /api/v2 shape, returning
+// the items listed and the warnings of the envelope.
+func listBindings(t *testing.T, clientset *fake.Clientset, v2 bool, target string) ([]bindingItem, []string) {
+	t.Helper()
+	e := echo.New()
+	api := e.Group("/api")
+	if v2 {
+		api = e.Group("/api/v2", listing.Middleware())
+	}
+	api.GET("/rolebindings", RoleBindingsHandler(clientset))
+	api.GET("/clusterrolebindings", ClusterRoleBindingsHandler(clientset))
+	prefix := "/api"
+	if v2 {
+		prefix = "/api/v2"
+	}
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, prefix+target, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	var list struct {
+		Items    []bindingItem `json:"items"`
+		Warnings []string      `json:"warnings"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if list.Items == nil {
+		t.Errorf("items = null, want a list")
+	}
+	return list.Items, list.Warnings
+}
+
+func TestBindingListFilters(t *testing.T) {
+	clientset := expiringBindings()
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"expired", "expiring", "foreign", "malformed", "permanent"}},
+		{"expired=true", []string{"expired"}},
+		{"expired=false", []string{"expiring", "foreign", "malformed", "permanent"}},
+		{"managedBy=argocd", []string{"foreign"}},
+		{"managedBy=k-rbac&expired=false", []string{"expiring", "malformed", "permanent"}},
+		{"managedOnly=true&expired=true", []string{"expired"}},
+	}
+	for _, resource := range []string{"/rolebindings?namespace=prod&", "/clusterrolebindings?"} {
+		for _, v2 := range []bool{false, true} {
+			for _, tt := range tests {
+				items, _ := listBindings(t, clientset, v2, resource+tt.query)
+				var names []string
+				for _, item := range items {
+					names = append(names, item.Metadata.Name)
+				}
+				if !slices.Equal(names, tt.want) {
+					t.Errorf("%s%s (v2 %v) listed %v, want %v", resource, tt.query, v2, names, tt.want)
+				}
+			}
+		}
+	}
+}
+
+func TestBindingListStatus(t *testing.T) {
+	clientset := expiringBindings()
+	tests := []struct {
+		target string
+		prefix string
+	}{
+		{"/rolebindings?namespace=prod", "prod/"},
+		{"/clusterrolebindings", ""},
+	}
+	for _, tt := range tests {
+		for _, v2 := range []bool{false, true} {
+			items, warnings := listBindings(t, clientset, v2, tt.target)
+			for _, item := range items {
+				expires := item.Metadata.Name == "expired" || item.Metadata.Name == "expiring"
+				if (item.ExpiresAt != nil) != expires || item.Expired != (item.Metadata.Name == "expired") {
+					t.Errorf("%s (v2 %v) %s: expiresAt = %v, expired = %v", tt.target, v2, item.Metadata.Name, item.ExpiresAt, item.Expired)
+				}
+			}
+
+			if !v2 {
+				continue
+			}
+			want := []string{
+				tt.prefix + "foreign: " + expiry.Annotation + " is ignored as the object is not managed by k-rbac",
+				tt.prefix + "malformed: " + expiry.Annotation + ` "tomorrow" is not an RFC 3339 time and is ignored`,
+			}
+			if !slices.Equal(warnings, want) {
+				t.Errorf("%s warnings = %q, want %q", tt.target, warnings, want)
+			}
+		}
+	}
+}
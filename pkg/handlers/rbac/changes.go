@@ -0,0 +1,54 @@
+package rbac
+
+import (
+	"net/http"
+	"strconv"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/httperror"
+	"rbac/pkg/watch"
+
+	"github.com/labstack/echo/v4"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// dryRunOption returns the dry-run option of the request: with ?dryRun=true the change is only submitted
+// to the API server as a server-side dry run, and left out of the audit log since nothing changes.
+func dryRunOption(c echo.Context) ([]string, error) {
+	value := c.QueryParam("dryRun")
+	if value == "" {
+		return nil, nil
+	}
+	dryRun, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "dryRun must be true or false")
+	}
+	if !dryRun {
+		return nil, nil
+	}
+	audit.Skip(c)
+	return []string{metav1.DryRunAll}, nil
+}
+
+// annotateChange attaches the mutated object's identity and before/after state to the request's audit entry.
+func annotateChange(c echo.Context, namespace, name string, before, after interface{}) {
+	audit.Annotate(c, namespace, name, snapshot(before), snapshot(after))
+}
+
+// snapshot returns the compact projection of an RBAC object, or nil if there is none.
+func snapshot(obj interface{}) interface{} {
+	if lite, ok := watch.ToLite(obj); ok {
+		return lite
+	}
+	return nil
+}
+
+// existingError checks the read of the object a change targets, whose state the protection and ownership
+// checks rely on. Only NotFound lets the change go ahead, so a failed read can't skip the checks.
+func existingError(err error, kind string) error {
+	if err == nil || apierrors.IsNotFound(err) {
+		return nil
+	}
+	return httperror.Wrap(err, "Error reading "+kind+" before changing it: ")
+}
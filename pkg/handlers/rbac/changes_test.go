@@ -0,0 +1,210 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rbac/pkg/managed"
+	"rbac/pkg/protection"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// serveChange sends a change to handler behind the protection guard and any further middleware, and returns
+// the response.
+func serveChange(t *testing.T, handler echo.HandlerFunc, method, target, body string, middleware ...echo.MiddlewareFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	guard, err := protection.New(nil, "admin-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := echo.New()
+	e.Any("/", handler, append([]echo.MiddlewareFunc{guard.Middleware()}, middleware...)...)
+
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// failGets makes every get on clientset fail with err.
+func failGets(clientset *fake.Clientset, err error) {
+	clientset.PrependReactor("get", "*", func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, err
+	})
+}
+
+// changed reports whether clientset received an update or delete.
+func changed(clientset *fake.Clientset) bool {
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "update" || action.GetVerb() == "delete" {
+			return true
+		}
+	}
+	return false
+}
+
+// changeCases are an update and a delete through each handler whose changes are guarded.
+var changeCases = []struct {
+	name    string
+	handler func(kubernetes.Interface) echo.HandlerFunc
+	method  string
+	target  string
+	body    string
+}{
+	{"update role", RolesHandler, http.MethodPut, "/?namespace=prod", `{"metadata":{"name":"deployer","namespace":"prod"},"rules":[{"apiGroups":["apps"],"resources":["deployments"],"verbs":["get"]}]}`},
+	{"delete role", RolesHandler, http.MethodDelete, "/?namespace=prod&name=deployer", ""},
+	{"update cluster role", ClusterRolesHandler, http.MethodPut, "/", `{"metadata":{"name":"admin"},"rules":[{"apiGroups":[""],"resources":["pods"],"verbs":["get"]}]}`},
+	{"delete cluster role", ClusterRolesHandler, http.MethodDelete, "/?name=admin", ""},
+	{"update role binding", RoleBindingsHandler, http.MethodPut, "/?namespace=prod", `{"metadata":{"name":"ci","namespace":"prod"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"Role","name":"deployer"},"subjects":[{"kind":"User","name":"alice"}]}`},
+	{"delete role binding", RoleBindingsHandler, http.MethodDelete, "/?namespace=prod&name=ci", ""},
+	{"update cluster role binding", ClusterRoleBindingsHandler, http.MethodPut, "/", `{"metadata":{"name":"admins"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"ClusterRole","name":"admin"},"subjects":[{"kind":"Group","name":"ops"}]}`},
+	{"delete cluster role binding", ClusterRoleBindingsHandler, http.MethodDelete, "/?name=admins", ""},
+	{"delete namespace", NamespacesHandler, http.MethodDelete, "/?name=prod", ""},
+	{"delete service account", ServiceAccountsHandler, http.MethodDelete, "/?namespace=prod&name=ci", ""},
+}
+
+func TestChangeRefusedWhenExistingUnreadable(t *testing.T) {
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Group: rbacv1.GroupName, Resource: "roles"}, "", nil)
+	unavailable := apierrors.NewServiceUnavailable("etcd is unavailable")
+
+	for _, tc := range changeCases {
+		for _, failure := range []struct {
+			err  error
+			code int
+		}{{forbidden, http.StatusForbidden}, {unavailable, http.StatusServiceUnavailable}} {
+			t.Run(tc.name, func(t *testing.T) {
+				clientset := fake.NewSimpleClientset()
+				failGets(clientset, failure.err)
+
+				rec := serveChange(t, tc.handler(clientset), tc.method, tc.target, tc.body)
+				if rec.Code != failure.code {
+					t.Errorf("status = %d, want %d: %s", rec.Code, failure.code, rec.Body)
+				}
+				if changed(clientset) {
+					t.Error("change was sent although the existing object couldn't be read")
+				}
+			})
+		}
+	}
+}
+
+func TestChangeAllowedWhenExistingNotFound(t *testing.T) {
+	for _, tc := range changeCases {
+		t.Run(tc.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset()
+
+			serveChange(t, tc.handler(clientset), tc.method, tc.target, tc.body)
+			if !changed(clientset) {
+				t.Error("change was not sent for an object that doesn't exist yet")
+			}
+		})
+	}
+}
+
+func TestChangeRefusedForDefaultRBACObject(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{
+		Name:   "admin",
+		Labels: map[string]string{"kubernetes.io/bootstrapping": "rbac-defaults"},
+	}})
+
+	rec := serveChange(t, ClusterRolesHandler(clientset), http.MethodDelete, "/?name=admin", "")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusForbidden, rec.Body)
+	}
+	if changed(clientset) {
+		t.Error("default RBAC object was deleted")
+	}
+}
+
+// roleBindingUpdate is the body of an update to the prod role binding ci.
+const roleBindingUpdate = `{"metadata":{"name":"ci","namespace":"prod"},"roleRef":{"apiGroup":"rbac.authorization.k8s.io","kind":"Role","name":"deployer"},"subjects":[{"kind":"User","name":"bob"}]}`
+
+// managedRoleBinding returns the prod role binding ci, managed by manager on behalf of creator.
+func managedRoleBinding(manager, creator string) *rbacv1.RoleBinding {
+	return &rbacv1.RoleBinding{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "ci",
+			Namespace:   "prod",
+			Labels:      map[string]string{managed.Label: manager},
+			Annotations: map[string]string{managed.CreatedByAnnotation: creator},
+		},
+		RoleRef:  rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "deployer"},
+		Subjects: []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}},
+	}
+}
+
+func TestForeignChangeRefused(t *testing.T) {
+	clientset := fake.NewSimpleClientset(managedRoleBinding("argocd", ""))
+
+	rec := serveChange(t, RoleBindingsHandler(clientset), http.MethodPut, "/?namespace=prod", roleBindingUpdate, managed.Middleware(true))
+	if rec.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusConflict, rec.Body)
+	}
+	if changed(clientset) {
+		t.Error("binding managed by argocd was updated")
+	}
+}
+
+func TestForeignChangeRefusedWhenExistingUnreadable(t *testing.T) {
+	clientset := fake.NewSimpleClientset(managedRoleBinding("argocd", ""))
+	failGets(clientset, apierrors.NewTimeoutError("slow API server", 1))
+
+	rec := serveChange(t, RoleBindingsHandler(clientset), http.MethodPut, "/?namespace=prod", roleBindingUpdate, managed.Middleware(true))
+	if rec.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusGatewayTimeout, rec.Body)
+	}
+	if changed(clientset) {
+		t.Error("binding managed by argocd was updated without reading it")
+	}
+}
+
+func TestForeignChangeWarned(t *testing.T) {
+	clientset := fake.NewSimpleClientset(managedRoleBinding("argocd", ""))
+
+	rec := serveChange(t, RoleBindingsHandler(clientset), http.MethodPut, "/?namespace=prod", roleBindingUpdate, managed.Middleware(false))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if rec.Header().Get("Warning") == "" {
+		t.Error("no Warning header for a binding managed by argocd")
+	}
+	updated, err := clientset.RbacV1().RoleBindings("prod").Get(context.Background(), "ci", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := managed.Owner(updated.ObjectMeta); owner != "" {
+		t.Errorf("updated binding is managed by %q; the update carries no label and must not adopt it", owner)
+	}
+}
+
+func TestManagedChangeKeepsCreator(t *testing.T) {
+	clientset := fake.NewSimpleClientset(managedRoleBinding(managed.Value, "alice"))
+
+	rec := serveChange(t, RoleBindingsHandler(clientset), http.MethodPut, "/?namespace=prod", roleBindingUpdate, managed.Middleware(true))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	updated, err := clientset.RbacV1().RoleBindings("prod").Get(context.Background(), "ci", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if owner := managed.Owner(updated.ObjectMeta); owner != managed.Value {
+		t.Errorf("owner = %q, want %q", owner, managed.Value)
+	}
+	if creator := updated.Annotations[managed.CreatedByAnnotation]; creator != "alice" {
+		t.Errorf("creator = %q, want alice", creator)
+	}
+}
@@ -1,9 +1,15 @@
 package rbac
 
 import (
-	"context"
 	"net/http"
+	"rbac/pkg/audit"
+	"rbac/pkg/expiry"
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
+	"rbac/pkg/managed"
+	"rbac/pkg/protection"
 	"rbac/pkg/utils"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -12,9 +18,9 @@ import (
 )
 
 // ClusterRoleBindingsHandler handles requests related to cluster role bindings.
-func ClusterRoleBindingsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func ClusterRoleBindingsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		handlers := map[string]func(echo.Context, *kubernetes.Clientset, string) error{
+		handlers := map[string]func(echo.Context, kubernetes.Interface, string) error{
 			http.MethodGet:    handleListClusterRoleBindings,
 			http.MethodPost:   handleCreateClusterRoleBinding,
 			http.MethodPut:    handleUpdateClusterRoleBinding,
@@ -25,48 +31,140 @@ func ClusterRoleBindingsHandler(clientset *kubernetes.Clientset) echo.HandlerFun
 	}
 }
 
-// handleListClusterRoleBindings lists all cluster role bindings.
-func handleListClusterRoleBindings(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
-	return utils.ListResources(c, clientset, "", func(namespace string, opts metav1.ListOptions) (interface{}, error) {
-		return clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), opts)
-	})
+// handleListClusterRoleBindings lists all cluster role bindings with their expiry and ownership, narrowed by
+// ?roleName=, ?roleKind=, ?subjectKind=, ?subjectName=, ?subjectContains= and ?expired=. Bindings are filtered
+// after paging, so a page may hold fewer than ?limit=.
+func handleListClusterRoleBindings(c echo.Context, clientset kubernetes.Interface, _ string) error {
+	filter, err := parseBindingFilter(c)
+	if err != nil {
+		return err
+	}
+	opts, order, err := utils.ListOptions(c)
+	if err != nil {
+		return err
+	}
+
+	list, err := clientset.RbacV1().ClusterRoleBindings().List(c.Request().Context(), opts)
+	if err != nil {
+		return httperror.Wrap(err, "Error listing cluster role bindings: ")
+	}
+
+	listing.Sort(list.Items, order, func(binding *rbacv1.ClusterRoleBinding) metav1.Object { return binding })
+	now := time.Now()
+	result := BindingList[ClusterRoleBindingWithStatus]{TypeMeta: list.TypeMeta, ListMeta: list.ListMeta}
+	var warnings []string
+	for _, crb := range list.Items {
+		status := bindingStatus(crb.ObjectMeta, now)
+		if !filter.matches(crb.RoleRef, crb.Subjects) || !filter.matchesStatus(status) {
+			continue
+		}
+		result.Items = append(result.Items, ClusterRoleBindingWithStatus{ClusterRoleBinding: crb, BindingStatus: status})
+		warnings = append(warnings, statusWarnings(crb.ObjectMeta, status)...)
+	}
+	return respondBindings(c, result, warnings)
 }
 
 // handleCreateClusterRoleBinding creates a new cluster role binding.
-func handleCreateClusterRoleBinding(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+func handleCreateClusterRoleBinding(c echo.Context, clientset kubernetes.Interface, _ string) error {
+	expiresAt, err := expiry.Parse(c.QueryParam("expiresAt"), c.QueryParam("expiresIn"), time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid expiry: "+err.Error())
+	}
+	dryRun, err := dryRunOption(c)
+	if err != nil {
+		return err
+	}
+
 	var clusterRoleBinding rbacv1.ClusterRoleBinding
 	return utils.CreateResource(c, clientset, "", &clusterRoleBinding, func(namespace string, obj interface{}, opts metav1.CreateOptions) (interface{}, error) {
-		return clientset.RbacV1().ClusterRoleBindings().Create(context.TODO(), obj.(*rbacv1.ClusterRoleBinding), opts)
+		binding := obj.(*rbacv1.ClusterRoleBinding)
+		if err := utils.ValidateClusterRoleBinding(binding); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid cluster role binding: "+err.Error())
+		}
+		opts.DryRun = dryRun
+		managed.Stamp(&binding.ObjectMeta, audit.Actor(c))
+		if expiresAt != nil {
+			expiry.Stamp(&binding.ObjectMeta, *expiresAt)
+		}
+		created, err := clientset.RbacV1().ClusterRoleBindings().Create(c.Request().Context(), binding, opts)
+		if err == nil {
+			annotateChange(c, "", created.Name, nil, created)
+		}
+		return created, err
 	})
 }
 
 // handleUpdateClusterRoleBinding updates an existing cluster role binding.
-func handleUpdateClusterRoleBinding(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+func handleUpdateClusterRoleBinding(c echo.Context, clientset kubernetes.Interface, _ string) error {
+	dryRun, err := dryRunOption(c)
+	if err != nil {
+		return err
+	}
+
 	var clusterRoleBinding rbacv1.ClusterRoleBinding
 	return utils.UpdateResource(c, clientset, "", &clusterRoleBinding, func(namespace string, obj interface{}, opts metav1.UpdateOptions) (interface{}, error) {
-		return clientset.RbacV1().ClusterRoleBindings().Update(context.TODO(), obj.(*rbacv1.ClusterRoleBinding), opts)
+		desired := obj.(*rbacv1.ClusterRoleBinding)
+		if err := utils.ValidateClusterRoleBinding(desired); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid cluster role binding: "+err.Error())
+		}
+		opts.DryRun = dryRun
+		existing, err := clientset.RbacV1().ClusterRoleBindings().Get(c.Request().Context(), desired.Name, metav1.GetOptions{})
+		if err := existingError(err, "cluster role binding"); err != nil {
+			return nil, err
+		}
+		if err := protection.Check(c, desired.Name, existing.ObjectMeta); err != nil {
+			return nil, err
+		}
+		if err := managed.CheckConflict(c, existing.ObjectMeta); err != nil {
+			return nil, err
+		}
+		managed.Adopt(&desired.ObjectMeta, existing.ObjectMeta, audit.Actor(c))
+		updated, err := clientset.RbacV1().ClusterRoleBindings().Update(c.Request().Context(), desired, opts)
+		if err == nil {
+			annotateChange(c, "", updated.Name, existing, updated)
+		}
+		return updated, err
 	})
 }
 
 // handleDeleteClusterRoleBinding deletes a cluster role binding by name.
-func handleDeleteClusterRoleBinding(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+func handleDeleteClusterRoleBinding(c echo.Context, clientset kubernetes.Interface, _ string) error {
 	name := c.QueryParam("name")
+	dryRun, err := dryRunOption(c)
+	if err != nil {
+		return err
+	}
 	return utils.DeleteResource(c, clientset, "", name, func(namespace, name string, opts metav1.DeleteOptions) error {
-		return clientset.RbacV1().ClusterRoleBindings().Delete(context.TODO(), name, opts)
+		existing, err := clientset.RbacV1().ClusterRoleBindings().Get(c.Request().Context(), name, metav1.GetOptions{})
+		if err := existingError(err, "cluster role binding"); err != nil {
+			return err
+		}
+		if err := protection.Check(c, name, existing.ObjectMeta); err != nil {
+			return err
+		}
+		opts.DryRun = dryRun
+		if err := managed.CheckConflict(c, existing.ObjectMeta); err != nil {
+			return err
+		}
+		if err := clientset.RbacV1().ClusterRoleBindings().Delete(c.Request().Context(), name, opts); err != nil {
+			return err
+		}
+		annotateChange(c, "", name, existing, nil)
+		return nil
 	})
 }
 
 // ClusterRoleBindingDetailsHandler handles fetching detailed information about a specific cluster role binding.
-func ClusterRoleBindingDetailsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func ClusterRoleBindingDetailsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		clusterRoleBindingName := c.QueryParam("name")
 		if clusterRoleBindingName == "" {
 			return echo.NewHTTPError(http.StatusBadRequest, "Cluster role binding name is required")
 		}
 
-		clusterRoleBinding, err := clientset.RbacV1().ClusterRoleBindings().Get(context.TODO(), clusterRoleBindingName, metav1.GetOptions{})
+		clusterRoleBinding, err := clientset.RbacV1().ClusterRoleBindings().Get(c.Request().Context(), clusterRoleBindingName, metav1.GetOptions{})
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error fetching cluster role binding details: "+err.Error())
+			return detailsError(err, "cluster role binding", "", clusterRoleBindingName)
 		}
 
 		return c.JSON(http.StatusOK, clusterRoleBinding)
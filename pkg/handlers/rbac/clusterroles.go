@@ -3,6 +3,11 @@ package rbac
 import (
 	"context"
 	"net/http"
+	"rbac/pkg/audit"
+	"rbac/pkg/discovery"
+	"rbac/pkg/httperror"
+	"rbac/pkg/managed"
+	"rbac/pkg/protection"
 	"rbac/pkg/utils"
 
 	"github.com/labstack/echo/v4"
@@ -12,9 +17,9 @@ import (
 )
 
 // ClusterRolesHandler handles requests related to cluster roles.
-func ClusterRolesHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func ClusterRolesHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		handlers := map[string]func(echo.Context, *kubernetes.Clientset, string) error{
+		handlers := map[string]func(echo.Context, kubernetes.Interface, string) error{
 			http.MethodGet:    handleListClusterRoles,
 			http.MethodPost:   handleCreateClusterRole,
 			http.MethodPut:    handleUpdateClusterRole,
@@ -26,65 +31,117 @@ func ClusterRolesHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
 }
 
 // handleListClusterRoles lists all cluster roles.
-func handleListClusterRoles(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+func handleListClusterRoles(c echo.Context, clientset kubernetes.Interface, _ string) error {
 	return utils.ListResources(c, clientset, "", func(namespace string, opts metav1.ListOptions) (interface{}, error) {
-		return clientset.RbacV1().ClusterRoles().List(context.TODO(), opts)
+		return clientset.RbacV1().ClusterRoles().List(c.Request().Context(), opts)
 	})
 }
 
-// handleCreateClusterRole creates a new cluster role.
-func handleCreateClusterRole(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+// handleCreateClusterRole creates a new cluster role. Names reserved for system roles, and default RBAC
+// labels, are refused like changes to the objects they protect.
+func handleCreateClusterRole(c echo.Context, clientset kubernetes.Interface, _ string) error {
 	var clusterRole rbacv1.ClusterRole
 	return utils.CreateResource(c, clientset, "", &clusterRole, func(namespace string, obj interface{}, opts metav1.CreateOptions) (interface{}, error) {
-		return clientset.RbacV1().ClusterRoles().Create(context.TODO(), obj.(*rbacv1.ClusterRole), opts)
+		desired := obj.(*rbacv1.ClusterRole)
+		if err := protection.Check(c, desired.Name, desired.ObjectMeta); err != nil {
+			return nil, err
+		}
+		managed.Stamp(&desired.ObjectMeta, audit.Actor(c))
+		created, err := clientset.RbacV1().ClusterRoles().Create(c.Request().Context(), desired, opts)
+		if err == nil {
+			annotateChange(c, "", created.Name, nil, created)
+			discovery.Warn(c, created.Rules)
+		}
+		return created, err
 	})
 }
 
 // handleUpdateClusterRole updates an existing cluster role.
-func handleUpdateClusterRole(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+func handleUpdateClusterRole(c echo.Context, clientset kubernetes.Interface, _ string) error {
 	var clusterRole rbacv1.ClusterRole
 	return utils.UpdateResource(c, clientset, "", &clusterRole, func(namespace string, obj interface{}, opts metav1.UpdateOptions) (interface{}, error) {
-		return clientset.RbacV1().ClusterRoles().Update(context.TODO(), obj.(*rbacv1.ClusterRole), opts)
+		desired := obj.(*rbacv1.ClusterRole)
+		existing, err := clientset.RbacV1().ClusterRoles().Get(c.Request().Context(), desired.Name, metav1.GetOptions{})
+		if err := existingError(err, "cluster role"); err != nil {
+			return nil, err
+		}
+		if err := protection.Check(c, desired.Name, existing.ObjectMeta); err != nil {
+			return nil, err
+		}
+		if err := managed.CheckConflict(c, existing.ObjectMeta); err != nil {
+			return nil, err
+		}
+		managed.Adopt(&desired.ObjectMeta, existing.ObjectMeta, audit.Actor(c))
+		updated, err := clientset.RbacV1().ClusterRoles().Update(c.Request().Context(), desired, opts)
+		if err == nil {
+			annotateChange(c, "", updated.Name, existing, updated)
+			discovery.Warn(c, updated.Rules)
+		}
+		return updated, err
 	})
 }
 
-// handleDeleteClusterRole deletes a cluster role by name.
-func handleDeleteClusterRole(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+// handleDeleteClusterRole deletes a cluster role by name, recording the whole of it in the audit log.
+func handleDeleteClusterRole(c echo.Context, clientset kubernetes.Interface, _ string) error {
 	name := c.QueryParam("name")
 	return utils.DeleteResource(c, clientset, "", name, func(namespace, name string, opts metav1.DeleteOptions) error {
-		return clientset.RbacV1().ClusterRoles().Delete(context.TODO(), name, opts)
+		existing, err := clientset.RbacV1().ClusterRoles().Get(c.Request().Context(), name, metav1.GetOptions{})
+		if err := existingError(err, "cluster role"); err != nil {
+			return err
+		}
+		if err := protection.Check(c, name, existing.ObjectMeta); err != nil {
+			return err
+		}
+		if err := managed.CheckConflict(c, existing.ObjectMeta); err != nil {
+			return err
+		}
+		if err := clientset.RbacV1().ClusterRoles().Delete(c.Request().Context(), name, opts); err != nil {
+			return err
+		}
+		audit.Annotate(c, "", name, clusterRoleManifest(existing), nil)
+		return nil
 	})
 }
 
+// clusterRoleManifest returns the whole of a cluster role as a manifest that recreates it, without the
+// server-maintained managed fields.
+func clusterRoleManifest(clusterRole *rbacv1.ClusterRole) *rbacv1.ClusterRole {
+	manifest := clusterRole.DeepCopy()
+	manifest.APIVersion = rbacv1.SchemeGroupVersion.String()
+	manifest.Kind = "ClusterRole"
+	manifest.ManagedFields = nil
+	return manifest
+}
+
 // ClusterRoleDetailsHandler handles fetching detailed information about a specific cluster role.
-func ClusterRoleDetailsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func ClusterRoleDetailsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		return handleGetClusterRoleDetails(c, clientset)
 	}
 }
 
 // handleGetClusterRoleDetails fetches detailed information about a specific cluster role.
-func handleGetClusterRoleDetails(c echo.Context, clientset *kubernetes.Clientset) error {
+func handleGetClusterRoleDetails(c echo.Context, clientset kubernetes.Interface) error {
 	clusterRoleName := c.QueryParam("clusterRoleName")
 	if clusterRoleName == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "Cluster role name is required")
 	}
 
-	clusterRole, err := clientset.RbacV1().ClusterRoles().Get(context.TODO(), clusterRoleName, metav1.GetOptions{})
+	clusterRole, err := clientset.RbacV1().ClusterRoles().Get(c.Request().Context(), clusterRoleName, metav1.GetOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error fetching cluster role details: "+err.Error())
+		return detailsError(err, "cluster role", "", clusterRoleName)
 	}
 
-	clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+	clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(c.Request().Context(), metav1.ListOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error listing cluster role bindings: "+err.Error())
+		return httperror.Wrap(err, "Error listing cluster role bindings: ")
 	}
 
 	associatedBindings := filterClusterRoleBindings(clusterRoleBindings.Items, clusterRoleName)
 
-	active, err := IsClusterRoleActive(clientset, clusterRoleName)
+	active, err := IsClusterRoleActive(c.Request().Context(), clientset, clusterRoleName)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error checking if cluster role is active: "+err.Error())
+		return httperror.Wrap(err, "Error checking if cluster role is active: ")
 	}
 
 	response := ClusterRoleDetailsResponse{
@@ -121,9 +178,9 @@ type ClusterRoleDetailsResponse struct {
 }
 
 // IsClusterRoleActive checks if a cluster role is active by looking for any cluster role bindings that reference it.
-func IsClusterRoleActive(clientset *kubernetes.Clientset, clusterRoleName string) (bool, error) {
+func IsClusterRoleActive(ctx context.Context, clientset kubernetes.Interface, clusterRoleName string) (bool, error) {
 	// Check ClusterRoleBindings
-	clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+	clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return false, err
 	}
@@ -0,0 +1,332 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/consolidation"
+	"rbac/pkg/httperror"
+	"rbac/pkg/managed"
+	"rbac/pkg/protection"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ConsolidationResult is what applying a consolidation suggestion did, or would do on a dry run.
+type ConsolidationResult struct {
+	Suggestion consolidation.Suggestion `json:"suggestion"`
+	DryRun     bool                     `json:"dryRun"`
+	Operations []ConsolidationOperation `json:"operations"`
+}
+
+// ConsolidationOperation is one change made to apply a suggestion: a binding recreated pointing at the role
+// that stays, or a merged role deleted.
+type ConsolidationOperation struct {
+	Action    string `json:"action"`
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+}
+
+// ConsolidationSuggestionsHandler proposes merges of roles granting the same permissions as another, or a
+// subset of another's, with the bindings to re-point and the access each merge would add.
+func ConsolidationSuggestionsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		suggestions, err := loadSuggestions(c.Request().Context(), clientset)
+		if err != nil {
+			return err
+		}
+		if suggestions == nil {
+			suggestions = []consolidation.Suggestion{}
+		}
+		return c.JSON(http.StatusOK, suggestions)
+	}
+}
+
+// ApplyConsolidationHandler applies the suggestion named by :id: each binding of a merged role is recreated
+// pointing at the role that stays, as the role of a binding can't be changed, then the merged roles are
+// deleted. Suggestions are recomputed first, so one made stale by a change to its roles is not found. Every
+// object is checked for protection and foreign managers before anything changes. With ?dryRun=true the
+// deletions are sent as server-side dry runs and nothing is recreated, as the bindings still exist.
+func ApplyConsolidationHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		dryRun := false
+		if value := c.QueryParam("dryRun"); value != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(value); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "dryRun must be true or false")
+			}
+		}
+
+		ctx := c.Request().Context()
+		suggestions, err := loadSuggestions(ctx, clientset)
+		if err != nil {
+			return err
+		}
+		var suggestion *consolidation.Suggestion
+		for i := range suggestions {
+			if suggestions[i].ID == c.Param("id") {
+				suggestion = &suggestions[i]
+			}
+		}
+		if suggestion == nil {
+			return echo.NewHTTPError(http.StatusNotFound, "Suggestion not found, its roles may have changed since it was made: "+c.Param("id"))
+		}
+
+		plan, err := planConsolidation(c, clientset, *suggestion)
+		if err != nil {
+			return err
+		}
+		result := ConsolidationResult{Suggestion: *suggestion, DryRun: dryRun, Operations: []ConsolidationOperation{}}
+		if dryRun {
+			audit.Skip(c)
+			if err := plan.dryRun(ctx, clientset); err != nil {
+				return err
+			}
+			result.Operations = plan.operations()
+			return c.JSON(http.StatusOK, result)
+		}
+
+		record := func(op ConsolidationOperation, resource string, before, after interface{}) {
+			entry := audit.EntryFromContext(c)
+			// named like the entries of the same change made through the resource's own route
+			entry.Action = op.Action + "_" + strings.TrimSuffix(resource, "s")
+			entry.Resource = resource
+			entry.Namespace = op.Namespace
+			entry.ResourceName = op.Name
+			entry.Status = http.StatusOK
+			entry.Details = audit.NewDetails(snapshot(before), snapshot(after))
+			audit.RecordFromHandler(c, entry)
+			result.Operations = append(result.Operations, op)
+		}
+		for _, binding := range plan.roleBindings {
+			recreated, err := recreateRoleBinding(ctx, clientset, binding, suggestion.Target, audit.Actor(c))
+			if err != nil {
+				return err
+			}
+			record(ConsolidationOperation{Action: "update", Kind: "RoleBinding", Namespace: binding.Namespace, Name: binding.Name}, "rolebindings", binding, recreated)
+		}
+		for _, binding := range plan.clusterRoleBindings {
+			recreated, err := recreateClusterRoleBinding(ctx, clientset, binding, suggestion.Target, audit.Actor(c))
+			if err != nil {
+				return err
+			}
+			record(ConsolidationOperation{Action: "update", Kind: "ClusterRoleBinding", Name: binding.Name}, "clusterrolebindings", binding, recreated)
+		}
+		for _, role := range plan.roles {
+			if err := clientset.RbacV1().Roles(role.Namespace).Delete(ctx, role.Name, metav1.DeleteOptions{}); err != nil {
+				return httperror.Wrap(err, "Failed to delete role "+role.Name+": ")
+			}
+			record(ConsolidationOperation{Action: "delete", Kind: "Role", Namespace: role.Namespace, Name: role.Name}, "roles", role, nil)
+		}
+		for _, clusterRole := range plan.clusterRoles {
+			if err := clientset.RbacV1().ClusterRoles().Delete(ctx, clusterRole.Name, metav1.DeleteOptions{}); err != nil {
+				return httperror.Wrap(err, "Failed to delete cluster role "+clusterRole.Name+": ")
+			}
+			record(ConsolidationOperation{Action: "delete", Kind: "ClusterRole", Name: clusterRole.Name}, "clusterroles", clusterRole, nil)
+		}
+
+		entry := audit.EntryFromContext(c)
+		entry.Action = "apply_consolidation"
+		entry.Resource = "suggestions"
+		entry.ResourceName = suggestion.ID
+		entry.Status = http.StatusOK
+		entry.Details = audit.NewDetails(nil, result)
+		audit.RecordFromHandler(c, entry)
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// loadSuggestions computes the consolidation suggestions for the whole cluster.
+func loadSuggestions(ctx context.Context, clientset kubernetes.Interface) ([]consolidation.Suggestion, error) {
+	rbac := clientset.RbacV1()
+	roles, err := rbac.Roles("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, httperror.Wrap(err, "Error listing roles: ")
+	}
+	clusterRoles, err := rbac.ClusterRoles().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, httperror.Wrap(err, "Error listing cluster roles: ")
+	}
+	roleBindings, err := rbac.RoleBindings("").List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, httperror.Wrap(err, "Error listing role bindings: ")
+	}
+	clusterRoleBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, httperror.Wrap(err, "Error listing cluster role bindings: ")
+	}
+	return consolidation.Suggest(roles.Items, clusterRoles.Items, roleBindings.Items, clusterRoleBindings.Items), nil
+}
+
+// consolidationPlan holds the current state of every object a suggestion changes.
+type consolidationPlan struct {
+	roleBindings        []*rbacv1.RoleBinding
+	clusterRoleBindings []*rbacv1.ClusterRoleBinding
+	roles               []*rbacv1.Role
+	clusterRoles        []*rbacv1.ClusterRole
+}
+
+// planConsolidation reads the objects of suggestion, refusing the whole merge when any of them is protected
+// or managed by another tool that refuses changes.
+func planConsolidation(c echo.Context, clientset kubernetes.Interface, suggestion consolidation.Suggestion) (*consolidationPlan, error) {
+	ctx := c.Request().Context()
+	rbac := clientset.RbacV1()
+	check := func(meta metav1.ObjectMeta) error {
+		if err := protection.Check(c, meta.Name, meta); err != nil {
+			return err
+		}
+		return managed.CheckConflict(c, meta)
+	}
+
+	plan := &consolidationPlan{}
+	for _, edit := range suggestion.BindingEdits {
+		if edit.Kind == "RoleBinding" {
+			binding, err := rbac.RoleBindings(edit.Namespace).Get(ctx, edit.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, httperror.Wrap(err, "Failed to get role binding "+edit.Name+": ")
+			}
+			if err := check(binding.ObjectMeta); err != nil {
+				return nil, err
+			}
+			plan.roleBindings = append(plan.roleBindings, binding)
+			continue
+		}
+		binding, err := rbac.ClusterRoleBindings().Get(ctx, edit.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, httperror.Wrap(err, "Failed to get cluster role binding "+edit.Name+": ")
+		}
+		if err := check(binding.ObjectMeta); err != nil {
+			return nil, err
+		}
+		plan.clusterRoleBindings = append(plan.clusterRoleBindings, binding)
+	}
+	for _, ref := range suggestion.Replaced {
+		if ref.Kind == "Role" {
+			role, err := rbac.Roles(ref.Namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+			if err != nil {
+				return nil, httperror.Wrap(err, "Failed to get role "+ref.Name+": ")
+			}
+			if err := check(role.ObjectMeta); err != nil {
+				return nil, err
+			}
+			plan.roles = append(plan.roles, role)
+			continue
+		}
+		clusterRole, err := rbac.ClusterRoles().Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, httperror.Wrap(err, "Failed to get cluster role "+ref.Name+": ")
+		}
+		if err := check(clusterRole.ObjectMeta); err != nil {
+			return nil, err
+		}
+		plan.clusterRoles = append(plan.clusterRoles, clusterRole)
+	}
+	return plan, nil
+}
+
+// operations lists the changes applying the plan makes.
+func (p *consolidationPlan) operations() []ConsolidationOperation {
+	ops := []ConsolidationOperation{}
+	for _, binding := range p.roleBindings {
+		ops = append(ops, ConsolidationOperation{Action: "update", Kind: "RoleBinding", Namespace: binding.Namespace, Name: binding.Name})
+	}
+	for _, binding := range p.clusterRoleBindings {
+		ops = append(ops, ConsolidationOperation{Action: "update", Kind: "ClusterRoleBinding", Name: binding.Name})
+	}
+	for _, role := range p.roles {
+		ops = append(ops, ConsolidationOperation{Action: "delete", Kind: "Role", Namespace: role.Namespace, Name: role.Name})
+	}
+	for _, clusterRole := range p.clusterRoles {
+		ops = append(ops, ConsolidationOperation{Action: "delete", Kind: "ClusterRole", Name: clusterRole.Name})
+	}
+	return ops
+}
+
+// dryRun sends the deletions of the plan as server-side dry runs, so missing permissions come out before
+// anything is changed.
+func (p *consolidationPlan) dryRun(ctx context.Context, clientset kubernetes.Interface) error {
+	rbac := clientset.RbacV1()
+	opts := metav1.DeleteOptions{DryRun: []string{metav1.DryRunAll}}
+	for _, binding := range p.roleBindings {
+		if err := rbac.RoleBindings(binding.Namespace).Delete(ctx, binding.Name, opts); err != nil {
+			return httperror.Wrap(err, "Dry run of deleting role binding "+binding.Name+" failed: ")
+		}
+	}
+	for _, binding := range p.clusterRoleBindings {
+		if err := rbac.ClusterRoleBindings().Delete(ctx, binding.Name, opts); err != nil {
+			return httperror.Wrap(err, "Dry run of deleting cluster role binding "+binding.Name+" failed: ")
+		}
+	}
+	for _, role := range p.roles {
+		if err := rbac.Roles(role.Namespace).Delete(ctx, role.Name, opts); err != nil {
+			return httperror.Wrap(err, "Dry run of deleting role "+role.Name+" failed: ")
+		}
+	}
+	for _, clusterRole := range p.clusterRoles {
+		if err := rbac.ClusterRoles().Delete(ctx, clusterRole.Name, opts); err != nil {
+			return httperror.Wrap(err, "Dry run of deleting cluster role "+clusterRole.Name+" failed: ")
+		}
+	}
+	return nil
+}
+
+// recreatedMeta returns the metadata of a binding recreated from existing under the same name, keeping its
+// labels, annotations and manager.
+func recreatedMeta(existing metav1.ObjectMeta, actor string) metav1.ObjectMeta {
+	existing = *existing.DeepCopy()
+	meta := metav1.ObjectMeta{Name: existing.Name, Namespace: existing.Namespace, Labels: existing.Labels, Annotations: existing.Annotations}
+	managed.Adopt(&meta, existing, actor)
+	return meta
+}
+
+// recreateRoleBinding replaces binding with one pointing at target. The original is restored if the new
+// binding can't be created, so a failure doesn't take access away.
+func recreateRoleBinding(ctx context.Context, clientset kubernetes.Interface, binding *rbacv1.RoleBinding, target consolidation.RoleRef, actor string) (*rbacv1.RoleBinding, error) {
+	bindings := clientset.RbacV1().RoleBindings(binding.Namespace)
+	replacement := &rbacv1.RoleBinding{
+		ObjectMeta: recreatedMeta(binding.ObjectMeta, actor),
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: target.Kind, Name: target.Name},
+		Subjects:   binding.Subjects,
+	}
+	if err := bindings.Delete(ctx, binding.Name, metav1.DeleteOptions{}); err != nil {
+		return nil, httperror.Wrap(err, "Failed to delete role binding "+binding.Name+": ")
+	}
+	created, err := bindings.Create(ctx, replacement, metav1.CreateOptions{})
+	if err != nil {
+		original := binding.DeepCopy()
+		original.ResourceVersion, original.UID = "", ""
+		_, _ = bindings.Create(ctx, original, metav1.CreateOptions{})
+		return nil, httperror.Wrap(err, "Failed to recreate role binding "+binding.Name+": ")
+	}
+	return created, nil
+}
+
+// recreateClusterRoleBinding replaces binding with one pointing at target, restoring the original if the
+// new binding can't be created.
+func recreateClusterRoleBinding(ctx context.Context, clientset kubernetes.Interface, binding *rbacv1.ClusterRoleBinding, target consolidation.RoleRef, actor string) (*rbacv1.ClusterRoleBinding, error) {
+	bindings := clientset.RbacV1().ClusterRoleBindings()
+	replacement := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: recreatedMeta(binding.ObjectMeta, actor),
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: target.Kind, Name: target.Name},
+		Subjects:   binding.Subjects,
+	}
+	if err := bindings.Delete(ctx, binding.Name, metav1.DeleteOptions{}); err != nil {
+		return nil, httperror.Wrap(err, "Failed to delete cluster role binding "+binding.Name+": ")
+	}
+	created, err := bindings.Create(ctx, replacement, metav1.CreateOptions{})
+	if err != nil {
+		original := binding.DeepCopy()
+		original.ResourceVersion, original.UID = "", ""
+		_, _ = bindings.Create(ctx, original, metav1.CreateOptions{})
+		return nil, httperror.Wrap(err, "Failed to recreate cluster role binding "+binding.Name+": ")
+	}
+	return created, nil
+}
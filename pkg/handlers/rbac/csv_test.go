@@ -0,0 +1,122 @@
+package rbac
+
+import (
+	"flag"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rbac/pkg/discovery"
+	"rbac/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// checkGolden compares got with testdata/name, or rewrites the file when -update is set.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs from the golden file; rerun with -update if the change is intended\ngot:\n%s", name, got)
+	}
+}
+
+// csvCluster is a cluster where prod is administered and edited by subjects whose names need quoting,
+// staging is edited by a service account, and a platform group administers every namespace. The edit
+// ClusterRole reads only two secrets.
+func csvCluster() *fake.Clientset {
+	roleRef := func(name string) rbacv1.RoleRef {
+		return rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: name}
+	}
+	clientset := fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "prod"}},
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "staging"}},
+		&rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "admin"},
+			Rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{rbacv1.GroupName}, Resources: []string{"roles", "rolebindings"}, Verbs: []string{"create", "update"}},
+				{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}},
+			},
+		},
+		&rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "edit"},
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"db", "tls"}, Verbs: []string{"get"}}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "owners", Namespace: "prod"},
+			RoleRef:    roleRef("admin"),
+			Subjects: []rbacv1.Subject{
+				{Kind: rbacv1.UserKind, Name: `Doe, "Jane"`},
+				{Kind: rbacv1.GroupKind, Name: "ops,sre"},
+			},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "readers", Namespace: "prod"},
+			RoleRef:    roleRef("edit"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "Smith, J"}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "deployers", Namespace: "staging"},
+			RoleRef:    roleRef("edit"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "deployer"}},
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "platform"},
+			RoleRef:    roleRef("admin"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "platform"}},
+		},
+	)
+	clientset.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "secrets", Namespaced: true, Kind: "Secret", Verbs: metav1.Verbs{"get", "list"}}},
+	}}
+	return clientset
+}
+
+// serveCSV sends a GET for target to handler and checks the response is a CSV download of report.
+func serveCSV(t *testing.T, handler echo.HandlerFunc, target, report string) []byte {
+	t.Helper()
+	e := echo.New()
+	e.GET("/", handler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+	if got := rec.Header().Get(echo.HeaderContentType); got != utils.CSVContentType {
+		t.Errorf("Content-Type = %q, want %q", got, utils.CSVContentType)
+	}
+	filename := report + "-" + time.Now().UTC().Format(time.DateOnly) + ".csv"
+	if got, want := rec.Header().Get(echo.HeaderContentDisposition), `attachment; filename="`+filename+`"`; got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+	return rec.Body.Bytes()
+}
+
+func TestWhoCanCSV(t *testing.T) {
+	clientset := csvCluster()
+	handler := WhoCanHandler(clientset, discovery.NewCache(clientset.Discovery(), time.Minute))
+	checkGolden(t, "who-can.csv.golden", serveCSV(t, handler, "/?verb=get&resource=secrets&namespace=prod&format=csv", "who-can"))
+}
+
+func TestNamespaceAdminsCSV(t *testing.T) {
+	checkGolden(t, "namespace-admins.csv.golden", serveCSV(t, NamespaceAdminsHandler(csvCluster()), "/?format=csv", "namespace-admins"))
+}
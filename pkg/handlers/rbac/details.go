@@ -0,0 +1,23 @@
+package rbac
+
+import (
+	"net/http"
+
+	"rbac/pkg/httperror"
+
+	"github.com/labstack/echo/v4"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// detailsError turns the error of fetching an object for a details endpoint into a response: 404 when the
+// object doesn't exist, 500 otherwise.
+func detailsError(err error, kind, namespace, name string) error {
+	if apierrors.IsNotFound(err) {
+		message := "No " + kind + " named " + name
+		if namespace != "" {
+			message += " in namespace " + namespace
+		}
+		return echo.NewHTTPError(http.StatusNotFound, message)
+	}
+	return httperror.Wrap(err, "Error fetching "+kind+" details: ")
+}
@@ -0,0 +1,135 @@
+package rbac
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// detailsCluster is a cluster with one object of each kind with a details endpoint, all called reader, and a
+// binding naming the user alice and the group devs.
+func detailsCluster() *fake.Clientset {
+	roleRef := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "reader"}
+	subjects := []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}, {Kind: rbacv1.GroupKind, Name: "devs"}}
+	return fake.NewSimpleClientset(
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "reader"}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "prod"}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: "reader"}},
+		&rbacv1.RoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "prod"}, RoleRef: roleRef, Subjects: subjects},
+		&rbacv1.ClusterRoleBinding{ObjectMeta: metav1.ObjectMeta{Name: "reader"}, RoleRef: roleRef, Subjects: subjects},
+	)
+}
+
+// serve sends a GET for target to handler, returning the status and body.
+func serve(handler echo.HandlerFunc, target string) (int, []byte) {
+	e := echo.New()
+	e.GET("/", handler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	return rec.Code, rec.Body.Bytes()
+}
+
+func TestDetailsNotFound(t *testing.T) {
+	clientset := detailsCluster()
+	tests := []struct {
+		name    string
+		handler echo.HandlerFunc
+		target  string
+		status  int
+		message string
+	}{
+		{"role", RoleDetailsHandler(clientset), "/?roleName=writer&namespace=prod", http.StatusNotFound, "No role named writer in namespace prod"},
+		{"role in another namespace", RoleDetailsHandler(clientset), "/?roleName=reader&namespace=staging", http.StatusNotFound, "No role named reader in namespace staging"},
+		{"role in the default namespace", RoleDetailsHandler(clientset), "/?roleName=reader", http.StatusNotFound, "No role named reader in namespace default"},
+		{"role without a name", RoleDetailsHandler(clientset), "/?namespace=prod", http.StatusBadRequest, "Role name is required"},
+		{"cluster role", ClusterRoleDetailsHandler(clientset), "/?clusterRoleName=writer", http.StatusNotFound, "No cluster role named writer"},
+		{"cluster role without a name", ClusterRoleDetailsHandler(clientset), "/", http.StatusBadRequest, "Cluster role name is required"},
+		{"role binding", RoleBindingDetailsHandler(clientset), "/?name=writer&namespace=prod", http.StatusNotFound, "No role binding named writer in namespace prod"},
+		{"role binding without a name", RoleBindingDetailsHandler(clientset), "/?namespace=prod", http.StatusBadRequest, "Role binding name is required"},
+		{"cluster role binding", ClusterRoleBindingDetailsHandler(clientset), "/?name=writer", http.StatusNotFound, "No cluster role binding named writer"},
+		{"cluster role binding without a name", ClusterRoleBindingDetailsHandler(clientset), "/", http.StatusBadRequest, "Cluster role binding name is required"},
+		{"namespace", NamespaceDetailsHandler(clientset), "/?name=writer", http.StatusNotFound, "No namespace named writer"},
+		{"namespace without a name", NamespaceDetailsHandler(clientset), "/", http.StatusBadRequest, "Namespace name is required"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := serve(tt.handler, tt.target)
+			if status != tt.status {
+				t.Fatalf("status = %d, want %d: %s", status, tt.status, body)
+			}
+			var got struct {
+				Message string `json:"message"`
+			}
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatalf("body %s is not a JSON error: %v", body, err)
+			}
+			if got.Message != tt.message {
+				t.Errorf("message = %q, want %q", got.Message, tt.message)
+			}
+		})
+	}
+}
+
+func TestDetailsFound(t *testing.T) {
+	clientset := detailsCluster()
+	tests := []struct {
+		name    string
+		handler echo.HandlerFunc
+		target  string
+	}{
+		{"role", RoleDetailsHandler(clientset), "/?roleName=reader&namespace=prod"},
+		{"cluster role", ClusterRoleDetailsHandler(clientset), "/?clusterRoleName=reader"},
+		{"role binding", RoleBindingDetailsHandler(clientset), "/?name=reader&namespace=prod"},
+		{"cluster role binding", ClusterRoleBindingDetailsHandler(clientset), "/?name=reader"},
+		{"namespace", NamespaceDetailsHandler(clientset), "/?name=reader"},
+	}
+	for _, tt := range tests {
+		if status, body := serve(tt.handler, tt.target); status != http.StatusOK {
+			t.Errorf("%s: status = %d, want %d: %s", tt.name, status, http.StatusOK, body)
+		}
+	}
+}
+
+func TestSubjectDetailsNotFound(t *testing.T) {
+	clientset := detailsCluster()
+	tests := []struct {
+		name        string
+		handler     echo.HandlerFunc
+		target      string
+		found       bool
+		collections []string
+	}{
+		{"unknown user", UserDetailsHandler(clientset), "/?userName=bob", false, []string{"roleBindings", "clusterRoleBindings", "roles", "clusterRoles"}},
+		{"bound user", UserDetailsHandler(clientset), "/?userName=alice", true, nil},
+		{"unknown group", GroupDetailsHandler(clientset), "/?groupName=ops", false, []string{"roleBindings", "clusterRoleBindings", "clusterRoles"}},
+		{"bound group", GroupDetailsHandler(clientset), "/?groupName=devs", true, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body := serve(tt.handler, tt.target)
+			if status != http.StatusOK {
+				t.Fatalf("status = %d, want %d: %s", status, http.StatusOK, body)
+			}
+			var got map[string]json.RawMessage
+			if err := json.Unmarshal(body, &got); err != nil {
+				t.Fatal(err)
+			}
+			var found bool
+			if err := json.Unmarshal(got["found"], &found); err != nil || found != tt.found {
+				t.Errorf("found = %s, want %v", got["found"], tt.found)
+			}
+			for _, key := range tt.collections {
+				if string(got[key]) != "[]" {
+					t.Errorf("%s = %s, want an empty list", key, got[key])
+				}
+			}
+		})
+	}
+}
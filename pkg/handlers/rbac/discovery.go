@@ -0,0 +1,21 @@
+package rbac
+
+import (
+	"net/http"
+
+	"rbac/pkg/discovery"
+
+	"github.com/labstack/echo/v4"
+)
+
+// DiscoveryResourcesHandler lists, per API group, the resources and subresources the cluster serves with
+// their verbs, for populating role editors. ?refresh=true bypasses the cache.
+func DiscoveryResourcesHandler(cache *discovery.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		catalog, err := cache.Catalog(c.QueryParam("refresh") == "true")
+		if err != nil {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Error retrieving API discovery information: "+err.Error())
+		}
+		return c.JSON(http.StatusOK, catalog)
+	}
+}
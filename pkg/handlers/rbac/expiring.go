@@ -0,0 +1,83 @@
+package rbac
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"rbac/pkg/expiry"
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
+	"rbac/pkg/managed"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// ExpiringBinding is a temporary binding and when it will be removed.
+type ExpiringBinding struct {
+	Kind      string           `json:"kind"`
+	Namespace string           `json:"namespace,omitempty"`
+	Name      string           `json:"name"`
+	RoleRef   rbacv1.RoleRef   `json:"roleRef"`
+	Subjects  []rbacv1.Subject `json:"subjects"`
+	ExpiresAt time.Time        `json:"expiresAt"`
+	// Expired is set for bindings past their expiry that the reaper hasn't removed yet.
+	Expired bool `json:"expired"`
+}
+
+// ExpiringBindingsHandler lists temporary RoleBindings and ClusterRoleBindings, soonest expiry first.
+// ?within=24h limits the list to bindings expiring within that duration.
+func ExpiringBindingsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		now := time.Now()
+		var horizon time.Time
+		if within := c.QueryParam("within"); within != "" {
+			d, err := time.ParseDuration(within)
+			if err != nil || d <= 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "within must be a positive duration such as 24h")
+			}
+			horizon = now.Add(d)
+		}
+
+		opts := metav1.ListOptions{LabelSelector: managed.Selector}
+		roleBindings, err := clientset.RbacV1().RoleBindings("").List(c.Request().Context(), opts)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing role bindings: ")
+		}
+		clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(c.Request().Context(), opts)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
+		}
+
+		bindings := []ExpiringBinding{}
+		add := func(kind string, meta metav1.ObjectMeta, roleRef rbacv1.RoleRef, subjects []rbacv1.Subject) {
+			expiresAt, ok := expiry.ExpiresAt(meta)
+			if !ok || (!horizon.IsZero() && expiresAt.After(horizon)) {
+				return
+			}
+			bindings = append(bindings, ExpiringBinding{
+				Kind:      kind,
+				Namespace: meta.Namespace,
+				Name:      meta.Name,
+				RoleRef:   roleRef,
+				Subjects:  subjects,
+				ExpiresAt: expiresAt,
+				Expired:   !expiresAt.After(now),
+			})
+		}
+		for _, rb := range roleBindings.Items {
+			add("RoleBinding", rb.ObjectMeta, rb.RoleRef, rb.Subjects)
+		}
+		for _, crb := range clusterRoleBindings.Items {
+			add("ClusterRoleBinding", crb.ObjectMeta, crb.RoleRef, crb.Subjects)
+		}
+
+		sort.SliceStable(bindings, func(i, j int) bool {
+			return bindings[i].ExpiresAt.Before(bindings[j].ExpiresAt)
+		})
+		return listing.Respond(c, bindings, listing.Meta{})
+	}
+}
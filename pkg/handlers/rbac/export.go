@@ -0,0 +1,116 @@
+package rbac
+
+import (
+	"net/http"
+	"strconv"
+
+	"rbac/pkg/httperror"
+	"rbac/pkg/managed"
+	"rbac/pkg/protection"
+	"rbac/pkg/terraform"
+
+	"github.com/labstack/echo/v4"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// hclContentType is the media type of exported Terraform configuration.
+const hclContentType = "text/plain; charset=utf-8"
+
+// TerraformExportHandler renders the Roles and RoleBindings of ?namespace= as Terraform configuration for the
+// kubernetes provider. System objects are left out unless ?includeSystem=true, and ?managedOnly= and
+// ?managedBy= narrow the export as they do lists.
+func TerraformExportHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		namespace := c.QueryParam("namespace")
+		if namespace == "" {
+			namespace = "default"
+		}
+		if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid namespace: "+errs[0])
+		}
+		opts, includeSystem, err := exportOptions(c)
+		if err != nil {
+			return err
+		}
+
+		ctx := c.Request().Context()
+		roles, err := clientset.RbacV1().Roles(namespace).List(ctx, opts)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing roles: ")
+		}
+		bindings, err := clientset.RbacV1().RoleBindings(namespace).List(ctx, opts)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing role bindings: ")
+		}
+
+		var objects terraform.Objects
+		for _, role := range roles.Items {
+			if includeSystem || !protection.IsSystem(role.ObjectMeta) {
+				objects.Roles = append(objects.Roles, role)
+			}
+		}
+		for _, binding := range bindings.Items {
+			if includeSystem || !protection.IsSystem(binding.ObjectMeta) {
+				objects.RoleBindings = append(objects.RoleBindings, binding)
+			}
+		}
+		return respondHCL(c, "rbac-"+namespace+".tf", objects)
+	}
+}
+
+// ClusterTerraformExportHandler renders the ClusterRoles and ClusterRoleBindings as Terraform configuration,
+// with the same parameters as TerraformExportHandler apart from the namespace.
+func ClusterTerraformExportHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		opts, includeSystem, err := exportOptions(c)
+		if err != nil {
+			return err
+		}
+
+		ctx := c.Request().Context()
+		roles, err := clientset.RbacV1().ClusterRoles().List(ctx, opts)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing cluster roles: ")
+		}
+		bindings, err := clientset.RbacV1().ClusterRoleBindings().List(ctx, opts)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
+		}
+
+		var objects terraform.Objects
+		for _, role := range roles.Items {
+			if includeSystem || !protection.IsSystem(role.ObjectMeta) {
+				objects.ClusterRoles = append(objects.ClusterRoles, role)
+			}
+		}
+		for _, binding := range bindings.Items {
+			if includeSystem || !protection.IsSystem(binding.ObjectMeta) {
+				objects.ClusterRoleBindings = append(objects.ClusterRoleBindings, binding)
+			}
+		}
+		return respondHCL(c, "rbac-cluster.tf", objects)
+	}
+}
+
+// exportOptions parses the list filters and ?includeSystem= of an export.
+func exportOptions(c echo.Context) (metav1.ListOptions, bool, error) {
+	opts, err := managed.ListOptions(c)
+	if err != nil {
+		return opts, false, echo.NewHTTPError(http.StatusBadRequest, "Invalid filter: "+err.Error())
+	}
+	includeSystem := false
+	if value := c.QueryParam("includeSystem"); value != "" {
+		if includeSystem, err = strconv.ParseBool(value); err != nil {
+			return opts, false, echo.NewHTTPError(http.StatusBadRequest, "includeSystem must be true or false")
+		}
+	}
+	return opts, includeSystem, nil
+}
+
+// respondHCL writes the rendered objects as a download called filename.
+func respondHCL(c echo.Context, filename string, objects terraform.Objects) error {
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	return c.Blob(http.StatusOK, hclContentType, terraform.Render(objects))
+}
@@ -0,0 +1,129 @@
+package rbac
+
+import (
+	"net/http"
+
+	"rbac/pkg/graph"
+	"rbac/pkg/httperror"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// defaultGraphDepth is how many edges from the subject or role asked about a graph reaches by default:
+	// enough for the roles of a subject and the namespaces they apply in, or the subjects of a role.
+	defaultGraphDepth = 2
+	// maxGraphDepth bounds ?depth=.
+	maxGraphDepth = 10
+	// defaultGraphNodes and maxGraphNodes are the default and the largest ?limit= on the nodes of a graph,
+	// which a browser can still lay out.
+	defaultGraphNodes = 500
+	maxGraphNodes     = 2000
+
+	// dotContentType and graphMLContentType are the media types of graph downloads.
+	dotContentType     = "text/vnd.graphviz; charset=utf-8"
+	graphMLContentType = "application/graphml+xml; charset=utf-8"
+)
+
+// GraphHandler returns the graph of subjects, roles and namespaces and the bindings between them. ?subject=
+// (narrowed by ?subjectKind=) or ?role= (narrowed by ?roleKind=) centre it on those nodes, reaching ?depth=
+// edges away. ?namespace= keeps only the roles and role bindings of one namespace. At most ?limit= nodes are
+// returned, the graph being marked truncated when there were more. ?format=dot and ?format=graphml download
+// the graph for Graphviz and other graph tools instead of returning JSON.
+func GraphHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		depth, err := intParam(c, "depth", defaultGraphDepth, 1, maxGraphDepth)
+		if err != nil {
+			return err
+		}
+		limit, err := intParam(c, "limit", defaultGraphNodes, 1, maxGraphNodes)
+		if err != nil {
+			return err
+		}
+		format := c.QueryParam("format")
+		switch format {
+		case "", "json", "dot", "graphml":
+		default:
+			return echo.NewHTTPError(http.StatusBadRequest, "format must be json, dot or graphml")
+		}
+
+		g, err := loadGraph(c, clientset, c.QueryParam("namespace"))
+		if err != nil {
+			return err
+		}
+
+		subject, subjectKind := c.QueryParam("subject"), c.QueryParam("subjectKind")
+		role, roleKind := c.QueryParam("role"), c.QueryParam("roleKind")
+		if subject != "" || role != "" {
+			var seeds []string
+			for _, node := range g.Nodes {
+				switch node.Kind {
+				case rbacv1.UserKind, rbacv1.GroupKind, rbacv1.ServiceAccountKind:
+					if subject != "" && node.Name == subject && (subjectKind == "" || node.Kind == subjectKind) {
+						seeds = append(seeds, node.ID)
+					}
+				case graph.KindRole, graph.KindClusterRole:
+					if role != "" && node.Name == role && (roleKind == "" || node.Kind == roleKind) {
+						seeds = append(seeds, node.ID)
+					}
+				}
+			}
+			g = g.Neighborhood(seeds, depth)
+		}
+
+		g = g.Limit(limit)
+
+		switch format {
+		case "dot":
+			c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="rbac-graph.dot"`)
+			return c.Blob(http.StatusOK, dotContentType, graph.RenderDOT(g))
+		case "graphml":
+			out, err := graph.RenderGraphML(g)
+			if err != nil {
+				return err
+			}
+			c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="rbac-graph.graphml"`)
+			return c.Blob(http.StatusOK, graphMLContentType, out)
+		}
+		return c.JSON(http.StatusOK, g)
+	}
+}
+
+// loadGraph builds the graph of every RBAC object, or of the roles and role bindings of namespace alone.
+func loadGraph(c echo.Context, clientset kubernetes.Interface, namespace string) (*graph.Graph, error) {
+	ctx := c.Request().Context()
+
+	roles, err := listRoles(c, clientset, namespace)
+	if err != nil {
+		return nil, httperror.Wrap(err, "Error listing roles: ")
+	}
+	roleBindings, err := listRoleBindings(c, clientset, namespace)
+	if err != nil {
+		return nil, httperror.Wrap(err, "Error listing role bindings: ")
+	}
+	if namespace != "" {
+		return graph.Build([]string{namespace}, roles.Items, nil, roleBindings.Items, nil), nil
+	}
+
+	namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, httperror.Wrap(err, "Error listing namespaces: ")
+	}
+	clusterRoles, err := listClusterRoles(c, clientset)
+	if err != nil {
+		return nil, httperror.Wrap(err, "Error listing cluster roles: ")
+	}
+	clusterRoleBindings, err := listClusterRoleBindings(c, clientset)
+	if err != nil {
+		return nil, httperror.Wrap(err, "Error listing cluster role bindings: ")
+	}
+
+	var names []string
+	for _, ns := range namespaces.Items {
+		names = append(names, ns.Name)
+	}
+	return graph.Build(names, roles.Items, clusterRoles.Items, roleBindings.Items, clusterRoleBindings.Items), nil
+}
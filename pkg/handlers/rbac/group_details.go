@@ -1,44 +1,46 @@
 package rbac
 
 import (
-	"context"
 	"net/http"
 
+	"rbac/pkg/httperror"
+
 	"github.com/labstack/echo/v4"
 	rbacv1 "k8s.io/api/rbac/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
-// GroupDetailsResponse represents the detailed information about a group.
+// GroupDetailsResponse represents the detailed information about a group. Found is false when no
+// binding names the group, so it has no access at all.
 type GroupDetailsResponse struct {
 	GroupName           string                      `json:"groupName"`
+	Found               bool                        `json:"found"`
 	RoleBindings        []rbacv1.RoleBinding        `json:"roleBindings"`
 	ClusterRoleBindings []rbacv1.ClusterRoleBinding `json:"clusterRoleBindings"`
 	ClusterRoles        []rbacv1.ClusterRole        `json:"clusterRoles"`
 }
 
 // GroupDetailsHandler handles requests for detailed information about a specific group.
-func GroupDetailsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func GroupDetailsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		groupName := c.QueryParam("groupName")
 		if groupName == "" {
 			return echo.NewHTTPError(http.StatusBadRequest, "Group name is required")
 		}
 
-		roleBindings, err := clientset.RbacV1().RoleBindings("").List(context.TODO(), metav1.ListOptions{})
+		roleBindings, err := listRoleBindingsNaming(c, clientset, rbacv1.GroupKind, groupName)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing role bindings: ")
 		}
 
-		clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+		clusterRoleBindings, err := listClusterRoleBindingsNaming(c, clientset, rbacv1.GroupKind, groupName)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing cluster role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
 		}
 
-		clusterRoles, err := clientset.RbacV1().ClusterRoles().List(context.TODO(), metav1.ListOptions{})
+		clusterRoles, err := listClusterRoles(c, clientset)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing cluster roles: "+err.Error())
+			return httperror.Wrap(err, "Error listing cluster roles: ")
 		}
 
 		groupDetails := extractGroupDetails(groupName, roleBindings.Items, clusterRoleBindings.Items, clusterRoles.Items)
@@ -48,9 +50,9 @@ func GroupDetailsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
 
 // extractGroupDetails extracts detailed information about a specific group.
 func extractGroupDetails(groupName string, roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding, clusterRoles []rbacv1.ClusterRole) GroupDetailsResponse {
-	var groupRoleBindings []rbacv1.RoleBinding
-	var groupClusterRoleBindings []rbacv1.ClusterRoleBinding
-	var groupClusterRoles []rbacv1.ClusterRole
+	groupRoleBindings := []rbacv1.RoleBinding{}
+	groupClusterRoleBindings := []rbacv1.ClusterRoleBinding{}
+	groupClusterRoles := []rbacv1.ClusterRole{}
 
 	for _, rb := range roleBindings {
 		for _, subject := range rb.Subjects {
@@ -79,6 +81,7 @@ func extractGroupDetails(groupName string, roleBindings []rbacv1.RoleBinding, cl
 
 	return GroupDetailsResponse{
 		GroupName:           groupName,
+		Found:               len(groupRoleBindings)+len(groupClusterRoleBindings) > 0,
 		RoleBindings:        groupRoleBindings,
 		ClusterRoleBindings: groupClusterRoleBindings,
 		ClusterRoles:        groupClusterRoles,
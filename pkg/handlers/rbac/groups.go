@@ -1,8 +1,13 @@
 package rbac
 
 import (
-	"context"
 	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
 
 	"github.com/labstack/echo/v4"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -10,48 +15,167 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-// GroupsHandler handles requests related to listing groups.
-func GroupsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+// GroupSummary describes a group and the bindings that grant it access.
+type GroupSummary struct {
+	Name                    string `json:"name"`
+	RoleBindingCount        int    `json:"roleBindingCount"`
+	ClusterRoleBindingCount int    `json:"clusterRoleBindingCount"`
+	// Namespaces are the namespaces where a RoleBinding grants the group access.
+	Namespaces   []string `json:"namespaces"`
+	ClusterAdmin bool     `json:"clusterAdmin"`
+	// LatestBinding is when the most recent binding naming the group was created.
+	LatestBinding *metav1.Time `json:"latestBinding,omitempty"`
+}
+
+// GroupsHandler handles requests related to listing groups. With ?detail=true each group is returned as a
+// GroupSummary instead of a bare name. Groups can be filtered with ?contains=, ?prefix= and ?regex= on the name
+// (?caseInsensitive=true ignores case for all three) and with ?namespace=, and ordered with ?sort=name or
+// ?sort=bindingCount.
+func GroupsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		roleBindings, err := clientset.RbacV1().RoleBindings("").List(context.TODO(), metav1.ListOptions{})
+		match, err := groupNameFilter(c)
+		if err != nil {
+			return err
+		}
+		namespace := c.QueryParam("namespace")
+
+		sortBy := c.QueryParam("sort")
+		if sortBy != "" && sortBy != "name" && sortBy != "bindingCount" {
+			return echo.NewHTTPError(http.StatusBadRequest, "sort must be name or bindingCount")
+		}
+
+		roleBindings, err := listRoleBindings(c, clientset, "")
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing role bindings: ")
 		}
 
-		clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+		clusterRoleBindings, err := listClusterRoleBindings(c, clientset)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing cluster role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
+		}
+
+		summaries := make([]GroupSummary, 0)
+		for _, summary := range summarizeGroups(roleBindings.Items, clusterRoleBindings.Items) {
+			if !match(summary.Name) || (namespace != "" && !containsString(summary.Namespaces, namespace)) {
+				continue
+			}
+			summaries = append(summaries, summary)
+		}
+		if sortBy == "bindingCount" {
+			sort.SliceStable(summaries, func(i, j int) bool {
+				return summaries[i].RoleBindingCount+summaries[i].ClusterRoleBindingCount > summaries[j].RoleBindingCount+summaries[j].ClusterRoleBindingCount
+			})
 		}
 
-		groups := extractGroupsFromBindings(roleBindings.Items, clusterRoleBindings.Items)
-		return c.JSON(http.StatusOK, groups)
+		if c.QueryParam("detail") == "true" {
+			return listing.Respond(c, summaries, listing.Meta{})
+		}
+
+		groups := make([]string, 0, len(summaries))
+		for _, summary := range summaries {
+			groups = append(groups, summary.Name)
+		}
+		return listing.Respond(c, groups, listing.Meta{})
 	}
 }
 
-// extractGroupsFromBindings extracts groups from RoleBindings and ClusterRoleBindings.
-func extractGroupsFromBindings(roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding) []string {
-	groupSet := make(map[string]struct{})
+// groupNameFilter builds the name filter of a groups request from ?contains=, ?prefix=, ?regex= and
+// ?caseInsensitive=. A group must pass every filter given.
+func groupNameFilter(c echo.Context) (func(string) bool, error) {
+	caseInsensitive := c.QueryParam("caseInsensitive") == "true"
+	fold := func(s string) string {
+		if caseInsensitive {
+			return strings.ToLower(s)
+		}
+		return s
+	}
+	contains := fold(c.QueryParam("contains"))
+	prefix := fold(c.QueryParam("prefix"))
 
-	for _, rb := range roleBindings {
-		for _, subject := range rb.Subjects {
-			if subject.Kind == rbacv1.GroupKind {
-				groupSet[subject.Name] = struct{}{}
-			}
+	var re *regexp.Regexp
+	if pattern := c.QueryParam("regex"); pattern != "" {
+		if caseInsensitive {
+			pattern = "(?i)" + pattern
+		}
+		var err error
+		if re, err = regexp.Compile(pattern); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid regex: "+err.Error())
 		}
 	}
 
-	for _, crb := range clusterRoleBindings {
-		for _, subject := range crb.Subjects {
-			if subject.Kind == rbacv1.GroupKind {
-				groupSet[subject.Name] = struct{}{}
+	return func(name string) bool {
+		if re != nil && !re.MatchString(name) {
+			return false
+		}
+		name = fold(name)
+		return strings.Contains(name, contains) && strings.HasPrefix(name, prefix)
+	}, nil
+}
+
+// containsString reports whether values includes value.
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// summarizeGroups builds a GroupSummary for every group named in a binding, sorted by name.
+func summarizeGroups(roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding) []GroupSummary {
+	summaries := make(map[string]*GroupSummary)
+	namespaces := make(map[string]map[string]bool)
+
+	record := func(meta metav1.ObjectMeta, roleRef rbacv1.RoleRef, subjects []rbacv1.Subject) {
+		seen := make(map[string]bool, len(subjects))
+		for _, subject := range subjects {
+			if subject.Kind != rbacv1.GroupKind || seen[subject.Name] {
+				continue
+			}
+			seen[subject.Name] = true
+
+			summary, ok := summaries[subject.Name]
+			if !ok {
+				summary = &GroupSummary{Name: subject.Name}
+				summaries[subject.Name] = summary
+				namespaces[subject.Name] = make(map[string]bool)
+			}
+			if meta.Namespace == "" {
+				summary.ClusterRoleBindingCount++
+			} else {
+				summary.RoleBindingCount++
+				namespaces[subject.Name][meta.Namespace] = true
+			}
+			if roleRef.Kind == "ClusterRole" && roleRef.Name == "cluster-admin" {
+				summary.ClusterAdmin = true
+			}
+			if summary.LatestBinding == nil || summary.LatestBinding.Before(&meta.CreationTimestamp) {
+				created := meta.CreationTimestamp
+				summary.LatestBinding = &created
 			}
 		}
 	}
 
-	groups := make([]string, 0, len(groupSet))
-	for group := range groupSet {
-		groups = append(groups, group)
+	for _, rb := range roleBindings {
+		record(rb.ObjectMeta, rb.RoleRef, rb.Subjects)
+	}
+	for _, crb := range clusterRoleBindings {
+		record(crb.ObjectMeta, crb.RoleRef, crb.Subjects)
 	}
 
-	return groups
+	results := make([]GroupSummary, 0, len(summaries))
+	for name, summary := range summaries {
+		summary.Namespaces = make([]string, 0, len(namespaces[name]))
+		for namespace := range namespaces[name] {
+			summary.Namespaces = append(summary.Namespaces, namespace)
+		}
+		sort.Strings(summary.Namespaces)
+		if summary.LatestBinding != nil && summary.LatestBinding.IsZero() {
+			summary.LatestBinding = nil
+		}
+		results = append(results, *summary)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results
 }
@@ -0,0 +1,197 @@
+package rbac
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"rbac/pkg/discovery"
+	"rbac/pkg/httperror"
+	"rbac/pkg/permissions"
+
+	"github.com/labstack/echo/v4"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxMatrixSubjects bounds the rows of a permission matrix.
+const maxMatrixSubjects = 200
+
+// matrixVerbs are the columns of a matrix, in the order they are shown, when discovery doesn't know the
+// resource.
+var matrixVerbs = []string{"get", "list", "watch", "create", "update", "patch", "delete", "deletecollection"}
+
+// MatrixCell says whether a subject may use a verb, and which grants allow it.
+type MatrixCell struct {
+	Allowed bool `json:"allowed"`
+	// ResourceNames, when set, are the only objects the subject may use the verb on.
+	ResourceNames []string            `json:"resourceNames,omitempty"`
+	Grants        []permissions.Grant `json:"grants,omitempty"`
+}
+
+// MatrixRow is the access of a single subject.
+type MatrixRow struct {
+	Kind      string                `json:"kind"`
+	Namespace string                `json:"namespace,omitempty"`
+	Name      string                `json:"name"`
+	Cells     map[string]MatrixCell `json:"cells"`
+}
+
+// PermissionMatrix is a grid of subjects against verbs for one resource.
+type PermissionMatrix struct {
+	Resource  string      `json:"resource"`
+	APIGroup  string      `json:"apiGroup"`
+	Namespace string      `json:"namespace,omitempty"`
+	Verbs     []string    `json:"verbs"`
+	Subjects  []MatrixRow `json:"subjects"`
+	// Truncated is set when more subjects had access than are returned.
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// MatrixHandler returns which subjects may use each verb on ?resource= in ?namespace=, or cluster-wide when
+// no namespace is given. ?apiGroup= is looked up in discovery when omitted. ?subjectKind= and ?subjects=
+// (comma-separated names) narrow the rows.
+func MatrixHandler(clientset kubernetes.Interface, cache *discovery.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		resource := c.QueryParam("resource")
+		if resource == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "resource is required")
+		}
+		namespace := c.QueryParam("namespace")
+		subjectKind := c.QueryParam("subjectKind")
+		names := make(map[string]bool)
+		for _, name := range strings.Split(c.QueryParam("subjects"), ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names[name] = true
+			}
+		}
+
+		apiGroup, verbs, err := resolveResource(c, cache, resource)
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := loadPermissions(c, clientset, namespace)
+		if err != nil {
+			return httperror.Wrap(err, "Error loading RBAC objects: ")
+		}
+
+		rows := make(map[string]*MatrixRow)
+		for _, verb := range verbs {
+			req := permissions.Request{Verb: verb, APIGroup: apiGroup, Resource: resource}
+			for _, sg := range snapshot.Grants(req, namespace) {
+				subject := sg.Subject
+				if (subjectKind != "" && subject.Kind != subjectKind) || (len(names) > 0 && !names[subject.Name]) {
+					continue
+				}
+				key := subject.Kind + "/" + subject.Namespace + "/" + subject.Name
+				row, ok := rows[key]
+				if !ok {
+					row = &MatrixRow{Kind: subject.Kind, Namespace: subject.Namespace, Name: subject.Name, Cells: make(map[string]MatrixCell)}
+					rows[key] = row
+				}
+				row.Cells[verb] = addGrant(row.Cells[verb], sg.Grant)
+			}
+		}
+
+		matrix := PermissionMatrix{Resource: resource, APIGroup: apiGroup, Namespace: namespace, Verbs: verbs, Subjects: []MatrixRow{}}
+		for _, row := range rows {
+			for _, verb := range verbs {
+				if _, ok := row.Cells[verb]; !ok {
+					row.Cells[verb] = MatrixCell{}
+				}
+			}
+			matrix.Subjects = append(matrix.Subjects, *row)
+		}
+		sort.Slice(matrix.Subjects, func(i, j int) bool {
+			a, b := matrix.Subjects[i], matrix.Subjects[j]
+			if a.Kind != b.Kind {
+				return a.Kind < b.Kind
+			}
+			if a.Namespace != b.Namespace {
+				return a.Namespace < b.Namespace
+			}
+			return a.Name < b.Name
+		})
+		if len(matrix.Subjects) > maxMatrixSubjects {
+			matrix.Subjects = matrix.Subjects[:maxMatrixSubjects]
+			matrix.Truncated = true
+		}
+
+		return c.JSON(http.StatusOK, matrix)
+	}
+}
+
+// addGrant records grant in a cell. Unrestricted access is kept once any grant allows it; otherwise the
+// allowed names are merged.
+func addGrant(cell MatrixCell, grant permissions.Grant) MatrixCell {
+	restricted := len(grant.ResourceNames) > 0
+	switch {
+	case !cell.Allowed:
+		cell.ResourceNames = grant.ResourceNames
+	case len(cell.ResourceNames) > 0 && !restricted:
+		cell.ResourceNames = nil
+	case len(cell.ResourceNames) > 0:
+		cell.ResourceNames = mergeNames(cell.ResourceNames, grant.ResourceNames)
+	}
+	cell.Allowed = true
+	cell.Grants = append(cell.Grants, grant)
+	return cell
+}
+
+// mergeNames returns the sorted union of a and b.
+func mergeNames(a, b []string) []string {
+	seen := make(map[string]bool, len(a)+len(b))
+	var merged []string
+	for _, name := range append(append([]string{}, a...), b...) {
+		if !seen[name] {
+			seen[name] = true
+			merged = append(merged, name)
+		}
+	}
+	sort.Strings(merged)
+	return merged
+}
+
+// resolveResource returns the API group of resource, from ?apiGroup= or discovery, and the verbs to show
+// for it: those discovery says it supports, or the usual ones when it is unknown.
+func resolveResource(c echo.Context, cache *discovery.Cache, resource string) (string, []string, error) {
+	catalog, err := cache.Catalog(false)
+	if err != nil {
+		catalog = nil
+	}
+
+	apiGroup := c.QueryParam("apiGroup")
+	if !c.QueryParams().Has("apiGroup") && catalog != nil {
+		switch groups := catalog.GroupsServing(resource); {
+		case len(groups) == 1:
+			apiGroup = groups[0]
+		case len(groups) > 1:
+			return "", nil, echo.NewHTTPError(http.StatusBadRequest, "Several API groups serve "+resource+", pass apiGroup to choose one of: "+strings.Join(groups, ", "))
+		}
+	}
+
+	if catalog == nil {
+		return apiGroup, matrixVerbs, nil
+	}
+	known, ok := catalog.Lookup(apiGroup, resource)
+	if !ok {
+		return apiGroup, matrixVerbs, nil
+	}
+	supported := make(map[string]bool, len(known.Verbs))
+	for _, verb := range known.Verbs {
+		supported[verb] = true
+	}
+	var verbs []string
+	for _, verb := range matrixVerbs {
+		if supported[verb] {
+			verbs = append(verbs, verb)
+			delete(supported, verb)
+		}
+	}
+	for _, verb := range known.Verbs {
+		if supported[verb] {
+			verbs = append(verbs, verb)
+		}
+	}
+	return apiGroup, verbs, nil
+}
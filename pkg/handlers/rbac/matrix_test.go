@@ -0,0 +1,167 @@
+package rbac
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"rbac/pkg/discovery"
+	"rbac/pkg/permissions"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// serveJSON sends a GET for target to handler and decodes the response into out, returning the status.
+func serveJSON(t *testing.T, handler echo.HandlerFunc, target string, out any) int {
+	t.Helper()
+	e := echo.New()
+	e.GET("/", handler)
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return rec.Code
+}
+
+// matrixCluster is a cluster serving pods, where prod has readers, editors limited to one pod, and a
+// cluster-wide reader, and staging has a reader who must not show up in prod.
+func matrixCluster(objects ...runtime.Object) *fake.Clientset {
+	roleRef := func(kind, name string) rbacv1.RoleRef {
+		return rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: kind, Name: name}
+	}
+	clientset := fake.NewSimpleClientset(append([]runtime.Object{
+		&rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-reader"},
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "list", "watch"}}},
+		},
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "pod-editor", Namespace: "prod"},
+			Rules: []rbacv1.PolicyRule{
+				{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"create"}},
+				{APIGroups: []string{""}, Resources: []string{"pods"}, ResourceNames: []string{"web-0"}, Verbs: []string{"delete"}},
+			},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "readers", Namespace: "prod"},
+			RoleRef:    roleRef("ClusterRole", "pod-reader"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "editors", Namespace: "prod"},
+			RoleRef:    roleRef("Role", "pod-editor"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "devs"}, {Kind: rbacv1.ServiceAccountKind, Namespace: "prod", Name: "ci"}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "readers", Namespace: "staging"},
+			RoleRef:    roleRef("ClusterRole", "pod-reader"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "carol"}},
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "auditors"},
+			RoleRef:    roleRef("ClusterRole", "pod-reader"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "bob"}},
+		},
+	}, objects...)...)
+	clientset.Resources = []*metav1.APIResourceList{{
+		GroupVersion: "v1",
+		APIResources: []metav1.APIResource{{Name: "pods", Namespaced: true, Kind: "Pod", Verbs: metav1.Verbs{"get", "list", "watch", "create", "delete"}}},
+	}}
+	return clientset
+}
+
+func matrixHandler(clientset *fake.Clientset) echo.HandlerFunc {
+	return MatrixHandler(clientset, discovery.NewCache(clientset.Discovery(), time.Minute))
+}
+
+func TestMatrix(t *testing.T) {
+	var matrix PermissionMatrix
+	if code := serveJSON(t, matrixHandler(matrixCluster()), "/?resource=pods&namespace=prod", &matrix); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	if want := []string{"get", "list", "watch", "create", "delete"}; !slices.Equal(matrix.Verbs, want) {
+		t.Errorf("verbs = %v, want discovery's %v", matrix.Verbs, want)
+	}
+	var rows []string
+	for _, row := range matrix.Subjects {
+		rows = append(rows, row.Kind+" "+row.Namespace+"/"+row.Name)
+	}
+	if want := []string{"Group /devs", "ServiceAccount prod/ci", "User /alice", "User /bob"}; !slices.Equal(rows, want) {
+		t.Fatalf("rows = %v, want %v", rows, want)
+	}
+
+	tests := []struct {
+		row           int
+		verb          string
+		allowed       bool
+		resourceNames []string
+		grant         permissions.Grant
+	}{
+		{0, "create", true, nil, permissions.Grant{BindingKind: "RoleBinding", BindingNamespace: "prod", BindingName: "editors", RoleKind: "Role", RoleName: "pod-editor"}},
+		{0, "delete", true, []string{"web-0"}, permissions.Grant{BindingKind: "RoleBinding", BindingNamespace: "prod", BindingName: "editors", RoleKind: "Role", RoleName: "pod-editor", ResourceNames: []string{"web-0"}}},
+		{0, "get", false, nil, permissions.Grant{}},
+		{1, "create", true, nil, permissions.Grant{BindingKind: "RoleBinding", BindingNamespace: "prod", BindingName: "editors", RoleKind: "Role", RoleName: "pod-editor"}},
+		{2, "get", true, nil, permissions.Grant{BindingKind: "RoleBinding", BindingNamespace: "prod", BindingName: "readers", RoleKind: "ClusterRole", RoleName: "pod-reader"}},
+		{2, "delete", false, nil, permissions.Grant{}},
+		{3, "watch", true, nil, permissions.Grant{BindingKind: "ClusterRoleBinding", BindingName: "auditors", RoleKind: "ClusterRole", RoleName: "pod-reader"}},
+		{3, "create", false, nil, permissions.Grant{}},
+	}
+	for _, tt := range tests {
+		row := matrix.Subjects[tt.row]
+		cell, ok := row.Cells[tt.verb]
+		if !ok {
+			t.Errorf("%s %s has no %s cell", row.Kind, row.Name, tt.verb)
+			continue
+		}
+		if cell.Allowed != tt.allowed || !slices.Equal(cell.ResourceNames, tt.resourceNames) {
+			t.Errorf("%s %s %s = allowed %v on %v, want %v on %v", row.Kind, row.Name, tt.verb, cell.Allowed, cell.ResourceNames, tt.allowed, tt.resourceNames)
+		}
+		var grants []permissions.Grant
+		if tt.allowed {
+			grants = []permissions.Grant{tt.grant}
+		}
+		if fmt.Sprint(cell.Grants) != fmt.Sprint(grants) {
+			t.Errorf("%s %s %s granted by %+v, want %+v", row.Kind, row.Name, tt.verb, cell.Grants, grants)
+		}
+	}
+}
+
+func TestMatrixFiltersSubjects(t *testing.T) {
+	var matrix PermissionMatrix
+	serveJSON(t, matrixHandler(matrixCluster()), "/?resource=pods&namespace=prod&subjectKind=User&subjects=bob,%20carol", &matrix)
+	if len(matrix.Subjects) != 1 || matrix.Subjects[0].Name != "bob" {
+		t.Errorf("subjects = %+v, want only bob", matrix.Subjects)
+	}
+}
+
+func TestMatrixCapsSubjects(t *testing.T) {
+	many := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "everyone"},
+		RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "pod-reader"},
+	}
+	for i := 0; i < maxMatrixSubjects+10; i++ {
+		many.Subjects = append(many.Subjects, rbacv1.Subject{Kind: rbacv1.UserKind, Name: fmt.Sprintf("user-%03d", i)})
+	}
+
+	var matrix PermissionMatrix
+	serveJSON(t, matrixHandler(matrixCluster(many)), "/?resource=pods", &matrix)
+	if len(matrix.Subjects) != maxMatrixSubjects || !matrix.Truncated {
+		t.Errorf("%d subjects, truncated %v; want %d and truncated", len(matrix.Subjects), matrix.Truncated, maxMatrixSubjects)
+	}
+}
+
+func TestMatrixRequiresResource(t *testing.T) {
+	if code := serveJSON(t, matrixHandler(matrixCluster()), "/?namespace=prod", nil); code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", code, http.StatusBadRequest)
+	}
+}
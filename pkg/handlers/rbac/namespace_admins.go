@@ -0,0 +1,214 @@
+package rbac
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rbac/pkg/httperror"
+	"rbac/pkg/permissions"
+	"rbac/pkg/protection"
+	"rbac/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// AdminLevelAdmin is a subject that can create and update roles and role bindings, and so extend access
+	// to others.
+	AdminLevelAdmin = "admin"
+	// AdminLevelEditor is a subject holding the admin or edit ClusterRole without being able to delegate.
+	AdminLevelEditor = "editor"
+)
+
+// editorRoles are the default ClusterRoles that make their holders look after a namespace.
+var editorRoles = map[string]bool{"admin": true, "edit": true}
+
+// NamespaceAdmin is a subject with administrative access to a namespace, and the grants it holds it through.
+type NamespaceAdmin struct {
+	Subject rbacv1.Subject `json:"subject"`
+	Level   string         `json:"level"`
+	// ClusterWide is set when a cluster role binding grants the access, so it covers every namespace.
+	ClusterWide bool                `json:"clusterWide"`
+	Grants      []permissions.Grant `json:"grants"`
+}
+
+// NamespaceAdmins is who administers a namespace, admins first.
+type NamespaceAdmins struct {
+	Namespace string           `json:"namespace"`
+	Admins    []NamespaceAdmin `json:"admins"`
+}
+
+// NamespaceAdminsReport lists the administrators of each namespace.
+type NamespaceAdminsReport struct {
+	Namespaces []NamespaceAdmins `json:"namespaces"`
+}
+
+// NamespaceAdminsHandler reports, for every namespace or only ?namespace=, the subjects that can extend
+// access in it by creating and updating roles and role bindings, and those that hold the admin or edit
+// ClusterRole without being able to. Access through cluster role bindings is listed under every namespace.
+// System bindings and subjects are left out unless ?includeSystem=true; ?format=csv downloads the report.
+func NamespaceAdminsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		namespace := c.QueryParam("namespace")
+		if namespace != "" {
+			if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid namespace: "+errs[0])
+			}
+		}
+		includeSystem := false
+		if value := c.QueryParam("includeSystem"); value != "" {
+			var err error
+			if includeSystem, err = strconv.ParseBool(value); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "includeSystem must be true or false")
+			}
+		}
+		format := c.QueryParam("format")
+		if format != "" && format != "json" && format != "csv" {
+			return echo.NewHTTPError(http.StatusBadRequest, "format must be json or csv")
+		}
+
+		ctx := c.Request().Context()
+		namespaces := []string{namespace}
+		if namespace == "" {
+			list, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return httperror.Wrap(err, "Error listing namespaces: ")
+			}
+			namespaces = namespaces[:0]
+			for _, ns := range list.Items {
+				namespaces = append(namespaces, ns.Name)
+			}
+			sort.Strings(namespaces)
+		}
+		snapshot, err := loadPermissions(c, clientset, namespace)
+		if err != nil {
+			return httperror.Wrap(err, "Error loading RBAC objects: ")
+		}
+
+		report := namespaceAdmins(snapshot, namespaces, includeSystem)
+		if format == "csv" {
+			return respondNamespaceAdminsCSV(c, report)
+		}
+		return c.JSON(http.StatusOK, report)
+	}
+}
+
+// namespaceAdmins builds the report for namespaces from snapshot.
+func namespaceAdmins(snapshot *permissions.Snapshot, namespaces []string, includeSystem bool) NamespaceAdminsReport {
+	// bindings are classified once; cluster-wide ones apply to every namespace
+	type classified struct {
+		subjects  []rbacv1.Subject
+		grant     permissions.Grant
+		delegates bool
+	}
+	classify := func(meta metav1.ObjectMeta, namespace string, ref rbacv1.RoleRef, subjects []rbacv1.Subject, grant permissions.Grant) (classified, bool) {
+		if !includeSystem && protection.IsSystem(meta) {
+			return classified{}, false
+		}
+		delegates := canDelegate(snapshot.Rules(namespace, ref), namespace)
+		if !delegates && !(ref.Kind == "ClusterRole" && editorRoles[ref.Name]) {
+			return classified{}, false
+		}
+		return classified{subjects: subjects, grant: grant, delegates: delegates}, true
+	}
+
+	var clusterWide []classified
+	for _, crb := range snapshot.ClusterRoleBindings {
+		grant := permissions.Grant{BindingKind: "ClusterRoleBinding", BindingName: crb.Name, RoleKind: crb.RoleRef.Kind, RoleName: crb.RoleRef.Name}
+		if binding, ok := classify(crb.ObjectMeta, "", crb.RoleRef, crb.Subjects, grant); ok {
+			clusterWide = append(clusterWide, binding)
+		}
+	}
+	byNamespace := make(map[string][]classified)
+	for _, rb := range snapshot.RoleBindings {
+		grant := permissions.Grant{BindingKind: "RoleBinding", BindingNamespace: rb.Namespace, BindingName: rb.Name, RoleKind: rb.RoleRef.Kind, RoleName: rb.RoleRef.Name}
+		if binding, ok := classify(rb.ObjectMeta, rb.Namespace, rb.RoleRef, rb.Subjects, grant); ok {
+			byNamespace[rb.Namespace] = append(byNamespace[rb.Namespace], binding)
+		}
+	}
+
+	report := NamespaceAdminsReport{Namespaces: []NamespaceAdmins{}}
+	for _, namespace := range namespaces {
+		admins := make(map[string]*NamespaceAdmin)
+		var order []string
+		for _, binding := range append(append([]classified{}, byNamespace[namespace]...), clusterWide...) {
+			for _, subject := range binding.subjects {
+				if !includeSystem && strings.HasPrefix(subject.Name, "system:") {
+					continue
+				}
+				if subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == "" {
+					subject.Namespace = namespace
+				}
+				key := subject.Kind + "/" + subject.Namespace + "/" + subject.Name
+				admin, ok := admins[key]
+				if !ok {
+					admin = &NamespaceAdmin{Subject: subject, Level: AdminLevelEditor}
+					admins[key] = admin
+					order = append(order, key)
+				}
+				if binding.delegates {
+					admin.Level = AdminLevelAdmin
+				}
+				if binding.grant.BindingKind == "ClusterRoleBinding" {
+					admin.ClusterWide = true
+				}
+				admin.Grants = append(admin.Grants, binding.grant)
+			}
+		}
+
+		entry := NamespaceAdmins{Namespace: namespace, Admins: []NamespaceAdmin{}}
+		for _, key := range order {
+			entry.Admins = append(entry.Admins, *admins[key])
+		}
+		sort.SliceStable(entry.Admins, func(i, j int) bool {
+			return entry.Admins[i].Level == AdminLevelAdmin && entry.Admins[j].Level != AdminLevelAdmin
+		})
+		report.Namespaces = append(report.Namespaces, entry)
+	}
+	return report
+}
+
+// canDelegate reports whether rules, granted in namespace or cluster-wide when it is "", allow creating and
+// updating both roles and role bindings without restriction to named objects, which lets their holder hand
+// out access.
+func canDelegate(rules []rbacv1.PolicyRule, namespace string) bool {
+	for _, resource := range []string{"roles", "rolebindings"} {
+		for _, verb := range []string{"create", "update"} {
+			match := permissions.MatchBinding(rules, permissions.Request{Verb: verb, APIGroup: rbacv1.GroupName, Resource: resource}, namespace)
+			if !match.Allowed || match.Restricted() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// respondNamespaceAdminsCSV streams the report as a CSV download, one row per namespace and subject.
+func respondNamespaceAdminsCSV(c echo.Context, report NamespaceAdminsReport) error {
+	w, err := utils.StartCSV(c.Response(), "namespace-admins", []string{"namespace", "level", "subjectKind", "subjectNamespace", "subjectName", "clusterWide", "grants"})
+	if err != nil {
+		return err
+	}
+	for _, ns := range report.Namespaces {
+		for _, admin := range ns.Admins {
+			var grants []string
+			for _, grant := range admin.Grants {
+				binding := grant.BindingName
+				if grant.BindingNamespace != "" {
+					binding = grant.BindingNamespace + "/" + binding
+				}
+				grants = append(grants, grant.BindingKind+" "+binding+" -> "+grant.RoleKind+" "+grant.RoleName)
+			}
+			if err := w.Write([]string{ns.Namespace, admin.Level, admin.Subject.Kind, admin.Subject.Namespace, admin.Subject.Name, strconv.FormatBool(admin.ClusterWide), strings.Join(grants, "; ")}); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Close()
+}
@@ -1,8 +1,10 @@
 package rbac
 
 import (
-	"context"
 	"net/http"
+	"rbac/pkg/audit"
+	"rbac/pkg/managed"
+	"rbac/pkg/protection"
 	"rbac/pkg/utils"
 
 	"github.com/labstack/echo/v4"
@@ -12,9 +14,9 @@ import (
 )
 
 // NamespacesHandler handles requests related to namespaces.
-func NamespacesHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func NamespacesHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		handlers := map[string]func(echo.Context, *kubernetes.Clientset, string) error{
+		handlers := map[string]func(echo.Context, kubernetes.Interface, string) error{
 			http.MethodGet:    handleListNamespaces,
 			http.MethodPost:   handleCreateNamespace,
 			http.MethodDelete: handleDeleteNamespace,
@@ -25,24 +27,52 @@ func NamespacesHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
 }
 
 // handleListNamespaces lists all namespaces.
-func handleListNamespaces(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+func handleListNamespaces(c echo.Context, clientset kubernetes.Interface, _ string) error {
 	return utils.ListResources(c, clientset, "", func(namespace string, opts metav1.ListOptions) (interface{}, error) {
-		return clientset.CoreV1().Namespaces().List(context.TODO(), opts)
+		return clientset.CoreV1().Namespaces().List(c.Request().Context(), opts)
 	})
 }
 
 // handleCreateNamespace creates a new namespace.
-func handleCreateNamespace(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+func handleCreateNamespace(c echo.Context, clientset kubernetes.Interface, _ string) error {
 	var namespace corev1.Namespace
 	return utils.CreateResource(c, clientset, "", &namespace, func(namespace string, obj interface{}, opts metav1.CreateOptions) (interface{}, error) {
-		return clientset.CoreV1().Namespaces().Create(context.TODO(), obj.(*corev1.Namespace), opts)
+		desired := obj.(*corev1.Namespace)
+		managed.Stamp(&desired.ObjectMeta, audit.Actor(c))
+		return clientset.CoreV1().Namespaces().Create(c.Request().Context(), desired, opts)
 	})
 }
 
 // handleDeleteNamespace deletes a namespace by name.
-func handleDeleteNamespace(c echo.Context, clientset *kubernetes.Clientset, _ string) error {
+func handleDeleteNamespace(c echo.Context, clientset kubernetes.Interface, _ string) error {
 	name := c.QueryParam("name")
 	return utils.DeleteResource(c, clientset, "", name, func(namespace, name string, opts metav1.DeleteOptions) error {
-		return clientset.CoreV1().Namespaces().Delete(context.TODO(), name, opts)
+		existing, err := clientset.CoreV1().Namespaces().Get(c.Request().Context(), name, metav1.GetOptions{})
+		if err := existingError(err, "namespace"); err != nil {
+			return err
+		}
+		if err := protection.Check(c, name, existing.ObjectMeta); err != nil {
+			return err
+		}
+		if err := managed.CheckConflict(c, existing.ObjectMeta); err != nil {
+			return err
+		}
+		return clientset.CoreV1().Namespaces().Delete(c.Request().Context(), name, opts)
 	})
-}
\ No newline at end of file
+}
+// NamespaceDetailsHandler returns the namespace called ?name=, or 404 when there is none.
+func NamespaceDetailsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		name := c.QueryParam("name")
+		if name == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Namespace name is required")
+		}
+
+		namespace, err := clientset.CoreV1().Namespaces().Get(c.Request().Context(), name, metav1.GetOptions{})
+		if err != nil {
+			return detailsError(err, "namespace", "", name)
+		}
+
+		return c.JSON(http.StatusOK, namespace)
+	}
+}
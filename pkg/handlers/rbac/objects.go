@@ -0,0 +1,73 @@
+package rbac
+
+import (
+	"rbac/pkg/cache"
+	"rbac/pkg/permissions"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// The list functions below read every role or binding from the informer cache when the request may use it,
+// and from the API server otherwise, so handlers needing all of them never wait on a LIST of thousands.
+
+// listRoles lists the roles of namespace, or of every namespace when it is "".
+func listRoles(c echo.Context, clientset kubernetes.Interface, namespace string) (*rbacv1.RoleList, error) {
+	if informers := cache.From(c); informers != nil {
+		return &rbacv1.RoleList{Items: informers.Roles(namespace)}, nil
+	}
+	return clientset.RbacV1().Roles(namespace).List(c.Request().Context(), metav1.ListOptions{})
+}
+
+// listClusterRoles lists every cluster role.
+func listClusterRoles(c echo.Context, clientset kubernetes.Interface) (*rbacv1.ClusterRoleList, error) {
+	if informers := cache.From(c); informers != nil {
+		return &rbacv1.ClusterRoleList{Items: informers.ClusterRoles()}, nil
+	}
+	return clientset.RbacV1().ClusterRoles().List(c.Request().Context(), metav1.ListOptions{})
+}
+
+// listRoleBindings lists the role bindings of namespace, or of every namespace when it is "".
+func listRoleBindings(c echo.Context, clientset kubernetes.Interface, namespace string) (*rbacv1.RoleBindingList, error) {
+	if informers := cache.From(c); informers != nil {
+		return &rbacv1.RoleBindingList{Items: informers.RoleBindings(namespace)}, nil
+	}
+	return clientset.RbacV1().RoleBindings(namespace).List(c.Request().Context(), metav1.ListOptions{})
+}
+
+// listClusterRoleBindings lists every cluster role binding.
+func listClusterRoleBindings(c echo.Context, clientset kubernetes.Interface) (*rbacv1.ClusterRoleBindingList, error) {
+	if informers := cache.From(c); informers != nil {
+		return &rbacv1.ClusterRoleBindingList{Items: informers.ClusterRoleBindings()}, nil
+	}
+	return clientset.RbacV1().ClusterRoleBindings().List(c.Request().Context(), metav1.ListOptions{})
+}
+
+// listRoleBindingsNaming lists the role bindings that may name the subject of kind called name. Only the
+// cache can look them up by subject, so without it every role binding is listed; callers still match the
+// subjects themselves.
+func listRoleBindingsNaming(c echo.Context, clientset kubernetes.Interface, kind, name string) (*rbacv1.RoleBindingList, error) {
+	if informers := cache.From(c); informers != nil {
+		return &rbacv1.RoleBindingList{Items: informers.RoleBindingsNaming(kind, name)}, nil
+	}
+	return clientset.RbacV1().RoleBindings("").List(c.Request().Context(), metav1.ListOptions{})
+}
+
+// listClusterRoleBindingsNaming lists the cluster role bindings that may name the subject of kind called
+// name, like listRoleBindingsNaming.
+func listClusterRoleBindingsNaming(c echo.Context, clientset kubernetes.Interface, kind, name string) (*rbacv1.ClusterRoleBindingList, error) {
+	if informers := cache.From(c); informers != nil {
+		return &rbacv1.ClusterRoleBindingList{Items: informers.ClusterRoleBindingsNaming(kind, name)}, nil
+	}
+	return clientset.RbacV1().ClusterRoleBindings().List(c.Request().Context(), metav1.ListOptions{})
+}
+
+// loadPermissions builds the permission snapshot of namespace, or of every namespace when it is "".
+func loadPermissions(c echo.Context, clientset kubernetes.Interface, namespace string) (*permissions.Snapshot, error) {
+	if informers := cache.From(c); informers != nil {
+		return permissions.NewSnapshot(informers.Roles(namespace), informers.ClusterRoles(), informers.RoleBindings(namespace), informers.ClusterRoleBindings()), nil
+	}
+	return permissions.Load(c.Request().Context(), clientset, namespace)
+}
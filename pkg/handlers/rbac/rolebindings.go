@@ -1,9 +1,15 @@
 package rbac
 
 import (
-	"context"
 	"net/http"
+	"rbac/pkg/audit"
+	"rbac/pkg/expiry"
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
+	"rbac/pkg/managed"
+	"rbac/pkg/protection"
 	"rbac/pkg/utils"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	rbacv1 "k8s.io/api/rbac/v1"
@@ -12,14 +18,14 @@ import (
 )
 
 // RoleBindingsHandler handles role binding-related requests.
-func RoleBindingsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func RoleBindingsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		namespace := c.QueryParam("namespace")
 		if namespace == "" {
 			namespace = "default"
 		}
 
-		handlers := map[string]func(echo.Context, *kubernetes.Clientset, string) error{
+		handlers := map[string]func(echo.Context, kubernetes.Interface, string) error{
 			http.MethodGet:    handleListRoleBindings,
 			http.MethodPost:   handleCreateRoleBinding,
 			http.MethodPut:    handleUpdateRoleBinding,
@@ -30,49 +36,147 @@ func RoleBindingsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
 	}
 }
 
-// handleListRoleBindings lists all role bindings in a specific namespace.
-func handleListRoleBindings(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
-	return utils.ListResources(c, clientset, namespace, func(namespace string, opts metav1.ListOptions) (interface{}, error) {
-		return clientset.RbacV1().RoleBindings(namespace).List(context.TODO(), opts)
-	})
+// handleListRoleBindings lists the role bindings in a specific namespace, or in every namespace when it is
+// "all", with their expiry and ownership, narrowed by ?roleName=, ?roleKind=, ?subjectKind=, ?subjectName=,
+// ?subjectContains= and ?expired=. Bindings are filtered after paging, so a page may hold fewer than ?limit=.
+func handleListRoleBindings(c echo.Context, clientset kubernetes.Interface, namespace string) error {
+	filter, err := parseBindingFilter(c)
+	if err != nil {
+		return err
+	}
+	opts, order, err := utils.ListOptions(c)
+	if err != nil {
+		return err
+	}
+	if namespace == "all" {
+		namespace = ""
+	}
+
+	list, err := clientset.RbacV1().RoleBindings(namespace).List(c.Request().Context(), opts)
+	if err != nil {
+		return httperror.Wrap(err, "Error listing role bindings: ")
+	}
+
+	listing.Sort(list.Items, order, func(binding *rbacv1.RoleBinding) metav1.Object { return binding })
+	now := time.Now()
+	result := BindingList[RoleBindingWithStatus]{TypeMeta: list.TypeMeta, ListMeta: list.ListMeta}
+	var warnings []string
+	for _, rb := range list.Items {
+		status := bindingStatus(rb.ObjectMeta, now)
+		if !filter.matches(rb.RoleRef, rb.Subjects) || !filter.matchesStatus(status) {
+			continue
+		}
+		result.Items = append(result.Items, RoleBindingWithStatus{RoleBinding: rb, BindingStatus: status})
+		warnings = append(warnings, statusWarnings(rb.ObjectMeta, status)...)
+	}
+	return respondBindings(c, result, warnings)
 }
 
 // handleCreateRoleBinding creates a new role binding in a specific namespace.
-func handleCreateRoleBinding(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+func handleCreateRoleBinding(c echo.Context, clientset kubernetes.Interface, namespace string) error {
+	expiresAt, err := expiry.Parse(c.QueryParam("expiresAt"), c.QueryParam("expiresIn"), time.Now())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid expiry: "+err.Error())
+	}
+	dryRun, err := dryRunOption(c)
+	if err != nil {
+		return err
+	}
+
 	var roleBinding rbacv1.RoleBinding
 	return utils.CreateResource(c, clientset, namespace, &roleBinding, func(namespace string, obj interface{}, opts metav1.CreateOptions) (interface{}, error) {
-		return clientset.RbacV1().RoleBindings(namespace).Create(context.TODO(), obj.(*rbacv1.RoleBinding), opts)
+		binding := obj.(*rbacv1.RoleBinding)
+		if err := utils.ValidateRoleBinding(binding); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid role binding: "+err.Error())
+		}
+		opts.DryRun = dryRun
+		managed.Stamp(&binding.ObjectMeta, audit.Actor(c))
+		if expiresAt != nil {
+			expiry.Stamp(&binding.ObjectMeta, *expiresAt)
+		}
+		created, err := clientset.RbacV1().RoleBindings(namespace).Create(c.Request().Context(), binding, opts)
+		if err == nil {
+			annotateChange(c, namespace, created.Name, nil, created)
+		}
+		return created, err
 	})
 }
 
 // handleUpdateRoleBinding updates an existing role binding in a specific namespace.
-func handleUpdateRoleBinding(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+func handleUpdateRoleBinding(c echo.Context, clientset kubernetes.Interface, namespace string) error {
+	dryRun, err := dryRunOption(c)
+	if err != nil {
+		return err
+	}
+
 	var roleBinding rbacv1.RoleBinding
 	return utils.UpdateResource(c, clientset, namespace, &roleBinding, func(namespace string, obj interface{}, opts metav1.UpdateOptions) (interface{}, error) {
-		return clientset.RbacV1().RoleBindings(namespace).Update(context.TODO(), obj.(*rbacv1.RoleBinding), opts)
+		desired := obj.(*rbacv1.RoleBinding)
+		if err := utils.ValidateRoleBinding(desired); err != nil {
+			return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid role binding: "+err.Error())
+		}
+		opts.DryRun = dryRun
+		existing, err := clientset.RbacV1().RoleBindings(namespace).Get(c.Request().Context(), desired.Name, metav1.GetOptions{})
+		if err := existingError(err, "role binding"); err != nil {
+			return nil, err
+		}
+		if err := protection.Check(c, desired.Name, existing.ObjectMeta); err != nil {
+			return nil, err
+		}
+		if err := managed.CheckConflict(c, existing.ObjectMeta); err != nil {
+			return nil, err
+		}
+		managed.Adopt(&desired.ObjectMeta, existing.ObjectMeta, audit.Actor(c))
+		updated, err := clientset.RbacV1().RoleBindings(namespace).Update(c.Request().Context(), desired, opts)
+		if err == nil {
+			annotateChange(c, namespace, updated.Name, existing, updated)
+		}
+		return updated, err
 	})
 }
 
 // handleDeleteRoleBinding deletes a role binding in a specific namespace.
-func handleDeleteRoleBinding(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+func handleDeleteRoleBinding(c echo.Context, clientset kubernetes.Interface, namespace string) error {
 	name := c.QueryParam("name")
+	dryRun, err := dryRunOption(c)
+	if err != nil {
+		return err
+	}
 	return utils.DeleteResource(c, clientset, namespace, name, func(namespace, name string, opts metav1.DeleteOptions) error {
-		return clientset.RbacV1().RoleBindings(namespace).Delete(context.TODO(), name, opts)
+		existing, err := clientset.RbacV1().RoleBindings(namespace).Get(c.Request().Context(), name, metav1.GetOptions{})
+		if err := existingError(err, "role binding"); err != nil {
+			return err
+		}
+		if err := protection.Check(c, name, existing.ObjectMeta); err != nil {
+			return err
+		}
+		opts.DryRun = dryRun
+		if err := managed.CheckConflict(c, existing.ObjectMeta); err != nil {
+			return err
+		}
+		if err := clientset.RbacV1().RoleBindings(namespace).Delete(c.Request().Context(), name, opts); err != nil {
+			return err
+		}
+		annotateChange(c, namespace, name, existing, nil)
+		return nil
 	})
 }
 
 // RoleBindingDetailsHandler handles fetching detailed information about a specific role binding.
-func RoleBindingDetailsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func RoleBindingDetailsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		roleBindingName := c.QueryParam("name")
+		if roleBindingName == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "Role binding name is required")
+		}
 		namespace := c.QueryParam("namespace")
 		if namespace == "" {
 			namespace = "default"
 		}
 
-		roleBinding, err := clientset.RbacV1().RoleBindings(namespace).Get(context.TODO(), roleBindingName, metav1.GetOptions{})
+		roleBinding, err := clientset.RbacV1().RoleBindings(namespace).Get(c.Request().Context(), roleBindingName, metav1.GetOptions{})
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error fetching role binding details: "+err.Error())
+			return detailsError(err, "role binding", namespace, roleBindingName)
 		}
 
 		return c.JSON(http.StatusOK, roleBinding)
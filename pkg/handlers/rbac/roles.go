@@ -3,6 +3,12 @@ package rbac
 import (
 	"context"
 	"net/http"
+	"rbac/pkg/audit"
+	"rbac/pkg/discovery"
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
+	"rbac/pkg/managed"
+	"rbac/pkg/protection"
 	"rbac/pkg/utils"
 
 	"github.com/labstack/echo/v4"
@@ -12,14 +18,14 @@ import (
 )
 
 // RolesHandler handles role-related requests.
-func RolesHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func RolesHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		namespace := c.QueryParam("namespace")
 		if namespace == "" {
 			namespace = "default"
 		}
 
-		handlers := map[string]func(echo.Context, *kubernetes.Clientset, string) error{
+		handlers := map[string]func(echo.Context, kubernetes.Interface, string) error{
 			http.MethodGet:    handleGetRoles,
 			http.MethodPost:   handleCreateRole,
 			http.MethodPut:    handleUpdateRole,
@@ -30,54 +36,72 @@ func RolesHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
 	}
 }
 
-// handleGetRoles handles listing roles in a specific namespace or across all namespaces.
-func handleGetRoles(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+// handleGetRoles handles listing roles in a specific namespace or across all namespaces, paged, selected and
+// sorted as the request asks.
+func handleGetRoles(c echo.Context, clientset kubernetes.Interface, namespace string) error {
+	opts, order, err := utils.ListOptions(c)
+	if err != nil {
+		return err
+	}
+
 	if namespace == "all" {
-		return listAllNamespacesRoles(c, clientset)
+		return listAllNamespacesRoles(c, clientset, opts, order)
 	}
-	return listNamespaceRoles(c, clientset, namespace)
+	return listNamespaceRoles(c, clientset, namespace, opts, order)
 }
 
 // listNamespaceRoles lists roles in a specific namespace.
-func listNamespaceRoles(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
-	roles, err := clientset.RbacV1().Roles(namespace).List(context.TODO(), metav1.ListOptions{})
+func listNamespaceRoles(c echo.Context, clientset kubernetes.Interface, namespace string, opts metav1.ListOptions, order listing.Order) error {
+	roles, err := clientset.RbacV1().Roles(namespace).List(c.Request().Context(), opts)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error listing roles: "+err.Error())
+		return httperror.Wrap(err, "Error listing roles: ")
 	}
 
+	listing.Sort(roles.Items, order, func(role *rbacv1.Role) metav1.Object { return role })
 	var rolesWithStatus []RoleWithStatus
 	for _, role := range roles.Items {
-		active, err := IsRoleActive(clientset, role.Name, namespace)
+		active, err := IsRoleActive(c.Request().Context(), clientset, role.Name, namespace)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error checking if role is active: "+err.Error())
+			return httperror.Wrap(err, "Error checking if role is active: ")
 		}
 		rolesWithStatus = append(rolesWithStatus, RoleWithStatus{Role: role, Active: active})
 	}
 
-	return c.JSON(http.StatusOK, rolesWithStatus)
+	return listing.Respond(c, rolesWithStatus, pageMeta(roles.ListMeta, len(rolesWithStatus)))
 }
 
 // listAllNamespacesRoles lists roles across all namespaces.
-func listAllNamespacesRoles(c echo.Context, clientset *kubernetes.Clientset) error {
-	roles, err := clientset.RbacV1().Roles("").List(context.TODO(), metav1.ListOptions{})
+func listAllNamespacesRoles(c echo.Context, clientset kubernetes.Interface, opts metav1.ListOptions, order listing.Order) error {
+	roles, err := clientset.RbacV1().Roles("").List(c.Request().Context(), opts)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error listing roles across all namespaces: "+err.Error())
+		return httperror.Wrap(err, "Error listing roles across all namespaces: ")
 	}
 
+	listing.Sort(roles.Items, order, func(role *rbacv1.Role) metav1.Object { return role })
 	var rolesWithStatus []RoleWithStatus
 	for _, role := range roles.Items {
-		active, err := IsRoleActive(clientset, role.Name, role.Namespace)
+		active, err := IsRoleActive(c.Request().Context(), clientset, role.Name, role.Namespace)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error checking if role is active: "+err.Error())
+			return httperror.Wrap(err, "Error checking if role is active: ")
 		}
 		rolesWithStatus = append(rolesWithStatus, RoleWithStatus{Role: role, Active: active})
 	}
 
-	return c.JSON(http.StatusOK, rolesWithStatus)
+	return listing.Respond(c, rolesWithStatus, pageMeta(roles.ListMeta, len(rolesWithStatus)))
+}
+
+// pageMeta describes a page of count items listed with list, counting the items the server has left in the
+// total as respondList does.
+func pageMeta(list metav1.ListMeta, count int) listing.Meta {
+	meta := listing.Meta{Continue: list.Continue}
+	if list.RemainingItemCount != nil {
+		meta.Total = count + int(*list.RemainingItemCount)
+	}
+	return meta
 }
 
 // handleCreateRole handles creating a new role in a specific namespace.
-func handleCreateRole(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+func handleCreateRole(c echo.Context, clientset kubernetes.Interface, namespace string) error {
 	var role rbacv1.Role
 	if err := c.Bind(&role); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Failed to decode request body: "+err.Error())
@@ -87,16 +111,20 @@ func handleCreateRole(c echo.Context, clientset *kubernetes.Clientset, namespace
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid role: "+err.Error())
 	}
 
-	createdRole, err := clientset.RbacV1().Roles(namespace).Create(context.TODO(), &role, metav1.CreateOptions{})
+	managed.Stamp(&role.ObjectMeta, audit.Actor(c))
+	createdRole, err := clientset.RbacV1().Roles(namespace).Create(c.Request().Context(), &role, metav1.CreateOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create role: "+err.Error())
+		return httperror.Wrap(err, "Failed to create role: ")
 	}
 
+	annotateChange(c, namespace, createdRole.Name, nil, createdRole)
+	discovery.Warn(c, createdRole.Rules)
+
 	return c.JSON(http.StatusOK, createdRole)
 }
 
 // handleUpdateRole handles updating an existing role in a specific namespace.
-func handleUpdateRole(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+func handleUpdateRole(c echo.Context, clientset kubernetes.Interface, namespace string) error {
 	var role rbacv1.Role
 	if err := c.Bind(&role); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Failed to decode request body: "+err.Error())
@@ -106,26 +134,54 @@ func handleUpdateRole(c echo.Context, clientset *kubernetes.Clientset, namespace
 		return echo.NewHTTPError(http.StatusBadRequest, "Invalid role: "+err.Error())
 	}
 
-	updatedRole, err := clientset.RbacV1().Roles(namespace).Update(context.TODO(), &role, metav1.UpdateOptions{})
+	existingRole, err := clientset.RbacV1().Roles(namespace).Get(c.Request().Context(), role.Name, metav1.GetOptions{})
+	if err := existingError(err, "role"); err != nil {
+		return err
+	}
+	if err := protection.Check(c, role.Name, existingRole.ObjectMeta); err != nil {
+		return err
+	}
+	if err := managed.CheckConflict(c, existingRole.ObjectMeta); err != nil {
+		return err
+	}
+	managed.Adopt(&role.ObjectMeta, existingRole.ObjectMeta, audit.Actor(c))
+
+	updatedRole, err := clientset.RbacV1().Roles(namespace).Update(c.Request().Context(), &role, metav1.UpdateOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update role: "+err.Error())
+		return httperror.Wrap(err, "Failed to update role: ")
 	}
 
+	annotateChange(c, namespace, updatedRole.Name, existingRole, updatedRole)
+	discovery.Warn(c, updatedRole.Rules)
+
 	return c.JSON(http.StatusOK, updatedRole)
 }
 
 // handleDeleteRole handles deleting a role in a specific namespace.
-func handleDeleteRole(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+func handleDeleteRole(c echo.Context, clientset kubernetes.Interface, namespace string) error {
 	name := c.QueryParam("name")
 	if name == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "Role name is required")
 	}
 
-	err := clientset.RbacV1().Roles(namespace).Delete(context.TODO(), name, metav1.DeleteOptions{})
+	existingRole, err := clientset.RbacV1().Roles(namespace).Get(c.Request().Context(), name, metav1.GetOptions{})
+	if err := existingError(err, "role"); err != nil {
+		return err
+	}
+	if err := protection.Check(c, name, existingRole.ObjectMeta); err != nil {
+		return err
+	}
+	if err := managed.CheckConflict(c, existingRole.ObjectMeta); err != nil {
+		return err
+	}
+
+	err = clientset.RbacV1().Roles(namespace).Delete(c.Request().Context(), name, metav1.DeleteOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete role: "+err.Error())
+		return httperror.Wrap(err, "Failed to delete role: ")
 	}
 
+	annotateChange(c, namespace, name, existingRole, nil)
+
 	return c.JSON(http.StatusOK, map[string]string{"message": "Role deleted successfully"})
 }
 
@@ -136,9 +192,9 @@ type RoleWithStatus struct {
 }
 
 // IsRoleActive checks if a role is active by looking for any role bindings that reference it.
-func IsRoleActive(clientset *kubernetes.Clientset, roleName, namespace string) (bool, error) {
+func IsRoleActive(ctx context.Context, clientset kubernetes.Interface, roleName, namespace string) (bool, error) {
 	// Check RoleBindings in the namespace
-	roleBindings, err := clientset.RbacV1().RoleBindings(namespace).List(context.TODO(), metav1.ListOptions{})
+	roleBindings, err := clientset.RbacV1().RoleBindings(namespace).List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return false, err
 	}
@@ -158,35 +214,38 @@ type RoleDetailsResponse struct {
 }
 
 // RoleDetailsHandler handles fetching detailed information about a specific role.
-func RoleDetailsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func RoleDetailsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		return getRoleDetails(c, clientset)
 	}
 }
 
 // getRoleDetails fetches detailed information about a specific role.
-func getRoleDetails(c echo.Context, clientset *kubernetes.Clientset) error {
+func getRoleDetails(c echo.Context, clientset kubernetes.Interface) error {
 	roleName := c.QueryParam("roleName")
+	if roleName == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Role name is required")
+	}
 	namespace := c.QueryParam("namespace")
 	if namespace == "" {
 		namespace = "default"
 	}
 
-	role, err := clientset.RbacV1().Roles(namespace).Get(context.TODO(), roleName, metav1.GetOptions{})
+	role, err := clientset.RbacV1().Roles(namespace).Get(c.Request().Context(), roleName, metav1.GetOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error fetching role details: "+err.Error())
+		return detailsError(err, "role", namespace, roleName)
 	}
 
-	roleBindings, err := clientset.RbacV1().RoleBindings(namespace).List(context.TODO(), metav1.ListOptions{})
+	roleBindings, err := clientset.RbacV1().RoleBindings(namespace).List(c.Request().Context(), metav1.ListOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error listing role bindings: "+err.Error())
+		return httperror.Wrap(err, "Error listing role bindings: ")
 	}
 
 	associatedBindings := filterRoleBindings(roleBindings.Items, roleName)
 
-	active, err := IsRoleActive(clientset, roleName, namespace)
+	active, err := IsRoleActive(c.Request().Context(), clientset, roleName, namespace)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error checking if role is active: "+err.Error())
+		return httperror.Wrap(err, "Error checking if role is active: ")
 	}
 
 	response := RoleDetailsResponse{
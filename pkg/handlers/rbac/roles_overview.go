@@ -0,0 +1,127 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"rbac/internal/workpool"
+	"rbac/pkg/httperror"
+
+	"github.com/labstack/echo/v4"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// NamespaceRoles are the roles of one namespace on a page of the roles overview.
+type NamespaceRoles struct {
+	Namespace string `json:"namespace"`
+	// Count is the number of matching roles in the namespace, including those on other pages.
+	Count int           `json:"count"`
+	Roles []rbacv1.Role `json:"roles"`
+}
+
+// RolesOverview is a page of roles across namespaces, grouped by namespace.
+type RolesOverview struct {
+	Total      int              `json:"total"`
+	Offset     int              `json:"offset"`
+	Limit      int              `json:"limit"`
+	Namespaces []NamespaceRoles `json:"namespaces"`
+	// Partial is set when some namespaces could not be listed; Warnings says which.
+	Partial  bool     `json:"partial,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// RolesOverviewHandler lists the roles of every namespace, grouped by namespace, filtered by ?labelSelector=
+// and paged with ?offset= and ?limit=. When roles can't be listed cluster-wide it lists each visible
+// namespace instead, concurrency at a time, reporting the namespaces that failed as warnings.
+func RolesOverviewHandler(clientset kubernetes.Interface, concurrency int) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		selector := c.QueryParam("labelSelector")
+		if _, err := labels.Parse(selector); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid labelSelector: "+err.Error())
+		}
+		offset, err := intParam(c, "offset", 0, 0, -1)
+		if err != nil {
+			return err
+		}
+		limit, err := intParam(c, "limit", defaultPageSize, 1, maxPageSize)
+		if err != nil {
+			return err
+		}
+
+		ctx := c.Request().Context()
+		opts := metav1.ListOptions{LabelSelector: selector}
+		overview := RolesOverview{Offset: offset, Limit: limit, Namespaces: []NamespaceRoles{}}
+
+		var roles []rbacv1.Role
+		list, err := clientset.RbacV1().Roles("").List(ctx, opts)
+		switch {
+		case err == nil:
+			roles = list.Items
+		case apierrors.IsForbidden(err):
+			namespaces, err := clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return httperror.Wrap(err, "Error listing namespaces: ")
+			}
+			results := workpool.Run(ctx, concurrency, namespaces.Items, func(ctx context.Context, namespace corev1.Namespace) ([]rbacv1.Role, error) {
+				list, err := clientset.RbacV1().Roles(namespace.Name).List(ctx, opts)
+				if err != nil {
+					return nil, err
+				}
+				return list.Items, nil
+			})
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			for _, result := range results {
+				switch {
+				case apierrors.IsForbidden(result.Err):
+					overview.Partial = true
+					overview.Warnings = append(overview.Warnings, "Not allowed to list roles in namespace "+result.Item.Name)
+				case result.Err != nil:
+					overview.Partial = true
+					overview.Warnings = append(overview.Warnings, "Error listing roles in namespace "+result.Item.Name+": "+result.Err.Error())
+				default:
+					roles = append(roles, result.Value...)
+				}
+			}
+		default:
+			return httperror.Wrap(err, "Error listing roles across all namespaces: ")
+		}
+
+		sort.Slice(roles, func(i, j int) bool {
+			if roles[i].Namespace != roles[j].Namespace {
+				return roles[i].Namespace < roles[j].Namespace
+			}
+			return roles[i].Name < roles[j].Name
+		})
+
+		counts := make(map[string]int)
+		for _, role := range roles {
+			counts[role.Namespace]++
+		}
+
+		overview.Total = len(roles)
+		if offset < len(roles) {
+			end := offset + limit
+			if end > len(roles) {
+				end = len(roles)
+			}
+			for _, role := range roles[offset:end] {
+				last := len(overview.Namespaces) - 1
+				if last < 0 || overview.Namespaces[last].Namespace != role.Namespace {
+					overview.Namespaces = append(overview.Namespaces, NamespaceRoles{Namespace: role.Namespace, Count: counts[role.Namespace]})
+					last++
+				}
+				overview.Namespaces[last].Roles = append(overview.Namespaces[last].Roles, role)
+			}
+		}
+
+		return c.JSON(http.StatusOK, overview)
+	}
+}
@@ -0,0 +1,54 @@
+package rbac
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rbac/pkg/listing"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// pagedRoles is a cluster whose role lists answer with the first two of five roles, as a server paging by
+// ?limit=2 would; the fake clientset does not page by itself.
+func pagedRoles() *fake.Clientset {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "roles", func(k8stesting.Action) (bool, runtime.Object, error) {
+		remaining := int64(3)
+		return true, &rbacv1.RoleList{
+			ListMeta: metav1.ListMeta{Continue: "page-2", RemainingItemCount: &remaining},
+			Items: []rbacv1.Role{
+				{ObjectMeta: metav1.ObjectMeta{Name: "a", Namespace: "prod"}},
+				{ObjectMeta: metav1.ObjectMeta{Name: "b", Namespace: "staging"}},
+			},
+		}, nil
+	})
+	return clientset
+}
+
+func TestRolesPageTotal(t *testing.T) {
+	for _, namespace := range []string{"prod", "all"} {
+		e := echo.New()
+		e.Group("/api/v2", listing.Middleware()).GET("/roles", RolesHandler(pagedRoles()))
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v2/roles?limit=2&namespace="+namespace, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d, want %d: %s", namespace, rec.Code, http.StatusOK, rec.Body)
+		}
+
+		var list listing.List[RoleWithStatus]
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Items) != 2 || list.Total != 5 || list.Continue != "page-2" {
+			t.Errorf("%s: %d items, total %d, continue %q, want 2 items, total 5, continue %q", namespace, len(list.Items), list.Total, list.Continue, "page-2")
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package rbac
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rbac/pkg/httperror"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// defaultPageSize is the page size of paged listings unless ?limit= says otherwise.
+	defaultPageSize = 50
+	// maxPageSize bounds ?limit= of paged listings.
+	maxPageSize = 200
+)
+
+// searchKinds are the kinds a search covers, in the order their hits are returned.
+var searchKinds = []string{"Role", "ClusterRole", "RoleBinding", "ClusterRoleBinding"}
+
+// FieldMatch is a field of an object that contains the query. Highlight holds the start and end byte
+// offsets of the match within Value.
+type FieldMatch struct {
+	Field     string `json:"field"`
+	Value     string `json:"value"`
+	Highlight [2]int `json:"highlight"`
+}
+
+// SearchHit is an object with at least one matching field.
+type SearchHit struct {
+	Kind      string       `json:"kind"`
+	Namespace string       `json:"namespace,omitempty"`
+	Name      string       `json:"name"`
+	Matches   []FieldMatch `json:"matches"`
+}
+
+// SearchResults is a page of hits.
+type SearchResults struct {
+	Total  int         `json:"total"`
+	Offset int         `json:"offset"`
+	Limit  int         `json:"limit"`
+	Hits   []SearchHit `json:"hits"`
+}
+
+// SearchHandler searches roles, cluster roles and their bindings for ?q=, ignoring case. Names, label
+// values, subjects, role references and rule contents are searched. ?kinds= restricts the kinds, and
+// ?offset= and ?limit= page through the hits.
+func SearchHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := strings.ToLower(strings.TrimSpace(c.QueryParam("q")))
+		if query == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "q is required")
+		}
+
+		offset, err := intParam(c, "offset", 0, 0, -1)
+		if err != nil {
+			return err
+		}
+		limit, err := intParam(c, "limit", defaultPageSize, 1, maxPageSize)
+		if err != nil {
+			return err
+		}
+
+		kinds := make(map[string]bool)
+		for _, kind := range strings.Split(c.QueryParam("kinds"), ",") {
+			if kind = strings.TrimSpace(kind); kind == "" {
+				continue
+			}
+			canonical := ""
+			for _, known := range searchKinds {
+				if strings.EqualFold(kind, known) {
+					canonical = known
+				}
+			}
+			if canonical == "" {
+				return echo.NewHTTPError(http.StatusBadRequest, "Unknown kind "+kind+", expected one of "+strings.Join(searchKinds, ", "))
+			}
+			kinds[canonical] = true
+		}
+		wanted := func(kind string) bool { return len(kinds) == 0 || kinds[kind] }
+
+		var hits []SearchHit
+
+		if wanted("Role") {
+			roles, err := listRoles(c, clientset, "")
+			if err != nil {
+				return httperror.Wrap(err, "Error listing roles: ")
+			}
+			for _, role := range roles.Items {
+				hits = appendHit(hits, "Role", role.ObjectMeta, searchRules(query, role.ObjectMeta, role.Rules))
+			}
+		}
+		if wanted("ClusterRole") {
+			clusterRoles, err := listClusterRoles(c, clientset)
+			if err != nil {
+				return httperror.Wrap(err, "Error listing cluster roles: ")
+			}
+			for _, clusterRole := range clusterRoles.Items {
+				hits = appendHit(hits, "ClusterRole", clusterRole.ObjectMeta, searchRules(query, clusterRole.ObjectMeta, clusterRole.Rules))
+			}
+		}
+		if wanted("RoleBinding") {
+			roleBindings, err := listRoleBindings(c, clientset, "")
+			if err != nil {
+				return httperror.Wrap(err, "Error listing role bindings: ")
+			}
+			for _, rb := range roleBindings.Items {
+				hits = appendHit(hits, "RoleBinding", rb.ObjectMeta, searchBinding(query, rb.ObjectMeta, rb.RoleRef, rb.Subjects))
+			}
+		}
+		if wanted("ClusterRoleBinding") {
+			clusterRoleBindings, err := listClusterRoleBindings(c, clientset)
+			if err != nil {
+				return httperror.Wrap(err, "Error listing cluster role bindings: ")
+			}
+			for _, crb := range clusterRoleBindings.Items {
+				hits = appendHit(hits, "ClusterRoleBinding", crb.ObjectMeta, searchBinding(query, crb.ObjectMeta, crb.RoleRef, crb.Subjects))
+			}
+		}
+
+		// hits are returned in the order of searchKinds, then by namespace and name
+		sort.Slice(hits, func(i, j int) bool {
+			a, b := hits[i], hits[j]
+			if a.Kind != b.Kind {
+				return slices.Index(searchKinds, a.Kind) < slices.Index(searchKinds, b.Kind)
+			}
+			if a.Namespace != b.Namespace {
+				return a.Namespace < b.Namespace
+			}
+			return a.Name < b.Name
+		})
+
+		results := SearchResults{Total: len(hits), Offset: offset, Limit: limit, Hits: []SearchHit{}}
+		if offset < len(hits) {
+			end := offset + limit
+			if end > len(hits) {
+				end = len(hits)
+			}
+			results.Hits = hits[offset:end]
+		}
+		return c.JSON(http.StatusOK, results)
+	}
+}
+
+// appendHit adds an object to hits when any of its fields matched.
+func appendHit(hits []SearchHit, kind string, meta metav1.ObjectMeta, matches []FieldMatch) []SearchHit {
+	if len(matches) == 0 {
+		return hits
+	}
+	return append(hits, SearchHit{Kind: kind, Namespace: meta.Namespace, Name: meta.Name, Matches: matches})
+}
+
+// searchMeta matches the name and label values of an object.
+func searchMeta(query string, meta metav1.ObjectMeta) []FieldMatch {
+	var matches []FieldMatch
+	matches = matchField(matches, query, "metadata.name", meta.Name)
+
+	keys := make([]string, 0, len(meta.Labels))
+	for key := range meta.Labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		matches = matchField(matches, query, "metadata.labels["+key+"]", meta.Labels[key])
+	}
+	return matches
+}
+
+// searchRules matches a role's metadata and the API groups, resources, resource names and non-resource
+// URLs of its rules.
+func searchRules(query string, meta metav1.ObjectMeta, rules []rbacv1.PolicyRule) []FieldMatch {
+	matches := searchMeta(query, meta)
+	for i, rule := range rules {
+		fields := []struct {
+			name   string
+			values []string
+		}{
+			{"apiGroups", rule.APIGroups},
+			{"resources", rule.Resources},
+			{"resourceNames", rule.ResourceNames},
+			{"nonResourceURLs", rule.NonResourceURLs},
+		}
+		for _, field := range fields {
+			for j, value := range field.values {
+				matches = matchField(matches, query, fmt.Sprintf("rules[%d].%s[%d]", i, field.name, j), value)
+			}
+		}
+	}
+	return matches
+}
+
+// searchBinding matches a binding's metadata, role reference and subject names.
+func searchBinding(query string, meta metav1.ObjectMeta, roleRef rbacv1.RoleRef, subjects []rbacv1.Subject) []FieldMatch {
+	matches := searchMeta(query, meta)
+	matches = matchField(matches, query, "roleRef.name", roleRef.Name)
+	for i, subject := range subjects {
+		matches = matchField(matches, query, fmt.Sprintf("subjects[%d].name", i), subject.Name)
+	}
+	return matches
+}
+
+// matchField adds field to matches when value contains query, ignoring case.
+func matchField(matches []FieldMatch, query, field, value string) []FieldMatch {
+	lower := strings.ToLower(value)
+	start := strings.Index(lower, query)
+	if start < 0 {
+		return matches
+	}
+	highlight := [2]int{start, start + len(query)}
+	if len(lower) != len(value) {
+		// lowercasing changed the byte length, so the offsets would be wrong; highlight the whole value
+		highlight = [2]int{0, len(value)}
+	}
+	return append(matches, FieldMatch{Field: field, Value: value, Highlight: highlight})
+}
+
+// intParam parses the query parameter name, defaulting to def, and checks it lies within min and max.
+// A negative max means there is no upper bound.
+func intParam(c echo.Context, name string, def, min, max int) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return def, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < min || (max >= 0 && parsed > max) {
+		if max < 0 {
+			return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a number of at least %d", name, min))
+		}
+		return 0, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("%s must be a number between %d and %d", name, min, max))
+	}
+	return parsed, nil
+}
@@ -0,0 +1,180 @@
+package rbac
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// searchCluster has velero referenced in every searched field, among roles with many unrelated rules, and
+// objects of every kind named so that their listing order differs from the order hits are returned in.
+func searchCluster() *fake.Clientset {
+	manyRules := func(extra ...rbacv1.PolicyRule) []rbacv1.PolicyRule {
+		var rules []rbacv1.PolicyRule
+		for i := 0; i < 50; i++ {
+			rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{fmt.Sprintf("group%d.example.com", i)}, Resources: []string{"things"}, Verbs: []string{"get"}})
+		}
+		return append(rules, extra...)
+	}
+	roleRef := func(kind, name string) rbacv1.RoleRef {
+		return rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: kind, Name: name}
+	}
+	objects := []runtime.Object{
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "backup-operator", Namespace: "ops"},
+			Rules:      manyRules(rbacv1.PolicyRule{APIGroups: []string{"Velero.io"}, Resources: []string{"backups"}, Verbs: []string{"*"}}),
+		},
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "restore", Namespace: "apps", Labels: map[string]string{"app": "velero-restore"}},
+			Rules:      manyRules(rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"cloud-credentials-velero"}, Verbs: []string{"get"}}),
+		},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "unrelated", Namespace: "apps"}, Rules: manyRules()},
+		&rbacv1.ClusterRole{
+			ObjectMeta: metav1.ObjectMeta{Name: "plugin-reader"},
+			Rules:      []rbacv1.PolicyRule{{Resources: []string{"velero/plugins"}, Verbs: []string{"get"}}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "backups", Namespace: "ops"},
+			RoleRef:    roleRef("Role", "backup-operator"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "velero", Namespace: "velero"}},
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "plugins"},
+			RoleRef:    roleRef("ClusterRole", "velero-plugin-reader"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "ops"}},
+		},
+	}
+	// Enough hits of interleaved kinds that sorting them merges blocks rather than only inserting
+	for i := 0; i < 15; i++ {
+		objects = append(objects,
+			&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("zz-velero-%02d", 14-i), Namespace: fmt.Sprintf("ns-%02d", 14-i)}},
+			&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("aa-velero-%02d", 14-i)}},
+		)
+	}
+	return fake.NewSimpleClientset(objects...)
+}
+
+func TestSearchRuleContents(t *testing.T) {
+	var results SearchResults
+	if code := serveJSON(t, SearchHandler(searchCluster()), "/?q=VELERO&kinds=role,rolebinding,clusterrolebinding&limit=5", &results); code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", code, http.StatusOK)
+	}
+	want := []struct {
+		kind, namespace, name string
+		match                 FieldMatch
+	}{
+		{"Role", "apps", "restore", FieldMatch{Field: "metadata.labels[app]", Value: "velero-restore", Highlight: [2]int{0, 6}}},
+		{"Role", "ns-00", "zz-velero-00", FieldMatch{Field: "metadata.name", Value: "zz-velero-00", Highlight: [2]int{3, 9}}},
+		{"Role", "ns-01", "zz-velero-01", FieldMatch{Field: "metadata.name", Value: "zz-velero-01", Highlight: [2]int{3, 9}}},
+		{"Role", "ns-02", "zz-velero-02", FieldMatch{Field: "metadata.name", Value: "zz-velero-02", Highlight: [2]int{3, 9}}},
+		{"Role", "ns-03", "zz-velero-03", FieldMatch{Field: "metadata.name", Value: "zz-velero-03", Highlight: [2]int{3, 9}}},
+	}
+	if results.Total != 17+1+1 || len(results.Hits) != len(want) {
+		t.Fatalf("total = %d with %d hits, want 19 with %d", results.Total, len(results.Hits), len(want))
+	}
+	for i, hit := range results.Hits {
+		w := want[i]
+		if hit.Kind != w.kind || hit.Namespace != w.namespace || hit.Name != w.name || len(hit.Matches) == 0 || hit.Matches[0] != w.match {
+			t.Errorf("hit %d = %+v, want %s %s/%s matching %+v", i, hit, w.kind, w.namespace, w.name, w.match)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		query  string
+		field  string
+		value  string
+		object string
+	}{
+		{"api group among many rules", "velero.io", "rules[50].apiGroups[0]", "Velero.io", "Role ops/backup-operator"},
+		{"resource name", "credentials-velero", "rules[50].resourceNames[0]", "cloud-credentials-velero", "Role apps/restore"},
+		{"subresource", "velero/plugins", "rules[0].resources[0]", "velero/plugins", "ClusterRole plugin-reader"},
+		{"subject", "velero", "subjects[0].name", "velero", "RoleBinding ops/backups"},
+		{"role reference", "plugin-reader", "roleRef.name", "velero-plugin-reader", "ClusterRoleBinding plugins"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var results SearchResults
+			serveJSON(t, SearchHandler(searchCluster()), "/?limit=200&q="+tt.query, &results)
+			for _, hit := range results.Hits {
+				object := hit.Kind + " " + hit.Name
+				if hit.Namespace != "" {
+					object = hit.Kind + " " + hit.Namespace + "/" + hit.Name
+				}
+				if object != tt.object {
+					continue
+				}
+				for _, match := range hit.Matches {
+					if match.Field == tt.field && match.Value == tt.value {
+						return
+					}
+				}
+				t.Fatalf("%s matched %+v, want %s = %s", object, hit.Matches, tt.field, tt.value)
+			}
+			t.Errorf("%s not found for %q", tt.object, tt.query)
+		})
+	}
+}
+
+func TestSearchOrder(t *testing.T) {
+	var results SearchResults
+	serveJSON(t, SearchHandler(searchCluster()), "/?q=velero&limit=200", &results)
+	kindRank := map[string]int{"Role": 0, "ClusterRole": 1, "RoleBinding": 2, "ClusterRoleBinding": 3}
+	for i := 1; i < len(results.Hits); i++ {
+		a, b := results.Hits[i-1], results.Hits[i]
+		if kindRank[a.Kind] > kindRank[b.Kind] ||
+			a.Kind == b.Kind && (a.Namespace > b.Namespace || a.Namespace == b.Namespace && a.Name > b.Name) {
+			t.Errorf("hit %d (%s %s/%s) sorted after %s %s/%s", i, b.Kind, b.Namespace, b.Name, a.Kind, a.Namespace, a.Name)
+		}
+	}
+	if results.Total != 35 {
+		t.Errorf("total = %d, want 35", results.Total)
+	}
+}
+
+func TestSearchParameters(t *testing.T) {
+	tests := []struct {
+		target string
+		want   int
+	}{
+		{"/", http.StatusBadRequest},
+		{"/?q=%20", http.StatusBadRequest},
+		{"/?q=velero&kinds=Pod", http.StatusBadRequest},
+		{"/?q=velero&limit=0", http.StatusBadRequest},
+		{"/?q=velero&limit=201", http.StatusBadRequest},
+		{"/?q=velero&offset=-1", http.StatusBadRequest},
+		{"/?q=velero&offset=1000", http.StatusOK},
+	}
+	for _, tt := range tests {
+		var results SearchResults
+		if code := serveJSON(t, SearchHandler(searchCluster()), tt.target, &results); code != tt.want {
+			t.Errorf("%s = %d, want %d", tt.target, code, tt.want)
+		}
+	}
+}
+
+func TestMatchFieldHighlight(t *testing.T) {
+	tests := []struct {
+		value string
+		want  [2]int
+	}{
+		{"velero", [2]int{0, 6}},
+		{"backup-VELERO-sa", [2]int{7, 13}},
+		// lowercasing İ changes its byte length, so the whole value is highlighted
+		{"İvelero", [2]int{0, len("İvelero")}},
+	}
+	for _, tt := range tests {
+		matches := matchField(nil, "velero", "field", tt.value)
+		if len(matches) != 1 || matches[0].Highlight != tt.want {
+			t.Errorf("matchField(%q) = %+v, want highlight %v", tt.value, matches, tt.want)
+		}
+	}
+	if matches := matchField(nil, "velero", "field", "restic"); len(matches) != 0 {
+		t.Errorf("matchField(restic) = %+v, want none", matches)
+	}
+}
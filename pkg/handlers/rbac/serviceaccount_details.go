@@ -1,70 +1,116 @@
 package rbac
 
 import (
-	"context"
 	"net/http"
 
+	"rbac/pkg/httperror"
+	"rbac/pkg/permissions"
+
 	"github.com/labstack/echo/v4"
+	corev1 "k8s.io/api/core/v1"
 	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
 	"k8s.io/client-go/kubernetes"
 )
 
-// ServiceAccountDetailsResponse represents the detailed information about a service account.
+// ServiceAccountDetailsResponse represents the detailed information about a service account. Found is false when no
+// binding names the service account, so it has no access at all.
 type ServiceAccountDetailsResponse struct {
-	ServiceAccountName  string                      `json:"serviceAccountName"`
+	ServiceAccountName string `json:"serviceAccountName"`
+	Namespace          string `json:"namespace"`
+	// ServiceAccount is absent when it doesn't exist, although bindings and pods may still name it.
+	ServiceAccount      *corev1.ServiceAccount      `json:"serviceAccount,omitempty"`
+	Found               bool                        `json:"found"`
 	RoleBindings        []rbacv1.RoleBinding        `json:"roleBindings"`
 	ClusterRoleBindings []rbacv1.ClusterRoleBinding `json:"clusterRoleBindings"`
 	ClusterRoles        []rbacv1.ClusterRole        `json:"clusterRoles"`
+	// Pods are the pods running as the service account; those with tokenMounted hold its token.
+	Pods []PodUsage `json:"pods"`
 }
 
-// ServiceAccountDetailsHandler handles requests for detailed information about a specific service account.
-func ServiceAccountDetailsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+// ServiceAccountDetailsHandler handles requests for detailed information about a specific service account of
+// ?namespace=, default unless given: the bindings naming it, directly or through the groups of service
+// accounts, and the pods running as it.
+func ServiceAccountDetailsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		serviceAccountName := c.QueryParam("serviceAccountName")
 		if serviceAccountName == "" {
 			return echo.NewHTTPError(http.StatusBadRequest, "Service account name is required")
 		}
+		namespace := c.QueryParam("namespace")
+		if namespace == "" {
+			namespace = "default"
+		}
+
+		ctx := c.Request().Context()
+		serviceAccount, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, serviceAccountName, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			serviceAccount = nil
+		} else if err != nil {
+			return httperror.Wrap(err, "Error getting service account: ")
+		}
 
-		roleBindings, err := clientset.RbacV1().RoleBindings("").List(context.TODO(), metav1.ListOptions{})
+		roleBindings, err := listRoleBindings(c, clientset, "")
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing role bindings: ")
 		}
 
-		clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+		clusterRoleBindings, err := listClusterRoleBindings(c, clientset)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing cluster role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
 		}
 
-		clusterRoles, err := clientset.RbacV1().ClusterRoles().List(context.TODO(), metav1.ListOptions{})
+		clusterRoles, err := listClusterRoles(c, clientset)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing cluster roles: "+err.Error())
+			return httperror.Wrap(err, "Error listing cluster roles: ")
 		}
 
-		serviceAccountDetails := extractServiceAccountDetails(serviceAccountName, roleBindings.Items, clusterRoleBindings.Items, clusterRoles.Items)
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.serviceAccountName", serviceAccountName).String(),
+		})
+		if err != nil {
+			return httperror.Wrap(err, "Error listing pods: ")
+		}
+
+		serviceAccountDetails := extractServiceAccountDetails(namespace, serviceAccountName, roleBindings.Items, clusterRoleBindings.Items, clusterRoles.Items)
+		serviceAccountDetails.ServiceAccount = serviceAccount
+		workloads := newWorkloadResolver(clientset, namespace)
+		for _, pod := range pods.Items {
+			workload, err := workloads.resolve(ctx, pod.ObjectMeta)
+			if err != nil {
+				return httperror.Wrap(err, "Error resolving the workloads of pods: ")
+			}
+			serviceAccountDetails.Pods = append(serviceAccountDetails.Pods, PodUsage{
+				Name:         pod.Name,
+				Phase:        pod.Status.Phase,
+				TokenMounted: tokenMounted(pod, serviceAccount),
+				Workload:     workload,
+			})
+		}
 		return c.JSON(http.StatusOK, serviceAccountDetails)
 	}
 }
 
-// extractServiceAccountDetails extracts detailed information about a specific service account.
-func extractServiceAccountDetails(serviceAccountName string, roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding, clusterRoles []rbacv1.ClusterRole) ServiceAccountDetailsResponse {
-	var serviceAccountRoleBindings []rbacv1.RoleBinding
-	var serviceAccountClusterRoleBindings []rbacv1.ClusterRoleBinding
-	var serviceAccountClusterRoles []rbacv1.ClusterRole
+// extractServiceAccountDetails extracts detailed information about a specific service account. Role binding
+// subjects without a namespace are the service accounts of the binding's namespace.
+func extractServiceAccountDetails(namespace, serviceAccountName string, roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding, clusterRoles []rbacv1.ClusterRole) ServiceAccountDetailsResponse {
+	serviceAccountRoleBindings := []rbacv1.RoleBinding{}
+	serviceAccountClusterRoleBindings := []rbacv1.ClusterRoleBinding{}
+	serviceAccountClusterRoles := []rbacv1.ClusterRole{}
 
+	user := "system:serviceaccount:" + namespace + ":" + serviceAccountName
+	groups := permissions.Groups(user, nil)
 	for _, rb := range roleBindings {
-		for _, subject := range rb.Subjects {
-			if subject.Kind == rbacv1.ServiceAccountKind && subject.Name == serviceAccountName {
-				serviceAccountRoleBindings = append(serviceAccountRoleBindings, rb)
-			}
+		if bindingNames(rb.Subjects, rb.Namespace, user, groups) {
+			serviceAccountRoleBindings = append(serviceAccountRoleBindings, rb)
 		}
 	}
 
 	for _, crb := range clusterRoleBindings {
-		for _, subject := range crb.Subjects {
-			if subject.Kind == rbacv1.ServiceAccountKind && subject.Name == serviceAccountName {
-				serviceAccountClusterRoleBindings = append(serviceAccountClusterRoleBindings, crb)
-			}
+		if bindingNames(crb.Subjects, "", user, groups) {
+			serviceAccountClusterRoleBindings = append(serviceAccountClusterRoleBindings, crb)
 		}
 	}
 
@@ -79,8 +125,22 @@ func extractServiceAccountDetails(serviceAccountName string, roleBindings []rbac
 
 	return ServiceAccountDetailsResponse{
 		ServiceAccountName:  serviceAccountName,
+		Namespace:           namespace,
+		Found:               len(serviceAccountRoleBindings)+len(serviceAccountClusterRoleBindings) > 0,
 		RoleBindings:        serviceAccountRoleBindings,
 		ClusterRoleBindings: serviceAccountClusterRoleBindings,
 		ClusterRoles:        serviceAccountClusterRoles,
+		Pods:                []PodUsage{},
+	}
+}
+
+// bindingNames reports whether one of subjects, of a binding in bindingNamespace or of a cluster role
+// binding when it is "", applies to user or one of groups.
+func bindingNames(subjects []rbacv1.Subject, bindingNamespace, user string, groups []string) bool {
+	for _, subject := range subjects {
+		if permissions.AppliesTo(subject, bindingNamespace, user, groups) {
+			return true
+		}
 	}
+	return false
 }
@@ -0,0 +1,258 @@
+package rbac
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	"rbac/pkg/httperror"
+	"rbac/pkg/permissions"
+
+	"github.com/labstack/echo/v4"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WorkloadRef names the controller a pod belongs to.
+type WorkloadRef struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+}
+
+// PodUsage is a pod running as a service account.
+type PodUsage struct {
+	Name  string          `json:"name"`
+	Phase corev1.PodPhase `json:"phase"`
+	// TokenMounted is whether the token is mounted into the pod, per the automountServiceAccountToken of the
+	// pod and then of the service account.
+	TokenMounted bool `json:"tokenMounted"`
+	// Workload is the top-level controller of the pod, or absent for a bare pod.
+	Workload *WorkloadRef `json:"workload,omitempty"`
+}
+
+// ServiceAccountUsage is what runs as a service account, and whether it has been granted access.
+type ServiceAccountUsage struct {
+	Name string `json:"name"`
+	// Exists is false for a service account that pods name but that has been deleted.
+	Exists bool `json:"exists"`
+	// Bound is set when a binding names the service account.
+	Bound bool `json:"bound"`
+	// BoundButUnused flags a service account with access that no pod runs as, a candidate for removal.
+	BoundButUnused bool          `json:"boundButUnused"`
+	Pods           []PodUsage    `json:"pods"`
+	Workloads      []WorkloadRef `json:"workloads"`
+}
+
+// ServiceAccountUsageResponse is the usage of the service accounts of a namespace.
+type ServiceAccountUsageResponse struct {
+	Namespace       string                `json:"namespace"`
+	ServiceAccounts []ServiceAccountUsage `json:"serviceAccounts"`
+}
+
+// ServiceAccountUsageHandler reports the pods of ?namespace= running as each of its service accounts, or as
+// ?name= alone, with the Deployments, StatefulSets, DaemonSets, Jobs and CronJobs they belong to and whether
+// the token is mounted. Service accounts that bindings name but no pod uses are flagged.
+func ServiceAccountUsageHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx := c.Request().Context()
+		namespace := c.QueryParam("namespace")
+		if namespace == "" {
+			namespace = "default"
+		}
+		name := c.QueryParam("name")
+
+		serviceAccounts := make(map[string]*corev1.ServiceAccount)
+		podOptions := metav1.ListOptions{}
+		if name != "" {
+			podOptions.FieldSelector = fields.OneTermEqualSelector("spec.serviceAccountName", name).String()
+			sa, err := clientset.CoreV1().ServiceAccounts(namespace).Get(ctx, name, metav1.GetOptions{})
+			switch {
+			case err == nil:
+				serviceAccounts[name] = sa
+			case !apierrors.IsNotFound(err):
+				return httperror.Wrap(err, "Error getting service account: ")
+			}
+		} else {
+			list, err := clientset.CoreV1().ServiceAccounts(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return httperror.Wrap(err, "Error listing service accounts: ")
+			}
+			for i := range list.Items {
+				serviceAccounts[list.Items[i].Name] = &list.Items[i]
+			}
+		}
+
+		pods, err := clientset.CoreV1().Pods(namespace).List(ctx, podOptions)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing pods: ")
+		}
+		roleBindings, err := listRoleBindings(c, clientset, "")
+		if err != nil {
+			return httperror.Wrap(err, "Error listing role bindings: ")
+		}
+		clusterRoleBindings, err := listClusterRoleBindings(c, clientset)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
+		}
+
+		usage := make(map[string]*ServiceAccountUsage)
+		get := func(saName string) *ServiceAccountUsage {
+			if u, ok := usage[saName]; ok {
+				return u
+			}
+			_, exists := serviceAccounts[saName]
+			u := &ServiceAccountUsage{Name: saName, Exists: exists, Pods: []PodUsage{}, Workloads: []WorkloadRef{}}
+			usage[saName] = u
+			return u
+		}
+		for saName := range serviceAccounts {
+			get(saName)
+		}
+		if name != "" {
+			get(name)
+		}
+
+		workloads := newWorkloadResolver(clientset, namespace)
+		for _, pod := range pods.Items {
+			saName := pod.Spec.ServiceAccountName
+			if saName == "" {
+				saName = "default"
+			}
+			if name != "" && saName != name {
+				continue
+			}
+			workload, err := workloads.resolve(ctx, pod.ObjectMeta)
+			if err != nil {
+				return httperror.Wrap(err, "Error resolving the workloads of pods: ")
+			}
+
+			u := get(saName)
+			u.Pods = append(u.Pods, PodUsage{
+				Name:         pod.Name,
+				Phase:        pod.Status.Phase,
+				TokenMounted: tokenMounted(pod, serviceAccounts[saName]),
+				Workload:     workload,
+			})
+			if workload != nil && !containsWorkload(u.Workloads, *workload) {
+				u.Workloads = append(u.Workloads, *workload)
+			}
+		}
+
+		response := ServiceAccountUsageResponse{Namespace: namespace, ServiceAccounts: []ServiceAccountUsage{}}
+		for _, u := range usage {
+			u.Bound = serviceAccountBound("system:serviceaccount:"+namespace+":"+u.Name, roleBindings.Items, clusterRoleBindings.Items)
+			u.BoundButUnused = u.Bound && len(u.Pods) == 0
+			response.ServiceAccounts = append(response.ServiceAccounts, *u)
+		}
+		sort.Slice(response.ServiceAccounts, func(i, j int) bool {
+			return response.ServiceAccounts[i].Name < response.ServiceAccounts[j].Name
+		})
+		return c.JSON(http.StatusOK, response)
+	}
+}
+
+// tokenMounted reports whether a pod gets the token of sa, which is nil when the service account is gone.
+// The pod's automountServiceAccountToken wins over the service account's; both default to mounting.
+func tokenMounted(pod corev1.Pod, sa *corev1.ServiceAccount) bool {
+	if pod.Spec.AutomountServiceAccountToken != nil {
+		return *pod.Spec.AutomountServiceAccountToken
+	}
+	if sa != nil && sa.AutomountServiceAccountToken != nil {
+		return *sa.AutomountServiceAccountToken
+	}
+	return true
+}
+
+// serviceAccountBound reports whether any binding names the service account with user name user.
+func serviceAccountBound(user string, roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding) bool {
+	for _, rb := range roleBindings {
+		for _, subject := range rb.Subjects {
+			if permissions.AppliesTo(subject, rb.Namespace, user, nil) {
+				return true
+			}
+		}
+	}
+	for _, crb := range clusterRoleBindings {
+		for _, subject := range crb.Subjects {
+			if permissions.AppliesTo(subject, "", user, nil) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func containsWorkload(workloads []WorkloadRef, workload WorkloadRef) bool {
+	for _, w := range workloads {
+		if w == workload {
+			return true
+		}
+	}
+	return false
+}
+
+// workloadResolver finds the top-level controllers of pods in a namespace, following ReplicaSets up to their
+// Deployments and Jobs up to their CronJobs. ReplicaSets and Jobs are listed once, when first needed.
+type workloadResolver struct {
+	clientset   kubernetes.Interface
+	namespace   string
+	replicaSets map[string]*WorkloadRef
+	jobs        map[string]*WorkloadRef
+}
+
+func newWorkloadResolver(clientset kubernetes.Interface, namespace string) *workloadResolver {
+	return &workloadResolver{clientset: clientset, namespace: namespace}
+}
+
+// resolve returns the workload of the pod with meta, or nil when no controller owns it.
+func (r *workloadResolver) resolve(ctx context.Context, meta metav1.ObjectMeta) (*WorkloadRef, error) {
+	owner := metav1.GetControllerOfNoCopy(&meta)
+	if owner == nil {
+		return nil, nil
+	}
+
+	var parents map[string]*WorkloadRef
+	switch owner.Kind {
+	case "ReplicaSet":
+		if r.replicaSets == nil {
+			list, err := r.clientset.AppsV1().ReplicaSets(r.namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			r.replicaSets = make(map[string]*WorkloadRef, len(list.Items))
+			for _, rs := range list.Items {
+				r.replicaSets[rs.Name] = controllerRef(rs.ObjectMeta)
+			}
+		}
+		parents = r.replicaSets
+	case "Job":
+		if r.jobs == nil {
+			list, err := r.clientset.BatchV1().Jobs(r.namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			r.jobs = make(map[string]*WorkloadRef, len(list.Items))
+			for _, job := range list.Items {
+				r.jobs[job.Name] = controllerRef(job.ObjectMeta)
+			}
+		}
+		parents = r.jobs
+	}
+
+	if parent := parents[owner.Name]; parent != nil {
+		return parent, nil
+	}
+	return &WorkloadRef{Kind: owner.Kind, Name: owner.Name}, nil
+}
+
+// controllerRef returns the controller of an object, or nil when it has none.
+func controllerRef(meta metav1.ObjectMeta) *WorkloadRef {
+	if owner := metav1.GetControllerOfNoCopy(&meta); owner != nil {
+		return &WorkloadRef{Kind: owner.Kind, Name: owner.Name}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package rbac
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// controlledBy returns metadata of name in prod controlled by the kind and name of owner.
+func controlledBy(name, ownerKind, ownerName string) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{Name: name, Namespace: "prod"}
+	if ownerKind != "" {
+		controller := true
+		meta.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: ownerName, Controller: &controller}}
+	}
+	return meta
+}
+
+// pod returns a running pod in prod with the metadata meta, running as serviceAccount.
+func pod(meta metav1.ObjectMeta, serviceAccount string, automount *bool) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: meta,
+		Spec:       corev1.PodSpec{ServiceAccountName: serviceAccount, AutomountServiceAccountToken: automount},
+		Status:     corev1.PodStatus{Phase: corev1.PodRunning},
+	}
+}
+
+// usageCluster is a prod namespace with a Deployment and a CronJob, a bare pod running as a deleted service
+// account, and a bound service account that nothing runs as.
+func usageCluster() *fake.Clientset {
+	yes, no := true, false
+	return fake.NewSimpleClientset(
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "prod"}, AutomountServiceAccountToken: &no},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "prod"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "prod"}},
+		&corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "staging"}},
+
+		&appsv1.ReplicaSet{ObjectMeta: controlledBy("web-5d8f", "Deployment", "web")},
+		pod(controlledBy("web-5d8f-abcde", "ReplicaSet", "web-5d8f"), "web", nil),
+		pod(controlledBy("web-5d8f-fghij", "ReplicaSet", "web-5d8f"), "web", &yes),
+		pod(controlledBy("legacy-xyz", "ReplicaSet", "legacy"), "web", nil),
+		&batchv1.Job{ObjectMeta: controlledBy("backup-28000000", "CronJob", "backup")},
+		pod(controlledBy("backup-28000000-klmno", "Job", "backup-28000000"), "", nil),
+		pod(controlledBy("debug", "", ""), "gone", nil),
+
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "ci-deployer", Namespace: "prod"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "edit"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "ci"}},
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "web-reader"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: "view"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "system:serviceaccount:prod:web"}},
+		},
+	)
+}
+
+// usageOf returns the usage of the service account name in response.
+func usageOf(t *testing.T, response ServiceAccountUsageResponse, name string) ServiceAccountUsage {
+	t.Helper()
+	for _, u := range response.ServiceAccounts {
+		if u.Name == name {
+			return u
+		}
+	}
+	t.Fatalf("no usage reported for %s", name)
+	return ServiceAccountUsage{}
+}
+
+func TestServiceAccountUsage(t *testing.T) {
+	var response ServiceAccountUsageResponse
+	if code := serveJSON(t, ServiceAccountUsageHandler(usageCluster()), "/?namespace=prod", &response); code != http.StatusOK {
+		t.Fatalf("status = %d", code)
+	}
+	var names []string
+	for _, u := range response.ServiceAccounts {
+		names = append(names, u.Name)
+	}
+	if want := []string{"ci", "default", "gone", "web"}; !slices.Equal(names, want) {
+		t.Fatalf("service accounts = %v, want %v", names, want)
+	}
+
+	t.Run("owners", func(t *testing.T) {
+		// A ReplicaSet that's gone is reported itself
+		web := usageOf(t, response, "web")
+		want := []WorkloadRef{{Kind: "Deployment", Name: "web"}, {Kind: "ReplicaSet", Name: "legacy"}}
+		if len(web.Workloads) != len(want) || !slices.Contains(web.Workloads, want[0]) || !slices.Contains(web.Workloads, want[1]) {
+			t.Errorf("web workloads = %v, want %v", web.Workloads, want)
+		}
+		if workloads := usageOf(t, response, "default").Workloads; !slices.Equal(workloads, []WorkloadRef{{Kind: "CronJob", Name: "backup"}}) {
+			t.Errorf("default workloads = %v, want CronJob backup", workloads)
+		}
+		gone := usageOf(t, response, "gone")
+		if gone.Exists || len(gone.Pods) != 1 || gone.Pods[0].Workload != nil || len(gone.Workloads) != 0 {
+			t.Errorf("gone = %+v, want a deleted service account with one bare pod", gone)
+		}
+	})
+
+	t.Run("automount", func(t *testing.T) {
+		mounted := make(map[string]bool)
+		for _, u := range response.ServiceAccounts {
+			for _, p := range u.Pods {
+				mounted[p.Name] = p.TokenMounted
+			}
+		}
+		want := map[string]bool{
+			// the service account opts out
+			"web-5d8f-abcde": false,
+			"legacy-xyz":     false,
+			// the pod opts back in
+			"web-5d8f-fghij": true,
+			// nothing opts out
+			"backup-28000000-klmno": true,
+			"debug":                 true,
+		}
+		for name, want := range want {
+			if got, ok := mounted[name]; !ok || got != want {
+				t.Errorf("%s token mounted = %v (reported %v), want %v", name, got, ok, want)
+			}
+		}
+	})
+
+	t.Run("bound but unused", func(t *testing.T) {
+		tests := []struct {
+			name          string
+			bound, unused bool
+		}{
+			{"ci", true, true},
+			{"web", true, false},
+			{"default", false, false},
+			{"gone", false, false},
+		}
+		for _, tt := range tests {
+			u := usageOf(t, response, tt.name)
+			if u.Bound != tt.bound || u.BoundButUnused != tt.unused {
+				t.Errorf("%s bound %v, unused %v; want %v, %v", tt.name, u.Bound, u.BoundButUnused, tt.bound, tt.unused)
+			}
+		}
+	})
+}
+
+func TestServiceAccountUsageOfOne(t *testing.T) {
+	var response ServiceAccountUsageResponse
+	serveJSON(t, ServiceAccountUsageHandler(usageCluster()), "/?namespace=prod&name=ci", &response)
+	if len(response.ServiceAccounts) != 1 {
+		t.Fatalf("service accounts = %+v, want only ci", response.ServiceAccounts)
+	}
+	if ci := response.ServiceAccounts[0]; ci.Name != "ci" || !ci.Exists || !ci.BoundButUnused || len(ci.Pods) != 0 {
+		t.Errorf("ci = %+v, want an existing bound service account without pods", ci)
+	}
+
+	serveJSON(t, ServiceAccountUsageHandler(usageCluster()), "/?namespace=prod&name=missing", &response)
+	if len(response.ServiceAccounts) != 1 || response.ServiceAccounts[0].Exists {
+		t.Errorf("service accounts = %+v, want missing reported as not existing", response.ServiceAccounts)
+	}
+}
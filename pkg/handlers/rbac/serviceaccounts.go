@@ -1,8 +1,10 @@
 package rbac
 
 import (
-	"context"
 	"net/http"
+	"rbac/pkg/audit"
+	"rbac/pkg/managed"
+	"rbac/pkg/protection"
 	"rbac/pkg/utils"
 
 	"github.com/labstack/echo/v4"
@@ -12,14 +14,14 @@ import (
 )
 
 // ServiceAccountsHandler handles requests related to service accounts.
-func ServiceAccountsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func ServiceAccountsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		namespace := c.QueryParam("namespace")
 		if namespace == "" {
 			namespace = "default"
 		}
 
-		handlers := map[string]func(echo.Context, *kubernetes.Clientset, string) error{
+		handlers := map[string]func(echo.Context, kubernetes.Interface, string) error{
 			http.MethodGet:    handleListServiceAccounts,
 			http.MethodPost:   handleCreateServiceAccount,
 			http.MethodDelete: handleDeleteServiceAccount,
@@ -29,28 +31,44 @@ func ServiceAccountsHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
 	}
 }
 
-// handleListServiceAccounts lists all service accounts in a specific namespace.
-func handleListServiceAccounts(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+// handleListServiceAccounts lists all service accounts in a specific namespace, or in every namespace for
+// "all".
+func handleListServiceAccounts(c echo.Context, clientset kubernetes.Interface, namespace string) error {
+	if namespace == "all" {
+		namespace = ""
+	}
 	listFunc := func(namespace string, opts metav1.ListOptions) (interface{}, error) {
-		return clientset.CoreV1().ServiceAccounts(namespace).List(context.TODO(), opts)
+		return clientset.CoreV1().ServiceAccounts(namespace).List(c.Request().Context(), opts)
 	}
 	return utils.ListResources(c, clientset, namespace, listFunc)
 }
 
 // handleCreateServiceAccount creates a new service account in a specific namespace.
-func handleCreateServiceAccount(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+func handleCreateServiceAccount(c echo.Context, clientset kubernetes.Interface, namespace string) error {
 	var serviceAccount corev1.ServiceAccount
 	createFunc := func(namespace string, obj interface{}, opts metav1.CreateOptions) (interface{}, error) {
-		return clientset.CoreV1().ServiceAccounts(namespace).Create(context.TODO(), obj.(*corev1.ServiceAccount), opts)
+		desired := obj.(*corev1.ServiceAccount)
+		managed.Stamp(&desired.ObjectMeta, audit.Actor(c))
+		return clientset.CoreV1().ServiceAccounts(namespace).Create(c.Request().Context(), desired, opts)
 	}
 	return utils.CreateResource(c, clientset, namespace, &serviceAccount, createFunc)
 }
 
 // handleDeleteServiceAccount deletes a service account in a specific namespace.
-func handleDeleteServiceAccount(c echo.Context, clientset *kubernetes.Clientset, namespace string) error {
+func handleDeleteServiceAccount(c echo.Context, clientset kubernetes.Interface, namespace string) error {
 	name := c.QueryParam("name")
 	deleteFunc := func(namespace, name string, opts metav1.DeleteOptions) error {
-		return clientset.CoreV1().ServiceAccounts(namespace).Delete(context.TODO(), name, opts)
+		existing, err := clientset.CoreV1().ServiceAccounts(namespace).Get(c.Request().Context(), name, metav1.GetOptions{})
+		if err := existingError(err, "service account"); err != nil {
+			return err
+		}
+		if err := protection.Check(c, name, existing.ObjectMeta); err != nil {
+			return err
+		}
+		if err := managed.CheckConflict(c, existing.ObjectMeta); err != nil {
+			return err
+		}
+		return clientset.CoreV1().ServiceAccounts(namespace).Delete(c.Request().Context(), name, opts)
 	}
 	return utils.DeleteResource(c, clientset, namespace, name, deleteFunc)
 }
\ No newline at end of file
@@ -0,0 +1,210 @@
+package rbac
+
+import (
+	"net/http"
+	"strings"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/httperror"
+	"rbac/pkg/permissions"
+
+	"github.com/labstack/echo/v4"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// SimulationRequest is an action to check for a subject.
+type SimulationRequest struct {
+	// Subject is the user, group or service account acting. A service account needs its namespace.
+	Subject rbacv1.Subject `json:"subject"`
+	// Groups are further groups of a user, which Kubernetes doesn't store.
+	Groups   []string `json:"groups,omitempty"`
+	Verb     string   `json:"verb"`
+	APIGroup string   `json:"apiGroup,omitempty"`
+	Resource string   `json:"resource,omitempty"`
+	// Subresource, such as log, is part of Resource as pods/log when not given separately.
+	Subresource    string `json:"subresource,omitempty"`
+	ResourceName   string `json:"resourceName,omitempty"`
+	Namespace      string `json:"namespace,omitempty"`
+	NonResourceURL string `json:"nonResourceURL,omitempty"`
+}
+
+// SimulationMatch is a rule allowing the action, and the binding granting it.
+type SimulationMatch struct {
+	AccessPath
+	Rule rbacv1.PolicyRule `json:"rule"`
+}
+
+// SimulationResult is the API server's decision on an action, with the RBAC rules that allow it.
+type SimulationResult struct {
+	Allowed bool `json:"allowed"`
+	// Denied is set when an authorizer explicitly refused the action, rather than none allowing it.
+	Denied bool   `json:"denied,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// EvaluationError is set when the API server could not evaluate every rule, such as for a missing role.
+	EvaluationError string `json:"evaluationError,omitempty"`
+	// User and Groups are the identity the review was made for.
+	User   string   `json:"user,omitempty"`
+	Groups []string `json:"groups"`
+	// Matches are the RBAC rules allowing the action. They may be empty although it is allowed, when
+	// another authorizer, such as a webhook, allowed it.
+	Matches []SimulationMatch `json:"matches"`
+}
+
+// SimulateHandler asks the API server, through a SubjectAccessReview, or a LocalSubjectAccessReview for a
+// namespaced action, whether a subject may perform an action, and returns its decision together with the
+// rules of the bindings that allow it. Nothing is changed, so the request is not audited.
+func SimulateHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		audit.Skip(c)
+
+		var req SimulationRequest
+		if err := c.Bind(&req); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to decode request body: "+err.Error())
+		}
+		if req.Verb == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "verb is required")
+		}
+		if (req.Resource == "") == (req.NonResourceURL == "") {
+			return echo.NewHTTPError(http.StatusBadRequest, "Exactly one of resource and nonResourceURL is required")
+		}
+		if req.Namespace != "" {
+			if req.NonResourceURL != "" {
+				return echo.NewHTTPError(http.StatusBadRequest, "Non-resource URLs are not namespaced")
+			}
+			if errs := validation.IsDNS1123Label(req.Namespace); len(errs) > 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid namespace: "+errs[0])
+			}
+		}
+		if resource, subresource, ok := strings.Cut(req.Resource, "/"); ok && req.Subresource == "" {
+			req.Resource, req.Subresource = resource, subresource
+		}
+		user, groups, err := simulationIdentity(req.Subject, req.Groups)
+		if err != nil {
+			return err
+		}
+
+		spec := authorizationv1.SubjectAccessReviewSpec{User: user, Groups: groups}
+		if req.NonResourceURL != "" {
+			spec.NonResourceAttributes = &authorizationv1.NonResourceAttributes{Path: req.NonResourceURL, Verb: req.Verb}
+		} else {
+			spec.ResourceAttributes = &authorizationv1.ResourceAttributes{
+				Namespace:   req.Namespace,
+				Verb:        req.Verb,
+				Group:       req.APIGroup,
+				Resource:    req.Resource,
+				Subresource: req.Subresource,
+				Name:        req.ResourceName,
+			}
+		}
+
+		ctx := c.Request().Context()
+		var status authorizationv1.SubjectAccessReviewStatus
+		if req.Namespace != "" {
+			review, err := clientset.AuthorizationV1().LocalSubjectAccessReviews(req.Namespace).Create(ctx,
+				&authorizationv1.LocalSubjectAccessReview{ObjectMeta: metav1.ObjectMeta{Namespace: req.Namespace}, Spec: spec}, metav1.CreateOptions{})
+			if err != nil {
+				return httperror.Wrap(err, "Failed to review access: ")
+			}
+			status = review.Status
+		} else {
+			review, err := clientset.AuthorizationV1().SubjectAccessReviews().Create(ctx,
+				&authorizationv1.SubjectAccessReview{Spec: spec}, metav1.CreateOptions{})
+			if err != nil {
+				return httperror.Wrap(err, "Failed to review access: ")
+			}
+			status = review.Status
+		}
+
+		snapshot, err := loadPermissions(c, clientset, req.Namespace)
+		if err != nil {
+			return httperror.Wrap(err, "Error loading RBAC objects: ")
+		}
+		resource := req.Resource
+		if req.Subresource != "" {
+			resource += "/" + req.Subresource
+		}
+		matches := simulationMatches(snapshot, permissions.Request{
+			Verb:           req.Verb,
+			APIGroup:       req.APIGroup,
+			Resource:       resource,
+			ResourceName:   req.ResourceName,
+			NonResourceURL: req.NonResourceURL,
+		}, req.Namespace, user, groups)
+
+		return c.JSON(http.StatusOK, SimulationResult{
+			Allowed:         status.Allowed,
+			Denied:          status.Denied,
+			Reason:          status.Reason,
+			EvaluationError: status.EvaluationError,
+			User:            user,
+			Groups:          groups,
+			Matches:         matches,
+		})
+	}
+}
+
+// simulationIdentity returns the user and groups the API server would see for subject. A group is reviewed
+// on its own; users and service accounts also get the groups the API server adds to their requests.
+func simulationIdentity(subject rbacv1.Subject, groups []string) (string, []string, error) {
+	if subject.Name == "" {
+		return "", nil, echo.NewHTTPError(http.StatusBadRequest, "subject.name is required")
+	}
+	switch subject.Kind {
+	case rbacv1.UserKind:
+		return subject.Name, permissions.Groups(subject.Name, groups), nil
+	case rbacv1.GroupKind:
+		return "", append([]string{subject.Name}, groups...), nil
+	case rbacv1.ServiceAccountKind:
+		if subject.Namespace == "" {
+			return "", nil, echo.NewHTTPError(http.StatusBadRequest, "subject.namespace is required for a ServiceAccount")
+		}
+		user := "system:serviceaccount:" + subject.Namespace + ":" + subject.Name
+		return user, permissions.Groups(user, groups), nil
+	}
+	return "", nil, echo.NewHTTPError(http.StatusBadRequest, "subject.kind must be User, Group or ServiceAccount")
+}
+
+// simulationMatches returns the rules of the bindings in snapshot naming user or one of groups that allow req
+// in namespace. Cluster role bindings come first.
+func simulationMatches(snapshot *permissions.Snapshot, req permissions.Request, namespace, user string, groups []string) []SimulationMatch {
+	matches := []SimulationMatch{}
+	add := func(bindingNamespace string, subjects []rbacv1.Subject, ref rbacv1.RoleRef, grant permissions.Grant) {
+		var matched []rbacv1.Subject
+		for _, subject := range subjects {
+			if permissions.AppliesTo(subject, bindingNamespace, user, groups) {
+				matched = append(matched, subject)
+			}
+		}
+		if len(matched) == 0 {
+			return
+		}
+		for _, rule := range snapshot.Rules(bindingNamespace, ref) {
+			match := permissions.MatchRule(rule, req)
+			if !match.Allowed {
+				continue
+			}
+			for _, subject := range matched {
+				path := AccessPath{Subject: subject, Grant: grant}
+				path.ResourceNames = match.ResourceNames
+				matches = append(matches, SimulationMatch{AccessPath: path, Rule: rule})
+			}
+		}
+	}
+
+	for _, crb := range snapshot.ClusterRoleBindings {
+		add("", crb.Subjects, crb.RoleRef, permissions.Grant{BindingKind: "ClusterRoleBinding", BindingName: crb.Name, RoleKind: crb.RoleRef.Kind, RoleName: crb.RoleRef.Name})
+	}
+	if namespace == "" {
+		return matches
+	}
+	for _, rb := range snapshot.RoleBindings {
+		if rb.Namespace == namespace {
+			add(rb.Namespace, rb.Subjects, rb.RoleRef, permissions.Grant{BindingKind: "RoleBinding", BindingNamespace: rb.Namespace, BindingName: rb.Name, RoleKind: rb.RoleRef.Kind, RoleName: rb.RoleRef.Name})
+		}
+	}
+	return matches
+}
@@ -0,0 +1,215 @@
+package rbac
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"rbac/pkg/httperror"
+	"rbac/pkg/permissions"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// allNamespaces stands for cluster-wide access in the namespaces of a permission.
+const allNamespaces = "*"
+
+// SubjectPermission is what a subject may do to one resource, or non-resource URL, and where.
+type SubjectPermission struct {
+	APIGroup       string `json:"apiGroup"`
+	Resource       string `json:"resource,omitempty"`
+	NonResourceURL string `json:"nonResourceURL,omitempty"`
+	// ResourceNames, when set, are the only objects the verbs apply to.
+	ResourceNames []string `json:"resourceNames,omitempty"`
+	Verbs         []string `json:"verbs"`
+	// Namespaces are where the verbs are allowed; * is every namespace and the cluster.
+	Namespaces []string `json:"namespaces"`
+}
+
+// SubjectPermissionsResponse is every permission a subject's bindings grant, flattened out of their roles.
+type SubjectPermissionsResponse struct {
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+	// Groups are those the bindings were matched against: the group itself, or the supplied groups and
+	// those the API server adds for a user or service account.
+	Groups      []string            `json:"groups"`
+	Permissions []SubjectPermission `json:"permissions"`
+}
+
+// SubjectPermissionsHandler returns the permissions of the User, Group or ServiceAccount :kind named :name,
+// merged across every binding naming it, with aggregated ClusterRoles resolved. A service account needs its
+// ?namespace=, and a user's ?groups= (comma-separated) are matched too. Verbs a broader permission already
+// allows, cluster-wide or for every object, are left out of narrower ones.
+func SubjectPermissionsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		kind, ok := subjectKinds[strings.ToLower(c.Param("kind"))]
+		if !ok {
+			return echo.NewHTTPError(http.StatusBadRequest, "Unknown subject kind "+c.Param("kind")+", expected User, Group or ServiceAccount")
+		}
+		subject := rbacv1.Subject{Kind: kind, Name: c.Param("name")}
+		var supplied []string
+		switch kind {
+		case rbacv1.ServiceAccountKind:
+			subject.Namespace = c.QueryParam("namespace")
+			if subject.Namespace == "" {
+				return echo.NewHTTPError(http.StatusBadRequest, "namespace is required for a ServiceAccount")
+			}
+		case rbacv1.UserKind:
+			for _, group := range strings.Split(c.QueryParam("groups"), ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					supplied = append(supplied, group)
+				}
+			}
+		}
+		user, groups, err := simulationIdentity(subject, supplied)
+		if err != nil {
+			return err
+		}
+
+		snapshot, err := loadPermissions(c, clientset, "")
+		if err != nil {
+			return httperror.Wrap(err, "Error loading RBAC objects: ")
+		}
+
+		return c.JSON(http.StatusOK, SubjectPermissionsResponse{
+			Kind:        subject.Kind,
+			Name:        subject.Name,
+			Namespace:   subject.Namespace,
+			Groups:      groups,
+			Permissions: subjectPermissions(snapshot, user, groups),
+		})
+	}
+}
+
+// permissionKey identifies what a permission applies to; names are the sorted resource names, joined.
+type permissionKey struct {
+	apiGroup, resource, nonResourceURL, names string
+}
+
+// subjectPermissions flattens the rules of every binding in snapshot naming user or one of groups into one
+// permission per target and set of verbs, listing the namespaces they are allowed in.
+func subjectPermissions(snapshot *permissions.Snapshot, user string, groups []string) []SubjectPermission {
+	// verbs[key][scope] holds the verbs allowed on key in a namespace, or in allNamespaces
+	verbs := make(map[permissionKey]map[string]map[string]bool)
+	allow := func(key permissionKey, scope string, ruleVerbs []string) {
+		if verbs[key] == nil {
+			verbs[key] = make(map[string]map[string]bool)
+		}
+		if verbs[key][scope] == nil {
+			verbs[key][scope] = make(map[string]bool)
+		}
+		for _, verb := range ruleVerbs {
+			verbs[key][scope][verb] = true
+		}
+	}
+	add := func(bindingNamespace string, subjects []rbacv1.Subject, ref rbacv1.RoleRef) {
+		if !bindingNames(subjects, bindingNamespace, user, groups) {
+			return
+		}
+		scope := bindingNamespace
+		if scope == "" {
+			scope = allNamespaces
+		}
+		for _, rule := range snapshot.Rules(bindingNamespace, ref) {
+			if len(rule.NonResourceURLs) > 0 {
+				// non-resource URLs are not namespaced, so role bindings don't grant them
+				if bindingNamespace == "" {
+					for _, url := range rule.NonResourceURLs {
+						allow(permissionKey{nonResourceURL: url}, scope, rule.Verbs)
+					}
+				}
+				continue
+			}
+			names := append([]string{}, rule.ResourceNames...)
+			sort.Strings(names)
+			for _, apiGroup := range rule.APIGroups {
+				for _, resource := range rule.Resources {
+					allow(permissionKey{apiGroup: apiGroup, resource: resource, names: strings.Join(names, ",")}, scope, rule.Verbs)
+				}
+			}
+		}
+	}
+	for _, crb := range snapshot.ClusterRoleBindings {
+		add("", crb.Subjects, crb.RoleRef)
+	}
+	for _, rb := range snapshot.RoleBindings {
+		add(rb.Namespace, rb.Subjects, rb.RoleRef)
+	}
+
+	allows := func(key permissionKey, scope, verb string) bool {
+		set := verbs[key][scope]
+		return set[rbacv1.VerbAll] || set[verb]
+	}
+	// redundant reports whether verb on key in scope is already allowed cluster-wide, or for every object
+	redundant := func(key permissionKey, scope, verb string) bool {
+		if scope != allNamespaces && allows(key, allNamespaces, verb) {
+			return true
+		}
+		if key.names == "" {
+			return false
+		}
+		unnamed := key
+		unnamed.names = ""
+		return allows(unnamed, scope, verb) || allows(unnamed, allNamespaces, verb)
+	}
+
+	result := []SubjectPermission{}
+	index := make(map[string]int)
+	for key, scopes := range verbs {
+		for scope, set := range scopes {
+			var remaining []string
+			if set[rbacv1.VerbAll] {
+				if !redundant(key, scope, rbacv1.VerbAll) {
+					remaining = []string{rbacv1.VerbAll}
+				}
+			} else {
+				for verb := range set {
+					if !redundant(key, scope, verb) {
+						remaining = append(remaining, verb)
+					}
+				}
+			}
+			if len(remaining) == 0 {
+				continue
+			}
+			sort.Strings(remaining)
+
+			id := key.apiGroup + "\x00" + key.resource + "\x00" + key.nonResourceURL + "\x00" + key.names + "\x00" + strings.Join(remaining, ",")
+			i, ok := index[id]
+			if !ok {
+				i = len(result)
+				index[id] = i
+				permission := SubjectPermission{APIGroup: key.apiGroup, Resource: key.resource, NonResourceURL: key.nonResourceURL, Verbs: remaining}
+				if key.names != "" {
+					permission.ResourceNames = strings.Split(key.names, ",")
+				}
+				result = append(result, permission)
+			}
+			result[i].Namespaces = append(result[i].Namespaces, scope)
+		}
+	}
+
+	for i := range result {
+		sort.Strings(result[i].Namespaces)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.APIGroup != b.APIGroup {
+			return a.APIGroup < b.APIGroup
+		}
+		if a.Resource != b.Resource {
+			return a.Resource < b.Resource
+		}
+		if a.NonResourceURL != b.NonResourceURL {
+			return a.NonResourceURL < b.NonResourceURL
+		}
+		if an, bn := strings.Join(a.ResourceNames, ","), strings.Join(b.ResourceNames, ","); an != bn {
+			return an < bn
+		}
+		return strings.Join(a.Namespaces, ",") < strings.Join(b.Namespaces, ",")
+	})
+	return result
+}
@@ -0,0 +1,143 @@
+package rbac
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// defaultSubjectSearchLimit is how many subjects a search returns unless ?limit= says otherwise.
+	defaultSubjectSearchLimit = 20
+	// maxSubjectSearchLimit bounds ?limit=.
+	maxSubjectSearchLimit = 200
+)
+
+// subjectKinds maps lowercased subject kinds to their canonical spelling.
+var subjectKinds = map[string]string{
+	"user":           rbacv1.UserKind,
+	"group":          rbacv1.GroupKind,
+	"serviceaccount": rbacv1.ServiceAccountKind,
+}
+
+// SubjectMatch is a subject found in bindings and how many bindings it appears in.
+type SubjectMatch struct {
+	Kind         string `json:"kind"`
+	Name         string `json:"name"`
+	Namespace    string `json:"namespace,omitempty"`
+	BindingCount int    `json:"bindingCount"`
+
+	prefix bool
+}
+
+// SubjectSearchHandler finds users, groups and service accounts named in any binding whose name contains
+// ?q=, ignoring case. Prefix matches rank first. ?kinds= restricts the kinds and ?limit= the result count.
+func SubjectSearchHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		query := strings.ToLower(strings.TrimSpace(c.QueryParam("q")))
+		if query == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "q is required")
+		}
+
+		limit := defaultSubjectSearchLimit
+		if value := c.QueryParam("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > maxSubjectSearchLimit {
+				return echo.NewHTTPError(http.StatusBadRequest, "limit must be a number between 1 and "+strconv.Itoa(maxSubjectSearchLimit))
+			}
+			limit = parsed
+		}
+
+		kinds := make(map[string]bool)
+		for _, kind := range strings.Split(c.QueryParam("kinds"), ",") {
+			if kind = strings.TrimSpace(kind); kind == "" {
+				continue
+			}
+			canonical, ok := subjectKinds[strings.ToLower(kind)]
+			if !ok {
+				return echo.NewHTTPError(http.StatusBadRequest, "Unknown subject kind "+kind+", expected User, Group or ServiceAccount")
+			}
+			kinds[canonical] = true
+		}
+
+		roleBindings, err := listRoleBindings(c, clientset, "")
+		if err != nil {
+			return httperror.Wrap(err, "Error listing role bindings: ")
+		}
+
+		clusterRoleBindings, err := listClusterRoleBindings(c, clientset)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
+		}
+
+		var bindings [][]rbacv1.Subject
+		for _, rb := range roleBindings.Items {
+			bindings = append(bindings, rb.Subjects)
+		}
+		for _, crb := range clusterRoleBindings.Items {
+			bindings = append(bindings, crb.Subjects)
+		}
+
+		return listing.Respond(c, searchSubjects(bindings, query, kinds, limit), listing.Meta{})
+	}
+}
+
+// searchSubjects matches the subjects of each binding against query, counting each binding once per subject.
+func searchSubjects(bindings [][]rbacv1.Subject, query string, kinds map[string]bool, limit int) []SubjectMatch {
+	matches := make(map[string]*SubjectMatch)
+	for _, subjects := range bindings {
+		seen := make(map[string]bool, len(subjects))
+		for _, subject := range subjects {
+			if len(kinds) > 0 && !kinds[subject.Kind] {
+				continue
+			}
+			name := strings.ToLower(subject.Name)
+			if !strings.Contains(name, query) {
+				continue
+			}
+
+			key := subject.Kind + "/" + subject.Namespace + "/" + subject.Name
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+
+			match, ok := matches[key]
+			if !ok {
+				match = &SubjectMatch{Kind: subject.Kind, Name: subject.Name, Namespace: subject.Namespace, prefix: strings.HasPrefix(name, query)}
+				matches[key] = match
+			}
+			match.BindingCount++
+		}
+	}
+
+	results := make([]SubjectMatch, 0, len(matches))
+	for _, match := range matches {
+		results = append(results, *match)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.prefix != b.prefix {
+			return a.prefix
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.Namespace < b.Namespace
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
@@ -0,0 +1,124 @@
+package rbac
+
+import (
+	"net/http"
+	"reflect"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
+	"rbac/pkg/managed"
+	"rbac/pkg/templates"
+
+	"github.com/labstack/echo/v4"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// TemplateRequest supplies the parameters of a role template.
+type TemplateRequest struct {
+	Parameters map[string]string `json:"parameters"`
+}
+
+// TemplatesHandler lists the role templates.
+func TemplatesHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return listing.Respond(c, templates.List(), listing.Meta{})
+	}
+}
+
+// TemplateHandler returns a single role template.
+func TemplateHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		template, ok := templates.Get(c.Param("id"))
+		if !ok {
+			return echo.NewHTTPError(http.StatusNotFound, "Template not found: "+c.Param("id"))
+		}
+		return c.JSON(http.StatusOK, template)
+	}
+}
+
+// RenderTemplateHandler returns the objects a template would create, without creating them.
+func RenderTemplateHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		audit.Skip(c)
+
+		rendered, err := renderTemplate(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, rendered)
+	}
+}
+
+// ApplyTemplateHandler renders a template and creates its role and binding. A role left by an earlier
+// apply is reused if its rules are unchanged, so a template can be applied once per subject.
+func ApplyTemplateHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		rendered, err := renderTemplate(c)
+		if err != nil {
+			return err
+		}
+		ctx := c.Request().Context()
+		roles := clientset.RbacV1().Roles(rendered.Role.Namespace)
+		bindings := clientset.RbacV1().RoleBindings(rendered.RoleBinding.Namespace)
+		managed.Stamp(&rendered.Role.ObjectMeta, audit.Actor(c))
+		managed.Stamp(&rendered.RoleBinding.ObjectMeta, audit.Actor(c))
+
+		role, err := roles.Create(ctx, rendered.Role, metav1.CreateOptions{})
+		createdRole := err == nil
+		if apierrors.IsAlreadyExists(err) {
+			role, err = roles.Get(ctx, rendered.Role.Name, metav1.GetOptions{})
+			if err == nil && !reflect.DeepEqual(role.Rules, rendered.Role.Rules) {
+				return echo.NewHTTPError(http.StatusConflict, "Role "+role.Name+" already exists with different rules")
+			}
+		}
+		if err != nil {
+			return httperror.Wrap(err, "Failed to create role: ")
+		}
+
+		binding, err := bindings.Create(ctx, rendered.RoleBinding, metav1.CreateOptions{})
+		if err != nil {
+			// don't leave behind a role nothing is bound to
+			if createdRole {
+				_ = roles.Delete(ctx, role.Name, metav1.DeleteOptions{})
+			}
+			if apierrors.IsAlreadyExists(err) {
+				return echo.NewHTTPError(http.StatusConflict, "Role binding "+rendered.RoleBinding.Name+" already exists")
+			}
+			return httperror.Wrap(err, "Failed to create role binding: ")
+		}
+
+		result := templates.Rendered{Role: role, RoleBinding: binding}
+		entry := audit.EntryFromContext(c)
+		entry.Action = "apply_template"
+		entry.Resource = "templates"
+		entry.Namespace = binding.Namespace
+		entry.ResourceName = c.Param("id")
+		entry.Status = http.StatusOK
+		entry.Details = audit.NewDetails(nil, map[string]interface{}{"role": snapshot(role), "roleBinding": snapshot(binding)})
+		audit.RecordFromHandler(c, entry)
+
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// renderTemplate renders the template named by the :id parameter with the parameters in the request body.
+func renderTemplate(c echo.Context) (*templates.Rendered, error) {
+	template, ok := templates.Get(c.Param("id"))
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "Template not found: "+c.Param("id"))
+	}
+
+	var req TemplateRequest
+	if err := c.Bind(&req); err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Failed to decode request body: "+err.Error())
+	}
+
+	rendered, err := templates.Render(template, req.Parameters)
+	if err != nil {
+		return nil, echo.NewHTTPError(http.StatusBadRequest, "Invalid parameters: "+err.Error())
+	}
+	return rendered, nil
+}
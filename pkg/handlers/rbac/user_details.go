@@ -0,0 +1,110 @@
+package rbac
+
+import (
+	"net/http"
+
+	"rbac/pkg/httperror"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// UserDetailsResponse represents the detailed information about a user: the bindings naming them and the
+// roles and cluster roles those bindings reference. Found is false when no binding names the user, so they
+// have no access of their own.
+type UserDetailsResponse struct {
+	UserName            string                      `json:"userName"`
+	Found               bool                        `json:"found"`
+	RoleBindings        []rbacv1.RoleBinding        `json:"roleBindings"`
+	ClusterRoleBindings []rbacv1.ClusterRoleBinding `json:"clusterRoleBindings"`
+	Roles               []rbacv1.Role               `json:"roles"`
+	ClusterRoles        []rbacv1.ClusterRole        `json:"clusterRoles"`
+}
+
+// UserDetailsHandler handles requests for detailed information about a specific user.
+func UserDetailsHandler(clientset kubernetes.Interface) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		userName := c.QueryParam("userName")
+		if userName == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "User name is required")
+		}
+
+		roleBindings, err := listRoleBindingsNaming(c, clientset, rbacv1.UserKind, userName)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing role bindings: ")
+		}
+
+		clusterRoleBindings, err := listClusterRoleBindingsNaming(c, clientset, rbacv1.UserKind, userName)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
+		}
+
+		roles, err := listRoles(c, clientset, "")
+		if err != nil {
+			return httperror.Wrap(err, "Error listing roles: ")
+		}
+
+		clusterRoles, err := listClusterRoles(c, clientset)
+		if err != nil {
+			return httperror.Wrap(err, "Error listing cluster roles: ")
+		}
+
+		userDetails := extractUserDetails(userName, roleBindings.Items, clusterRoleBindings.Items, roles.Items, clusterRoles.Items)
+		return c.JSON(http.StatusOK, userDetails)
+	}
+}
+
+// extractUserDetails extracts detailed information about a specific user. Each binding, role and cluster
+// role is listed once, however many times it names or is referenced for the user.
+func extractUserDetails(userName string, roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding, roles []rbacv1.Role, clusterRoles []rbacv1.ClusterRole) UserDetailsResponse {
+	details := UserDetailsResponse{
+		UserName:            userName,
+		RoleBindings:        []rbacv1.RoleBinding{},
+		ClusterRoleBindings: []rbacv1.ClusterRoleBinding{},
+		Roles:               []rbacv1.Role{},
+		ClusterRoles:        []rbacv1.ClusterRole{},
+	}
+	namesUser := func(subjects []rbacv1.Subject) bool {
+		for _, subject := range subjects {
+			if subject.Kind == rbacv1.UserKind && subject.Name == userName {
+				return true
+			}
+		}
+		return false
+	}
+
+	referencedRoles := make(map[string]bool)
+	referencedClusterRoles := make(map[string]bool)
+	for _, rb := range roleBindings {
+		if !namesUser(rb.Subjects) {
+			continue
+		}
+		details.RoleBindings = append(details.RoleBindings, rb)
+		if rb.RoleRef.Kind == "ClusterRole" {
+			referencedClusterRoles[rb.RoleRef.Name] = true
+		} else {
+			referencedRoles[rb.Namespace+"/"+rb.RoleRef.Name] = true
+		}
+	}
+	for _, crb := range clusterRoleBindings {
+		if namesUser(crb.Subjects) {
+			details.ClusterRoleBindings = append(details.ClusterRoleBindings, crb)
+			referencedClusterRoles[crb.RoleRef.Name] = true
+		}
+	}
+
+	for _, role := range roles {
+		if referencedRoles[role.Namespace+"/"+role.Name] {
+			details.Roles = append(details.Roles, role)
+		}
+	}
+	for _, cr := range clusterRoles {
+		if referencedClusterRoles[cr.Name] {
+			details.ClusterRoles = append(details.ClusterRoles, cr)
+		}
+	}
+
+	details.Found = len(details.RoleBindings)+len(details.ClusterRoleBindings) > 0
+	return details
+}
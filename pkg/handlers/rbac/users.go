@@ -1,35 +1,36 @@
 package rbac
 
 import (
-	"context"
 	"net/http"
 
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
+
 	"github.com/labstack/echo/v4"
 	rbacv1 "k8s.io/api/rbac/v1"
-	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
 // UserRolesHandler handles requests to show the roles or cluster roles a user has access to.
-func UserRolesHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func UserRolesHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		userName := c.QueryParam("userName")
 		if userName == "" {
 			return echo.NewHTTPError(http.StatusBadRequest, "User name is required")
 		}
 
-		roleBindings, err := clientset.RbacV1().RoleBindings("").List(context.TODO(), metav1.ListOptions{})
+		roleBindings, err := listRoleBindings(c, clientset, "")
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing role bindings: ")
 		}
 
-		clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+		clusterRoleBindings, err := listClusterRoleBindings(c, clientset)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing cluster role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
 		}
 
 		userRoles := extractUserRoles(userName, roleBindings.Items, clusterRoleBindings.Items)
-		return c.JSON(http.StatusOK, userRoles)
+		return listing.Respond(c, userRoles, listing.Meta{})
 	}
 }
 
@@ -57,20 +58,20 @@ func extractUserRoles(username string, roleBindings []rbacv1.RoleBinding, cluste
 }
 
 // UsersHandler handles requests to list all users from role bindings and cluster role bindings.
-func UsersHandler(clientset *kubernetes.Clientset) echo.HandlerFunc {
+func UsersHandler(clientset kubernetes.Interface) echo.HandlerFunc {
 	return func(c echo.Context) error {
-		roleBindings, err := clientset.RbacV1().RoleBindings("").List(context.TODO(), metav1.ListOptions{})
+		roleBindings, err := listRoleBindings(c, clientset, "")
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing role bindings: ")
 		}
 
-		clusterRoleBindings, err := clientset.RbacV1().ClusterRoleBindings().List(context.TODO(), metav1.ListOptions{})
+		clusterRoleBindings, err := listClusterRoleBindings(c, clientset)
 		if err != nil {
-			return echo.NewHTTPError(http.StatusInternalServerError, "Error listing cluster role bindings: "+err.Error())
+			return httperror.Wrap(err, "Error listing cluster role bindings: ")
 		}
 
 		users := extractUsers(roleBindings.Items, clusterRoleBindings.Items)
-		return c.JSON(http.StatusOK, users)
+		return listing.Respond(c, users, listing.Meta{})
 	}
 }
 
@@ -0,0 +1,42 @@
+package rbac
+
+import (
+	"net/http"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/discovery"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// RuleValidation lists the parts of a role's rules that grant nothing on this cluster.
+type RuleValidation struct {
+	Warnings []discovery.Warning `json:"warnings"`
+	// Partial is set when some API groups could not be discovered, so warnings about them may be wrong.
+	Partial bool `json:"partial,omitempty"`
+}
+
+// ValidateRulesHandler checks the rules of a role or cluster role against the cluster's discovery
+// information without saving anything, so editors can lint while the user types.
+func ValidateRulesHandler(cache *discovery.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		audit.Skip(c)
+
+		var role rbacv1.ClusterRole
+		if err := c.Bind(&role); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to decode request body: "+err.Error())
+		}
+
+		catalog, err := cache.Catalog(false)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusServiceUnavailable, "Error retrieving API discovery information: "+err.Error())
+		}
+
+		warnings := catalog.Validate(role.Rules)
+		if warnings == nil {
+			warnings = []discovery.Warning{}
+		}
+		return c.JSON(http.StatusOK, RuleValidation{Warnings: warnings, Partial: catalog.Partial})
+	}
+}
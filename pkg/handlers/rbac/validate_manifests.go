@@ -0,0 +1,286 @@
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/discovery"
+	"rbac/pkg/httperror"
+	"rbac/pkg/manifests"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// maxManifestBytes bounds the manifests accepted for validation.
+const maxManifestBytes = 4 << 20
+
+// ManifestValidation is the result of validating a manifest. Errors are what would make applying it fail;
+// warnings are what would be applied but deserves a look, so pipelines can choose what fails a build.
+type ManifestValidation struct {
+	// Valid is set when no object has an error.
+	Valid    bool `json:"valid"`
+	Errors   int  `json:"errors"`
+	Warnings int  `json:"warnings"`
+	// DryRun is set when the objects were also submitted to the API server as a dry run.
+	DryRun bool `json:"dryRun"`
+	// Notes explain checks that could not be made, such as rule validation while discovery is unavailable.
+	Notes   []string           `json:"notes"`
+	Objects []ObjectValidation `json:"objects"`
+}
+
+// ObjectValidation is the result of validating one object of a manifest.
+type ObjectValidation struct {
+	// Index is the position of the object in the manifest, skipping empty documents.
+	Index     int                 `json:"index"`
+	Kind      string              `json:"kind,omitempty"`
+	Namespace string              `json:"namespace,omitempty"`
+	Name      string              `json:"name,omitempty"`
+	Errors    []manifests.Finding `json:"errors"`
+	Warnings  []manifests.Finding `json:"warnings"`
+}
+
+// ValidateManifestsHandler validates a multi-document YAML manifest, or a JSON array, of RBAC objects
+// without saving anything. Each object is decoded strictly, checked for what the API server would refuse,
+// linted and, for roles, checked against the cluster's discovery information. Unless ?dryRun=false, objects
+// without errors are then created or updated as a server-side dry run, so admission and RBAC escalation
+// checks are reported too. Namespaced objects without a namespace get ?namespace=, "default" unless given.
+func ValidateManifestsHandler(clientset kubernetes.Interface, cache *discovery.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		audit.Skip(c)
+
+		namespace := c.QueryParam("namespace")
+		if namespace == "" {
+			namespace = metav1.NamespaceDefault
+		} else if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid namespace: "+errs[0])
+		}
+		dryRun := true
+		if value := c.QueryParam("dryRun"); value != "" {
+			var err error
+			if dryRun, err = strconv.ParseBool(value); err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest, "dryRun must be true or false")
+			}
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxManifestBytes+1))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body: "+err.Error())
+		}
+		if len(body) > maxManifestBytes {
+			return echo.NewHTTPError(http.StatusRequestEntityTooLarge, fmt.Sprintf("Manifests are limited to %d bytes", maxManifestBytes))
+		}
+		docs, err := manifests.Parse(body)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Failed to parse manifest: "+err.Error())
+		}
+		if len(docs) == 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "The manifest holds no objects")
+		}
+
+		result := ManifestValidation{DryRun: dryRun, Notes: []string{}, Objects: []ObjectValidation{}}
+		catalog, err := cache.Catalog(false)
+		if err != nil {
+			catalog = nil
+			result.Notes = append(result.Notes, "Rules were not checked against the cluster, API discovery failed: "+err.Error())
+		} else if catalog.Partial {
+			result.Notes = append(result.Notes, "Some API groups could not be discovered, so rule warnings about them may be wrong")
+		}
+		batch := roleNames(docs)
+
+		ctx := c.Request().Context()
+		for _, doc := range docs {
+			object := ObjectValidation{Index: doc.Index, Kind: doc.Kind, Errors: []manifests.Finding{}, Warnings: []manifests.Finding{}}
+			if doc.Err != nil {
+				object.Errors = append(object.Errors, manifests.Finding{Source: manifests.SourceParse, Message: doc.Err.Error()})
+				result.Errors++
+				result.Objects = append(result.Objects, object)
+				continue
+			}
+
+			meta := doc.Meta()
+			if doc.Kind == manifests.KindRole || doc.Kind == manifests.KindRoleBinding {
+				if meta.Namespace == "" {
+					meta.Namespace = namespace
+				}
+				object.Namespace = meta.Namespace
+			}
+			object.Name = meta.Name
+
+			object.Errors = append(object.Errors, manifests.Check(doc)...)
+			object.Warnings = append(object.Warnings, manifests.Lint(doc)...)
+			if catalog != nil {
+				object.Warnings = append(object.Warnings, ruleWarnings(catalog, doc)...)
+			}
+			if dryRun && len(object.Errors) == 0 {
+				findings, err := dryRunManifest(ctx, clientset, doc)
+				if err != nil {
+					return err
+				}
+				object.Errors = append(object.Errors, findings...)
+			}
+			if dryRun {
+				warning, err := missingRoleRef(ctx, clientset, doc, batch)
+				if err != nil {
+					return err
+				}
+				if warning != nil {
+					object.Warnings = append(object.Warnings, *warning)
+				}
+			}
+
+			result.Errors += len(object.Errors)
+			result.Warnings += len(object.Warnings)
+			result.Objects = append(result.Objects, object)
+		}
+		result.Valid = result.Errors == 0
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// ruleWarnings returns the discovery warnings about the rules of a role.
+func ruleWarnings(catalog *discovery.Catalog, doc manifests.Document) []manifests.Finding {
+	var rules []rbacv1.PolicyRule
+	switch obj := doc.Object.(type) {
+	case *rbacv1.Role:
+		rules = obj.Rules
+	case *rbacv1.ClusterRole:
+		rules = obj.Rules
+	}
+	var findings []manifests.Finding
+	for _, warning := range catalog.Validate(rules) {
+		rule := warning.Rule
+		findings = append(findings, manifests.Finding{Source: manifests.SourceDiscovery, Rule: &rule, Message: warning.Message})
+	}
+	return findings
+}
+
+// dryRunManifest creates the object of doc, or updates it when it exists, as a server-side dry run and
+// returns what the API server refused. Failing to reach the API server at all is an error of the request.
+func dryRunManifest(ctx context.Context, clientset kubernetes.Interface, doc manifests.Document) ([]manifests.Finding, error) {
+	rbac := clientset.RbacV1()
+	create := metav1.CreateOptions{DryRun: []string{metav1.DryRunAll}}
+	update := metav1.UpdateOptions{DryRun: []string{metav1.DryRunAll}}
+
+	var err error
+	switch obj := doc.Object.(type) {
+	case *rbacv1.Role:
+		var existing *rbacv1.Role
+		if existing, err = rbac.Roles(obj.Namespace).Get(ctx, obj.Name, metav1.GetOptions{}); err == nil {
+			obj.ResourceVersion = existing.ResourceVersion
+			_, err = rbac.Roles(obj.Namespace).Update(ctx, obj, update)
+		} else if apierrors.IsNotFound(err) {
+			_, err = rbac.Roles(obj.Namespace).Create(ctx, obj, create)
+		}
+	case *rbacv1.ClusterRole:
+		var existing *rbacv1.ClusterRole
+		if existing, err = rbac.ClusterRoles().Get(ctx, obj.Name, metav1.GetOptions{}); err == nil {
+			obj.ResourceVersion = existing.ResourceVersion
+			_, err = rbac.ClusterRoles().Update(ctx, obj, update)
+		} else if apierrors.IsNotFound(err) {
+			_, err = rbac.ClusterRoles().Create(ctx, obj, create)
+		}
+	case *rbacv1.RoleBinding:
+		var existing *rbacv1.RoleBinding
+		if existing, err = rbac.RoleBindings(obj.Namespace).Get(ctx, obj.Name, metav1.GetOptions{}); err == nil {
+			obj.ResourceVersion = existing.ResourceVersion
+			_, err = rbac.RoleBindings(obj.Namespace).Update(ctx, obj, update)
+		} else if apierrors.IsNotFound(err) {
+			_, err = rbac.RoleBindings(obj.Namespace).Create(ctx, obj, create)
+		}
+	case *rbacv1.ClusterRoleBinding:
+		var existing *rbacv1.ClusterRoleBinding
+		if existing, err = rbac.ClusterRoleBindings().Get(ctx, obj.Name, metav1.GetOptions{}); err == nil {
+			obj.ResourceVersion = existing.ResourceVersion
+			_, err = rbac.ClusterRoleBindings().Update(ctx, obj, update)
+		} else if apierrors.IsNotFound(err) {
+			_, err = rbac.ClusterRoleBindings().Create(ctx, obj, create)
+		}
+	}
+	if err == nil {
+		return nil, nil
+	}
+
+	var status apierrors.APIStatus
+	if !errors.As(err, &status) || apierrors.IsServiceUnavailable(err) || apierrors.IsTimeout(err) || apierrors.IsServerTimeout(err) ||
+		apierrors.IsTooManyRequests(err) || apierrors.IsInternalError(err) {
+		return nil, httperror.Wrap(err, "Failed to dry run "+doc.Kind+": ")
+	}
+	details := status.Status().Details
+	if details == nil || len(details.Causes) == 0 {
+		return []manifests.Finding{{Source: manifests.SourceAdmission, Message: status.Status().Message}}, nil
+	}
+	findings := make([]manifests.Finding, 0, len(details.Causes))
+	for _, cause := range details.Causes {
+		message := cause.Message
+		if cause.Field != "" {
+			message = cause.Field + ": " + message
+		}
+		findings = append(findings, manifests.Finding{Source: manifests.SourceAdmission, Message: message})
+	}
+	return findings, nil
+}
+
+// roleNames returns the roles and cluster roles defined by docs, keyed as namespace/name and /name.
+func roleNames(docs []manifests.Document) map[string]bool {
+	names := make(map[string]bool)
+	for _, doc := range docs {
+		switch obj := doc.Object.(type) {
+		case *rbacv1.Role:
+			names[obj.Namespace+"/"+obj.Name] = true
+		case *rbacv1.ClusterRole:
+			names["/"+obj.Name] = true
+		}
+	}
+	return names
+}
+
+// missingRoleRef returns a warning when the binding of doc refers to a role that neither the manifest nor
+// the cluster defines. The API server accepts such bindings; they grant nothing until the role appears.
+func missingRoleRef(ctx context.Context, clientset kubernetes.Interface, doc manifests.Document, batch map[string]bool) (*manifests.Finding, error) {
+	var ref rbacv1.RoleRef
+	namespace := ""
+	switch obj := doc.Object.(type) {
+	case *rbacv1.RoleBinding:
+		ref = obj.RoleRef
+		if ref.Kind == manifests.KindRole {
+			namespace = obj.Namespace
+		}
+	case *rbacv1.ClusterRoleBinding:
+		ref = obj.RoleRef
+	default:
+		return nil, nil
+	}
+	if ref.Name == "" || batch[namespace+"/"+ref.Name] {
+		return nil, nil
+	}
+
+	var err error
+	switch ref.Kind {
+	case manifests.KindRole:
+		_, err = clientset.RbacV1().Roles(namespace).Get(ctx, ref.Name, metav1.GetOptions{})
+	case manifests.KindClusterRole:
+		_, err = clientset.RbacV1().ClusterRoles().Get(ctx, ref.Name, metav1.GetOptions{})
+	default:
+		return nil, nil
+	}
+	if apierrors.IsNotFound(err) {
+		return &manifests.Finding{
+			Source:  manifests.SourceLint,
+			Message: fmt.Sprintf("roleRef names %s %s, which neither the manifest nor the cluster defines", ref.Kind, ref.Name),
+		}, nil
+	}
+	if err != nil && !apierrors.IsForbidden(err) {
+		return nil, httperror.Wrap(err, "Failed to get "+ref.Kind+": ")
+	}
+	return nil, nil
+}
@@ -0,0 +1,62 @@
+package rbac
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"rbac/pkg/utils"
+	"rbac/pkg/watch"
+
+	"github.com/labstack/echo/v4"
+)
+
+// WatchRBACHandler streams RBAC change events to the client as server-sent events.
+func WatchRBACHandler(hub *watch.Hub) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		kinds, err := watch.ParseKinds(c.QueryParam("kinds"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid kinds: "+err.Error())
+		}
+
+		events, unsubscribe := hub.Subscribe(kinds)
+		defer unsubscribe()
+
+		res := c.Response()
+		utils.StartSSE(res)
+
+		heartbeat := time.NewTicker(utils.SSEHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-c.Request().Context().Done():
+				return nil
+			case <-hub.Done():
+				return nil
+			case <-heartbeat.C:
+				if err := utils.WriteSSEHeartbeat(res); err != nil {
+					return nil
+				}
+			case event, ok := <-events:
+				if !ok {
+					return nil
+				}
+				if err := utils.WriteSSEEvent(res, event.Type, event); err != nil {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// WatchHandler streams RBAC change events over whichever transport the client asks for: a WebSocket when the
+// request is an upgrade, server-sent events otherwise.
+func WatchHandler(sse, ws echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if strings.EqualFold(c.Request().Header.Get(echo.HeaderUpgrade), "websocket") {
+			return ws(c)
+		}
+		return sse(c)
+	}
+}
@@ -0,0 +1,127 @@
+package rbac
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"rbac/pkg/utils"
+	"rbac/pkg/watch"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+)
+
+// SnapshotMessage is the first message sent on a WebSocket connection, carrying the full current state.
+type SnapshotMessage struct {
+	Type    string             `json:"type"`
+	Objects []watch.ObjectLite `json:"objects"`
+}
+
+// wsWriteTimeout bounds how long a single WebSocket write may block.
+const wsWriteTimeout = 10 * time.Second
+
+// connectionLimiter tracks open connections per client.
+type connectionLimiter struct {
+	mu    sync.Mutex
+	max   int
+	conns map[string]int
+}
+
+// acquire reserves a connection slot for the client, reporting whether one was available.
+func (l *connectionLimiter) acquire(client string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.conns[client] >= l.max {
+		return false
+	}
+	l.conns[client]++
+	return true
+}
+
+// release frees a connection slot held by the client.
+func (l *connectionLimiter) release(client string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.conns[client]--
+	if l.conns[client] <= 0 {
+		delete(l.conns, client)
+	}
+}
+
+// WebSocketHandler pushes RBAC change events over a WebSocket, starting with a full state snapshot.
+// maxPerClient limits concurrent connections per client address; zero disables the limit.
+func WebSocketHandler(hub *watch.Hub, maxPerClient int) echo.HandlerFunc {
+	limiter := &connectionLimiter{max: maxPerClient, conns: make(map[string]int)}
+
+	return func(c echo.Context) error {
+		kinds, err := watch.ParseKinds(c.QueryParam("kinds"))
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid kinds: "+err.Error())
+		}
+
+		client := c.RealIP()
+		if !limiter.acquire(client) {
+			return echo.NewHTTPError(http.StatusTooManyRequests, "Too many concurrent WebSocket connections")
+		}
+		defer limiter.release(client)
+
+		websocket.Handler(func(ws *websocket.Conn) {
+			defer ws.Close()
+			streamWebSocket(ws, hub, kinds)
+		}).ServeHTTP(c.Response(), c.Request())
+		return nil
+	}
+}
+
+// streamWebSocket sends the initial snapshot and then forwards events until the client
+// disconnects or the hub stops.
+func streamWebSocket(ws *websocket.Conn, hub *watch.Hub, kinds map[string]bool) {
+	events, unsubscribe := hub.Subscribe(kinds)
+	defer unsubscribe()
+
+	snapshot := SnapshotMessage{Type: "SNAPSHOT", Objects: hub.Snapshot(kinds)}
+	if err := sendWebSocket(ws, snapshot); err != nil {
+		return
+	}
+
+	// The client is not expected to send anything; reading detects disconnects.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		var discard string
+		for websocket.Message.Receive(ws, &discard) == nil {
+		}
+	}()
+
+	heartbeat := time.NewTicker(utils.SSEHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-hub.Done():
+			return
+		case <-heartbeat.C:
+			if err := sendWebSocket(ws, map[string]string{"type": "HEARTBEAT"}); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := sendWebSocket(ws, event); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendWebSocket writes a JSON message with a write deadline.
+func sendWebSocket(ws *websocket.Conn, v interface{}) error {
+	if err := ws.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+		return err
+	}
+	return websocket.JSON.Send(ws, v)
+}
@@ -0,0 +1,128 @@
+package rbac
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"rbac/pkg/watch"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/websocket"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// eventually fails the test unless condition holds within a few seconds.
+func eventually(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWebSocketStream(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: "prod"}})
+	ctx, cancel := context.WithCancel(context.Background())
+	factory := informers.NewSharedInformerFactory(clientset, 0)
+	defer func() {
+		cancel()
+		factory.Shutdown()
+	}()
+	hub := watch.NewHub(ctx, factory)
+
+	e := echo.New()
+	e.GET("/ws", WebSocketHandler(hub, 1))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/ws?kinds=role"
+
+	ws, err := websocket.Dial(url, "", srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	if err := ws.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+
+	var snapshot SnapshotMessage
+	if err := websocket.JSON.Receive(ws, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	if snapshot.Type != "SNAPSHOT" || len(snapshot.Objects) != 1 || snapshot.Objects[0].Name != "deployer" {
+		t.Fatalf("first message = %+v, want a SNAPSHOT of deployer", snapshot)
+	}
+
+	// the fake API server only sends events to watches already open
+	eventually(t, "the roles watch", func() bool {
+		for _, action := range clientset.Actions() {
+			if action.GetVerb() == "watch" && action.GetResource().Resource == "roles" {
+				return true
+			}
+		}
+		return false
+	})
+	created := &rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "prod"}}
+	if _, err := clientset.RbacV1().Roles("prod").Create(ctx, created, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	var event watch.Event
+	if err := websocket.JSON.Receive(ws, &event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != watch.EventAdded || event.Kind != watch.KindRole || event.Name != "reader" {
+		t.Errorf("event = %+v, want reader ADDED", event)
+	}
+
+	if extra, err := websocket.Dial(url, "", srv.URL); err == nil {
+		extra.Close()
+		t.Error("second connection from the same client was accepted over the limit of 1")
+	}
+
+	ws.Close()
+	eventually(t, "the subscription to be released", func() bool { return hub.Subscribers() == 0 })
+	var last *websocket.Conn
+	eventually(t, "the connection slot to be released", func() bool {
+		last, err = websocket.Dial(url, "", srv.URL)
+		return err == nil
+	})
+	defer last.Close()
+
+	// stopping the hub, as the server does when it shuts down, ends open streams
+	if err := last.SetReadDeadline(time.Now().Add(5 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if err := websocket.JSON.Receive(last, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	var message map[string]interface{}
+	if err := websocket.JSON.Receive(last, &message); err == nil || strings.Contains(err.Error(), "timeout") {
+		t.Errorf("stream still open after the hub stopped: %v %v", message, err)
+	}
+}
+
+func TestWebSocketRefusesUnknownKinds(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	hub := watch.NewHub(ctx, informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0))
+
+	e := echo.New()
+	e.GET("/ws", WebSocketHandler(hub, 0))
+	srv := httptest.NewServer(e)
+	defer srv.Close()
+
+	if ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http")+"/ws?kinds=pods", "", srv.URL); err == nil {
+		ws.Close()
+		t.Error("connection with unknown kinds was accepted")
+	}
+}
@@ -0,0 +1,163 @@
+package rbac
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"rbac/pkg/discovery"
+	"rbac/pkg/httperror"
+	"rbac/pkg/permissions"
+	"rbac/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/kubernetes"
+)
+
+// WhoCanSubject is a subject allowed the action, and the grants allowing it.
+type WhoCanSubject struct {
+	Kind      string `json:"kind"`
+	Namespace string `json:"namespace,omitempty"`
+	Name      string `json:"name"`
+	// ResourceNames, when set, are the only objects the subject may act on.
+	ResourceNames []string            `json:"resourceNames,omitempty"`
+	Grants        []permissions.Grant `json:"grants"`
+}
+
+// WhoCan lists the subjects allowed an action.
+type WhoCan struct {
+	Verb           string          `json:"verb"`
+	APIGroup       string          `json:"apiGroup"`
+	Resource       string          `json:"resource,omitempty"`
+	ResourceName   string          `json:"resourceName,omitempty"`
+	NonResourceURL string          `json:"nonResourceURL,omitempty"`
+	Namespace      string          `json:"namespace,omitempty"`
+	Subjects       []WhoCanSubject `json:"subjects"`
+}
+
+// WhoCanHandler returns every user, group and service account that may use ?verb= on ?resource= in
+// ?namespace=, or cluster-wide when no namespace is given, resolving each binding to the rules of its role.
+// ?apiGroup= is looked up in discovery when omitted, ?resourceName= asks about one object, and
+// ?nonResourceURL= asks about an API server path instead of a resource. ?format=csv downloads the result as
+// one row per grant.
+func WhoCanHandler(clientset kubernetes.Interface, cache *discovery.Cache) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := permissions.Request{
+			Verb:           c.QueryParam("verb"),
+			Resource:       c.QueryParam("resource"),
+			ResourceName:   c.QueryParam("resourceName"),
+			NonResourceURL: c.QueryParam("nonResourceURL"),
+		}
+		if req.Verb == "" {
+			return echo.NewHTTPError(http.StatusBadRequest, "verb is required")
+		}
+		if (req.Resource == "") == (req.NonResourceURL == "") {
+			return echo.NewHTTPError(http.StatusBadRequest, "Exactly one of resource and nonResourceURL is required")
+		}
+		namespace := c.QueryParam("namespace")
+		if namespace != "" {
+			if errs := validation.IsDNS1123Label(namespace); len(errs) > 0 {
+				return echo.NewHTTPError(http.StatusBadRequest, "Invalid namespace: "+errs[0])
+			}
+		}
+		format := c.QueryParam("format")
+		if format != "" && format != "json" && format != "csv" {
+			return echo.NewHTTPError(http.StatusBadRequest, "format must be json or csv")
+		}
+		if req.Resource != "" {
+			apiGroup, _, err := resolveResource(c, cache, req.Resource)
+			if err != nil {
+				return err
+			}
+			req.APIGroup = apiGroup
+		}
+
+		snapshot, err := loadPermissions(c, clientset, namespace)
+		if err != nil {
+			return httperror.Wrap(err, "Error loading RBAC objects: ")
+		}
+
+		result := whoCan(snapshot, req, namespace)
+		if format == "csv" {
+			return respondWhoCanCSV(c, result)
+		}
+		return c.JSON(http.StatusOK, result)
+	}
+}
+
+// whoCan collects the subjects snapshot allows req in namespace, sorted by kind, namespace and name.
+func whoCan(snapshot *permissions.Snapshot, req permissions.Request, namespace string) WhoCan {
+	result := WhoCan{
+		Verb:           req.Verb,
+		APIGroup:       req.APIGroup,
+		Resource:       req.Resource,
+		ResourceName:   req.ResourceName,
+		NonResourceURL: req.NonResourceURL,
+		Namespace:      namespace,
+		Subjects:       []WhoCanSubject{},
+	}
+
+	subjects := make(map[string]*MatrixCell)
+	var order []rbacv1.Subject
+	for _, sg := range snapshot.Grants(req, namespace) {
+		subject := sg.Subject
+		if subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == "" {
+			// service accounts of a role binding default to its namespace
+			subject.Namespace = sg.Grant.BindingNamespace
+		}
+		key := subject.Kind + "/" + subject.Namespace + "/" + subject.Name
+		cell, ok := subjects[key]
+		if !ok {
+			cell = &MatrixCell{}
+			subjects[key] = cell
+			order = append(order, subject)
+		}
+		*cell = addGrant(*cell, sg.Grant)
+	}
+
+	for _, subject := range order {
+		cell := subjects[subject.Kind+"/"+subject.Namespace+"/"+subject.Name]
+		result.Subjects = append(result.Subjects, WhoCanSubject{
+			Kind:          subject.Kind,
+			Namespace:     subject.Namespace,
+			Name:          subject.Name,
+			ResourceNames: cell.ResourceNames,
+			Grants:        cell.Grants,
+		})
+	}
+	sort.Slice(result.Subjects, func(i, j int) bool {
+		a, b := result.Subjects[i], result.Subjects[j]
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		return a.Name < b.Name
+	})
+	return result
+}
+
+// respondWhoCanCSV streams the result as a CSV download, one row per subject and grant.
+func respondWhoCanCSV(c echo.Context, result WhoCan) error {
+	w, err := utils.StartCSV(c.Response(), "who-can", []string{"subjectKind", "subjectNamespace", "subjectName", "namespace", "role", "binding", "resourceNames"})
+	if err != nil {
+		return err
+	}
+	for _, subject := range result.Subjects {
+		for _, grant := range subject.Grants {
+			binding := grant.BindingName
+			if grant.BindingNamespace != "" {
+				binding = grant.BindingNamespace + "/" + binding
+			}
+			row := []string{subject.Kind, subject.Namespace, subject.Name, grant.BindingNamespace,
+				grant.RoleKind + " " + grant.RoleName, grant.BindingKind + " " + binding, strings.Join(grant.ResourceNames, " ")}
+			if err := w.Write(row); err != nil {
+				return err
+			}
+		}
+	}
+	return w.Close()
+}
@@ -0,0 +1,115 @@
+package health
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Check is a named dependency probe.
+type Check struct {
+	Name  string
+	Probe func(ctx context.Context) error
+}
+
+// CheckResult is the outcome of a single check.
+type CheckResult struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// Report is the readiness response body.
+type Report struct {
+	Status    string        `json:"status"`
+	Failed    []string      `json:"failed,omitempty"`
+	Checks    []CheckResult `json:"checks"`
+	CheckedAt time.Time     `json:"checkedAt"`
+}
+
+// Checker runs readiness checks, caching the report so frequent probes don't hammer dependencies.
+type Checker struct {
+	checks  []Check
+	timeout time.Duration
+	ttl     time.Duration
+
+	mu     sync.Mutex
+	report *Report
+}
+
+// NewChecker creates a checker that gives each check timeout to complete and reuses a report for ttl.
+func NewChecker(timeout, ttl time.Duration, checks ...Check) *Checker {
+	return &Checker{checks: checks, timeout: timeout, ttl: ttl}
+}
+
+// Run returns the cached report, or runs every check concurrently when the cache has expired.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.report != nil && time.Since(c.report.CheckedAt) < c.ttl {
+		return *c.report
+	}
+
+	// The report is shared by every caller, so one client disconnecting must not fail the checks
+	ctx = context.WithoutCancel(ctx)
+	results := make([]CheckResult, len(c.checks))
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+			checkCtx, cancel := context.WithTimeout(ctx, c.timeout)
+			defer cancel()
+
+			results[i] = CheckResult{Name: check.Name, OK: true}
+			if err := check.Probe(checkCtx); err != nil {
+				results[i] = CheckResult{Name: check.Name, OK: false, Error: err.Error()}
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: "ok", Checks: results, CheckedAt: time.Now().UTC()}
+	for _, result := range results {
+		if !result.OK {
+			report.Status = "unavailable"
+			report.Failed = append(report.Failed, result.Name)
+		}
+	}
+	c.report = &report
+	return report
+}
+
+// ReadinessHandler responds 200 when every check passes and 503 naming the failed dependencies otherwise.
+func (c *Checker) ReadinessHandler() echo.HandlerFunc {
+	return func(ctx echo.Context) error {
+		report := c.Run(ctx.Request().Context())
+		if report.Status != "ok" {
+			return ctx.JSON(http.StatusServiceUnavailable, report)
+		}
+		return ctx.JSON(http.StatusOK, report)
+	}
+}
+
+// LivenessHandler reports that the process is running without checking dependencies.
+func LivenessHandler() echo.HandlerFunc {
+	return func(c echo.Context) error {
+		return c.JSON(http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// KubernetesCheck verifies the API server is reachable and the credentials are accepted
+// by requesting the server version.
+func KubernetesCheck(clientset kubernetes.Interface) Check {
+	return Check{
+		Name: "kubernetes",
+		Probe: func(ctx context.Context) error {
+			return clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+		},
+	}
+}
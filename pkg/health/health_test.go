@@ -0,0 +1,149 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+)
+
+// probe returns a check named name that counts its calls in calls and fails with err.
+func probe(name string, calls *atomic.Int32, err error) Check {
+	return Check{Name: name, Probe: func(context.Context) error {
+		calls.Add(1)
+		return err
+	}}
+}
+
+// ready serves the readiness handler of c and returns the status and report.
+func ready(t *testing.T, c *Checker) (int, Report) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	if err := c.ReadinessHandler()(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/readyz", nil), rec)); err != nil {
+		t.Fatal(err)
+	}
+	var report Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	return rec.Code, report
+}
+
+func TestReadiness(t *testing.T) {
+	hang := Check{Name: "hang", Probe: func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+	var calls atomic.Int32
+	tests := []struct {
+		name       string
+		checks     []Check
+		wantStatus int
+		wantFailed []string
+	}{
+		{"all pass", []Check{probe("kubernetes", &calls, nil), probe("cache", &calls, nil)}, http.StatusOK, nil},
+		{"one fails", []Check{probe("kubernetes", &calls, errors.New("unauthorized")), probe("cache", &calls, nil)}, http.StatusServiceUnavailable, []string{"kubernetes"}},
+		{"timeout", []Check{hang, probe("cache", &calls, nil)}, http.StatusServiceUnavailable, []string{"hang"}},
+		{"no checks", nil, http.StatusOK, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start := time.Now()
+			status, report := ready(t, NewChecker(50*time.Millisecond, time.Minute, tt.checks...))
+			if elapsed := time.Since(start); elapsed > time.Second {
+				t.Errorf("checks took %v despite the timeout", elapsed)
+			}
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if len(report.Failed) != len(tt.wantFailed) || len(tt.wantFailed) > 0 && report.Failed[0] != tt.wantFailed[0] {
+				t.Errorf("failed = %v, want %v", report.Failed, tt.wantFailed)
+			}
+			if len(report.Checks) != len(tt.checks) {
+				t.Errorf("%d check results, want %d", len(report.Checks), len(tt.checks))
+			}
+			for _, result := range report.Checks {
+				if !result.OK && result.Error == "" {
+					t.Errorf("failed check %s reports no error", result.Name)
+				}
+			}
+		})
+	}
+}
+
+func TestReadinessCachesReport(t *testing.T) {
+	var calls atomic.Int32
+	c := NewChecker(time.Second, 50*time.Millisecond, probe("kubernetes", &calls, nil))
+
+	ready(t, c)
+	ready(t, c)
+	if n := calls.Load(); n != 1 {
+		t.Errorf("probed %d times within the TTL, want 1", n)
+	}
+	time.Sleep(60 * time.Millisecond)
+	ready(t, c)
+	if n := calls.Load(); n != 2 {
+		t.Errorf("probed %d times after the TTL, want 2", n)
+	}
+}
+
+func TestReadinessIgnoresCancelledProbe(t *testing.T) {
+	c := NewChecker(time.Second, time.Minute, Check{Name: "kubernetes", Probe: func(ctx context.Context) error {
+		return ctx.Err()
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if report := c.Run(ctx); report.Status != "ok" {
+		t.Errorf("report = %+v, want the shared report unaffected by the caller going away", report)
+	}
+}
+
+func TestLiveness(t *testing.T) {
+	rec := httptest.NewRecorder()
+	if err := LivenessHandler()(echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/healthz", nil), rec)); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestKubernetesCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		wantErr bool
+	}{
+		{"reachable", http.StatusOK, false},
+		{"credentials refused", http.StatusUnauthorized, true},
+		{"server failing", http.StatusInternalServerError, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/version" {
+					t.Errorf("requested %s, want /version", r.URL.Path)
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"major":"1","minor":"31"}`))
+			}))
+			defer apiServer.Close()
+			clientset, err := kubernetes.NewForConfig(&rest.Config{Host: apiServer.URL})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := KubernetesCheck(clientset).Probe(context.Background()); (err != nil) != tt.wantErr {
+				t.Errorf("Probe() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
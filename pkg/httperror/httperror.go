@@ -0,0 +1,116 @@
+// Package httperror maps errors, including those returned by the Kubernetes API, to HTTP responses with
+// a single JSON shape.
+package httperror
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Response is the body of every failed request.
+type Response struct {
+	// Code is a machine-readable reason, such as NotFound or Conflict, following Kubernetes status reasons.
+	Code    string      `json:"code"`
+	Message interface{} `json:"message"`
+	// Details lists the individual causes, such as invalid fields, when the API server reported them.
+	Details   []string `json:"details"`
+	RequestID string   `json:"requestId,omitempty"`
+}
+
+// Wrap returns an HTTP error for err prefixed with message. Kubernetes API errors keep their meaning:
+// NotFound becomes 404, Forbidden 403, Conflict and AlreadyExists 409, Invalid 422 and a timeout 504.
+// Anything else is a 500.
+func Wrap(err error, message string) *echo.HTTPError {
+	return echo.NewHTTPError(Status(err), message+err.Error()).SetInternal(err)
+}
+
+// Status returns the HTTP status matching a Kubernetes API error, or 500 for any other error.
+func Status(err error) int {
+	switch {
+	case apierrors.IsNotFound(err):
+		return http.StatusNotFound
+	case apierrors.IsForbidden(err):
+		return http.StatusForbidden
+	case apierrors.IsUnauthorized(err):
+		return http.StatusUnauthorized
+	case apierrors.IsConflict(err), apierrors.IsAlreadyExists(err):
+		return http.StatusConflict
+	case apierrors.IsInvalid(err):
+		return http.StatusUnprocessableEntity
+	case apierrors.IsBadRequest(err):
+		return http.StatusBadRequest
+	case apierrors.IsTimeout(err), apierrors.IsServerTimeout(err):
+		return http.StatusGatewayTimeout
+	case apierrors.IsTooManyRequests(err):
+		return http.StatusTooManyRequests
+	case apierrors.IsServiceUnavailable(err):
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+// reasons are the codes of responses that don't carry a Kubernetes status reason.
+var reasons = map[int]metav1.StatusReason{
+	http.StatusBadRequest:            metav1.StatusReasonBadRequest,
+	http.StatusUnauthorized:          metav1.StatusReasonUnauthorized,
+	http.StatusForbidden:             metav1.StatusReasonForbidden,
+	http.StatusNotFound:              metav1.StatusReasonNotFound,
+	http.StatusMethodNotAllowed:      metav1.StatusReasonMethodNotAllowed,
+	http.StatusConflict:              metav1.StatusReasonConflict,
+	http.StatusRequestEntityTooLarge: metav1.StatusReasonRequestEntityTooLarge,
+	http.StatusUnsupportedMediaType:  metav1.StatusReasonUnsupportedMediaType,
+	http.StatusUnprocessableEntity:   metav1.StatusReasonInvalid,
+	http.StatusTooManyRequests:       metav1.StatusReasonTooManyRequests,
+	http.StatusServiceUnavailable:    metav1.StatusReasonServiceUnavailable,
+	http.StatusGatewayTimeout:        metav1.StatusReasonTimeout,
+}
+
+// Build returns the status and body of the response for err. Errors that aren't HTTP errors are treated as
+// Kubernetes API errors, and otherwise as an internal error whose text is not disclosed.
+func Build(err error, requestID string) (int, Response) {
+	code := http.StatusInternalServerError
+	var message interface{} = http.StatusText(code)
+	cause := err
+
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		code = httpErr.Code
+		message = httpErr.Message
+		cause = httpErr.Internal
+	} else if errors.As(err, new(apierrors.APIStatus)) {
+		code = Status(err)
+		message = err.Error()
+	}
+
+	response := Response{Message: message, Details: []string{}, RequestID: requestID}
+
+	var status apierrors.APIStatus
+	if cause != nil && errors.As(cause, &status) {
+		if apiStatus := status.Status(); apiStatus.Details != nil {
+			for _, c := range apiStatus.Details.Causes {
+				detail := c.Message
+				if c.Field != "" {
+					detail = c.Field + ": " + detail
+				}
+				response.Details = append(response.Details, detail)
+			}
+		}
+		if reason := apierrors.ReasonForError(cause); reason != metav1.StatusReasonUnknown && Status(cause) == code {
+			response.Code = string(reason)
+		}
+	}
+	if response.Code == "" {
+		if reason, ok := reasons[code]; ok {
+			response.Code = string(reason)
+		} else if code >= http.StatusInternalServerError {
+			response.Code = string(metav1.StatusReasonInternalError)
+		} else {
+			response.Code = "Unknown"
+		}
+	}
+	return code, response
+}
@@ -0,0 +1,160 @@
+package httperror
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+)
+
+var roles = schema.GroupResource{Group: "rbac.authorization.k8s.io", Resource: "roles"}
+
+func TestBuild(t *testing.T) {
+	invalid := apierrors.NewInvalid(schema.GroupKind{Group: roles.Group, Kind: "Role"}, "deployer", field.ErrorList{
+		field.Required(field.NewPath("rules").Index(0).Child("verbs"), "at least one verb is required"),
+		field.Invalid(field.NewPath("metadata", "name"), "Deployer", "must be lowercase"),
+	})
+	tests := []struct {
+		name        string
+		err         error
+		wantStatus  int
+		wantCode    string
+		wantMessage interface{}
+		wantDetails []string
+	}{
+		{
+			name:        "not found",
+			err:         Wrap(apierrors.NewNotFound(roles, "deployer"), "Error getting role: "),
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "NotFound",
+			wantMessage: `Error getting role: roles.rbac.authorization.k8s.io "deployer" not found`,
+		},
+		{
+			name:        "forbidden",
+			err:         Wrap(apierrors.NewForbidden(roles, "deployer", errors.New("denied")), "Error: "),
+			wantStatus:  http.StatusForbidden,
+			wantCode:    "Forbidden",
+			wantMessage: `Error: roles.rbac.authorization.k8s.io "deployer" is forbidden: denied`,
+		},
+		{
+			name:        "conflict",
+			err:         Wrap(apierrors.NewConflict(roles, "deployer", errors.New("modified")), ""),
+			wantStatus:  http.StatusConflict,
+			wantCode:    "Conflict",
+			wantMessage: `Operation cannot be fulfilled on roles.rbac.authorization.k8s.io "deployer": modified`,
+		},
+		{
+			name:       "already exists",
+			err:        Wrap(apierrors.NewAlreadyExists(roles, "deployer"), ""),
+			wantStatus: http.StatusConflict,
+			wantCode:   "AlreadyExists",
+		},
+		{
+			name:        "invalid",
+			err:         Wrap(invalid, "Error creating role: "),
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantCode:    "Invalid",
+			wantDetails: []string{"rules[0].verbs: Required value: at least one verb is required", `metadata.name: Invalid value: "Deployer": must be lowercase`},
+		},
+		{
+			name:       "timeout",
+			err:        Wrap(apierrors.NewTimeoutError("request timed out", 1), ""),
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   "Timeout",
+		},
+		{
+			name:       "server timeout",
+			err:        Wrap(apierrors.NewServerTimeout(roles, "list", 1), ""),
+			wantStatus: http.StatusGatewayTimeout,
+			wantCode:   "ServerTimeout",
+		},
+		{
+			name:       "unauthorized",
+			err:        Wrap(apierrors.NewUnauthorized("token expired"), ""),
+			wantStatus: http.StatusUnauthorized,
+			wantCode:   "Unauthorized",
+		},
+		{
+			name:       "too many requests",
+			err:        Wrap(apierrors.NewTooManyRequests("slow down", 1), ""),
+			wantStatus: http.StatusTooManyRequests,
+			wantCode:   "TooManyRequests",
+		},
+		{
+			name:       "service unavailable",
+			err:        Wrap(apierrors.NewServiceUnavailable("etcd down"), ""),
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   "ServiceUnavailable",
+		},
+		{
+			name:        "unwrapped API error",
+			err:         apierrors.NewNotFound(roles, "deployer"),
+			wantStatus:  http.StatusNotFound,
+			wantCode:    "NotFound",
+			wantMessage: `roles.rbac.authorization.k8s.io "deployer" not found`,
+		},
+		{
+			name:        "plain error is not disclosed",
+			err:         errors.New("dial tcp 10.0.0.1:443: connection refused"),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    "InternalError",
+			wantMessage: "Internal Server Error",
+		},
+		{
+			name:        "wrapped plain error",
+			err:         Wrap(errors.New("connection refused"), "Error listing roles: "),
+			wantStatus:  http.StatusInternalServerError,
+			wantCode:    "InternalError",
+			wantMessage: "Error listing roles: connection refused",
+		},
+		{
+			name:        "HTTP error",
+			err:         echo.NewHTTPError(http.StatusBadRequest, "namespace is required"),
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    "BadRequest",
+			wantMessage: "namespace is required",
+		},
+		{
+			// the role is missing, but the request was refused as locked; the code follows the status
+			name:       "HTTP error over a different API error",
+			err:        echo.NewHTTPError(http.StatusLocked, "read-only").SetInternal(apierrors.NewNotFound(roles, "deployer")),
+			wantStatus: http.StatusLocked,
+			wantCode:   "Unknown",
+		},
+		{
+			name:       "gateway error",
+			err:        echo.NewHTTPError(http.StatusBadGateway),
+			wantStatus: http.StatusBadGateway,
+			wantCode:   "InternalError",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, response := Build(tt.err, "req-1")
+			if status != tt.wantStatus {
+				t.Errorf("status = %d, want %d", status, tt.wantStatus)
+			}
+			if response.Code != tt.wantCode {
+				t.Errorf("code = %q, want %q", response.Code, tt.wantCode)
+			}
+			if tt.wantMessage != nil && response.Message != tt.wantMessage {
+				t.Errorf("message = %v, want %v", response.Message, tt.wantMessage)
+			}
+			wantDetails := tt.wantDetails
+			if wantDetails == nil {
+				wantDetails = []string{}
+			}
+			if !reflect.DeepEqual(response.Details, wantDetails) {
+				t.Errorf("details = %q, want %q", response.Details, wantDetails)
+			}
+			if response.RequestID != "req-1" {
+				t.Errorf("requestId = %q, want req-1", response.RequestID)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package kubernetes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"rbac/pkg/metrics"
+	"rbac/pkg/version"
+
+	"k8s.io/client-go/rest"
+)
+
+func TestConfigure(t *testing.T) {
+	tests := []struct {
+		name    string
+		options Options
+	}{
+		{"tuned", Options{QPS: 50, Burst: 100, Timeout: 30 * time.Second}},
+		// zero leaves client-go to apply its own defaults
+		{"defaults", Options{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &rest.Config{QPS: 1, Burst: 1, Timeout: time.Hour, UserAgent: "kubectl"}
+			configure(config, tt.options)
+			if config.QPS != tt.options.QPS || config.Burst != tt.options.Burst || config.Timeout != tt.options.Timeout {
+				t.Errorf("QPS = %v, Burst = %d, Timeout = %v; want %v, %d, %v",
+					config.QPS, config.Burst, config.Timeout, tt.options.QPS, tt.options.Burst, tt.options.Timeout)
+			}
+			if want := "k-rbac/" + version.Version; config.UserAgent != want {
+				t.Errorf("UserAgent = %q, want %q", config.UserAgent, want)
+			}
+		})
+	}
+}
+
+// rateLimiterWaits returns how many waits for the client-side rate limiter were recorded.
+func rateLimiterWaits(t *testing.T) uint64 {
+	t.Helper()
+	families, err := metrics.Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var count uint64
+	for _, family := range families {
+		if family.GetName() == "kubeberus_kubernetes_rate_limiter_wait_seconds" {
+			for _, metric := range family.GetMetric() {
+				count += metric.GetHistogram().GetSampleCount()
+			}
+		}
+	}
+	return count
+}
+
+func TestNewClientsetFromKubeconfig(t *testing.T) {
+	var mu sync.Mutex
+	var userAgent string
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		userAgent = r.UserAgent()
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"major":"1","minor":"31","gitVersion":"v1.31.0"}`))
+	}))
+	defer apiServer.Close()
+
+	kubeconfig := filepath.Join(t.TempDir(), "config")
+	content := `apiVersion: v1
+kind: Config
+clusters:
+- name: test
+  cluster:
+    server: ` + apiServer.URL + `
+contexts:
+- name: test
+  context:
+    cluster: test
+    user: test
+current-context: test
+users:
+- name: test
+  user:
+    token: secret
+`
+	if err := os.WriteFile(kubeconfig, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// Outside a cluster, so the kubeconfig is used
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	t.Setenv("KUBECONFIG", kubeconfig)
+
+	clientset, err := NewClientset(Options{QPS: 100, Burst: 200})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waits := rateLimiterWaits(t)
+	if _, err := clientset.Discovery().ServerVersion(); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if want := "k-rbac/" + version.Version; userAgent != want {
+		t.Errorf("User-Agent = %q, want %q", userAgent, want)
+	}
+	if rateLimiterWaits(t) <= waits {
+		t.Error("rate limiter wait not recorded")
+	}
+}
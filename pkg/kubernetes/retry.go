@@ -0,0 +1,97 @@
+package kubernetes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"rbac/pkg/logging"
+	"rbac/pkg/utils"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// maxRetryAfter caps how long a Retry-After header can make a request wait.
+const maxRetryAfter = 10 * time.Second
+
+// retryBackoff spaces out retries that the API server gives no Retry-After for.
+var retryBackoff = wait.Backoff{Duration: 100 * time.Millisecond, Factor: 2, Jitter: 0.1, Cap: 2 * time.Second}
+
+// retryTransport wraps a Kubernetes client transport to retry reads up to maxRetries times when the request
+// fails without a response, is throttled or meets a server error. Mutations are sent once: client-go has
+// already consumed their bodies and a create or delete that reached the server may not be repeatable.
+func retryTransport(maxRetries int) func(http.RoundTripper) http.RoundTripper {
+	return func(rt http.RoundTripper) http.RoundTripper {
+		return utils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if maxRetries <= 0 || (req.Method != http.MethodGet && req.Method != http.MethodHead) {
+				return rt.RoundTrip(req)
+			}
+
+			ctx := req.Context()
+			backoff := retryBackoff
+			for attempt := 0; ; attempt++ {
+				resp, err := rt.RoundTrip(req)
+				if attempt == maxRetries || !retryable(resp, err) || ctx.Err() != nil {
+					return resp, err
+				}
+
+				delay := backoff.Step()
+				if after, ok := retryAfter(resp); ok {
+					delay = after
+				}
+				if resp != nil {
+					resp.Body.Close()
+				}
+				logging.CountRetry(ctx)
+				logging.FromContext(ctx).Debug("retrying Kubernetes API request", "method", req.Method, "path", req.URL.Path,
+					"attempt", attempt+1, "delay", delay.String(), "status", statusOf(resp), "error", errorOf(err))
+
+				timer := time.NewTimer(delay)
+				select {
+				case <-ctx.Done():
+					timer.Stop()
+					return nil, ctx.Err()
+				case <-timer.C:
+				}
+			}
+		})
+	}
+}
+
+// retryable reports whether a read is worth sending again: it failed in transit, or the API server answered
+// with Too Many Requests or a 5xx.
+func retryable(resp *http.Response, err error) bool {
+	if err != nil {
+		return true
+	}
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError
+}
+
+// retryAfter returns the delay a response asks for in whole seconds, capped at maxRetryAfter.
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return 0, false
+	}
+	if delay := time.Duration(seconds) * time.Second; delay < maxRetryAfter {
+		return delay, true
+	}
+	return maxRetryAfter, true
+}
+
+func statusOf(resp *http.Response) int {
+	if resp == nil {
+		return 0
+	}
+	return resp.StatusCode
+}
+
+func errorOf(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
@@ -0,0 +1,154 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"rbac/pkg/utils"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+// fastBackoff keeps the retries of a test quick.
+func fastBackoff(t *testing.T, backoff wait.Backoff) {
+	t.Helper()
+	saved := retryBackoff
+	retryBackoff = backoff
+	t.Cleanup(func() { retryBackoff = saved })
+}
+
+// replies answers successive requests with statuses, repeating the last one, and counts them.
+func replies(calls *int, header http.Header, statuses ...int) http.RoundTripper {
+	return utils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		status := statuses[min(*calls, len(statuses)-1)]
+		*calls++
+		return &http.Response{StatusCode: status, Header: header.Clone(), Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	})
+}
+
+func roundTrip(t *testing.T, rt http.RoundTripper, ctx context.Context, method string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, method, "https://kubernetes/api/v1/namespaces", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rt.RoundTrip(req)
+}
+
+func TestRetryTransport(t *testing.T) {
+	fastBackoff(t, wait.Backoff{Duration: time.Millisecond, Factor: 1})
+	tests := []struct {
+		name     string
+		method   string
+		statuses []int
+		calls    int
+		status   int
+	}{
+		{"get retried on 429", http.MethodGet, []int{http.StatusTooManyRequests, http.StatusOK}, 2, http.StatusOK},
+		{"get retried on 503", http.MethodGet, []int{http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusOK}, 3, http.StatusOK},
+		{"head retried on 500", http.MethodHead, []int{http.StatusInternalServerError, http.StatusOK}, 2, http.StatusOK},
+		{"get gives up after the retries", http.MethodGet, []int{http.StatusBadGateway}, 4, http.StatusBadGateway},
+		{"get not retried on 404", http.MethodGet, []int{http.StatusNotFound}, 1, http.StatusNotFound},
+		{"get not retried on 403", http.MethodGet, []int{http.StatusForbidden}, 1, http.StatusForbidden},
+		{"post never retried", http.MethodPost, []int{http.StatusServiceUnavailable}, 1, http.StatusServiceUnavailable},
+		{"put never retried", http.MethodPut, []int{http.StatusTooManyRequests}, 1, http.StatusTooManyRequests},
+		{"delete never retried", http.MethodDelete, []int{http.StatusInternalServerError}, 1, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			rt := retryTransport(3)(replies(&calls, nil, tt.statuses...))
+			resp, err := roundTrip(t, rt, context.Background(), tt.method)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.status || calls != tt.calls {
+				t.Errorf("status = %d after %d requests, want %d after %d", resp.StatusCode, calls, tt.status, tt.calls)
+			}
+		})
+	}
+}
+
+func TestRetryTransportRetriesTransportErrors(t *testing.T) {
+	fastBackoff(t, wait.Backoff{Duration: time.Millisecond, Factor: 1})
+	calls := 0
+	rt := retryTransport(2)(utils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			return nil, errors.New("connection reset by peer")
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Request: req}, nil
+	}))
+	if resp, err := roundTrip(t, rt, context.Background(), http.MethodGet); err != nil || resp.StatusCode != http.StatusOK || calls != 2 {
+		t.Errorf("got %v, %v after %d requests; want 200 after 2", resp, err, calls)
+	}
+}
+
+func TestRetryTransportDisabled(t *testing.T) {
+	calls := 0
+	rt := retryTransport(0)(replies(&calls, nil, http.StatusServiceUnavailable))
+	if _, err := roundTrip(t, rt, context.Background(), http.MethodGet); err != nil || calls != 1 {
+		t.Errorf("sent %d requests with retries disabled, want 1", calls)
+	}
+}
+
+func TestRetryTransportHonoursRetryAfter(t *testing.T) {
+	// Without the header the retry would wait for the backoff, far longer than the test allows
+	fastBackoff(t, wait.Backoff{Duration: time.Minute, Factor: 1})
+	calls := 0
+	rt := retryTransport(1)(replies(&calls, http.Header{"Retry-After": {"0"}}, http.StatusTooManyRequests, http.StatusOK))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := roundTrip(t, rt, ctx, http.MethodGet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || calls != 2 {
+		t.Errorf("status = %d after %d requests, want 200 after 2", resp.StatusCode, calls)
+	}
+}
+
+func TestRetryTransportStopsWithContext(t *testing.T) {
+	calls := 0
+	rt := retryTransport(3)(replies(&calls, http.Header{"Retry-After": {"5"}}, http.StatusServiceUnavailable))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := roundTrip(t, rt, ctx, http.MethodGet); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err = %v, want the context's deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second || calls != 1 {
+		t.Errorf("returned after %v and %d requests; the wait must end with the context", elapsed, calls)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		header string
+		delay  time.Duration
+		ok     bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"10", maxRetryAfter, true},
+		{"3600", maxRetryAfter, true},
+		{"-1", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, false},
+	}
+	for _, tt := range tests {
+		resp := &http.Response{Header: http.Header{"Retry-After": {tt.header}}}
+		if delay, ok := retryAfter(resp); delay != tt.delay || ok != tt.ok {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tt.header, delay, ok, tt.delay, tt.ok)
+		}
+	}
+	if _, ok := retryAfter(nil); ok {
+		t.Error("retryAfter(nil) found a delay")
+	}
+}
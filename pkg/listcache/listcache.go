@@ -0,0 +1,205 @@
+// Package listcache reuses the responses of Kubernetes LIST calls for a short while, for clusters where the
+// service may list but not watch and so cannot keep an informer cache. Writes made through the same client
+// invalidate the written resource at once; writes made by anyone else show up once the TTL has passed.
+package listcache
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"rbac/pkg/metrics"
+	"rbac/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contextKey is the type of context keys defined by this package.
+type contextKey int
+
+// bypassKey marks a request context whose LIST calls skip the cache.
+const bypassKey contextKey = iota
+
+// entry is a cached response.
+type entry struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// Cache holds LIST responses by resource, such as rolebindings, and by URL.
+type Cache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]map[string]entry
+	// generations count the writes to each resource, so a LIST that was in flight during a write is not
+	// cached afterwards.
+	generations map[string]uint64
+}
+
+// New creates a cache reusing LIST responses for ttl; zero disables caching.
+func New(ttl time.Duration) *Cache {
+	return &Cache{ttl: ttl, entries: make(map[string]map[string]entry), generations: make(map[string]uint64)}
+}
+
+// Bypass returns a context whose LIST calls go to the API server, refreshing the cache.
+func Bypass(ctx context.Context) context.Context {
+	return context.WithValue(ctx, bypassKey, true)
+}
+
+// Bypassed reports whether the LIST calls of ctx skip the cache.
+func Bypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(bypassKey).(bool)
+	return bypass
+}
+
+// Middleware bypasses the cache for requests with ?noCache=true.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if noCache, _ := strconv.ParseBool(c.QueryParam("noCache")); noCache {
+				c.SetRequest(c.Request().WithContext(Bypass(c.Request().Context())))
+			}
+			return next(c)
+		}
+	}
+}
+
+// Transport wraps a Kubernetes client transport to serve LIST calls from the cache and to invalidate a
+// resource whenever it is written.
+func (c *Cache) Transport(rt http.RoundTripper) http.RoundTripper {
+	if c.ttl <= 0 {
+		return rt
+	}
+	return utils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		resource := utils.KubernetesResource(req.URL.Path)
+		if !isList(req, resource) {
+			if req.Method != http.MethodGet && req.Method != http.MethodHead {
+				// invalidated once the write is done, so a LIST sent meanwhile can't cache the old state
+				defer c.Invalidate(resource)
+			}
+			return rt.RoundTrip(req)
+		}
+
+		key := req.URL.String()
+		bypass := Bypassed(req.Context())
+		if !bypass {
+			if cached, ok := c.lookup(resource, key); ok {
+				metrics.ListCacheLookup(resource, "hit")
+				return cached.response(req), nil
+			}
+		}
+		if bypass {
+			metrics.ListCacheLookup(resource, "bypass")
+		} else {
+			metrics.ListCacheLookup(resource, "miss")
+		}
+
+		generation := c.generation(resource)
+		resp, err := rt.RoundTrip(req)
+		if err != nil || resp.StatusCode != http.StatusOK {
+			return resp, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		c.store(resource, key, generation, entry{status: resp.StatusCode, header: resp.Header.Clone(), body: body})
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	})
+}
+
+// Invalidate drops the cached responses of resource.
+func (c *Cache) Invalidate(resource string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, resource)
+	c.generations[resource]++
+}
+
+// Flush drops every cached response, returning how many there were.
+func (c *Cache) Flush() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	flushed := 0
+	for resource, entries := range c.entries {
+		flushed += len(entries)
+		c.generations[resource]++
+	}
+	c.entries = make(map[string]map[string]entry)
+	return flushed
+}
+
+func (c *Cache) lookup(resource, key string) (entry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cached, ok := c.entries[resource][key]
+	if !ok || time.Now().After(cached.expires) {
+		return entry{}, false
+	}
+	return cached, true
+}
+
+func (c *Cache) generation(resource string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generations[resource]
+}
+
+// store caches a response unless resource was written since generation, dropping expired entries as it goes.
+func (c *Cache) store(resource, key string, generation uint64, cached entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.generations[resource] != generation {
+		return
+	}
+
+	now := time.Now()
+	entries := c.entries[resource]
+	if entries == nil {
+		entries = make(map[string]entry)
+		c.entries[resource] = entries
+	}
+	for k, e := range entries {
+		if now.After(e.expires) {
+			delete(entries, k)
+		}
+	}
+	cached.expires = now.Add(c.ttl)
+	entries[key] = cached
+}
+
+// response builds a fresh response from the cached one.
+func (e entry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        strconv.Itoa(e.status) + " " + http.StatusText(e.status),
+		StatusCode:    e.status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+// isList reports whether req lists a collection, as opposed to getting, watching or writing.
+func isList(req *http.Request, resource string) bool {
+	if req.Method != http.MethodGet {
+		return false
+	}
+	if watch, _ := strconv.ParseBool(req.URL.Query().Get("watch")); watch {
+		return false
+	}
+	return strings.HasSuffix(strings.TrimSuffix(req.URL.Path, "/"), "/"+resource)
+}
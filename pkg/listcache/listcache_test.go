@@ -0,0 +1,185 @@
+package listcache
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	roleBindings = "https://kubernetes/apis/rbac.authorization.k8s.io/v1/namespaces/prod/rolebindings"
+	roles        = "https://kubernetes/apis/rbac.authorization.k8s.io/v1/namespaces/prod/roles"
+)
+
+// apiServer answers every request with a body counting the requests it has received, or with status when
+// it isn't zero.
+type apiServer struct {
+	calls  atomic.Int64
+	status int
+	// during runs while a request is being answered.
+	during func()
+}
+
+func (s *apiServer) RoundTrip(req *http.Request) (*http.Response, error) {
+	n := s.calls.Add(1)
+	if s.during != nil {
+		s.during()
+	}
+	status := http.StatusOK
+	if s.status != 0 {
+		status = s.status
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": {"application/json"}},
+		Body:       io.NopCloser(strings.NewReader(strconv.FormatInt(n, 10))),
+		Request:    req,
+	}, nil
+}
+
+// send makes a request through rt and returns the response body.
+func send(t *testing.T, rt http.RoundTripper, ctx context.Context, method, url string) string {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := rt.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestTransportCachesLists(t *testing.T) {
+	server := &apiServer{}
+	rt := New(time.Minute).Transport(server)
+	ctx := context.Background()
+
+	first := send(t, rt, ctx, http.MethodGet, roleBindings)
+	if again := send(t, rt, ctx, http.MethodGet, roleBindings); again != first {
+		t.Errorf("second LIST answered %s, want the cached %s", again, first)
+	}
+	// Other URLs, gets and watches are separate
+	send(t, rt, ctx, http.MethodGet, roleBindings+"?labelSelector=team%3Dops")
+	send(t, rt, ctx, http.MethodGet, roleBindings+"/ci")
+	send(t, rt, ctx, http.MethodGet, roleBindings+"/ci")
+	send(t, rt, ctx, http.MethodGet, roleBindings+"?watch=true")
+	if calls := server.calls.Load(); calls != 5 {
+		t.Errorf("API server received %d requests, want 5", calls)
+	}
+}
+
+func TestTransportWriteInvalidates(t *testing.T) {
+	server := &apiServer{}
+	cache := New(time.Minute)
+	rt := cache.Transport(server)
+	ctx := context.Background()
+
+	send(t, rt, ctx, http.MethodGet, roleBindings)
+	send(t, rt, ctx, http.MethodGet, roles)
+	generation := cache.generation("rolebindings")
+	send(t, rt, ctx, http.MethodPut, roleBindings+"/ci")
+	if cache.generation("rolebindings") != generation+1 {
+		t.Errorf("write didn't bump the generation of rolebindings")
+	}
+
+	before := server.calls.Load()
+	send(t, rt, ctx, http.MethodGet, roleBindings)
+	if server.calls.Load() != before+1 {
+		t.Error("LIST after a write was answered from the cache")
+	}
+	send(t, rt, ctx, http.MethodGet, roles)
+	if server.calls.Load() != before+1 {
+		t.Error("write to rolebindings invalidated roles")
+	}
+}
+
+func TestTransportDoesNotCacheListRacingWrite(t *testing.T) {
+	server := &apiServer{}
+	cache := New(time.Minute)
+	rt := cache.Transport(server)
+	ctx := context.Background()
+
+	// A write lands while the LIST is being answered, so its response may predate the write
+	server.during = func() { cache.Invalidate("rolebindings") }
+	send(t, rt, ctx, http.MethodGet, roleBindings)
+	server.during = nil
+
+	before := server.calls.Load()
+	send(t, rt, ctx, http.MethodGet, roleBindings)
+	if server.calls.Load() != before+1 {
+		t.Error("LIST that raced a write was cached")
+	}
+}
+
+func TestTransportExpires(t *testing.T) {
+	server := &apiServer{}
+	rt := New(50 * time.Millisecond).Transport(server)
+	ctx := context.Background()
+
+	first := send(t, rt, ctx, http.MethodGet, roleBindings)
+	time.Sleep(100 * time.Millisecond)
+	if again := send(t, rt, ctx, http.MethodGet, roleBindings); again == first {
+		t.Error("LIST answered from the cache after the TTL")
+	}
+}
+
+func TestTransportSkipsFailures(t *testing.T) {
+	server := &apiServer{status: http.StatusForbidden}
+	rt := New(time.Minute).Transport(server)
+	ctx := context.Background()
+
+	send(t, rt, ctx, http.MethodGet, roleBindings)
+	send(t, rt, ctx, http.MethodGet, roleBindings)
+	if calls := server.calls.Load(); calls != 2 {
+		t.Errorf("API server received %d requests, want 2; failed LISTs must not be cached", calls)
+	}
+}
+
+func TestTransportDisabled(t *testing.T) {
+	server := &apiServer{}
+	if rt := New(0).Transport(server); rt != http.RoundTripper(server) {
+		t.Error("a zero TTL still wraps the transport")
+	}
+}
+
+func TestNoCacheBypasses(t *testing.T) {
+	server := &apiServer{}
+	rt := New(time.Minute).Transport(server)
+	first := send(t, rt, context.Background(), http.MethodGet, roleBindings)
+
+	var bypassed string
+	e := echo.New()
+	e.GET("/", func(c echo.Context) error {
+		bypassed = send(t, rt, c.Request().Context(), http.MethodGet, roleBindings)
+		return nil
+	}, Middleware())
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?noCache=true", nil))
+	if bypassed == first {
+		t.Fatal("?noCache=true was answered from the cache")
+	}
+	// The bypassing LIST refreshes the cache for everyone else
+	if again := send(t, rt, context.Background(), http.MethodGet, roleBindings); again != bypassed {
+		t.Errorf("LIST after a bypass answered %s, want the refreshed %s", again, bypassed)
+	}
+
+	before := server.calls.Load()
+	e.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/?noCache=false", nil))
+	if server.calls.Load() != before {
+		t.Error("?noCache=false bypassed the cache")
+	}
+}
@@ -0,0 +1,70 @@
+// Package listing writes the responses of list endpoints. Under /api they are bare JSON arrays, as the
+// current frontend expects; under /api/v2 they are wrapped in an envelope that has room for totals,
+// pagination and warnings without breaking clients again.
+package listing
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contextKey is the context key marking a request for an enveloped response.
+const contextKey = "listing.enveloped"
+
+// List is the envelope of a list response.
+type List[T any] struct {
+	Items []T `json:"items"`
+	// Total is the number of items across every page.
+	Total int `json:"total"`
+	// Continue, when set, is passed back as ?continue= to fetch the next page.
+	Continue string   `json:"continue,omitempty"`
+	Warnings []string `json:"warnings"`
+}
+
+// Meta is what a handler knows about its items besides the items themselves.
+type Meta struct {
+	// Total is the number of items across every page; it defaults to the number of items given.
+	Total    int
+	Continue string
+	Warnings []string
+}
+
+// Middleware marks the requests of a route group for enveloped responses.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(contextKey, true)
+			return next(c)
+		}
+	}
+}
+
+// Enveloped reports whether the request expects an enveloped response.
+func Enveloped(c echo.Context) bool {
+	enveloped, _ := c.Get(contextKey).(bool)
+	return enveloped
+}
+
+// Respond writes items, enveloped with meta when the request expects it and as a bare array otherwise, with
+// the continue token in the X-Continue header.
+func Respond[T any](c echo.Context, items []T, meta Meta) error {
+	if !Enveloped(c) {
+		if meta.Continue != "" {
+			c.Response().Header().Set(HeaderContinue, meta.Continue)
+		}
+		return c.JSON(http.StatusOK, items)
+	}
+
+	list := List[T]{Items: items, Total: meta.Total, Continue: meta.Continue, Warnings: meta.Warnings}
+	if list.Items == nil {
+		list.Items = []T{}
+	}
+	if list.Total < len(list.Items) {
+		list.Total = len(list.Items)
+	}
+	if list.Warnings == nil {
+		list.Warnings = []string{}
+	}
+	return c.JSON(http.StatusOK, list)
+}
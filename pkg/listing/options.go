@@ -0,0 +1,126 @@
+package listing
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// maxLimit bounds ?limit=, the page size asked of the API server.
+const maxLimit = 1000
+
+// HeaderContinue carries the continue token of a bare array response, which has nowhere else to put it.
+const HeaderContinue = "X-Continue"
+
+// The orders ?sort= accepts; a leading - reverses them.
+const (
+	SortName              = "name"
+	SortNamespace         = "namespace"
+	SortCreationTimestamp = "creationTimestamp"
+)
+
+// ListOptions adds the paging and selection parameters of a list request to opts: ?limit= and ?continue=
+// page through the API server's results and ?labelSelector= narrows them, together with any selector opts
+// already has.
+func ListOptions(c echo.Context, opts metav1.ListOptions) (metav1.ListOptions, error) {
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 || limit > maxLimit {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("limit must be a number between 1 and %d", maxLimit))
+		}
+		opts.Limit = limit
+	}
+	opts.Continue = c.QueryParam("continue")
+
+	if selector := c.QueryParam("labelSelector"); selector != "" {
+		if _, err := labels.Parse(selector); err != nil {
+			return opts, echo.NewHTTPError(http.StatusBadRequest, "Invalid labelSelector: "+err.Error())
+		}
+		if opts.LabelSelector != "" {
+			selector = opts.LabelSelector + "," + selector
+		}
+		opts.LabelSelector = selector
+	}
+	return opts, nil
+}
+
+// Order is the order of a list response, as given by ?sort=.
+type Order struct {
+	field   string
+	reverse bool
+}
+
+// ParseOrder reads ?sort=: name, namespace or creationTimestamp, with a leading - for descending order.
+// Without it items keep the API server's order, which is by namespace and name. A paged list is sorted one
+// page at a time.
+func ParseOrder(c echo.Context) (Order, error) {
+	value := c.QueryParam("sort")
+	order := Order{field: strings.TrimPrefix(value, "-"), reverse: strings.HasPrefix(value, "-")}
+	switch order.field {
+	case "", SortName, SortNamespace, SortCreationTimestamp:
+		return order, nil
+	}
+	return Order{}, echo.NewHTTPError(http.StatusBadRequest, "sort must be name, namespace or creationTimestamp, optionally prefixed with -")
+}
+
+// less reports whether a comes before b. Ties are broken by namespace and then name.
+func (o Order) less(a, b metav1.Object) bool {
+	if o.reverse {
+		a, b = b, a
+	}
+	switch o.field {
+	case SortName:
+		if a.GetName() != b.GetName() {
+			return a.GetName() < b.GetName()
+		}
+	case SortCreationTimestamp:
+		at, bt := a.GetCreationTimestamp(), b.GetCreationTimestamp()
+		if !at.Equal(&bt) {
+			return at.Before(&bt)
+		}
+	}
+	if a.GetNamespace() != b.GetNamespace() {
+		return a.GetNamespace() < b.GetNamespace()
+	}
+	return a.GetName() < b.GetName()
+}
+
+// Sort orders items, whose metadata object returns.
+func Sort[T any](items []T, order Order, object func(*T) metav1.Object) {
+	if order.field == "" {
+		return
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		return order.less(object(&items[i]), object(&items[j]))
+	})
+}
+
+// SortList orders the items of a Kubernetes list in place.
+func SortList(list runtime.Object, order Order) error {
+	if order.field == "" {
+		return nil
+	}
+	items, err := apimeta.ExtractList(list)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if _, err := apimeta.Accessor(item); err != nil {
+			return err
+		}
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, _ := apimeta.Accessor(items[i])
+		b, _ := apimeta.Accessor(items[j])
+		return order.less(a, b)
+	})
+	return apimeta.SetList(list, items)
+}
@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"rbac/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+)
+
+// contextKey is the type of context keys defined by this package.
+type contextKey int
+
+const (
+	// requestIDKey holds the request id in a request context.
+	requestIDKey contextKey = iota
+	// retriesKey holds the count of Kubernetes API retries made for a request.
+	retriesKey
+)
+
+// maxRequestIDLength bounds request ids accepted from clients.
+const maxRequestIDLength = 128
+
+// Middleware assigns each request an id, taken from X-Request-ID when the client
+// supplies one, stores it in the request context and response header, and logs
+// the completed request as a structured line.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			req := c.Request()
+
+			requestID := req.Header.Get(echo.HeaderXRequestID)
+			if requestID == "" || len(requestID) > maxRequestIDLength {
+				requestID = newRequestID()
+			}
+			c.Response().Header().Set(echo.HeaderXRequestID, requestID)
+			retries := new(atomic.Int32)
+			ctx := context.WithValue(req.Context(), requestIDKey, requestID)
+			c.SetRequest(req.WithContext(context.WithValue(ctx, retriesKey, retries)))
+
+			err := next(c)
+
+			status := utils.ResponseStatus(c, err)
+			attrs := []any{
+				slog.String("method", req.Method),
+				slog.String("route", c.Path()),
+				slog.String("path", req.URL.Path),
+				slog.Int("status", status),
+				slog.Float64("latencyMs", float64(time.Since(start).Microseconds())/1000),
+				slog.String("remoteIP", c.RealIP()),
+			}
+			if n := retries.Load(); n > 0 {
+				attrs = append(attrs, slog.Int("kubeRetries", int(n)))
+			}
+			logger := FromContext(c.Request().Context())
+			switch {
+			case err != nil && status >= 500:
+				logger.Error("request failed", append(attrs, slog.String("error", err.Error()))...)
+			case err != nil:
+				logger.Warn("request rejected", append(attrs, slog.String("error", err.Error()))...)
+			default:
+				logger.Info("request completed", attrs...)
+			}
+			return err
+		}
+	}
+}
+
+// RequestID returns the id of the request carried by ctx, or an empty string.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// CountRetry records that a Kubernetes API call made for the request carried by ctx was retried.
+func CountRetry(ctx context.Context) {
+	if retries, ok := ctx.Value(retriesKey).(*atomic.Int32); ok {
+		retries.Add(1)
+	}
+}
+
+// FromContext returns the default logger annotated with the request id carried by ctx.
+func FromContext(ctx context.Context) *slog.Logger {
+	if id := RequestID(ctx); id != "" {
+		return slog.Default().With(slog.String("requestId", id))
+	}
+	return slog.Default()
+}
+
+// newRequestID generates a random 128-bit hex id.
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,107 @@
+package managed
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// Label is the well-known label naming the tool that manages an object.
+	Label = "app.kubernetes.io/managed-by"
+	// Value marks objects created or adopted by this tool.
+	Value = "k-rbac"
+	// CreatedByAnnotation records the actor that created or adopted an object through this tool.
+	CreatedByAnnotation = "k-rbac.io/created-by"
+
+	// policyKey is the context key holding the conflict policy.
+	policyKey = "managed.policy"
+)
+
+// Selector selects objects managed by this tool.
+var Selector = Label + "=" + Value
+
+// Stamp marks meta as managed by this tool on behalf of actor.
+func Stamp(meta *metav1.ObjectMeta, actor string) {
+	if meta.Labels == nil {
+		meta.Labels = make(map[string]string)
+	}
+	if meta.Annotations == nil {
+		meta.Annotations = make(map[string]string)
+	}
+	meta.Labels[Label] = Value
+	meta.Annotations[CreatedByAnnotation] = actor
+}
+
+// Adopt carries ownership over to desired, the replacement for existing. Objects already managed by this
+// tool keep their marks, unmanaged objects are adopted on behalf of actor, and objects owned by another
+// manager are left as they are.
+func Adopt(desired *metav1.ObjectMeta, existing metav1.ObjectMeta, actor string) {
+	switch Owner(existing) {
+	case Value:
+		Stamp(desired, existing.Annotations[CreatedByAnnotation])
+	case "":
+		Stamp(desired, actor)
+	}
+}
+
+// Owner returns the manager named by meta's managed-by label, or "" if it has none.
+func Owner(meta metav1.ObjectMeta) string {
+	return meta.Labels[Label]
+}
+
+// ListOptions returns list options honouring the ?managedOnly=true and ?managedBy= filters of the request.
+func ListOptions(c echo.Context) (metav1.ListOptions, error) {
+	managedBy := c.QueryParam("managedBy")
+	if value := c.QueryParam("managedOnly"); value != "" {
+		managedOnly, err := strconv.ParseBool(value)
+		if err != nil {
+			return metav1.ListOptions{}, fmt.Errorf("managedOnly must be true or false")
+		}
+		if managedOnly {
+			if managedBy != "" && managedBy != Value {
+				return metav1.ListOptions{}, fmt.Errorf("managedOnly=true cannot be combined with managedBy=%s", managedBy)
+			}
+			managedBy = Value
+		}
+	}
+
+	if managedBy == "" {
+		return metav1.ListOptions{}, nil
+	}
+	if errs := validation.IsValidLabelValue(managedBy); len(errs) > 0 {
+		return metav1.ListOptions{}, fmt.Errorf("managedBy is not a valid label value: %s", errs[0])
+	}
+	return metav1.ListOptions{LabelSelector: Label + "=" + managedBy}, nil
+}
+
+// Middleware makes the conflict policy available to CheckConflict. With refuseForeign set, changes to objects
+// owned by another manager are refused instead of merely warned about.
+func Middleware(refuseForeign bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(policyKey, refuseForeign)
+			return next(c)
+		}
+	}
+}
+
+// CheckConflict guards a change to existing when another manager, such as a GitOps controller, owns it:
+// the change is refused with 409 Conflict if the policy says so, and otherwise allowed with a Warning header.
+func CheckConflict(c echo.Context, existing metav1.ObjectMeta) error {
+	owner := Owner(existing)
+	if owner == "" || owner == Value {
+		return nil
+	}
+
+	if refuse, _ := c.Get(policyKey).(bool); refuse {
+		return echo.NewHTTPError(http.StatusConflict, fmt.Sprintf("Refusing to modify %s, which is managed by %s", existing.Name, owner))
+	}
+	message := fmt.Sprintf("%s is managed by %s, which may revert this change", existing.Name, owner)
+	c.Response().Header().Add("Warning", `199 kubeberus "`+message+`"`)
+	return nil
+}
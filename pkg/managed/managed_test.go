@@ -0,0 +1,81 @@
+package managed
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// owned returns metadata managed by manager on behalf of creator; an empty manager leaves it unmanaged.
+func owned(manager, creator string) metav1.ObjectMeta {
+	meta := metav1.ObjectMeta{Name: "ci"}
+	if manager != "" {
+		meta.Labels = map[string]string{Label: manager}
+		meta.Annotations = map[string]string{CreatedByAnnotation: creator}
+	}
+	return meta
+}
+
+func TestAdopt(t *testing.T) {
+	tests := []struct {
+		name             string
+		existing         metav1.ObjectMeta
+		owner, createdBy string
+	}{
+		{"managed keeps its creator", owned(Value, "alice"), Value, "alice"},
+		{"unmanaged is adopted", owned("", ""), Value, "bob"},
+		{"foreign is left alone", owned("argocd", ""), "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var desired metav1.ObjectMeta
+			Adopt(&desired, tt.existing, "bob")
+			if owner := Owner(desired); owner != tt.owner {
+				t.Errorf("owner = %q, want %q", owner, tt.owner)
+			}
+			if createdBy := desired.Annotations[CreatedByAnnotation]; createdBy != tt.createdBy {
+				t.Errorf("created by = %q, want %q", createdBy, tt.createdBy)
+			}
+		})
+	}
+}
+
+func TestCheckConflict(t *testing.T) {
+	tests := []struct {
+		name          string
+		existing      metav1.ObjectMeta
+		refuseForeign bool
+		code          int
+		warned        bool
+	}{
+		{"managed", owned(Value, "alice"), true, 0, false},
+		{"unmanaged", owned("", ""), true, 0, false},
+		{"foreign refused", owned("argocd", ""), true, http.StatusConflict, false},
+		{"foreign warned", owned("argocd", ""), false, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPut, "/", nil), rec)
+			err := Middleware(tt.refuseForeign)(func(c echo.Context) error {
+				return CheckConflict(c, tt.existing)
+			})(c)
+
+			code := 0
+			if httpErr, ok := err.(*echo.HTTPError); ok {
+				code = httpErr.Code
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.code {
+				t.Errorf("status = %d, want %d", code, tt.code)
+			}
+			if warned := rec.Header().Get("Warning") != ""; warned != tt.warned {
+				t.Errorf("warned = %v, want %v", warned, tt.warned)
+			}
+		})
+	}
+}
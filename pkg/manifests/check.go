@@ -0,0 +1,227 @@
+package manifests
+
+import (
+	"fmt"
+	"strings"
+
+	"rbac/pkg/protection"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// The sources of findings, telling a pipeline which stage found a problem.
+const (
+	// SourceParse findings are documents that could not be decoded.
+	SourceParse = "parse"
+	// SourceSchema findings are objects the API server would refuse as invalid.
+	SourceSchema = "schema"
+	// SourceAdmission findings are what the API server answered to a dry run.
+	SourceAdmission = "admission"
+	// SourceDiscovery findings are rules granting nothing on the cluster, per its discovery information.
+	SourceDiscovery = "discovery"
+	// SourceLint findings are valid objects that are probably a mistake or grant more than intended.
+	SourceLint = "lint"
+)
+
+// Finding is one problem found in an object.
+type Finding struct {
+	Source string `json:"source"`
+	// Rule is the index of the rule concerned, for findings about one rule of a role.
+	Rule    *int   `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// finding returns a finding about the rule at index rule, or about the whole object when rule is negative.
+func finding(source string, rule int, format string, args ...interface{}) Finding {
+	f := Finding{Source: source, Message: fmt.Sprintf(format, args...)}
+	if rule >= 0 {
+		f.Rule = &rule
+	}
+	return f
+}
+
+// Check returns the problems that make the API server refuse the decoded object of doc. It is no substitute
+// for a dry run, but works without a cluster.
+func Check(doc Document) []Finding {
+	var findings []Finding
+	fail := func(rule int, format string, args ...interface{}) {
+		findings = append(findings, finding(SourceSchema, rule, format, args...))
+	}
+
+	if meta := doc.Meta(); meta != nil && meta.Name == "" && meta.GenerateName == "" {
+		fail(-1, "metadata.name is required")
+	}
+	switch obj := doc.Object.(type) {
+	case *rbacv1.Role:
+		if obj.Namespace == "" {
+			fail(-1, "metadata.namespace is required")
+		}
+		for i, rule := range obj.Rules {
+			if len(rule.NonResourceURLs) > 0 {
+				fail(i, "nonResourceURLs are only allowed in a ClusterRole")
+			}
+			checkRule(rule, i, fail)
+		}
+	case *rbacv1.ClusterRole:
+		for i, rule := range obj.Rules {
+			checkRule(rule, i, fail)
+		}
+	case *rbacv1.RoleBinding:
+		if obj.Namespace == "" {
+			fail(-1, "metadata.namespace is required")
+		}
+		checkRoleRef(obj.RoleRef, fail, KindRole, KindClusterRole)
+		checkSubjects(obj.Subjects, true, fail)
+	case *rbacv1.ClusterRoleBinding:
+		checkRoleRef(obj.RoleRef, fail, KindClusterRole)
+		checkSubjects(obj.Subjects, false, fail)
+	}
+	return findings
+}
+
+// checkRule checks the rule at index i of a role.
+func checkRule(rule rbacv1.PolicyRule, i int, fail func(int, string, ...interface{})) {
+	if len(rule.Verbs) == 0 {
+		fail(i, "verbs are required")
+	}
+	if len(rule.NonResourceURLs) > 0 && (len(rule.Resources) > 0 || len(rule.APIGroups) > 0) {
+		fail(i, "a rule cannot have both nonResourceURLs and resources or apiGroups")
+	}
+	if len(rule.NonResourceURLs) == 0 && len(rule.Resources) == 0 {
+		fail(i, "resources or nonResourceURLs are required")
+	}
+	if len(rule.Resources) > 0 && len(rule.APIGroups) == 0 {
+		fail(i, "apiGroups are required for resources; use \"\" for the core group")
+	}
+}
+
+// checkRoleRef checks the role a binding refers to, which must be of one of kinds.
+func checkRoleRef(ref rbacv1.RoleRef, fail func(int, string, ...interface{}), kinds ...string) {
+	if ref.APIGroup != rbacv1.GroupName {
+		fail(-1, "roleRef.apiGroup must be %s", rbacv1.GroupName)
+	}
+	if !contains(kinds, ref.Kind) {
+		fail(-1, "roleRef.kind must be %s", strings.Join(kinds, " or "))
+	}
+	if ref.Name == "" {
+		fail(-1, "roleRef.name is required")
+	}
+}
+
+// checkSubjects checks the subjects of a binding. Service accounts of a role binding default to its
+// namespace; those of a cluster role binding must name theirs.
+func checkSubjects(subjects []rbacv1.Subject, namespaced bool, fail func(int, string, ...interface{})) {
+	for i, subject := range subjects {
+		if subject.Name == "" {
+			fail(-1, "subjects[%d].name is required", i)
+		}
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			if subject.APIGroup != "" {
+				fail(-1, "subjects[%d].apiGroup must be empty for a ServiceAccount", i)
+			}
+			if subject.Namespace == "" && !namespaced {
+				fail(-1, "subjects[%d].namespace is required for a ServiceAccount", i)
+			}
+		case rbacv1.UserKind, rbacv1.GroupKind:
+			if subject.APIGroup != rbacv1.GroupName {
+				fail(-1, "subjects[%d].apiGroup must be %s for a %s", i, rbacv1.GroupName, subject.Kind)
+			}
+		default:
+			fail(-1, "subjects[%d].kind must be User, Group or ServiceAccount", i)
+		}
+	}
+}
+
+// broadGroups are groups that include every, or every anonymous, client of the cluster.
+var broadGroups = map[string]bool{
+	"system:authenticated":   true,
+	"system:unauthenticated": true,
+}
+
+// escalatingVerbs are verbs that let their holder gain permissions they were not granted.
+var escalatingVerbs = map[string]bool{
+	"escalate":    true,
+	"bind":        true,
+	"impersonate": true,
+}
+
+// Lint returns the findings about the decoded object of doc that the API server would accept but are
+// probably a mistake or grant more than intended.
+func Lint(doc Document) []Finding {
+	var findings []Finding
+	warn := func(rule int, format string, args ...interface{}) {
+		findings = append(findings, finding(SourceLint, rule, format, args...))
+	}
+
+	if meta := doc.Meta(); meta != nil && protection.IsSystem(*meta) {
+		warn(-1, "%s is a system object; changing it through the service requires an admin protection override", meta.Name)
+	}
+	switch obj := doc.Object.(type) {
+	case *rbacv1.Role:
+		lintRules(obj.Rules, warn)
+	case *rbacv1.ClusterRole:
+		if obj.AggregationRule != nil && len(obj.Rules) > 0 {
+			warn(-1, "the rules of an aggregated ClusterRole are overwritten by the controller")
+		}
+		lintRules(obj.Rules, warn)
+	case *rbacv1.RoleBinding:
+		lintBinding(obj.RoleRef, obj.Subjects, warn)
+	case *rbacv1.ClusterRoleBinding:
+		lintBinding(obj.RoleRef, obj.Subjects, warn)
+	}
+	return findings
+}
+
+// lintRules flags wildcards, escalating verbs and access to secrets.
+func lintRules(rules []rbacv1.PolicyRule, warn func(int, string, ...interface{})) {
+	for i, rule := range rules {
+		if contains(rule.Verbs, rbacv1.VerbAll) {
+			warn(i, "grants every verb, including ones added to the API later")
+		}
+		if contains(rule.Resources, rbacv1.ResourceAll) {
+			warn(i, "grants every resource, including ones added to the API later")
+		}
+		if contains(rule.APIGroups, rbacv1.APIGroupAll) {
+			warn(i, "applies to every API group, including those of CRDs installed later")
+		}
+		for _, verb := range rule.Verbs {
+			if escalatingVerbs[verb] {
+				warn(i, "grants %q, which allows gaining permissions beyond this role", verb)
+			}
+		}
+		coreGroup := contains(rule.APIGroups, "") || contains(rule.APIGroups, rbacv1.APIGroupAll)
+		readsSecrets := contains(rule.Verbs, rbacv1.VerbAll) || contains(rule.Verbs, "get") || contains(rule.Verbs, "list") || contains(rule.Verbs, "watch")
+		if coreGroup && readsSecrets && (contains(rule.Resources, "secrets") || contains(rule.Resources, rbacv1.ResourceAll)) {
+			warn(i, "grants read access to secrets")
+		}
+	}
+}
+
+// lintBinding flags bindings that grant nobody anything, grant cluster-admin or grant to everyone.
+func lintBinding(ref rbacv1.RoleRef, subjects []rbacv1.Subject, warn func(int, string, ...interface{})) {
+	if len(subjects) == 0 {
+		warn(-1, "the binding has no subjects, so it grants nothing")
+	}
+	if ref.Kind == KindClusterRole && ref.Name == "cluster-admin" {
+		warn(-1, "binds cluster-admin, which grants full control")
+	}
+	for _, subject := range subjects {
+		if subject.Kind == rbacv1.GroupKind && broadGroups[subject.Name] {
+			warn(-1, "binds group %s, which includes every such client of the cluster", subject.Name)
+		}
+		if subject.Kind == rbacv1.UserKind && subject.Name == "system:anonymous" {
+			warn(-1, "binds system:anonymous, granting unauthenticated requests")
+		}
+	}
+}
+
+// contains reports whether values includes value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
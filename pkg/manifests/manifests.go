@@ -0,0 +1,138 @@
+// Package manifests decodes and checks RBAC manifests, as written in a GitOps repository, without applying
+// them: structural errors that the API server would refuse, and lint findings that it would accept.
+package manifests
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/yaml"
+)
+
+// The kinds of object a manifest may hold.
+const (
+	KindRole               = "Role"
+	KindClusterRole        = "ClusterRole"
+	KindRoleBinding        = "RoleBinding"
+	KindClusterRoleBinding = "ClusterRoleBinding"
+)
+
+// Document is one object of a manifest.
+type Document struct {
+	// Index is the position of the object in the manifest, counting from zero and skipping empty documents.
+	Index int
+	Kind  string
+	// Object is the decoded *rbacv1.Role, *rbacv1.ClusterRole, *rbacv1.RoleBinding or *rbacv1.ClusterRoleBinding;
+	// it is nil when Err is set.
+	Object runtime.Object
+	// Err is why the document could not be decoded.
+	Err error
+}
+
+// Meta returns the object metadata of the document, or nil when it could not be decoded.
+func (d Document) Meta() *metav1.ObjectMeta {
+	switch obj := d.Object.(type) {
+	case *rbacv1.Role:
+		return &obj.ObjectMeta
+	case *rbacv1.ClusterRole:
+		return &obj.ObjectMeta
+	case *rbacv1.RoleBinding:
+		return &obj.ObjectMeta
+	case *rbacv1.ClusterRoleBinding:
+		return &obj.ObjectMeta
+	}
+	return nil
+}
+
+// Parse splits a multi-document YAML manifest, or a JSON array of objects, into documents. Documents that
+// can't be decoded are returned with their error, so one typo doesn't hide the results of the others; Parse
+// itself only fails when the manifest can't be split at all.
+func Parse(data []byte) ([]Document, error) {
+	chunks, err := split(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []Document
+	for _, chunk := range chunks {
+		var probe interface{}
+		if err := yaml.Unmarshal(chunk, &probe); err == nil && probe == nil {
+			// comments or empty documents between separators
+			continue
+		}
+		doc := decode(chunk)
+		doc.Index = len(docs)
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// split returns the documents of a YAML stream, or the elements of a JSON array.
+func split(data []byte) ([][]byte, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var items []json.RawMessage
+		if err := json.Unmarshal(trimmed, &items); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %w", err)
+		}
+		chunks := make([][]byte, len(items))
+		for i, item := range items {
+			chunks[i] = item
+		}
+		return chunks, nil
+	}
+
+	var chunks [][]byte
+	reader := utilyaml.NewYAMLReader(bufio.NewReader(bytes.NewReader(data)))
+	for {
+		chunk, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return chunks, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid YAML stream: %w", err)
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+// decode decodes one document strictly, so misspelled fields are errors rather than silently dropped.
+func decode(chunk []byte) Document {
+	var meta metav1.TypeMeta
+	if err := yaml.Unmarshal(chunk, &meta); err != nil {
+		return Document{Err: fmt.Errorf("invalid document: %w", err)}
+	}
+	doc := Document{Kind: meta.Kind}
+	if meta.APIVersion != rbacv1.SchemeGroupVersion.String() {
+		doc.Err = fmt.Errorf("apiVersion %q is not %s", meta.APIVersion, rbacv1.SchemeGroupVersion.String())
+		return doc
+	}
+
+	var obj runtime.Object
+	switch meta.Kind {
+	case KindRole:
+		obj = &rbacv1.Role{}
+	case KindClusterRole:
+		obj = &rbacv1.ClusterRole{}
+	case KindRoleBinding:
+		obj = &rbacv1.RoleBinding{}
+	case KindClusterRoleBinding:
+		obj = &rbacv1.ClusterRoleBinding{}
+	default:
+		doc.Err = fmt.Errorf("kind %q is not Role, ClusterRole, RoleBinding or ClusterRoleBinding", meta.Kind)
+		return doc
+	}
+	if err := yaml.UnmarshalStrict(chunk, obj); err != nil {
+		doc.Err = fmt.Errorf("invalid %s: %w", meta.Kind, err)
+		return doc
+	}
+	doc.Object = obj
+	return doc
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/auth"
+	"rbac/pkg/utils"
+
+	"github.com/labstack/echo/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+// Registry holds every metric exposed at /metrics.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeberus_http_requests_total",
+		Help: "HTTP requests served, by route, method and status code.",
+	}, []string{"route", "method", "status"})
+
+	httpRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kubeberus_http_request_duration_seconds",
+		Help:    "HTTP request latency, by route, method and status code.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	kubeRequestsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeberus_kubernetes_requests_total",
+		Help: "Kubernetes API requests, by verb, resource and status code.",
+	}, []string{"verb", "resource", "code"})
+
+	kubeRequestErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeberus_kubernetes_request_errors_total",
+		Help: "Kubernetes API requests that failed without a response, by verb and resource.",
+	}, []string{"verb", "resource"})
+
+	kubeRequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kubeberus_kubernetes_request_duration_seconds",
+		Help:    "Kubernetes API request latency, by verb and resource.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"verb", "resource"})
+
+	kubeRateLimiterWait = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "kubeberus_kubernetes_rate_limiter_wait_seconds",
+		Help:    "Time Kubernetes API requests waited for the client-side rate limiter, by verb and resource.",
+		Buckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+	}, []string{"verb", "resource"})
+
+	listCacheLookupsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeberus_list_cache_lookups_total",
+		Help: "Kubernetes LIST calls looked up in the list cache, by resource and result (hit, miss or bypass).",
+	}, []string{"resource", "result"})
+
+	auditEntriesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeberus_audit_entries_total",
+		Help: "Audit entries recorded, by action.",
+	}, []string{"action"})
+
+	authFailuresTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "kubeberus_auth_failures_total",
+		Help: "Requests refused for their credentials, by reason.",
+	}, []string{"reason"})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequestsTotal,
+		httpRequestDuration,
+		kubeRequestsTotal,
+		kubeRequestErrorsTotal,
+		kubeRequestDuration,
+		kubeRateLimiterWait,
+		listCacheLookupsTotal,
+		auditEntriesTotal,
+		authFailuresTotal,
+	)
+	clientmetrics.Register(clientmetrics.RegisterOpts{RateLimiterLatency: rateLimiterLatency{}})
+}
+
+// Handler serves the metrics registry. When token is set, requests must present it as a bearer token, and
+// refusals are recorded by the auditor attached to the request, whose AuditSink counts them.
+func Handler(token string) echo.HandlerFunc {
+	metricsHandler := echo.WrapHandler(promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	if token == "" {
+		return metricsHandler
+	}
+	return auth.RequireBearerToken(token)(metricsHandler)
+}
+
+// Middleware records request counts and latencies labelled by route pattern.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+
+			route := c.Path()
+			if route == "" {
+				route = "unmatched"
+			}
+			status := strconv.Itoa(utils.ResponseStatus(c, err))
+			method := c.Request().Method
+
+			httpRequestsTotal.WithLabelValues(route, method, status).Inc()
+			httpRequestDuration.WithLabelValues(route, method, status).Observe(time.Since(start).Seconds())
+			return err
+		}
+	}
+}
+
+// InstrumentTransport wraps a Kubernetes client transport to record API call metrics.
+func InstrumentTransport(rt http.RoundTripper) http.RoundTripper {
+	return utils.RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		start := time.Now()
+		verb := req.Method
+		resource := utils.KubernetesResource(req.URL.Path)
+
+		resp, err := rt.RoundTrip(req)
+		kubeRequestDuration.WithLabelValues(verb, resource).Observe(time.Since(start).Seconds())
+		if err != nil {
+			kubeRequestErrorsTotal.WithLabelValues(verb, resource).Inc()
+			return resp, err
+		}
+		kubeRequestsTotal.WithLabelValues(verb, resource, strconv.Itoa(resp.StatusCode)).Inc()
+		return resp, nil
+	})
+}
+
+// rateLimiterLatency records how long client-go throttled each request before sending it.
+type rateLimiterLatency struct{}
+
+// Observe records the wait of one request.
+func (rateLimiterLatency) Observe(_ context.Context, verb string, u url.URL, latency time.Duration) {
+	kubeRateLimiterWait.WithLabelValues(verb, utils.KubernetesResource(u.Path)).Observe(latency.Seconds())
+}
+
+// ListCacheLookup counts a LIST call looked up in the list cache.
+func ListCacheLookup(resource, result string) {
+	listCacheLookupsTotal.WithLabelValues(resource, result).Inc()
+}
+
+// AuditSink counts recorded audit entries.
+type AuditSink struct{}
+
+// Write increments the counter for the entry's action and, for failed authentications, their reason.
+func (AuditSink) Write(entry audit.Entry) {
+	auditEntriesTotal.WithLabelValues(entry.Action).Inc()
+	if entry.Action == audit.ActionAuthFailed {
+		authFailuresTotal.WithLabelValues(entry.Reason).Inc()
+	}
+}
@@ -0,0 +1,162 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"rbac/pkg/watch"
+
+	"github.com/prometheus/client_golang/prometheus"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// clusterAdminRole is the built-in ClusterRole granting full control of the cluster.
+const clusterAdminRole = "cluster-admin"
+
+var (
+	rbacObjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubeberus_rbac_objects",
+		Help: "RBAC objects in the cluster, by kind.",
+	}, []string{"kind"})
+
+	rbacSubjects = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "kubeberus_rbac_subjects",
+		Help: "Distinct subjects referenced by bindings, by subject kind.",
+	}, []string{"kind"})
+
+	clusterAdminBindings = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kubeberus_cluster_admin_bindings",
+		Help: "RoleBindings and ClusterRoleBindings that reference the cluster-admin ClusterRole.",
+	})
+
+	rbacStateLastRefresh = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "kubeberus_rbac_state_last_refresh_timestamp_seconds",
+		Help: "Unix time the RBAC state gauges were last refreshed.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(rbacObjects, rbacSubjects, clusterAdminBindings, rbacStateLastRefresh)
+}
+
+// RBACSource reads every RBAC object for the state gauges. It returns false when it could not read them
+// all, and the gauges keep their previous values.
+type RBACSource func(ctx context.Context) ([]watch.ObjectLite, bool)
+
+// InformerSource reads the RBAC objects from the hub's informer caches, once they have synced, so the gauges
+// are never set from a partial cache.
+func InformerSource(hub *watch.Hub) RBACSource {
+	kinds, _ := watch.ParseKinds("")
+	return func(ctx context.Context) ([]watch.ObjectLite, bool) {
+		if !hub.WaitForSync(ctx, kinds) {
+			return nil, false
+		}
+		return hub.Snapshot(kinds), true
+	}
+}
+
+// ListSource reads the RBAC objects by listing them, for deployments without the informer cache, which may
+// not be allowed to watch. The lists go through the client's list cache.
+func ListSource(clientset kubernetes.Interface) RBACSource {
+	return func(ctx context.Context) ([]watch.ObjectLite, bool) {
+		rbac := clientset.RbacV1()
+		var items []interface{}
+
+		roles, err := rbac.Roles("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			slog.Error("Error listing roles for the RBAC state metrics", "error", err)
+			return nil, false
+		}
+		for i := range roles.Items {
+			items = append(items, &roles.Items[i])
+		}
+		clusterRoles, err := rbac.ClusterRoles().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			slog.Error("Error listing cluster roles for the RBAC state metrics", "error", err)
+			return nil, false
+		}
+		for i := range clusterRoles.Items {
+			items = append(items, &clusterRoles.Items[i])
+		}
+		roleBindings, err := rbac.RoleBindings("").List(ctx, metav1.ListOptions{})
+		if err != nil {
+			slog.Error("Error listing role bindings for the RBAC state metrics", "error", err)
+			return nil, false
+		}
+		for i := range roleBindings.Items {
+			items = append(items, &roleBindings.Items[i])
+		}
+		clusterRoleBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			slog.Error("Error listing cluster role bindings for the RBAC state metrics", "error", err)
+			return nil, false
+		}
+		for i := range clusterRoleBindings.Items {
+			items = append(items, &clusterRoleBindings.Items[i])
+		}
+
+		objects := make([]watch.ObjectLite, 0, len(items))
+		for _, item := range items {
+			if lite, ok := watch.ToLite(item); ok {
+				objects = append(objects, lite)
+			}
+		}
+		return objects, true
+	}
+}
+
+// RunRBACStateCollector refreshes the RBAC state gauges from source every interval until ctx is cancelled.
+func RunRBACStateCollector(ctx context.Context, source RBACSource, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if objects, ok := source(ctx); ok && ctx.Err() == nil {
+			refreshRBACState(objects)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// refreshRBACState recomputes the gauges from a snapshot of every RBAC object.
+func refreshRBACState(objects []watch.ObjectLite) {
+	objectCounts := make(map[string]int)
+	subjects := map[string]map[string]struct{}{
+		rbacv1.UserKind:           {},
+		rbacv1.GroupKind:          {},
+		rbacv1.ServiceAccountKind: {},
+	}
+	adminBindings := 0
+
+	for _, object := range objects {
+		objectCounts[object.Kind]++
+		if object.RoleRef == nil {
+			continue
+		}
+		if object.RoleRef.Kind == "ClusterRole" && object.RoleRef.Name == clusterAdminRole {
+			adminBindings++
+		}
+		for _, subject := range object.Subjects {
+			if _, tracked := subjects[subject.Kind]; tracked {
+				subjects[subject.Kind][subject.Namespace+"/"+subject.Name] = struct{}{}
+			}
+		}
+	}
+
+	for _, kind := range watch.AllKinds {
+		rbacObjects.WithLabelValues(kind).Set(float64(objectCounts[kind]))
+	}
+	for kind, names := range subjects {
+		rbacSubjects.WithLabelValues(kind).Set(float64(len(names)))
+	}
+	clusterAdminBindings.Set(float64(adminBindings))
+	rbacStateLastRefresh.SetToCurrentTime()
+}
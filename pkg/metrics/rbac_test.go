@@ -0,0 +1,199 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"rbac/pkg/watch"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+// gathered returns the value of metric name from the registry, selecting the series labelled with kind
+// when it is set.
+func gathered(t *testing.T, name, kind string) float64 {
+	t.Helper()
+	families, err := Registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, family := range families {
+		if family.GetName() != name {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := metric.GetLabel()
+			if kind == "" || len(labels) == 1 && labels[0].GetName() == "kind" && labels[0].GetValue() == kind {
+				return metric.GetGauge().GetValue()
+			}
+		}
+	}
+	t.Fatalf("%s{kind=%q} not gathered", name, kind)
+	return 0
+}
+
+// rbacCluster is a cluster with two roles, cluster-admin, and three bindings of which two reference it.
+func rbacCluster() *fake.Clientset {
+	adminRef := rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: clusterAdminRole}
+	builder := rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: "builder", Namespace: "ci"}
+	return fake.NewSimpleClientset(
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: "prod"}},
+		&rbacv1.Role{ObjectMeta: metav1.ObjectMeta{Name: "reader", Namespace: "prod"}},
+		&rbacv1.ClusterRole{ObjectMeta: metav1.ObjectMeta{Name: clusterAdminRole}},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "prod"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "deployer"},
+			Subjects:   []rbacv1.Subject{builder, {Kind: rbacv1.UserKind, Name: "alice"}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "break-glass", Namespace: "prod"},
+			RoleRef:    adminRef,
+			Subjects:   []rbacv1.Subject{builder},
+		},
+		&rbacv1.ClusterRoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "admins"},
+			RoleRef:    adminRef,
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, Name: "ops"}, {Kind: rbacv1.UserKind, Name: "alice"}},
+		},
+	)
+}
+
+// collect runs the collector over source until the returned stop is called, which fails the test unless the
+// collector returns promptly.
+func collect(t *testing.T, source RBACSource) (stop func()) {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		RunRBACStateCollector(ctx, source, time.Hour)
+		close(done)
+	}()
+	return func() {
+		t.Helper()
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("collector still running after its context was cancelled")
+		}
+	}
+}
+
+func TestRBACStateCollector(t *testing.T) {
+	tests := []struct {
+		name   string
+		source func(ctx context.Context, clientset *fake.Clientset) RBACSource
+	}{
+		{"informers", func(ctx context.Context, clientset *fake.Clientset) RBACSource {
+			factory := informers.NewSharedInformerFactory(clientset, 0)
+			t.Cleanup(factory.Shutdown)
+			return InformerSource(watch.NewHub(ctx, factory))
+		}},
+		{"lists", func(_ context.Context, clientset *fake.Clientset) RBACSource {
+			return ListSource(clientset)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacStateLastRefresh.Set(0)
+			clusterAdminBindings.Set(0)
+			hubCtx, cancelHub := context.WithCancel(context.Background())
+			defer cancelHub()
+			clientset := rbacCluster()
+			stop := collect(t, tt.source(hubCtx, clientset))
+			defer stop()
+
+			deadline := time.Now().Add(5 * time.Second)
+			for gathered(t, "kubeberus_rbac_state_last_refresh_timestamp_seconds", "") == 0 {
+				if time.Now().After(deadline) {
+					t.Fatal("gauges not refreshed")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			values := []struct {
+				name  string
+				value float64
+				want  float64
+			}{
+				{"roles", gathered(t, "kubeberus_rbac_objects", watch.KindRole), 2},
+				{"cluster roles", gathered(t, "kubeberus_rbac_objects", watch.KindClusterRole), 1},
+				{"role bindings", gathered(t, "kubeberus_rbac_objects", watch.KindRoleBinding), 2},
+				{"cluster role bindings", gathered(t, "kubeberus_rbac_objects", watch.KindClusterRoleBinding), 1},
+				{"users", gathered(t, "kubeberus_rbac_subjects", rbacv1.UserKind), 1},
+				{"groups", gathered(t, "kubeberus_rbac_subjects", rbacv1.GroupKind), 1},
+				{"service accounts", gathered(t, "kubeberus_rbac_subjects", rbacv1.ServiceAccountKind), 1},
+				{"cluster-admin bindings", gathered(t, "kubeberus_cluster_admin_bindings", ""), 2},
+			}
+			for _, v := range values {
+				if v.value != v.want {
+					t.Errorf("%s = %v, want %v", v.name, v.value, v.want)
+				}
+			}
+
+			rec := httptest.NewRecorder()
+			e := echo.New()
+			if err := Handler("")(e.NewContext(httptest.NewRequest(http.MethodGet, "/metrics", nil), rec)); err != nil {
+				t.Fatal(err)
+			}
+			if want := `kubeberus_cluster_admin_bindings 2`; !strings.Contains(rec.Body.String(), want) {
+				t.Errorf("metrics output lacks %q", want)
+			}
+		})
+	}
+}
+
+func TestRBACStateCollectorKeepsGaugesWhenUnreadable(t *testing.T) {
+	// without the list permission informers never sync and lists fail
+	forbidden := func() *fake.Clientset {
+		clientset := rbacCluster()
+		clientset.PrependReactor("list", "*", func(action k8stesting.Action) (bool, runtime.Object, error) {
+			return true, nil, apierrors.NewForbidden(schema.GroupResource{Group: rbacv1.GroupName, Resource: action.GetResource().Resource}, "", errors.New("denied"))
+		})
+		return clientset
+	}
+	tests := []struct {
+		name   string
+		source func(ctx context.Context) RBACSource
+	}{
+		{"informers", func(ctx context.Context) RBACSource {
+			factory := informers.NewSharedInformerFactory(forbidden(), 0)
+			t.Cleanup(factory.Shutdown)
+			return InformerSource(watch.NewHub(ctx, factory))
+		}},
+		{"lists", func(context.Context) RBACSource {
+			return ListSource(forbidden())
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rbacStateLastRefresh.Set(0)
+			clusterAdminBindings.Set(7)
+			hubCtx, cancelHub := context.WithCancel(context.Background())
+			defer cancelHub()
+			stop := collect(t, tt.source(hubCtx))
+
+			time.Sleep(100 * time.Millisecond)
+			stop()
+			if got := gathered(t, "kubeberus_rbac_state_last_refresh_timestamp_seconds", ""); got != 0 {
+				t.Errorf("gauges refreshed at %v from objects that couldn't be read", got)
+			}
+			if got := gathered(t, "kubeberus_cluster_admin_bindings", ""); got != 7 {
+				t.Errorf("cluster-admin bindings = %v, want the previous value kept", got)
+			}
+		})
+	}
+}
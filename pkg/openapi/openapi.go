@@ -0,0 +1,258 @@
+// Package openapi builds the OpenAPI 3 document of the API from the routes registered with Echo and the
+// Go types their handlers read and write, so the contract can't drift from the code unnoticed.
+package openapi
+
+import (
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Document is an OpenAPI 3.0 document.
+type Document struct {
+	OpenAPI    string                           `json:"openapi"`
+	Info       Info                             `json:"info"`
+	Paths      map[string]map[string]*Operation `json:"paths"`
+	Components Components                       `json:"components"`
+}
+
+// Info describes the API.
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+// Components holds the schemas operations refer to.
+type Components struct {
+	Schemas map[string]*Schema `json:"schemas"`
+}
+
+// Operation is a single method on a path.
+type Operation struct {
+	Summary     string              `json:"summary,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	Parameters  []Parameter         `json:"parameters,omitempty"`
+	RequestBody *RequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]Response `json:"responses"`
+}
+
+// Parameter is a path or query parameter.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+// RequestBody is the body an operation accepts.
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+// Response is one of the responses of an operation.
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// MediaType is the schema of a body in one content type.
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Schema is the subset of the OpenAPI schema object the generator produces.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+}
+
+// Param documents a query parameter. Path parameters are documented from the route itself.
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+	// Enum, when set, lists the accepted values.
+	Enum []string
+}
+
+// Route documents one operation. Body and Response are values of the types the handler decodes and
+// encodes; nil means there is none.
+type Route struct {
+	Summary  string
+	Query    []Param
+	Body     interface{}
+	Response interface{}
+	// ContentType is the type of the response, application/json unless set.
+	ContentType string
+}
+
+// Spec collects route documentation until the document is built.
+type Spec struct {
+	info    Info
+	routes  map[string]Route
+	errType interface{}
+
+	once     sync.Once
+	document *Document
+}
+
+// New returns an empty spec. errorBody is a value of the type every failed request responds with.
+func New(title, version string, errorBody interface{}) *Spec {
+	return &Spec{info: Info{Title: title, Version: version}, routes: make(map[string]Route), errType: errorBody}
+}
+
+// Describe documents the operation of method on path, using Echo's path syntax.
+func (s *Spec) Describe(method, path string, route Route) {
+	s.routes[method+" "+path] = route
+}
+
+// Route returns the documentation of the operation of method on path.
+func (s *Spec) Route(method, path string) Route {
+	return s.routes[method+" "+path]
+}
+
+// Undocumented returns the registered routes that have not been described, as "METHOD path".
+func (s *Spec) Undocumented(routes []*echo.Route) []string {
+	var missing []string
+	for _, route := range apiRoutes(routes) {
+		key := route.Method + " " + route.Path
+		if _, ok := s.routes[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+	sort.Strings(missing)
+	return missing
+}
+
+// Document builds the document for routes. Every route appears, described or not.
+func (s *Spec) Document(routes []*echo.Route) *Document {
+	builder := schemaBuilder{schemas: make(map[string]*Schema), names: make(map[reflect.Type]string)}
+	errorSchema := builder.schemaFor(reflect.TypeOf(s.errType))
+
+	doc := &Document{
+		OpenAPI:    "3.0.3",
+		Info:       s.info,
+		Paths:      make(map[string]map[string]*Operation),
+		Components: Components{Schemas: builder.schemas},
+	}
+	for _, r := range apiRoutes(routes) {
+		route := s.routes[r.Method+" "+r.Path]
+		path, params := openAPIPath(r.Path)
+
+		op := &Operation{
+			Summary:    route.Summary,
+			Tags:       []string{tag(r.Path)},
+			Parameters: params,
+			Responses: map[string]Response{
+				"default": {Description: "Error", Content: map[string]MediaType{"application/json": {Schema: errorSchema}}},
+			},
+		}
+		for _, q := range route.Query {
+			schema := &Schema{Type: "string", Enum: q.Enum}
+			op.Parameters = append(op.Parameters, Parameter{Name: q.Name, In: "query", Description: q.Description, Required: q.Required, Schema: schema})
+		}
+		if route.Body != nil {
+			op.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{
+				"application/json": {Schema: builder.schemaFor(reflect.TypeOf(route.Body))},
+			}}
+		}
+		ok := Response{Description: "OK"}
+		if route.Response != nil {
+			contentType := route.ContentType
+			if contentType == "" {
+				contentType = "application/json"
+			}
+			ok.Content = map[string]MediaType{contentType: {Schema: builder.schemaFor(reflect.TypeOf(route.Response))}}
+		}
+		op.Responses["200"] = ok
+
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = make(map[string]*Operation)
+		}
+		doc.Paths[path][strings.ToLower(r.Method)] = op
+	}
+	return doc
+}
+
+// Handler serves the document of e's routes, built on the first request once every route is registered.
+func (s *Spec) Handler(e *echo.Echo) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s.once.Do(func() { s.document = s.Document(e.Routes()) })
+		return c.JSON(http.StatusOK, s.document)
+	}
+}
+
+// methods are the HTTP methods documented; Echo also registers internal pseudo-methods.
+var methods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// apiRoutes returns the documentable routes, sorted and without duplicates.
+func apiRoutes(routes []*echo.Route) []*echo.Route {
+	seen := make(map[string]bool)
+	var filtered []*echo.Route
+	for _, route := range routes {
+		key := route.Method + " " + route.Path
+		if !methods[route.Method] || seen[key] {
+			continue
+		}
+		seen[key] = true
+		filtered = append(filtered, route)
+	}
+	sort.Slice(filtered, func(i, j int) bool {
+		if filtered[i].Path != filtered[j].Path {
+			return filtered[i].Path < filtered[j].Path
+		}
+		return filtered[i].Method < filtered[j].Method
+	})
+	return filtered
+}
+
+// openAPIPath converts an Echo path such as /api/templates/:id to /api/templates/{id}, returning its
+// parameters.
+func openAPIPath(path string) (string, []Parameter) {
+	var params []Parameter
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		name := ""
+		switch {
+		case strings.HasPrefix(segment, ":"):
+			name = segment[1:]
+		case segment == "*":
+			name = "path"
+		default:
+			continue
+		}
+		segments[i] = "{" + name + "}"
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: &Schema{Type: "string"}})
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// tag groups an operation by the first segment of its path after /api and any API version.
+func tag(path string) string {
+	trimmed := strings.TrimPrefix(path, "/api")
+	if trimmed == path {
+		return "server"
+	}
+	segment, rest, _ := strings.Cut(strings.TrimPrefix(trimmed, "/"), "/")
+	if versionSegment.MatchString(segment) && rest != "" {
+		segment, _, _ = strings.Cut(rest, "/")
+	}
+	return segment
+}
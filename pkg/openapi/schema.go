@@ -0,0 +1,158 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// versionSegment matches the version element of a Kubernetes API package path, such as v1.
+var versionSegment = regexp.MustCompile(`^v\d+((alpha|beta)\d+)?$`)
+
+// invalidComponentChars are the characters OpenAPI doesn't allow in component names.
+var invalidComponentChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// known are types whose JSON form differs from their Go structure.
+var known = map[reflect.Type]*Schema{
+	reflect.TypeOf(time.Time{}):        {Type: "string", Format: "date-time"},
+	reflect.TypeOf(metav1.Time{}):      {Type: "string", Format: "date-time"},
+	reflect.TypeOf(metav1.MicroTime{}): {Type: "string", Format: "date-time"},
+	reflect.TypeOf(metav1.Duration{}):  {Type: "string"},
+	reflect.TypeOf(time.Duration(0)):   {Type: "integer", Format: "int64"},
+	reflect.TypeOf(json.RawMessage{}):  {},
+}
+
+var (
+	jsonMarshaler = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshaler = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// schemaBuilder derives schemas from Go types, registering named structs as components.
+type schemaBuilder struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+}
+
+// schemaFor returns the schema of t, a reference for named structs.
+func (b *schemaBuilder) schemaFor(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if schema, ok := known[t]; ok {
+		copied := *schema
+		return &copied
+	}
+	if t.Implements(jsonMarshaler) || reflect.PointerTo(t).Implements(jsonMarshaler) {
+		// custom JSON, such as managed fields, is documented as free-form
+		return &Schema{}
+	}
+	if t.Implements(textMarshaler) || reflect.PointerTo(t).Implements(textMarshaler) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: b.schemaFor(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name, ok := b.names[t]
+		if !ok {
+			name = componentName(t)
+			b.names[t] = name
+			// registered before the fields so that recursive types terminate
+			b.schemas[name] = &Schema{}
+			*b.schemas[name] = *b.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + name}
+	}
+	return &Schema{}
+}
+
+// structSchema describes the JSON object of a struct, inlining embedded structs as encoding/json does.
+func (b *schemaBuilder) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	b.addFields(schema, t)
+	return schema
+}
+
+func (b *schemaBuilder) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			b.addFields(schema, fieldType)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = b.schemaFor(field.Type)
+	}
+}
+
+// componentName names a type by its package and type name. Kubernetes API packages are named by group and
+// version, such as rbac.v1.Role, as their package names alone collide. Instances of generic types are
+// named after their type arguments, such as listing.List_rbac.v1.Role.
+func componentName(t reflect.Type) string {
+	name := t.Name()
+	if base, args, ok := strings.Cut(name, "["); ok {
+		var short []string
+		for _, arg := range strings.Split(strings.TrimSuffix(args, "]"), ",") {
+			short = append(short, shortTypeName(arg))
+		}
+		name = base + "_" + strings.Join(short, "_")
+	}
+	return packageName(t.PkgPath()) + "." + name
+}
+
+// packageName shortens an import path to its last element, or its last two for Kubernetes API versions.
+func packageName(path string) string {
+	elements := strings.Split(path, "/")
+	pkg := elements[len(elements)-1]
+	if len(elements) > 1 && versionSegment.MatchString(pkg) {
+		pkg = elements[len(elements)-2] + "." + pkg
+	}
+	return pkg
+}
+
+// shortTypeName shortens a type argument such as k8s.io/api/rbac/v1.Role to rbac.v1.Role.
+func shortTypeName(arg string) string {
+	if dot := strings.LastIndex(arg, "."); dot >= 0 {
+		arg = packageName(arg[:dot]) + "." + arg[dot+1:]
+	}
+	return invalidComponentChars.ReplaceAllString(arg, "_")
+}
@@ -0,0 +1,166 @@
+package permissions
+
+import (
+	"context"
+	"fmt"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Grant is the binding, and the role it references, through which a subject is allowed an action.
+type Grant struct {
+	BindingKind      string `json:"bindingKind"`
+	BindingNamespace string `json:"bindingNamespace,omitempty"`
+	BindingName      string `json:"bindingName"`
+	RoleKind         string `json:"roleKind"`
+	RoleName         string `json:"roleName"`
+	// ResourceNames, when set, are the only objects this grant allows.
+	ResourceNames []string `json:"resourceNames,omitempty"`
+}
+
+// SubjectGrant is a grant to a single subject of a binding.
+type SubjectGrant struct {
+	Subject rbacv1.Subject
+	Grant   Grant
+}
+
+// Snapshot holds the roles and bindings questions about access are answered from.
+type Snapshot struct {
+	RoleBindings        []rbacv1.RoleBinding
+	ClusterRoleBindings []rbacv1.ClusterRoleBinding
+
+	roles        map[string][]rbacv1.PolicyRule
+	clusterRoles map[string][]rbacv1.PolicyRule
+}
+
+// Load reads the roles and bindings relevant to namespace, or to every namespace when it is "".
+func Load(ctx context.Context, clientset kubernetes.Interface, namespace string) (*Snapshot, error) {
+	rbac := clientset.RbacV1()
+
+	roles, err := rbac.Roles(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing roles: %w", err)
+	}
+	clusterRoles, err := rbac.ClusterRoles().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing cluster roles: %w", err)
+	}
+	roleBindings, err := rbac.RoleBindings(namespace).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing role bindings: %w", err)
+	}
+	clusterRoleBindings, err := rbac.ClusterRoleBindings().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("listing cluster role bindings: %w", err)
+	}
+
+	return NewSnapshot(roles.Items, clusterRoles.Items, roleBindings.Items, clusterRoleBindings.Items), nil
+}
+
+// NewSnapshot builds a snapshot from already listed objects.
+func NewSnapshot(roles []rbacv1.Role, clusterRoles []rbacv1.ClusterRole, roleBindings []rbacv1.RoleBinding, clusterRoleBindings []rbacv1.ClusterRoleBinding) *Snapshot {
+	s := &Snapshot{
+		RoleBindings:        roleBindings,
+		ClusterRoleBindings: clusterRoleBindings,
+		roles:               make(map[string][]rbacv1.PolicyRule, len(roles)),
+		clusterRoles:        make(map[string][]rbacv1.PolicyRule, len(clusterRoles)),
+	}
+	for _, role := range roles {
+		s.roles[role.Namespace+"/"+role.Name] = role.Rules
+	}
+	for _, clusterRole := range clusterRoles {
+		s.clusterRoles[clusterRole.Name] = aggregatedRules(clusterRole, clusterRoles)
+	}
+	return s
+}
+
+// aggregatedRules returns the rules of clusterRole. An aggregated ClusterRole also gets the rules of every
+// ClusterRole its selectors match, which the controller may not have copied into it yet.
+func aggregatedRules(clusterRole rbacv1.ClusterRole, clusterRoles []rbacv1.ClusterRole) []rbacv1.PolicyRule {
+	if clusterRole.AggregationRule == nil {
+		return clusterRole.Rules
+	}
+	rules := append([]rbacv1.PolicyRule{}, clusterRole.Rules...)
+	for _, selector := range clusterRole.AggregationRule.ClusterRoleSelectors {
+		matches, err := metav1.LabelSelectorAsSelector(&selector)
+		if err != nil {
+			continue
+		}
+		for _, other := range clusterRoles {
+			if other.Name == clusterRole.Name || !matches.Matches(labels.Set(other.Labels)) {
+				continue
+			}
+			for _, rule := range other.Rules {
+				if !containsRule(rules, rule) {
+					rules = append(rules, rule)
+				}
+			}
+		}
+	}
+	return rules
+}
+
+// containsRule reports whether rules has one equal to rule.
+func containsRule(rules []rbacv1.PolicyRule, rule rbacv1.PolicyRule) bool {
+	for _, r := range rules {
+		if equality.Semantic.DeepEqual(r, rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules returns the rules of the role a binding in namespace references. A missing role grants nothing.
+func (s *Snapshot) Rules(namespace string, ref rbacv1.RoleRef) []rbacv1.PolicyRule {
+	if ref.Kind == "ClusterRole" {
+		return s.clusterRoles[ref.Name]
+	}
+	return s.roles[namespace+"/"+ref.Name]
+}
+
+// Grants returns every subject allowed req in namespace, with the grant that allows it. Cluster role
+// bindings apply everywhere; role bindings only in their own namespace, so with namespace "" only cluster-wide
+// access is reported.
+func (s *Snapshot) Grants(req Request, namespace string) []SubjectGrant {
+	var grants []SubjectGrant
+	add := func(subjects []rbacv1.Subject, grant Grant, match Match) {
+		if !match.Allowed {
+			return
+		}
+		grant.ResourceNames = match.ResourceNames
+		for _, subject := range subjects {
+			grants = append(grants, SubjectGrant{Subject: subject, Grant: grant})
+		}
+	}
+
+	for _, crb := range s.ClusterRoleBindings {
+		match := MatchBinding(s.Rules("", crb.RoleRef), req, "")
+		add(crb.Subjects, Grant{
+			BindingKind: "ClusterRoleBinding",
+			BindingName: crb.Name,
+			RoleKind:    crb.RoleRef.Kind,
+			RoleName:    crb.RoleRef.Name,
+		}, match)
+	}
+	if namespace == "" {
+		return grants
+	}
+	for _, rb := range s.RoleBindings {
+		if rb.Namespace != namespace {
+			continue
+		}
+		match := MatchBinding(s.Rules(rb.Namespace, rb.RoleRef), req, rb.Namespace)
+		add(rb.Subjects, Grant{
+			BindingKind:      "RoleBinding",
+			BindingNamespace: rb.Namespace,
+			BindingName:      rb.Name,
+			RoleKind:         rb.RoleRef.Kind,
+			RoleName:         rb.RoleRef.Name,
+		}, match)
+	}
+	return grants
+}
@@ -0,0 +1,75 @@
+package permissions
+
+import (
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestGrants(t *testing.T) {
+	roleRef := func(kind, name string) rbacv1.RoleRef {
+		return rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: kind, Name: name}
+	}
+	snapshot := NewSnapshot(
+		[]rbacv1.Role{{
+			ObjectMeta: metav1.ObjectMeta{Name: "secret-reader", Namespace: "prod"},
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"tls"}, Verbs: []string{"get", "create"}}},
+		}},
+		[]rbacv1.ClusterRole{
+			{
+				ObjectMeta:      metav1.ObjectMeta{Name: "monitoring"},
+				AggregationRule: &rbacv1.AggregationRule{ClusterRoleSelectors: []metav1.LabelSelector{{MatchLabels: map[string]string{"aggregate-to-monitoring": "true"}}}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "metrics-reader", Labels: map[string]string{"aggregate-to-monitoring": "true"}},
+				Rules:      []rbacv1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}},
+			},
+		},
+		[]rbacv1.RoleBinding{
+			{ObjectMeta: metav1.ObjectMeta{Name: "tls", Namespace: "prod"}, RoleRef: roleRef("Role", "secret-reader"), Subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "ingress"}}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "metrics", Namespace: "prod"}, RoleRef: roleRef("ClusterRole", "monitoring"), Subjects: []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "missing", Namespace: "prod"}, RoleRef: roleRef("Role", "gone"), Subjects: []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "mallory"}}},
+		},
+		[]rbacv1.ClusterRoleBinding{
+			{ObjectMeta: metav1.ObjectMeta{Name: "prometheus"}, RoleRef: roleRef("ClusterRole", "monitoring"), Subjects: []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Namespace: "monitoring", Name: "prometheus"}}},
+		},
+	)
+
+	subjects := func(req Request, namespace string) map[string]Grant {
+		found := make(map[string]Grant)
+		for _, sg := range snapshot.Grants(req, namespace) {
+			found[sg.Subject.Kind+"/"+sg.Subject.Name] = sg.Grant
+		}
+		return found
+	}
+
+	t.Run("non-resource URLs only through cluster role bindings", func(t *testing.T) {
+		found := subjects(Request{Verb: "get", NonResourceURL: "/metrics"}, "prod")
+		if len(found) != 1 {
+			t.Fatalf("grants = %v, want only the prometheus service account", found)
+		}
+		if grant := found["ServiceAccount/prometheus"]; grant.BindingKind != "ClusterRoleBinding" || grant.RoleName != "monitoring" {
+			t.Errorf("grant = %+v, want ClusterRoleBinding prometheus to the aggregated monitoring role", grant)
+		}
+	})
+
+	t.Run("resource names", func(t *testing.T) {
+		found := subjects(Request{Verb: "get", Resource: "secrets"}, "prod")
+		if grant, ok := found["ServiceAccount/ingress"]; !ok || len(grant.ResourceNames) != 1 || grant.ResourceNames[0] != "tls" {
+			t.Errorf("grants = %v, want ingress restricted to tls", found)
+		}
+		if found := subjects(Request{Verb: "create", Resource: "secrets"}, "prod"); len(found) != 0 {
+			t.Errorf("create granted to %v through a rule with resourceNames", found)
+		}
+	})
+
+	t.Run("role bindings only in their namespace", func(t *testing.T) {
+		if found := subjects(Request{Verb: "get", Resource: "secrets"}, "staging"); len(found) != 0 {
+			t.Errorf("staging grants = %v, want none", found)
+		}
+		if found := subjects(Request{Verb: "get", Resource: "secrets"}, ""); len(found) != 0 {
+			t.Errorf("cluster-wide grants = %v, want none", found)
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package permissions
+
+import (
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+const (
+	// serviceAccountPrefix starts the user names of service accounts, system:serviceaccount:<namespace>:<name>.
+	serviceAccountPrefix = "system:serviceaccount:"
+	// anonymousUser is the user name of unauthenticated requests.
+	anonymousUser = "system:anonymous"
+)
+
+// Groups returns groups together with those the API server adds to requests by user: system:authenticated, or
+// system:unauthenticated for the anonymous user, and for a service account system:serviceaccounts and the
+// group of its namespace. Kubernetes doesn't store group membership, so the rest must be supplied.
+func Groups(user string, groups []string) []string {
+	all := append([]string{}, groups...)
+	add := func(group string) {
+		if !contains(all, group) {
+			all = append(all, group)
+		}
+	}
+
+	if user == anonymousUser {
+		add("system:unauthenticated")
+		return all
+	}
+	add("system:authenticated")
+	if namespace, _, ok := serviceAccount(user); ok {
+		add("system:serviceaccounts")
+		add("system:serviceaccounts:" + namespace)
+	}
+	return all
+}
+
+// AppliesTo reports whether subject, of a binding in bindingNamespace or of a ClusterRoleBinding when it is
+// "", names user or one of groups, as the RBAC authorizer decides.
+func AppliesTo(subject rbacv1.Subject, bindingNamespace, user string, groups []string) bool {
+	switch subject.Kind {
+	case rbacv1.UserKind:
+		return subject.Name == user
+	case rbacv1.GroupKind:
+		return contains(groups, subject.Name)
+	case rbacv1.ServiceAccountKind:
+		// a service account subject of a role binding defaults to the binding's namespace
+		namespace := subject.Namespace
+		if namespace == "" {
+			namespace = bindingNamespace
+		}
+		saNamespace, saName, ok := serviceAccount(user)
+		return ok && namespace != "" && saNamespace == namespace && saName == subject.Name
+	}
+	return false
+}
+
+// serviceAccount splits the user name of a service account into its namespace and name.
+func serviceAccount(user string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(user, serviceAccountPrefix)
+	if !ok {
+		return "", "", false
+	}
+	namespace, name, ok := strings.Cut(rest, ":")
+	if !ok || namespace == "" || name == "" || strings.Contains(name, ":") {
+		return "", "", false
+	}
+	return namespace, name, true
+}
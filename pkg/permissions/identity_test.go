@@ -0,0 +1,56 @@
+package permissions
+
+import (
+	"slices"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestAppliesTo(t *testing.T) {
+	const ci = "system:serviceaccount:prod:ci"
+	tests := []struct {
+		name             string
+		subject          rbacv1.Subject
+		bindingNamespace string
+		user             string
+		applies          bool
+	}{
+		{"user", rbacv1.Subject{Kind: rbacv1.UserKind, Name: "alice"}, "prod", "alice", true},
+		{"other user", rbacv1.Subject{Kind: rbacv1.UserKind, Name: "alice"}, "prod", "bob", false},
+		{"group", rbacv1.Subject{Kind: rbacv1.GroupKind, Name: "system:serviceaccounts:prod"}, "", ci, true},
+		{"service account", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "prod", Name: "ci"}, "", ci, true},
+		{"service account defaults to the binding's namespace", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: "ci"}, "prod", ci, true},
+		{"service account in another namespace", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: "ci"}, "staging", ci, false},
+		{"service account without a namespace in a cluster role binding", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Name: "ci"}, "", ci, false},
+		{"service account explicit namespace wins", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "staging", Name: "ci"}, "prod", ci, false},
+		{"service account subject isn't a user", rbacv1.Subject{Kind: rbacv1.ServiceAccountKind, Namespace: "prod", Name: "ci"}, "", "ci", false},
+		{"service account named as a user", rbacv1.Subject{Kind: rbacv1.UserKind, Name: ci}, "", ci, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if applies := AppliesTo(tt.subject, tt.bindingNamespace, tt.user, Groups(tt.user, nil)); applies != tt.applies {
+				t.Errorf("AppliesTo = %v, want %v", applies, tt.applies)
+			}
+		})
+	}
+}
+
+func TestGroups(t *testing.T) {
+	tests := []struct {
+		user   string
+		groups []string
+		want   []string
+	}{
+		{"alice", []string{"devs"}, []string{"devs", "system:authenticated"}},
+		{"system:anonymous", nil, []string{"system:unauthenticated"}},
+		{"system:serviceaccount:prod:ci", nil, []string{"system:authenticated", "system:serviceaccounts", "system:serviceaccounts:prod"}},
+		{"system:serviceaccount:prod", nil, []string{"system:authenticated"}},
+		{"alice", []string{"system:authenticated"}, []string{"system:authenticated"}},
+	}
+	for _, tt := range tests {
+		if got := Groups(tt.user, tt.groups); !slices.Equal(got, tt.want) {
+			t.Errorf("Groups(%q, %v) = %v, want %v", tt.user, tt.groups, got, tt.want)
+		}
+	}
+}
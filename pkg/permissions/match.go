@@ -0,0 +1,150 @@
+package permissions
+
+import (
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// Request is an action to check rules against, in the terms the RBAC authorizer uses.
+type Request struct {
+	Verb     string
+	APIGroup string
+	// Resource is the resource, optionally with a subresource such as pods/log.
+	Resource string
+	// ResourceName is the object acted on. It is empty for a question about the resource as a whole.
+	ResourceName string
+	// NonResourceURL, such as /metrics, asks about an API server path instead of a resource. The other
+	// fields except Verb are then ignored.
+	NonResourceURL string
+}
+
+// Match is the outcome of checking rules against a request.
+type Match struct {
+	Allowed bool `json:"allowed"`
+	// ResourceNames, when set, are the only objects the matching rules allow. Such a grant is restricted: it
+	// is not blanket access to the resource.
+	ResourceNames []string `json:"resourceNames,omitempty"`
+}
+
+// Restricted reports whether the access is limited to ResourceNames.
+func (m Match) Restricted() bool {
+	return m.Allowed && len(m.ResourceNames) > 0
+}
+
+// MatchRules combines the matches of rules. Unrestricted access from any rule wins; otherwise the names of
+// the restricted rules are merged.
+func MatchRules(rules []rbacv1.PolicyRule, req Request) Match {
+	var combined Match
+	names := make(map[string]bool)
+	for _, rule := range rules {
+		m := MatchRule(rule, req)
+		if !m.Allowed {
+			continue
+		}
+		if !m.Restricted() {
+			return m
+		}
+		combined.Allowed = true
+		for _, name := range m.ResourceNames {
+			names[name] = true
+		}
+	}
+	for name := range names {
+		combined.ResourceNames = append(combined.ResourceNames, name)
+	}
+	sort.Strings(combined.ResourceNames)
+	return combined
+}
+
+// MatchBinding is MatchRules for the rules a binding grants. bindingNamespace is the namespace of a
+// RoleBinding, or "" for a ClusterRoleBinding. Non-resource URLs are not namespaced, so rules reach them
+// only through ClusterRoleBindings.
+func MatchBinding(rules []rbacv1.PolicyRule, req Request, bindingNamespace string) Match {
+	if req.NonResourceURL != "" && bindingNamespace != "" {
+		return Match{}
+	}
+	return MatchRules(rules, req)
+}
+
+// MatchRule checks a single rule against req, following the RBAC authorizer.
+//
+// A rule with resourceNames only ever allows requests naming one of them. Create and deletecollection
+// requests carry no name when they are authorized, so such a rule never allows them. List and watch carry
+// a name only when the client selects metadata.name with a field selector, so without a ResourceName a
+// restricted rule is reported as allowing them for its names alone, never for the whole collection.
+func MatchRule(rule rbacv1.PolicyRule, req Request) Match {
+	if req.NonResourceURL != "" {
+		return Match{Allowed: matchesVerb(rule.Verbs, req.Verb) && matchesNonResourceURL(rule.NonResourceURLs, req.NonResourceURL)}
+	}
+	if !matchesVerb(rule.Verbs, req.Verb) || !matchesAPIGroup(rule.APIGroups, req.APIGroup) || !matchesResource(rule.Resources, req.Resource) {
+		return Match{}
+	}
+	if len(rule.ResourceNames) == 0 {
+		return Match{Allowed: true}
+	}
+
+	switch req.Verb {
+	case "create", "deletecollection":
+		return Match{}
+	}
+	if req.ResourceName != "" {
+		if contains(rule.ResourceNames, req.ResourceName) {
+			return Match{Allowed: true, ResourceNames: []string{req.ResourceName}}
+		}
+		return Match{}
+	}
+	names := append([]string(nil), rule.ResourceNames...)
+	sort.Strings(names)
+	return Match{Allowed: true, ResourceNames: names}
+}
+
+// matchesVerb reports whether verbs includes verb or the wildcard.
+func matchesVerb(verbs []string, verb string) bool {
+	return contains(verbs, rbacv1.VerbAll) || contains(verbs, verb)
+}
+
+// matchesAPIGroup reports whether groups includes group or the wildcard.
+func matchesAPIGroup(groups []string, group string) bool {
+	return contains(groups, rbacv1.APIGroupAll) || contains(groups, group)
+}
+
+// matchesResource reports whether resources covers resource. Besides exact names and the wildcard, a
+// subresource is covered by */subresource, as in */scale.
+func matchesResource(resources []string, resource string) bool {
+	_, subresource, hasSubresource := strings.Cut(resource, "/")
+	for _, r := range resources {
+		if r == rbacv1.ResourceAll || r == resource {
+			return true
+		}
+		if hasSubresource && r == "*/"+subresource {
+			return true
+		}
+	}
+	return false
+}
+
+// matchesNonResourceURL reports whether urls covers url, either exactly or through a trailing wildcard
+// such as /api/*. A * anywhere else is matched literally.
+func matchesNonResourceURL(urls []string, url string) bool {
+	for _, u := range urls {
+		if u == rbacv1.NonResourceAll || u == url {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(u, "*"); ok && strings.HasPrefix(url, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// contains reports whether values includes value.
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
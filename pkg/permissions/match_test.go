@@ -0,0 +1,80 @@
+package permissions
+
+import (
+	"slices"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestMatchRule(t *testing.T) {
+	pods := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get", "create"}}
+	named := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"b", "a"}, Verbs: []string{"*"}}
+	scale := rbacv1.PolicyRule{APIGroups: []string{"apps"}, Resources: []string{"*/scale"}, Verbs: []string{"update"}}
+	metrics := rbacv1.PolicyRule{NonResourceURLs: []string{"/metrics", "/logs/*"}, Verbs: []string{"get"}}
+
+	tests := []struct {
+		name  string
+		rule  rbacv1.PolicyRule
+		req   Request
+		match Match
+	}{
+		{"exact", pods, Request{Verb: "get", Resource: "pods"}, Match{Allowed: true}},
+		{"other verb", pods, Request{Verb: "delete", Resource: "pods"}, Match{}},
+		{"other group", pods, Request{Verb: "get", APIGroup: "apps", Resource: "pods"}, Match{}},
+		{"subresource not covered by resource", pods, Request{Verb: "get", Resource: "pods/log"}, Match{}},
+		{"wildcard subresource", scale, Request{Verb: "update", APIGroup: "apps", Resource: "deployments/scale"}, Match{Allowed: true}},
+		{"wildcard subresource not the resource", scale, Request{Verb: "update", APIGroup: "apps", Resource: "deployments"}, Match{}},
+
+		{"named get", named, Request{Verb: "get", Resource: "configmaps", ResourceName: "a"}, Match{Allowed: true, ResourceNames: []string{"a"}}},
+		{"unnamed get restricted", named, Request{Verb: "get", Resource: "configmaps"}, Match{Allowed: true, ResourceNames: []string{"a", "b"}}},
+		{"list restricted", named, Request{Verb: "list", Resource: "configmaps"}, Match{Allowed: true, ResourceNames: []string{"a", "b"}}},
+		{"other name", named, Request{Verb: "delete", Resource: "configmaps", ResourceName: "c"}, Match{}},
+		{"names never grant create", named, Request{Verb: "create", Resource: "configmaps"}, Match{}},
+		{"names never grant create by name", named, Request{Verb: "create", Resource: "configmaps", ResourceName: "a"}, Match{}},
+		{"names never grant deletecollection", named, Request{Verb: "deletecollection", Resource: "configmaps"}, Match{}},
+
+		{"non-resource URL", metrics, Request{Verb: "get", NonResourceURL: "/metrics"}, Match{Allowed: true}},
+		{"non-resource prefix", metrics, Request{Verb: "get", NonResourceURL: "/logs/kubelet"}, Match{Allowed: true}},
+		{"non-resource other URL", metrics, Request{Verb: "get", NonResourceURL: "/healthz"}, Match{}},
+		{"non-resource rule doesn't grant resources", metrics, Request{Verb: "get", Resource: "pods"}, Match{}},
+		{"resource rule doesn't grant URLs", pods, Request{Verb: "get", NonResourceURL: "/metrics"}, Match{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := MatchRule(tt.rule, tt.req)
+			if m.Allowed != tt.match.Allowed || !slices.Equal(m.ResourceNames, tt.match.ResourceNames) {
+				t.Errorf("MatchRule = %+v, want %+v", m, tt.match)
+			}
+		})
+	}
+}
+
+func TestMatchRules(t *testing.T) {
+	restricted := func(names ...string) rbacv1.PolicyRule {
+		return rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: names, Verbs: []string{"get"}}
+	}
+	all := rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"secrets"}, Verbs: []string{"get"}}
+	req := Request{Verb: "get", Resource: "secrets"}
+
+	if m := MatchRules([]rbacv1.PolicyRule{restricted("b"), restricted("a", "b")}, req); !m.Restricted() || !slices.Equal(m.ResourceNames, []string{"a", "b"}) {
+		t.Errorf("restricted rules = %+v, want a and b", m)
+	}
+	if m := MatchRules([]rbacv1.PolicyRule{restricted("a"), all}, req); !m.Allowed || m.Restricted() {
+		t.Errorf("restricted and unrestricted rules = %+v, want unrestricted", m)
+	}
+	if m := MatchRules(nil, req); m.Allowed {
+		t.Error("no rules allowed the request")
+	}
+}
+
+func TestMatchBinding(t *testing.T) {
+	rules := []rbacv1.PolicyRule{{NonResourceURLs: []string{"/metrics"}, Verbs: []string{"get"}}}
+	req := Request{Verb: "get", NonResourceURL: "/metrics"}
+	if !MatchBinding(rules, req, "").Allowed {
+		t.Error("ClusterRoleBinding didn't grant the non-resource URL")
+	}
+	if MatchBinding(rules, req, "prod").Allowed {
+		t.Error("RoleBinding granted a non-resource URL")
+	}
+}
@@ -0,0 +1,101 @@
+package protection
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strings"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/auth"
+
+	"github.com/labstack/echo/v4"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// systemPrefix starts the names Kubernetes reserves for its own components.
+	systemPrefix = "system:"
+	// bootstrapLabel and bootstrapValue mark the default RBAC objects the API server reconciles.
+	bootstrapLabel = "kubernetes.io/bootstrapping"
+	bootstrapValue = "rbac-defaults"
+
+	// guardKey is the context key holding the guard serving the request.
+	guardKey = "protection.guard"
+)
+
+// Guard refuses changes to objects the cluster depends on.
+type Guard struct {
+	patterns   []string
+	adminToken string
+}
+
+// New creates a guard protecting system objects and objects whose names match one of patterns, which use
+// path.Match syntax such as "kube-*". Admins presenting adminToken may override it.
+func New(patterns []string, adminToken string) (*Guard, error) {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid protected name pattern %q: %w", pattern, err)
+		}
+	}
+	return &Guard{patterns: patterns, adminToken: adminToken}, nil
+}
+
+// Middleware makes the guard available to Check.
+func (g *Guard) Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Set(guardKey, g)
+			return next(c)
+		}
+	}
+}
+
+// IsSystem reports whether an object is a Kubernetes component's or a default RBAC object, which are always
+// protected.
+func IsSystem(meta metav1.ObjectMeta) bool {
+	return strings.HasPrefix(meta.Name, systemPrefix) || meta.Labels[bootstrapLabel] == bootstrapValue
+}
+
+// reason explains why the object called name is protected, or returns "" if it is not.
+func (g *Guard) reason(name string, existing metav1.ObjectMeta) string {
+	if strings.HasPrefix(name, systemPrefix) {
+		return "names starting with " + systemPrefix + " are reserved for Kubernetes components"
+	}
+	if existing.Labels[bootstrapLabel] == bootstrapValue {
+		return "it is a default RBAC object maintained by the API server"
+	}
+	for _, pattern := range g.patterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return fmt.Sprintf("it matches the protected name pattern %q", pattern)
+		}
+	}
+	return ""
+}
+
+// Check refuses an update or delete of the object called name, whose current state is existing, with
+// 403 Forbidden when it is protected. An admin can pass ?overrideProtection=true to go ahead anyway, which
+// is logged and flagged on the request's audit entry.
+func Check(c echo.Context, name string, existing metav1.ObjectMeta) error {
+	g, ok := c.Get(guardKey).(*Guard)
+	if !ok {
+		return nil
+	}
+	reason := g.reason(name, existing)
+	if reason == "" {
+		return nil
+	}
+
+	if c.QueryParam("overrideProtection") != "true" {
+		return echo.NewHTTPError(http.StatusForbidden, name+" is protected because "+reason+"; an admin can pass overrideProtection=true to change it anyway")
+	}
+	if !auth.ValidBearerToken(c.Request(), g.adminToken) {
+		return echo.NewHTTPError(http.StatusForbidden, "Only an admin can override the protection of "+name)
+	}
+
+	slog.Warn("Protection overridden", "route", c.Path(), "method", c.Request().Method,
+		"namespace", existing.Namespace, "name", name, "reason", reason, "actor", audit.Actor(c), "remoteIP", c.RealIP())
+	audit.MarkProtectionOverridden(c)
+	return nil
+}
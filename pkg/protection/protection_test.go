@@ -0,0 +1,125 @@
+package protection
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rbac/pkg/audit"
+
+	"github.com/labstack/echo/v4"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// memorySink keeps the entries written to it.
+type memorySink struct {
+	entries []audit.Entry
+}
+
+func (s *memorySink) Write(entry audit.Entry) {
+	s.entries = append(s.entries, entry)
+}
+
+func TestCheck(t *testing.T) {
+	guard, err := New([]string{"kube-*", "platform-admin"}, "admin-token")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bootstrapped := metav1.ObjectMeta{Labels: map[string]string{bootstrapLabel: bootstrapValue}}
+
+	tests := []struct {
+		name       string
+		object     string
+		existing   metav1.ObjectMeta
+		query      string
+		token      string
+		wantStatus int
+		wantReason string
+		overridden bool
+	}{
+		{name: "unprotected", object: "deployer", wantStatus: http.StatusNoContent},
+		{name: "system prefix", object: "system:controller:foo", wantStatus: http.StatusForbidden, wantReason: "reserved for Kubernetes components"},
+		{name: "bootstrapping label", object: "view", existing: bootstrapped, wantStatus: http.StatusForbidden, wantReason: "default RBAC object"},
+		{name: "pattern match", object: "kube-proxy", wantStatus: http.StatusForbidden, wantReason: `protected name pattern "kube-*"`},
+		{name: "exact pattern", object: "platform-admin", wantStatus: http.StatusForbidden, wantReason: `protected name pattern "platform-admin"`},
+		{name: "pattern miss", object: "my-kube-role", wantStatus: http.StatusNoContent},
+		{name: "override by an admin", object: "kube-proxy", query: "?overrideProtection=true", token: "admin-token", wantStatus: http.StatusNoContent, overridden: true},
+		{name: "override of a system object", object: "system:node", query: "?overrideProtection=true", token: "admin-token", wantStatus: http.StatusNoContent, overridden: true},
+		{name: "override without a token", object: "kube-proxy", query: "?overrideProtection=true", wantStatus: http.StatusForbidden, wantReason: "Only an admin"},
+		{name: "override with a wrong token", object: "kube-proxy", query: "?overrideProtection=true", token: "guess", wantStatus: http.StatusForbidden, wantReason: "Only an admin"},
+		{name: "token without the override", object: "kube-proxy", token: "admin-token", wantStatus: http.StatusForbidden, wantReason: "overrideProtection=true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sink := &memorySink{}
+			e := echo.New()
+			api := e.Group("/api", audit.New(sink).Middleware(), guard.Middleware())
+			api.PUT("/roles/:name", func(c echo.Context) error {
+				if err := Check(c, tt.object, tt.existing); err != nil {
+					return err
+				}
+				return c.NoContent(http.StatusNoContent)
+			})
+
+			req := httptest.NewRequest(http.MethodPut, "/api/roles/"+tt.object+tt.query, nil)
+			if tt.token != "" {
+				req.Header.Set(echo.HeaderAuthorization, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusForbidden {
+				var body struct{ Message string }
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+					t.Fatal(err)
+				}
+				if !strings.Contains(body.Message, tt.wantReason) {
+					t.Errorf("message = %q, want it to mention %q", body.Message, tt.wantReason)
+				}
+				return
+			}
+			// only changes that went ahead are audited
+			if len(sink.entries) != 1 {
+				t.Fatalf("recorded %d audit entries, want 1", len(sink.entries))
+			}
+			if got := sink.entries[0].ProtectionOverridden; got != tt.overridden {
+				t.Errorf("ProtectionOverridden = %v, want %v", got, tt.overridden)
+			}
+		})
+	}
+}
+
+func TestCheckWithoutGuard(t *testing.T) {
+	c := echo.New().NewContext(httptest.NewRequest(http.MethodDelete, "/", nil), httptest.NewRecorder())
+	if err := Check(c, "system:node", metav1.ObjectMeta{}); err != nil {
+		t.Errorf("Check without a guard = %v, want nil", err)
+	}
+}
+
+func TestNewRejectsInvalidPattern(t *testing.T) {
+	if _, err := New([]string{"kube-["}, ""); err == nil {
+		t.Error("New accepted a malformed pattern")
+	}
+}
+
+func TestIsSystem(t *testing.T) {
+	tests := []struct {
+		meta metav1.ObjectMeta
+		want bool
+	}{
+		{metav1.ObjectMeta{Name: "system:kube-scheduler"}, true},
+		{metav1.ObjectMeta{Name: "view", Labels: map[string]string{bootstrapLabel: bootstrapValue}}, true},
+		{metav1.ObjectMeta{Name: "view", Labels: map[string]string{bootstrapLabel: "other"}}, false},
+		{metav1.ObjectMeta{Name: "kube-proxy"}, false},
+	}
+	for _, tt := range tests {
+		if got := IsSystem(tt.meta); got != tt.want {
+			t.Errorf("IsSystem(%s %v) = %v, want %v", tt.meta.Name, tt.meta.Labels, got, tt.want)
+		}
+	}
+}
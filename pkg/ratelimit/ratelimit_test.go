@@ -0,0 +1,128 @@
+package ratelimit
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestAllowBurst(t *testing.T) {
+	l := New(1, 5)
+	for i := 0; i < 5; i++ {
+		if ok, _ := l.Allow("alice"); !ok {
+			t.Fatalf("request %d of the burst refused", i+1)
+		}
+	}
+	ok, retryAfter := l.Allow("alice")
+	if ok {
+		t.Fatal("request beyond the burst allowed")
+	}
+	if retryAfter <= 0 || retryAfter > time.Second {
+		t.Errorf("retry after %v, want at most the 1s refill", retryAfter)
+	}
+	if ok, _ := l.Allow("bob"); !ok {
+		t.Error("another key shares alice's bucket")
+	}
+}
+
+func TestAllowConcurrent(t *testing.T) {
+	l := New(0.001, 10)
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := l.Allow("alice"); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := allowed.Load(); n != 10 {
+		t.Errorf("%d concurrent requests allowed, want the burst of 10", n)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	for _, rps := range []float64{0, -1} {
+		l := New(rps, 1)
+		if l != nil {
+			t.Errorf("New(%v, 1) = %v, want nil", rps, l)
+		}
+		for i := 0; i < 100; i++ {
+			if ok, _ := l.Allow("alice"); !ok {
+				t.Fatalf("disabled limiter refused request %d", i+1)
+			}
+		}
+	}
+	if l := New(1, 0); l.burst != 1 {
+		t.Errorf("burst = %d, want at least 1", l.burst)
+	}
+}
+
+func TestSweepForgetsIdleBuckets(t *testing.T) {
+	l := New(1, 1)
+	l.Allow("alice")
+	l.buckets["alice"].lastSeen = time.Now().Add(-2 * idleBucketTTL)
+	l.lastSweep = time.Time{}
+
+	l.Allow("bob")
+	if _, ok := l.buckets["alice"]; ok {
+		t.Error("idle bucket kept")
+	}
+	if _, ok := l.buckets["bob"]; !ok {
+		t.Error("active bucket dropped")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		extractor   echo.IPExtractor
+		secondXFF   string
+		wantAllowed bool
+	}{
+		// Without a trusted proxy X-Forwarded-For is ignored, so both requests share the socket address
+		{"untrusted forwarded header", echo.ExtractIPDirect(), "203.0.113.2", false},
+		{"trusted forwarded header", echo.ExtractIPFromXFFHeader(echo.TrustLoopback(true)), "203.0.113.2", true},
+		{"same forwarded client", echo.ExtractIPFromXFFHeader(echo.TrustLoopback(true)), "203.0.113.1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := echo.New()
+			e.IPExtractor = tt.extractor
+			e.GET("/api/reports", func(c echo.Context) error { return c.NoContent(http.StatusOK) }, Middleware(New(0.001, 1)))
+			get := func(xff string) *httptest.ResponseRecorder {
+				req := httptest.NewRequest(http.MethodGet, "/api/reports", nil)
+				req.RemoteAddr = "127.0.0.1:1234"
+				req.Header.Set(echo.HeaderXForwardedFor, xff)
+				rec := httptest.NewRecorder()
+				e.ServeHTTP(rec, req)
+				return rec
+			}
+
+			if rec := get("203.0.113.1"); rec.Code != http.StatusOK {
+				t.Fatalf("first request = %d, want %d", rec.Code, http.StatusOK)
+			}
+			rec := get(tt.secondXFF)
+			if tt.wantAllowed {
+				if rec.Code != http.StatusOK {
+					t.Errorf("second client = %d, want %d", rec.Code, http.StatusOK)
+				}
+				return
+			}
+			if rec.Code != http.StatusTooManyRequests {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+			}
+			if got := rec.Header().Get("Retry-After"); got != "1000" {
+				t.Errorf("Retry-After = %q, want 1000", got)
+			}
+		})
+	}
+}
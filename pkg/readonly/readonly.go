@@ -0,0 +1,85 @@
+package readonly
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// State describes whether read-only mode is on and who turned it on.
+type State struct {
+	Enabled bool       `json:"enabled"`
+	By      string     `json:"by,omitempty"`
+	Reason  string     `json:"reason,omitempty"`
+	Since   *time.Time `json:"since,omitempty"`
+}
+
+// Mode holds the read-only switch. It lives in memory, so a restart reverts to the configured default.
+type Mode struct {
+	mu    sync.RWMutex
+	state State
+}
+
+// New creates the switch, enabled from startup when enabled is set.
+func New(enabled bool) *Mode {
+	m := &Mode{}
+	if enabled {
+		m.Set(true, "configuration", "READ_ONLY is set")
+	}
+	return m
+}
+
+// State returns the current state.
+func (m *Mode) State() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// Set switches read-only mode on or off and returns the previous state.
+func (m *Mode) Set(enabled bool, by, reason string) State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	previous := m.state
+	if enabled {
+		now := time.Now().UTC()
+		m.state = State{Enabled: true, By: by, Reason: reason, Since: &now}
+	} else {
+		m.state = State{}
+	}
+	return previous
+}
+
+// Middleware rejects mutating requests with 423 Locked while read-only mode is on. Reads always pass,
+// as do the routes in exempt, which is how the switch itself stays reachable.
+func (m *Mode) Middleware(exempt ...string) echo.MiddlewareFunc {
+	exemptRoutes := make(map[string]bool, len(exempt))
+	for _, route := range exempt {
+		exemptRoutes[route] = true
+	}
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			switch c.Request().Method {
+			case http.MethodGet, http.MethodHead, http.MethodOptions:
+				return next(c)
+			}
+			if exemptRoutes[c.Path()] {
+				return next(c)
+			}
+
+			state := m.State()
+			if !state.Enabled {
+				return next(c)
+			}
+			message := "Read-only mode was enabled by " + state.By + " at " + state.Since.Format(time.RFC3339)
+			if state.Reason != "" {
+				message += ": " + state.Reason
+			}
+			return echo.NewHTTPError(http.StatusLocked, message)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// clientIPExtractor decides how c.RealIP() finds the client address. X-Forwarded-For is only honoured
+// when the request arrives from one of the trusted proxy ranges; otherwise the peer address is used,
+// so clients can't pick their own rate limit or connection limit key.
+func clientIPExtractor(trustedProxies []string) echo.IPExtractor {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range trustedProxies {
+		// Validate has already rejected anything that doesn't parse
+		if ipNet, err := parseProxyRange(proxy); err == nil {
+			options = append(options, echo.TrustIPRange(ipNet))
+		}
+	}
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// parseProxyRange parses a CIDR, or a single address treated as a one-address range.
+func parseProxyRange(proxy string) (*net.IPNet, error) {
+	if !strings.Contains(proxy, "/") {
+		ip := net.ParseIP(proxy)
+		if ip == nil {
+			return nil, fmt.Errorf("trusted proxy %q is not an IP address or CIDR", proxy)
+		}
+		bits := 8 * net.IPv6len
+		if ip.To4() != nil {
+			ip, bits = ip.To4(), 8*net.IPv4len
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(proxy)
+	if err != nil {
+		return nil, fmt.Errorf("trusted proxy %q is not an IP address or CIDR", proxy)
+	}
+	return ipNet, nil
+}
@@ -0,0 +1,545 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/deadline"
+	"rbac/pkg/directory"
+	"rbac/pkg/frontend"
+	"rbac/pkg/gitops"
+	"rbac/pkg/kubernetes"
+	"rbac/pkg/protection"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/yaml"
+)
+
+// redacted replaces secret values when the configuration is printed.
+const redacted = "REDACTED"
+
+// Config holds the configuration for the server. It is loaded from an optional YAML file whose keys
+// are the json field names below, with environment variables taking precedence.
+type Config struct {
+	Port string `json:"port"`
+	// BindAddress is the interface to listen on; empty listens on all interfaces.
+	BindAddress string `json:"bindAddress"`
+	// ReadHeaderTimeout, ReadTimeout, WriteTimeout and IdleTimeout configure the HTTP server.
+	// WriteTimeout also bounds streaming responses, so it defaults to zero (no limit).
+	ReadHeaderTimeout metav1.Duration `json:"readHeaderTimeout"`
+	ReadTimeout       metav1.Duration `json:"readTimeout"`
+	WriteTimeout      metav1.Duration `json:"writeTimeout"`
+	IdleTimeout       metav1.Duration `json:"idleTimeout"`
+	// RequestTimeout, ListRequestTimeout and ReportRequestTimeout are the budgets of API requests: the default,
+	// that of routes listing the whole cluster, and that of reports and exports. A request over its budget is
+	// cancelled and fails with 504; zero leaves the class unbounded.
+	RequestTimeout       metav1.Duration `json:"requestTimeout"`
+	ListRequestTimeout   metav1.Duration `json:"listRequestTimeout"`
+	ReportRequestTimeout metav1.Duration `json:"reportRequestTimeout"`
+	// SlowRequestThreshold logs a warning for API requests taking at least this long; zero disables it.
+	SlowRequestThreshold metav1.Duration `json:"slowRequestThreshold"`
+	// ShutdownTimeout bounds how long shutdown waits for in-flight requests, streams and workers.
+	ShutdownTimeout metav1.Duration `json:"shutdownTimeout"`
+	// LogLevel is the minimum level logged: debug, info, warn or error.
+	LogLevel string `json:"logLevel"`
+	// WSMaxConnsPerClient limits concurrent WebSocket connections per client address.
+	WSMaxConnsPerClient int `json:"wsMaxConnsPerClient"`
+	// AuditStreamBacklog is the number of recent audit entries kept for /api/audit-logs and replayed to new
+	// stream subscribers.
+	AuditStreamBacklog int `json:"auditStreamBacklog"`
+	// AuditForwardAddress is the syslog collector audit entries are forwarded to, e.g. udp://siem:514.
+	AuditForwardAddress string `json:"auditForwardAddress"`
+	// AuditForwardFormat is the forwarded message format, cef or json.
+	AuditForwardFormat string `json:"auditForwardFormat"`
+	// AuditForwardQueue is the number of entries buffered while the collector is slow or down.
+	AuditForwardQueue int `json:"auditForwardQueue"`
+	// MetricsEnabled exposes Prometheus metrics at /metrics.
+	MetricsEnabled bool `json:"metricsEnabled"`
+	// MetricsToken, when set, is required as a bearer token to scrape /metrics.
+	MetricsToken string `json:"metricsToken"`
+	// MetricsRefreshInterval is how often the RBAC state gauges are recomputed.
+	MetricsRefreshInterval metav1.Duration `json:"metricsRefreshInterval"`
+	// AdminToken is the bearer token required by administrative endpoints.
+	AdminToken string `json:"adminToken"`
+	// BindingReaperInterval is how often expired temporary bindings are deleted; zero disables the reaper.
+	BindingReaperInterval metav1.Duration `json:"bindingReaperInterval"`
+	// ReadOnly starts the server with mutations refused; admins can switch it at runtime.
+	ReadOnly bool `json:"readOnly"`
+	// RefuseForeignManaged refuses changes to objects another tool manages, per their managed-by label,
+	// instead of allowing them with a warning.
+	RefuseForeignManaged bool `json:"refuseForeignManaged"`
+	// ProtectedNamePatterns protects objects whose names match, in path.Match syntax such as "kube-*", on top
+	// of the system: objects and RBAC defaults that are always protected.
+	ProtectedNamePatterns []string `json:"protectedNamePatterns"`
+	// DebugPprof mounts the pprof profiling endpoints under /debug/pprof.
+	DebugPprof bool `json:"debugPprof"`
+	// TLSCertFile and TLSKeyFile enable HTTPS; both must be set.
+	TLSCertFile string `json:"tlsCertFile"`
+	TLSKeyFile  string `json:"tlsKeyFile"`
+	// TLSClientCAFile, when set, requires clients to present a certificate signed by this CA, except on the
+	// health probes.
+	TLSClientCAFile string `json:"tlsClientCAFile"`
+	// CORSAllowedOrigins lists origins, exact or wildcard subdomain (https://*.example.com), allowed
+	// to call the API from a browser. Empty keeps the API same-origin only.
+	CORSAllowedOrigins []string `json:"corsAllowedOrigins"`
+	// CORSAllowedMethods and CORSAllowedHeaders are sent in preflight responses.
+	CORSAllowedMethods []string `json:"corsAllowedMethods"`
+	CORSAllowedHeaders []string `json:"corsAllowedHeaders"`
+	// CORSAllowCredentials lets browsers send cookies and authorization headers cross-origin.
+	CORSAllowCredentials bool `json:"corsAllowCredentials"`
+	// CORSMaxAge is how long browsers may cache a preflight response.
+	CORSMaxAge metav1.Duration `json:"corsMaxAge"`
+	// TrustedProxies lists the proxy addresses or CIDRs whose X-Forwarded-For header is believed.
+	TrustedProxies []string `json:"trustedProxies"`
+	// RateLimitRPS and RateLimitBurst limit API requests per client; zero disables the limit.
+	RateLimitRPS   float64 `json:"rateLimitRPS"`
+	RateLimitBurst int     `json:"rateLimitBurst"`
+	// RateLimitExpensiveRPS and RateLimitExpensiveBurst additionally limit endpoints that scan every
+	// binding in the cluster; zero disables the limit.
+	RateLimitExpensiveRPS   float64 `json:"rateLimitExpensiveRPS"`
+	RateLimitExpensiveBurst int     `json:"rateLimitExpensiveBurst"`
+	// DirectoryProvider enables identity provider group suggestions: azure or scim.
+	DirectoryProvider string `json:"directoryProvider"`
+	// DirectoryURL and DirectoryToken configure the scim provider.
+	DirectoryURL   string `json:"directoryURL"`
+	DirectoryToken string `json:"directoryToken"`
+	// DirectoryTenantID, DirectoryClientID and DirectoryClientSecret configure the azure provider.
+	DirectoryTenantID     string `json:"directoryTenantID"`
+	DirectoryClientID     string `json:"directoryClientID"`
+	DirectoryClientSecret string `json:"directoryClientSecret"`
+	// DirectoryCacheTTL is how long directory search results are reused.
+	DirectoryCacheTTL metav1.Duration `json:"directoryCacheTTL"`
+
+	// GitRepoURL, when set, mirrors every RBAC change made through the service into this repository.
+	GitRepoURL string `json:"gitRepoURL"`
+	// GitBranch is the branch committed to, and GitPathPrefix the directory objects are written under.
+	GitBranch     string `json:"gitBranch"`
+	GitPathPrefix string `json:"gitPathPrefix"`
+	// GitToken authenticates HTTPS remotes; GitSSHKeyFile is the private key for SSH remotes.
+	GitToken      string `json:"gitToken"`
+	GitSSHKeyFile string `json:"gitSSHKeyFile"`
+	// GitWorkDir is where the repository is cloned; empty uses a temporary directory.
+	GitWorkDir string `json:"gitWorkDir"`
+	// GitPushRetries is how many times a push rejected by a concurrent push is rebased and retried.
+	GitPushRetries int `json:"gitPushRetries"`
+
+	// StaticDir, when set, serves the built frontend from this directory, falling back to its index.html for
+	// client-side routes. Leave it empty when a separate web server serves the frontend.
+	StaticDir string `json:"staticDir"`
+
+	// KubeQPS and KubeBurst are the client-side rate limits for Kubernetes API calls; zero keeps
+	// client-go's defaults of 5 and 10, which report endpoints listing every binding quickly exhaust.
+	KubeQPS   float32 `json:"kubeQPS"`
+	KubeBurst int     `json:"kubeBurst"`
+	// KubeTimeout bounds each Kubernetes API call. It also ends watches, so it defaults to zero (no limit).
+	KubeTimeout metav1.Duration `json:"kubeTimeout"`
+	// KubeMaxRetries is how many times a Kubernetes API read is retried after a 429, a 5xx or a connection
+	// failure; mutations are never retried. Zero disables retries.
+	KubeMaxRetries int `json:"kubeMaxRetries"`
+	// ListCacheTTL is how long Kubernetes LIST responses are reused, for clusters where watches, and so
+	// informers, are not allowed. Writes made through this service invalidate them at once; zero disables it.
+	ListCacheTTL metav1.Duration `json:"listCacheTTL"`
+	// InformerCache keeps every role and binding in shared informers, which the handlers reading all of them
+	// use once synced instead of listing. It needs permission to watch them; without it, turn this off and
+	// rely on the list cache.
+	InformerCache bool `json:"informerCache"`
+	// ScanConcurrency is how many namespaces a scan falling back to one namespace at a time lists at once.
+	ScanConcurrency int `json:"scanConcurrency"`
+
+	// DiscoveryCacheTTL is how long the API server's discovery information is reused to validate role rules.
+	DiscoveryCacheTTL metav1.Duration `json:"discoveryCacheTTL"`
+
+	// envProblems are the environment variables whose values didn't parse, reported by Validate.
+	envProblems []error
+}
+
+// DefaultConfig returns the configuration used when nothing is overridden.
+func DefaultConfig() *Config {
+	return &Config{
+		Port:                   "8080",
+		ReadHeaderTimeout:      metav1.Duration{Duration: 10 * time.Second},
+		IdleTimeout:            metav1.Duration{Duration: 120 * time.Second},
+		ShutdownTimeout:        metav1.Duration{Duration: 10 * time.Second},
+		RequestTimeout:         metav1.Duration{Duration: 10 * time.Second},
+		ListRequestTimeout:     metav1.Duration{Duration: 30 * time.Second},
+		ReportRequestTimeout:   metav1.Duration{Duration: 120 * time.Second},
+		SlowRequestThreshold:   metav1.Duration{Duration: 5 * time.Second},
+		LogLevel:               "info",
+		WSMaxConnsPerClient:    5,
+		AuditStreamBacklog:     100,
+		AuditForwardFormat:     audit.FormatCEF,
+		AuditForwardQueue:      1000,
+		MetricsRefreshInterval: metav1.Duration{Duration: 30 * time.Second},
+		CORSAllowedMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		CORSAllowedHeaders:     []string{"Authorization", "Content-Type", "X-Request-ID"},
+		CORSMaxAge:             metav1.Duration{Duration: 10 * time.Minute},
+		DirectoryCacheTTL:      metav1.Duration{Duration: time.Minute},
+		BindingReaperInterval:  metav1.Duration{Duration: time.Minute},
+		DiscoveryCacheTTL:      metav1.Duration{Duration: 5 * time.Minute},
+		KubeQPS:                50,
+		KubeBurst:              100,
+		KubeMaxRetries:         3,
+		ListCacheTTL:           metav1.Duration{Duration: 10 * time.Second},
+		InformerCache:          true,
+		ScanConcurrency:        8,
+		GitBranch:              "main",
+		GitPathPrefix:          "rbac",
+		GitPushRetries:         5,
+	}
+}
+
+// LoadConfig reads the YAML file at path, when given, over the defaults, applies environment
+// variable overrides and validates the result.
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := yaml.UnmarshalStrict(data, config); err != nil {
+			return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+		}
+	}
+	config.applyEnv()
+
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// applyEnv overrides fields with any environment variables that are set. Values that don't parse are kept
+// for Validate to report.
+func (c *Config) applyEnv() {
+	c.Port = c.envString("PORT", c.Port)
+	c.BindAddress = c.envString("BIND_ADDRESS", c.BindAddress)
+	c.ReadHeaderTimeout.Duration = c.envDuration("READ_HEADER_TIMEOUT", c.ReadHeaderTimeout.Duration)
+	c.ReadTimeout.Duration = c.envDuration("READ_TIMEOUT", c.ReadTimeout.Duration)
+	c.WriteTimeout.Duration = c.envDuration("WRITE_TIMEOUT", c.WriteTimeout.Duration)
+	c.IdleTimeout.Duration = c.envDuration("IDLE_TIMEOUT", c.IdleTimeout.Duration)
+	c.ShutdownTimeout.Duration = c.envDuration("SHUTDOWN_TIMEOUT", c.ShutdownTimeout.Duration)
+	c.RequestTimeout.Duration = c.envDuration("REQUEST_TIMEOUT", c.RequestTimeout.Duration)
+	c.ListRequestTimeout.Duration = c.envDuration("LIST_REQUEST_TIMEOUT", c.ListRequestTimeout.Duration)
+	c.ReportRequestTimeout.Duration = c.envDuration("REPORT_REQUEST_TIMEOUT", c.ReportRequestTimeout.Duration)
+	c.SlowRequestThreshold.Duration = c.envDuration("SLOW_REQUEST_THRESHOLD", c.SlowRequestThreshold.Duration)
+	c.LogLevel = c.envString("LOG_LEVEL", c.LogLevel)
+	c.WSMaxConnsPerClient = c.envInt("WS_MAX_CONNS_PER_CLIENT", c.WSMaxConnsPerClient)
+	c.AuditStreamBacklog = c.envInt("AUDIT_STREAM_BACKLOG", c.AuditStreamBacklog)
+	c.AuditForwardAddress = c.envString("AUDIT_FORWARD_ADDRESS", c.AuditForwardAddress)
+	c.AuditForwardFormat = c.envString("AUDIT_FORWARD_FORMAT", c.AuditForwardFormat)
+	c.AuditForwardQueue = c.envInt("AUDIT_FORWARD_QUEUE", c.AuditForwardQueue)
+	c.MetricsEnabled = c.envBool("METRICS_ENABLED", c.MetricsEnabled)
+	c.MetricsToken = c.envString("METRICS_TOKEN", c.MetricsToken)
+	c.MetricsRefreshInterval.Duration = c.envDuration("METRICS_REFRESH_INTERVAL", c.MetricsRefreshInterval.Duration)
+	c.AdminToken = c.envString("ADMIN_TOKEN", c.AdminToken)
+	c.DebugPprof = c.envBool("DEBUG_PPROF", c.DebugPprof)
+	c.ReadOnly = c.envBool("READ_ONLY", c.ReadOnly)
+	c.RefuseForeignManaged = c.envBool("REFUSE_FOREIGN_MANAGED", c.RefuseForeignManaged)
+	c.ProtectedNamePatterns = c.envList("PROTECTED_NAME_PATTERNS", c.ProtectedNamePatterns)
+	c.BindingReaperInterval.Duration = c.envDuration("BINDING_REAPER_INTERVAL", c.BindingReaperInterval.Duration)
+	c.TLSCertFile = c.envString("TLS_CERT_FILE", c.TLSCertFile)
+	c.TLSKeyFile = c.envString("TLS_KEY_FILE", c.TLSKeyFile)
+	c.TLSClientCAFile = c.envString("TLS_CLIENT_CA_FILE", c.TLSClientCAFile)
+	c.CORSAllowedOrigins = c.envList("CORS_ALLOWED_ORIGINS", c.CORSAllowedOrigins)
+	c.CORSAllowedMethods = c.envList("CORS_ALLOWED_METHODS", c.CORSAllowedMethods)
+	c.CORSAllowedHeaders = c.envList("CORS_ALLOWED_HEADERS", c.CORSAllowedHeaders)
+	c.CORSAllowCredentials = c.envBool("CORS_ALLOW_CREDENTIALS", c.CORSAllowCredentials)
+	c.CORSMaxAge.Duration = c.envDuration("CORS_MAX_AGE", c.CORSMaxAge.Duration)
+	c.TrustedProxies = c.envList("TRUSTED_PROXIES", c.TrustedProxies)
+	c.RateLimitRPS = c.envFloat("RATE_LIMIT_RPS", c.RateLimitRPS)
+	c.RateLimitBurst = c.envInt("RATE_LIMIT_BURST", c.RateLimitBurst)
+	c.RateLimitExpensiveRPS = c.envFloat("RATE_LIMIT_EXPENSIVE_RPS", c.RateLimitExpensiveRPS)
+	c.RateLimitExpensiveBurst = c.envInt("RATE_LIMIT_EXPENSIVE_BURST", c.RateLimitExpensiveBurst)
+	c.DirectoryProvider = c.envString("DIRECTORY_PROVIDER", c.DirectoryProvider)
+	c.DirectoryURL = c.envString("DIRECTORY_URL", c.DirectoryURL)
+	c.DirectoryToken = c.envString("DIRECTORY_TOKEN", c.DirectoryToken)
+	c.DirectoryTenantID = c.envString("DIRECTORY_TENANT_ID", c.DirectoryTenantID)
+	c.DirectoryClientID = c.envString("DIRECTORY_CLIENT_ID", c.DirectoryClientID)
+	c.DirectoryClientSecret = c.envString("DIRECTORY_CLIENT_SECRET", c.DirectoryClientSecret)
+	c.DirectoryCacheTTL.Duration = c.envDuration("DIRECTORY_CACHE_TTL", c.DirectoryCacheTTL.Duration)
+	c.GitRepoURL = c.envString("GIT_REPO_URL", c.GitRepoURL)
+	c.GitBranch = c.envString("GIT_BRANCH", c.GitBranch)
+	c.GitPathPrefix = c.envString("GIT_PATH_PREFIX", c.GitPathPrefix)
+	c.GitToken = c.envString("GIT_TOKEN", c.GitToken)
+	c.GitSSHKeyFile = c.envString("GIT_SSH_KEY_FILE", c.GitSSHKeyFile)
+	c.GitWorkDir = c.envString("GIT_WORK_DIR", c.GitWorkDir)
+	c.GitPushRetries = c.envInt("GIT_PUSH_RETRIES", c.GitPushRetries)
+	c.StaticDir = c.envString("STATIC_DIR", c.StaticDir)
+
+	c.KubeQPS = float32(c.envFloat("KUBE_QPS", float64(c.KubeQPS)))
+	c.KubeBurst = c.envInt("KUBE_BURST", c.KubeBurst)
+	c.KubeTimeout.Duration = c.envDuration("KUBE_TIMEOUT", c.KubeTimeout.Duration)
+	c.KubeMaxRetries = c.envInt("KUBE_MAX_RETRIES", c.KubeMaxRetries)
+	c.ListCacheTTL.Duration = c.envDuration("LIST_CACHE_TTL", c.ListCacheTTL.Duration)
+	c.InformerCache = c.envBool("INFORMER_CACHE", c.InformerCache)
+	c.ScanConcurrency = c.envInt("SCAN_CONCURRENCY", c.ScanConcurrency)
+
+	c.DiscoveryCacheTTL.Duration = c.envDuration("DISCOVERY_CACHE_TTL", c.DiscoveryCacheTTL.Duration)
+}
+
+// directoryConfig returns the directory lookup settings.
+func (c *Config) directoryConfig() directory.Config {
+	return directory.Config{
+		Provider:     c.DirectoryProvider,
+		URL:          c.DirectoryURL,
+		Token:        c.DirectoryToken,
+		TenantID:     c.DirectoryTenantID,
+		ClientID:     c.DirectoryClientID,
+		ClientSecret: c.DirectoryClientSecret,
+		CacheTTL:     c.DirectoryCacheTTL.Duration,
+	}
+}
+
+// gitConfig returns the settings of the git mirror.
+func (c *Config) gitConfig() gitops.Config {
+	return gitops.Config{
+		RepoURL:     c.GitRepoURL,
+		Branch:      c.GitBranch,
+		PathPrefix:  c.GitPathPrefix,
+		Token:       c.GitToken,
+		SSHKeyFile:  c.GitSSHKeyFile,
+		WorkDir:     c.GitWorkDir,
+		PushRetries: c.GitPushRetries,
+	}
+}
+
+// budgets returns the request budgets of each route class.
+func (c *Config) budgets() deadline.Budgets {
+	return deadline.Budgets{Default: c.RequestTimeout.Duration, List: c.ListRequestTimeout.Duration, Report: c.ReportRequestTimeout.Duration}
+}
+
+// KubernetesOptions returns the settings of the Kubernetes client.
+func (c *Config) KubernetesOptions() kubernetes.Options {
+	return kubernetes.Options{QPS: c.KubeQPS, Burst: c.KubeBurst, Timeout: c.KubeTimeout.Duration, MaxRetries: c.KubeMaxRetries}
+}
+
+// Validate checks the configuration, reporting every problem found rather than only the first.
+func (c *Config) Validate() error {
+	problems := append([]error{}, c.envProblems...)
+
+	if port, err := strconv.Atoi(c.Port); err != nil || port < 1 || port > 65535 {
+		problems = append(problems, fmt.Errorf("port %q must be a number between 1 and 65535", c.Port))
+	}
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"readHeaderTimeout", c.ReadHeaderTimeout.Duration},
+		{"readTimeout", c.ReadTimeout.Duration},
+		{"writeTimeout", c.WriteTimeout.Duration},
+		{"idleTimeout", c.IdleTimeout.Duration},
+		{"requestTimeout", c.RequestTimeout.Duration},
+		{"listRequestTimeout", c.ListRequestTimeout.Duration},
+		{"reportRequestTimeout", c.ReportRequestTimeout.Duration},
+		{"slowRequestThreshold", c.SlowRequestThreshold.Duration},
+	} {
+		if timeout.value < 0 {
+			problems = append(problems, fmt.Errorf("%s must not be negative", timeout.name))
+		}
+	}
+	if c.ShutdownTimeout.Duration <= 0 {
+		problems = append(problems, fmt.Errorf("shutdownTimeout must be positive"))
+	}
+	if _, err := c.parseLogLevel(); err != nil {
+		problems = append(problems, fmt.Errorf("logLevel %q must be debug, info, warn or error", c.LogLevel))
+	}
+	if c.WSMaxConnsPerClient < 0 {
+		problems = append(problems, fmt.Errorf("wsMaxConnsPerClient must not be negative"))
+	}
+	if c.AuditStreamBacklog < 0 {
+		problems = append(problems, fmt.Errorf("auditStreamBacklog must not be negative"))
+	}
+	if c.AuditForwardAddress != "" {
+		if _, err := audit.NewForwarder(c.AuditForwardAddress, c.AuditForwardFormat, c.AuditForwardQueue); err != nil {
+			problems = append(problems, fmt.Errorf("audit forwarder: %w", err))
+		}
+	}
+	if c.GitRepoURL != "" {
+		if _, err := gitops.New(c.gitConfig(), nil); err != nil {
+			problems = append(problems, fmt.Errorf("git mirror: %w", err))
+		}
+	}
+	if c.StaticDir != "" {
+		if _, err := frontend.New(os.DirFS(c.StaticDir)); err != nil {
+			problems = append(problems, fmt.Errorf("staticDir %s: %w", c.StaticDir, err))
+		}
+	}
+	if c.MetricsEnabled && c.MetricsRefreshInterval.Duration <= 0 {
+		problems = append(problems, fmt.Errorf("metricsRefreshInterval must be positive"))
+	}
+	if c.BindingReaperInterval.Duration < 0 {
+		problems = append(problems, fmt.Errorf("bindingReaperInterval must not be negative"))
+	}
+	if c.KubeQPS < 0 || c.KubeBurst < 0 {
+		problems = append(problems, fmt.Errorf("kubeQPS and kubeBurst must not be negative"))
+	}
+	if c.KubeTimeout.Duration < 0 {
+		problems = append(problems, fmt.Errorf("kubeTimeout must not be negative"))
+	}
+	if c.KubeMaxRetries < 0 {
+		problems = append(problems, fmt.Errorf("kubeMaxRetries must not be negative"))
+	}
+	if c.ListCacheTTL.Duration < 0 {
+		problems = append(problems, fmt.Errorf("listCacheTTL must not be negative"))
+	}
+	if c.ScanConcurrency < 1 {
+		problems = append(problems, fmt.Errorf("scanConcurrency must be at least 1"))
+	}
+	if c.DiscoveryCacheTTL.Duration < 0 {
+		problems = append(problems, fmt.Errorf("discoveryCacheTTL must not be negative"))
+	}
+	if c.DebugPprof && c.AdminToken == "" {
+		problems = append(problems, fmt.Errorf("debugPprof requires adminToken to be set"))
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		problems = append(problems, fmt.Errorf("tlsCertFile and tlsKeyFile must both be set to enable TLS"))
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		problems = append(problems, fmt.Errorf("tlsClientCAFile requires tlsCertFile and tlsKeyFile"))
+	}
+	for _, origin := range c.CORSAllowedOrigins {
+		if err := validateCORSOrigin(origin); err != nil {
+			problems = append(problems, err)
+		}
+		if origin == "*" && c.CORSAllowCredentials {
+			problems = append(problems, fmt.Errorf("corsAllowCredentials cannot be combined with the wildcard origin \"*\""))
+		}
+	}
+	if c.CORSMaxAge.Duration < 0 {
+		problems = append(problems, fmt.Errorf("corsMaxAge must not be negative"))
+	}
+	for _, proxy := range c.TrustedProxies {
+		if _, err := parseProxyRange(proxy); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	for _, limit := range []struct {
+		name  string
+		rps   float64
+		burst int
+	}{
+		{"rateLimit", c.RateLimitRPS, c.RateLimitBurst},
+		{"rateLimitExpensive", c.RateLimitExpensiveRPS, c.RateLimitExpensiveBurst},
+	} {
+		if limit.rps < 0 || limit.burst < 0 {
+			problems = append(problems, fmt.Errorf("%sRPS and %sBurst must not be negative", limit.name, limit.name))
+		} else if limit.rps > 0 && limit.burst == 0 {
+			problems = append(problems, fmt.Errorf("%sBurst must be at least 1 when %sRPS is set", limit.name, limit.name))
+		}
+	}
+	if _, err := directory.New(c.directoryConfig()); err != nil {
+		problems = append(problems, err)
+	}
+	if _, err := protection.New(c.ProtectedNamePatterns, c.AdminToken); err != nil {
+		problems = append(problems, err)
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
+	}
+	return nil
+}
+
+// SlogLevel returns the configured log level, defaulting to info.
+func (c *Config) SlogLevel() slog.Level {
+	level, _ := c.parseLogLevel()
+	return level
+}
+
+// parseLogLevel parses LogLevel using slog's level names.
+func (c *Config) parseLogLevel() (slog.Level, error) {
+	var level slog.Level
+	if c.LogLevel == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		return slog.LevelInfo, err
+	}
+	return level, nil
+}
+
+// Redacted returns a copy of the configuration with secrets masked, suitable for logging.
+func (c *Config) Redacted() Config {
+	out := *c
+	if out.MetricsToken != "" {
+		out.MetricsToken = redacted
+	}
+	if out.AdminToken != "" {
+		out.AdminToken = redacted
+	}
+	if out.DirectoryToken != "" {
+		out.DirectoryToken = redacted
+	}
+	if out.DirectoryClientSecret != "" {
+		out.DirectoryClientSecret = redacted
+	}
+	if out.GitToken != "" {
+		out.GitToken = redacted
+	}
+	return out
+}
+
+// envBool reads a boolean environment variable, falling back to def when unset.
+func (c *Config) envBool(name string, def bool) bool {
+	return envParse(c, name, def, strconv.ParseBool)
+}
+
+// envString reads a string environment variable, falling back to def when unset.
+func (c *Config) envString(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// envList reads a comma-separated environment variable, falling back to def when unset.
+func (c *Config) envList(name string, def []string) []string {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// envFloat reads a floating point environment variable, falling back to def when unset.
+func (c *Config) envFloat(name string, def float64) float64 {
+	return envParse(c, name, def, func(value string) (float64, error) { return strconv.ParseFloat(value, 64) })
+}
+
+// envInt reads an integer environment variable, falling back to def when unset.
+func (c *Config) envInt(name string, def int) int {
+	return envParse(c, name, def, strconv.Atoi)
+}
+
+// envDuration reads a duration environment variable such as "30s", falling back to def when unset.
+func (c *Config) envDuration(name string, def time.Duration) time.Duration {
+	return envParse(c, name, def, time.ParseDuration)
+}
+
+// envParse reads the environment variable name with parse, falling back to def when it is unset. A value
+// that doesn't parse is recorded as a problem of c and def is kept.
+func envParse[T any](c *Config, name string, def T, parse func(string) (T, error)) T {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	parsed, err := parse(value)
+	if err != nil {
+		c.envProblems = append(c.envProblems, fmt.Errorf("%s %q is invalid: %w", name, value, err))
+		return def
+	}
+	return parsed
+}
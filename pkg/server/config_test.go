@@ -0,0 +1,104 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigAppliesEnv(t *testing.T) {
+	t.Setenv("KUBE_QPS", "50")
+	t.Setenv("REQUEST_TIMEOUT", "45s")
+	t.Setenv("METRICS_REFRESH_INTERVAL", "2m")
+	t.Setenv("READ_ONLY", "true")
+
+	config, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.KubeQPS != 50 {
+		t.Errorf("KubeQPS = %v, want 50", config.KubeQPS)
+	}
+	if config.RequestTimeout.Duration != 45*time.Second {
+		t.Errorf("RequestTimeout = %v, want 45s", config.RequestTimeout.Duration)
+	}
+	if config.MetricsRefreshInterval.Duration != 2*time.Minute {
+		t.Errorf("MetricsRefreshInterval = %v, want 2m", config.MetricsRefreshInterval.Duration)
+	}
+	if !config.ReadOnly {
+		t.Error("ReadOnly = false, want true")
+	}
+}
+
+func TestLoadConfigRefusesInvalidEnv(t *testing.T) {
+	t.Setenv("KUBE_QPS", "fifty")
+	t.Setenv("REQUEST_TIMEOUT", "30")
+	t.Setenv("READ_ONLY", "yes please")
+	t.Setenv("METRICS_REFRESH_INTERVAL", "30")
+	t.Setenv("SHUTDOWN_TIMEOUT", "-1s")
+
+	_, err := LoadConfig("")
+	if err == nil {
+		t.Fatal("LoadConfig succeeded with invalid environment variables")
+	}
+	for _, want := range []string{"KUBE_QPS", "REQUEST_TIMEOUT", "READ_ONLY", "METRICS_REFRESH_INTERVAL", "shutdownTimeout"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error doesn't report %s: %v", want, err)
+		}
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("env overrides file", func(t *testing.T) {
+		t.Setenv("PORT", "9090")
+		config, err := LoadConfig(write("config.yaml", "port: \"8081\"\nlogLevel: debug\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config.Port != "9090" || config.LogLevel != "debug" {
+			t.Errorf("port = %s, logLevel = %s; want 9090 and debug", config.Port, config.LogLevel)
+		}
+	})
+	t.Run("unknown field", func(t *testing.T) {
+		if _, err := LoadConfig(write("unknown.yaml", "prot: \"8081\"\n")); err == nil {
+			t.Error("LoadConfig accepted an unknown field")
+		}
+	})
+	t.Run("every problem reported", func(t *testing.T) {
+		_, err := LoadConfig(write("invalid.yaml", "port: \"0\"\nlogLevel: loud\nscanConcurrency: 0\n"))
+		if err == nil {
+			t.Fatal("LoadConfig accepted an invalid configuration")
+		}
+		for _, want := range []string{"port", "logLevel", "scanConcurrency"} {
+			if !strings.Contains(err.Error(), want) {
+				t.Errorf("error doesn't report %s: %v", want, err)
+			}
+		}
+	})
+}
+
+func TestKubernetesOptions(t *testing.T) {
+	t.Setenv("KUBE_QPS", "75")
+	t.Setenv("KUBE_BURST", "150")
+	t.Setenv("KUBE_TIMEOUT", "20s")
+
+	config, err := LoadConfig("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := config.KubernetesOptions()
+	if options.QPS != 75 || options.Burst != 150 || options.Timeout != 20*time.Second || options.MaxRetries != config.KubeMaxRetries {
+		t.Errorf("options = %+v, want QPS 75, Burst 150, Timeout 20s and %d retries", options, config.KubeMaxRetries)
+	}
+}
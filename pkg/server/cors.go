@@ -0,0 +1,66 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"rbac/pkg/cache"
+	"rbac/pkg/listing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/cors"
+)
+
+// corsMiddleware applies the configured cross-origin policy to /api requests. It returns nil when no
+// origins are allowed, leaving the API same-origin only.
+func corsMiddleware(config *Config) echo.MiddlewareFunc {
+	if len(config.CORSAllowedOrigins) == 0 {
+		return nil
+	}
+
+	handler := echo.WrapMiddleware(cors.New(cors.Options{
+		AllowedOrigins:   config.CORSAllowedOrigins,
+		AllowedMethods:   config.CORSAllowedMethods,
+		AllowedHeaders:   config.CORSAllowedHeaders,
+		ExposedHeaders:   []string{listing.HeaderContinue, cache.HeaderCache, cache.HeaderUpdated},
+		AllowCredentials: config.CORSAllowCredentials,
+		MaxAge:           int(config.CORSMaxAge.Seconds()),
+	}).Handler)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		withCORS := handler(next)
+		return func(c echo.Context) error {
+			// Applied at the root so preflights reach it even for routes without an OPTIONS handler
+			path := c.Request().URL.Path
+			if path == "/api" || strings.HasPrefix(path, "/api/") {
+				return withCORS(c)
+			}
+			return next(c)
+		}
+	}
+}
+
+// validateCORSOrigin checks that origin is "*", an exact origin such as https://app.example.com, or a
+// wildcard subdomain origin such as https://*.example.com.
+func validateCORSOrigin(origin string) error {
+	if origin == "*" {
+		return nil
+	}
+	if strings.Count(origin, "*") > 1 {
+		return fmt.Errorf("CORS origin %q may contain at most one wildcard", origin)
+	}
+
+	host := origin
+	if scheme, rest, ok := strings.Cut(origin, "://*."); ok {
+		host = scheme + "://" + rest
+	} else if strings.Contains(origin, "*") {
+		return fmt.Errorf("CORS origin %q may only use a wildcard as a leading subdomain, e.g. https://*.example.com", origin)
+	}
+
+	u, err := url.Parse(host)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+		return fmt.Errorf("CORS origin %q must be a scheme and host such as https://app.example.com", origin)
+	}
+	return nil
+}
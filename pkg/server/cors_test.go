@@ -0,0 +1,111 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+// preflight returns the response to a preflight from origin for a PUT to target, with the request headers
+// lowercased as browsers send them.
+func preflight(e *echo.Echo, target, origin string) (int, http.Header) {
+	rec := serve(e, http.MethodOptions, target, "", http.Header{
+		echo.HeaderOrigin:                      {origin},
+		echo.HeaderAccessControlRequestMethod:  {http.MethodPut},
+		echo.HeaderAccessControlRequestHeaders: {"authorization,content-type"},
+	})
+	return rec.Code, rec.Header()
+}
+
+func TestCORSPreflight(t *testing.T) {
+	e, _ := testServer(t, func(c *Config) {
+		c.CORSAllowedOrigins = []string{"https://app.example.com", "https://*.example.org"}
+		c.CORSAllowCredentials = true
+	})
+	tests := []struct {
+		name    string
+		target  string
+		origin  string
+		allowed bool
+	}{
+		{"exact origin", "/api/roles", "https://app.example.com", true},
+		{"wildcard subdomain", "/api/roles", "https://ui.example.org", true},
+		{"wildcard doesn't match the apex", "/api/roles", "https://example.org", false},
+		{"other scheme", "/api/roles", "http://app.example.com", false},
+		{"unlisted origin", "/api/roles", "https://evil.example.net", false},
+		{"outside the API", "/healthz", "https://app.example.com", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, header := preflight(e, tt.target, tt.origin)
+			got := header.Get(echo.HeaderAccessControlAllowOrigin)
+			if !tt.allowed {
+				if got != "" {
+					t.Errorf("Access-Control-Allow-Origin = %q, want none", got)
+				}
+				return
+			}
+			if code != http.StatusNoContent {
+				t.Errorf("status = %d, want %d", code, http.StatusNoContent)
+			}
+			if got != tt.origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.origin)
+			}
+			if header.Get(echo.HeaderAccessControlAllowCredentials) != "true" {
+				t.Error("credentials not allowed")
+			}
+			if header.Get(echo.HeaderAccessControlMaxAge) != "600" {
+				t.Errorf("Access-Control-Max-Age = %q, want 600", header.Get(echo.HeaderAccessControlMaxAge))
+			}
+			if !strings.Contains(header.Get(echo.HeaderAccessControlAllowMethods), http.MethodPut) {
+				t.Errorf("Access-Control-Allow-Methods = %q, want PUT", header.Get(echo.HeaderAccessControlAllowMethods))
+			}
+		})
+	}
+
+	rec := serve(e, http.MethodGet, "/api/roles?namespace=default", "", http.Header{echo.HeaderOrigin: {"https://app.example.com"}})
+	if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderAccessControlAllowOrigin) != "https://app.example.com" {
+		t.Errorf("cross-origin GET = %d with origin %q", rec.Code, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+	}
+	if exposed := rec.Header().Get(echo.HeaderAccessControlExposeHeaders); exposed == "" {
+		t.Error("no headers exposed to cross-origin requests")
+	}
+}
+
+func TestCORSSameOriginByDefault(t *testing.T) {
+	e, _ := testServer(t, nil)
+	if _, header := preflight(e, "/api/roles", "https://app.example.com"); header.Get(echo.HeaderAccessControlAllowOrigin) != "" {
+		t.Errorf("default config allows origin %q", header.Get(echo.HeaderAccessControlAllowOrigin))
+	}
+}
+
+func TestValidateCORSOrigin(t *testing.T) {
+	tests := []struct {
+		origin  string
+		wantErr bool
+	}{
+		{"*", false},
+		{"https://app.example.com", false},
+		{"http://localhost:3000", false},
+		{"https://*.example.com", false},
+		{"app.example.com", true},
+		{"ftp://app.example.com", true},
+		{"https://app.example.com/ui", true},
+		{"https://app.*.example.com", true},
+		{"https://*.*.example.com", true},
+	}
+	for _, tt := range tests {
+		if err := validateCORSOrigin(tt.origin); (err != nil) != tt.wantErr {
+			t.Errorf("validateCORSOrigin(%q) = %v, want error %v", tt.origin, err, tt.wantErr)
+		}
+	}
+
+	config := DefaultConfig()
+	config.CORSAllowedOrigins = []string{"*"}
+	config.CORSAllowCredentials = true
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "corsAllowCredentials") {
+		t.Errorf("Validate() = %v, want the wildcard origin with credentials refused", err)
+	}
+}
@@ -0,0 +1,27 @@
+package server
+
+import (
+	"net/http"
+
+	"rbac/pkg/httperror"
+	"rbac/pkg/logging"
+
+	"github.com/labstack/echo/v4"
+)
+
+// httpErrorHandler writes handler errors as JSON, including the request id so users can quote it in bug reports.
+func httpErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	code, response := httperror.Build(err, logging.RequestID(c.Request().Context()))
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(code)
+	} else {
+		err = c.JSON(code, response)
+	}
+	if err != nil {
+		logging.FromContext(c.Request().Context()).Error("writing error response", "error", err)
+	}
+}
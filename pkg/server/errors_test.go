@@ -0,0 +1,40 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rbac/pkg/httperror"
+
+	"github.com/labstack/echo/v4"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestHTTPErrorHandler(t *testing.T) {
+	e := echo.New()
+	e.HTTPErrorHandler = httpErrorHandler
+	missing := func(echo.Context) error {
+		return httperror.Wrap(apierrors.NewNotFound(schema.GroupResource{Resource: "roles"}, "deployer"), "Error getting role: ")
+	}
+	e.GET("/role", missing)
+	e.HEAD("/role", missing)
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/role", nil))
+	var response httperror.Response
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Code != http.StatusNotFound || response.Code != "NotFound" || response.Message != `Error getting role: roles "deployer" not found` {
+		t.Errorf("GET = %d %+v", rec.Code, response)
+	}
+
+	rec = httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest(http.MethodHead, "/role", nil))
+	if rec.Code != http.StatusNotFound || rec.Body.Len() != 0 {
+		t.Errorf("HEAD = %d with %d body bytes, want %d without a body", rec.Code, rec.Body.Len(), http.StatusNotFound)
+	}
+}
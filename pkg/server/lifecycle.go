@@ -0,0 +1,167 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"rbac/pkg/listcache"
+
+	"github.com/labstack/echo/v4"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Server ties the HTTP server to the long-lived streams and background workers started by its
+// routes, so shutdown can wait for all of them.
+type Server struct {
+	echo      *echo.Echo
+	config    *Config
+	listCache *listcache.Cache
+
+	// streamCtx is cancelled when shutdown begins, ending SSE, WebSocket and watch streams.
+	streamCtx   context.Context
+	stopStreams context.CancelFunc
+	// workerCtx is cancelled once in-flight requests have finished, so their audit entries
+	// are still forwarded.
+	workerCtx   context.Context
+	stopWorkers context.CancelFunc
+
+	streams       sync.WaitGroup
+	workers       sync.WaitGroup
+	activeStreams atomic.Int64
+	openConns     atomic.Int64
+}
+
+// New configures TLS when enabled and registers the routes on e. listCache is the cache clientset answers
+// LIST calls from, flushed through the admin API.
+func New(e *echo.Echo, clientset kubernetes.Interface, listCache *listcache.Cache, config *Config) (*Server, error) {
+	s := &Server{echo: e, config: config, listCache: listCache}
+	s.streamCtx, s.stopStreams = context.WithCancel(context.Background())
+	s.workerCtx, s.stopWorkers = context.WithCancel(context.Background())
+
+	if config.TLSEnabled() {
+		tlsConfig, err := NewTLSConfig(config)
+		if err != nil {
+			return nil, fmt.Errorf("configuring TLS: %w", err)
+		}
+		e.TLSServer.TLSConfig = tlsConfig
+	}
+
+	if err := s.registerRoutes(clientset); err != nil {
+		s.stopStreams()
+		s.stopWorkers()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Run serves until ctx is cancelled, then stops accepting connections and waits, up to the
+// shutdown timeout, for in-flight requests, streams and background workers to finish.
+func (s *Server) Run(ctx context.Context) error {
+	srv := s.echo.Server
+	if s.echo.TLSServer.TLSConfig != nil {
+		srv = s.echo.TLSServer
+	}
+	srv.Addr = net.JoinHostPort(s.config.BindAddress, s.config.Port)
+	srv.ReadHeaderTimeout = s.config.ReadHeaderTimeout.Duration
+	srv.ReadTimeout = s.config.ReadTimeout.Duration
+	srv.WriteTimeout = s.config.WriteTimeout.Duration
+	srv.IdleTimeout = s.config.IdleTimeout.Duration
+	srv.ConnState = s.trackConn
+
+	slog.Info("Starting server", "address", srv.Addr, "tls", srv.TLSConfig != nil)
+	serveErr := make(chan error, 1)
+	go func() {
+		serveErr <- s.echo.StartServer(srv)
+	}()
+
+	select {
+	case err := <-serveErr:
+		s.stopStreams()
+		s.stopWorkers()
+		s.workers.Wait()
+		return err
+	case <-ctx.Done():
+	}
+
+	conns, streams := s.openConns.Load(), s.activeStreams.Load()
+	slog.Info("Shutting down server", "openConnections", conns, "activeStreams", streams)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout.Duration)
+	defer cancel()
+
+	// Streams never finish on their own, so end them before waiting on in-flight requests
+	s.stopStreams()
+	err := s.echo.Shutdown(shutdownCtx)
+	if waitErr := wait(shutdownCtx, &s.streams); err == nil {
+		err = waitErr
+	}
+
+	s.stopWorkers()
+	if waitErr := wait(shutdownCtx, &s.workers); err == nil {
+		err = waitErr
+	}
+
+	if serveErr := <-serveErr; err == nil && !errors.Is(serveErr, http.ErrServerClosed) {
+		err = serveErr
+	}
+
+	slog.Info("Server stopped",
+		"drainedConnections", conns-s.openConns.Load(),
+		"drainedStreams", streams-s.activeStreams.Load(),
+	)
+	return err
+}
+
+// goWorker runs fn in the background until the workers are stopped.
+func (s *Server) goWorker(fn func(ctx context.Context)) {
+	s.workers.Add(1)
+	go func() {
+		defer s.workers.Done()
+		fn(s.workerCtx)
+	}()
+}
+
+// trackStream counts a long-lived handler so shutdown can wait for it. WebSocket connections are
+// hijacked from the HTTP server, which otherwise wouldn't wait for them at all.
+func (s *Server) trackStream(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		s.streams.Add(1)
+		s.activeStreams.Add(1)
+		defer func() {
+			s.activeStreams.Add(-1)
+			s.streams.Done()
+		}()
+		return next(c)
+	}
+}
+
+// trackConn counts open connections. Hijacked connections are counted as streams instead.
+func (s *Server) trackConn(_ net.Conn, state http.ConnState) {
+	switch state {
+	case http.StateNew:
+		s.openConns.Add(1)
+	case http.StateHijacked, http.StateClosed:
+		s.openConns.Add(-1)
+	}
+}
+
+// wait blocks until wg is done or ctx expires.
+func wait(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// events records what happened during a shutdown, in order.
+type events struct {
+	mu   sync.Mutex
+	list []string
+}
+
+func (ev *events) add(event string) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.list = append(ev.list, event)
+}
+
+func (ev *events) get() []string {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	return slices.Clone(ev.list)
+}
+
+// run starts s on a local port and returns its address and the result of Run.
+func run(t *testing.T, s *Server, ctx context.Context) (string, <-chan error) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.echo.Listener = listener
+	done := make(chan error, 1)
+	go func() { done <- s.Run(ctx) }()
+	return "http://" + listener.Addr().String(), done
+}
+
+// openStream requests url and returns once the response headers have arrived.
+func openStream(t *testing.T, url string) *http.Response {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("stream status = %d", resp.StatusCode)
+	}
+	return resp
+}
+
+func TestRunDrainsInOrder(t *testing.T) {
+	s, _ := newTestServer(t, func(c *Config) { c.ShutdownTimeout = metav1.Duration{Duration: 5 * time.Second} })
+	var ev events
+	s.echo.GET("/test/stream", s.trackStream(func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusOK)
+		c.Response().Flush()
+		<-s.streamCtx.Done()
+		ev.add("stream ended")
+		return nil
+	}))
+	started, release := make(chan struct{}), make(chan struct{})
+	s.echo.GET("/test/slow", func(c echo.Context) error {
+		close(started)
+		<-release
+		if s.workerCtx.Err() != nil {
+			ev.add("workers stopped before the request finished")
+		}
+		ev.add("request finished")
+		return c.String(http.StatusOK, "done")
+	})
+	s.goWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		ev.add("worker stopped")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	url, done := run(t, s, ctx)
+
+	stream := openStream(t, url+"/test/stream")
+	defer stream.Body.Close()
+	slow := make(chan *http.Response, 1)
+	go func() {
+		resp, err := http.Get(url + "/test/slow")
+		if err != nil {
+			t.Error(err)
+		}
+		slow <- resp
+	}()
+	<-started
+
+	cancel()
+	// The stream ends as soon as shutdown begins, while the request is still being served
+	_, err := bufio.NewReader(stream.Body).ReadByte()
+	if err == nil {
+		t.Fatal("stream still open after shutdown began")
+	}
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run returned %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after shutdown")
+	}
+	if resp := <-slow; resp == nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("in-flight request wasn't served to the end: %v", resp)
+	} else {
+		resp.Body.Close()
+	}
+	want := []string{"stream ended", "request finished", "worker stopped"}
+	if got := ev.get(); !slices.Equal(got, want) {
+		t.Errorf("shutdown order = %v, want %v", got, want)
+	}
+}
+
+func TestRunGivesUpOnStuckStream(t *testing.T) {
+	s, _ := newTestServer(t, func(c *Config) { c.ShutdownTimeout = metav1.Duration{Duration: 100 * time.Millisecond} })
+	stuck := make(chan struct{})
+	defer close(stuck)
+	s.echo.GET("/test/stuck", s.trackStream(func(c echo.Context) error {
+		c.Response().WriteHeader(http.StatusOK)
+		c.Response().Flush()
+		<-stuck
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	url, done := run(t, s, ctx)
+	stream := openStream(t, url+"/test/stuck")
+	defer stream.Body.Close()
+
+	cancel()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Run returned %v, want the shutdown timeout", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run didn't return after the shutdown timeout")
+	}
+}
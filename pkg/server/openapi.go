@@ -0,0 +1,198 @@
+package server
+
+import (
+	"net/http"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/consolidation"
+	"rbac/pkg/discovery"
+	"rbac/pkg/gitops"
+	"rbac/pkg/graph"
+	"rbac/pkg/handlers/admin"
+	"rbac/pkg/handlers/auditlogs"
+	"rbac/pkg/handlers/lookup"
+	"rbac/pkg/handlers/rbac"
+	"rbac/pkg/health"
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
+	"rbac/pkg/openapi"
+	"rbac/pkg/readonly"
+	"rbac/pkg/templates"
+	"rbac/pkg/version"
+	"rbac/pkg/watch"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+// message is the body of responses that only confirm an action.
+type message struct {
+	Message string `json:"message"`
+}
+
+var (
+	namespaceParam     = openapi.Param{Name: "namespace", Description: "Namespace, default when omitted"}
+	nameParam          = openapi.Param{Name: "name", Description: "Name of the object", Required: true}
+	managedFilter      = []openapi.Param{{Name: "managedOnly", Description: "Only objects managed by this service", Enum: []string{"true"}}, {Name: "managedBy", Description: "Only objects whose managed-by label has this value"}}
+	bindingFilter      = []openapi.Param{{Name: "roleName"}, {Name: "roleKind", Enum: []string{"Role", "ClusterRole"}}, {Name: "subjectKind", Enum: []string{"User", "Group", "ServiceAccount"}}, {Name: "subjectName"}, {Name: "subjectContains", Description: "Only bindings with a subject whose name contains this, ignoring case"}, {Name: "expired", Description: "Only bindings whose expiry has (true) or hasn't (false) passed", Enum: []string{"true", "false"}}}
+	expiryParams       = []openapi.Param{{Name: "expiresAt", Description: "RFC 3339 time the binding is removed"}, {Name: "expiresIn", Description: "Duration after which the binding is removed"}}
+	dryRunParam        = openapi.Param{Name: "dryRun", Description: "Submit the change as a server-side dry run without saving it", Enum: []string{"true", "false"}}
+	overrideProtection = openapi.Param{Name: "overrideProtection", Description: "Change a protected object; requires the admin token", Enum: []string{"true"}}
+	pageParams         = []openapi.Param{{Name: "offset"}, {Name: "limit"}}
+	listParams         = []openapi.Param{{Name: "limit", Description: "Page size asked of the API server"}, {Name: "continue", Description: "Continue token of the previous page"}, {Name: "labelSelector"}, {Name: "sort", Description: "Order of the items in each page; prefix with - for descending", Enum: []string{"name", "namespace", "creationTimestamp", "-name", "-namespace", "-creationTimestamp"}}}
+	includeSystem      = openapi.Param{Name: "includeSystem", Description: "Include system and default RBAC objects", Enum: []string{"true", "false"}}
+	auditFilter        = []openapi.Param{
+		{Name: "category", Enum: []string{audit.CategoryRBAC, audit.CategoryAuth}},
+		{Name: "action"}, {Name: "namespace"}, {Name: "resourceName"}, {Name: "actor"}, {Name: "q"},
+		{Name: "from", Description: "RFC 3339 time of the oldest entry"}, {Name: "to", Description: "RFC 3339 time entries must precede"},
+		{Name: "includeDetails", Enum: []string{"true"}},
+	}
+)
+
+// params joins parameter lists.
+func params(lists ...[]openapi.Param) []openapi.Param {
+	var joined []openapi.Param
+	for _, list := range lists {
+		joined = append(joined, list...)
+	}
+	return joined
+}
+
+// describeRoutes documents every route registerRoutes adds. Routes missing here still appear in the
+// document, without parameters or schemas, and are logged at startup.
+func describeRoutes(spec *openapi.Spec) {
+	describe := spec.Describe
+
+	describe(http.MethodGet, "/api/namespaces", openapi.Route{Summary: "List namespaces", Query: params(managedFilter, listParams), Response: corev1.NamespaceList{}})
+	describe(http.MethodPost, "/api/namespaces", openapi.Route{Summary: "Create a namespace", Body: corev1.Namespace{}, Response: corev1.Namespace{}})
+	describe(http.MethodDelete, "/api/namespaces", openapi.Route{Summary: "Delete a namespace", Query: []openapi.Param{nameParam, overrideProtection}, Response: message{}})
+	describe(http.MethodGet, "/api/namespaces/details", openapi.Route{Summary: "Get a namespace", Query: []openapi.Param{nameParam}, Response: corev1.Namespace{}})
+
+	describe(http.MethodGet, "/api/roles", openapi.Route{Summary: "List roles with whether they are bound", Query: params([]openapi.Param{{Name: "namespace", Description: "Namespace, or all for every namespace"}}, managedFilter, listParams), Response: []rbac.RoleWithStatus{}})
+	describe(http.MethodPost, "/api/roles", openapi.Route{Summary: "Create a role", Query: []openapi.Param{namespaceParam}, Body: rbacv1.Role{}, Response: rbacv1.Role{}})
+	describe(http.MethodPut, "/api/roles", openapi.Route{Summary: "Update a role", Query: []openapi.Param{namespaceParam, overrideProtection}, Body: rbacv1.Role{}, Response: rbacv1.Role{}})
+	describe(http.MethodDelete, "/api/roles", openapi.Route{Summary: "Delete a role", Query: []openapi.Param{namespaceParam, nameParam, overrideProtection}, Response: message{}})
+	describe(http.MethodGet, "/api/roles/details", openapi.Route{Summary: "Get a role and the bindings that reference it", Query: []openapi.Param{{Name: "roleName", Required: true}, namespaceParam}, Response: rbac.RoleDetailsResponse{}})
+	describe(http.MethodGet, "/api/roles/all", openapi.Route{Summary: "List roles of every namespace, grouped by namespace", Query: params([]openapi.Param{{Name: "labelSelector"}}, pageParams), Response: rbac.RolesOverview{}})
+	describe(http.MethodPost, "/api/roles/validate", openapi.Route{Summary: "Check role rules against the resources the cluster serves", Body: rbacv1.ClusterRole{}, Response: rbac.RuleValidation{}})
+	describe(http.MethodPost, "/api/validate", openapi.Route{Summary: "Validate a multi-document YAML manifest, or JSON array, of RBAC objects without applying it", Query: []openapi.Param{{Name: "namespace", Description: "Namespace of namespaced objects that name none, default unless given"}, {Name: "dryRun", Description: "Also submit the objects to the API server as a dry run, true by default"}}, Response: rbac.ManifestValidation{}})
+
+	describe(http.MethodGet, "/api/rolebindings", openapi.Route{Summary: "List role bindings", Query: params([]openapi.Param{{Name: "namespace", Description: "Namespace, or all for every namespace"}}, bindingFilter, managedFilter, listParams), Response: rbac.BindingList[rbac.RoleBindingWithStatus]{}})
+	describe(http.MethodPost, "/api/rolebindings", openapi.Route{Summary: "Create a role binding", Query: params([]openapi.Param{namespaceParam, dryRunParam}, expiryParams), Body: rbacv1.RoleBinding{}, Response: rbacv1.RoleBinding{}})
+	describe(http.MethodPut, "/api/rolebindings", openapi.Route{Summary: "Update a role binding", Query: []openapi.Param{namespaceParam, dryRunParam, overrideProtection}, Body: rbacv1.RoleBinding{}, Response: rbacv1.RoleBinding{}})
+	describe(http.MethodDelete, "/api/rolebindings", openapi.Route{Summary: "Delete a role binding", Query: []openapi.Param{namespaceParam, nameParam, dryRunParam, overrideProtection}, Response: message{}})
+	describe(http.MethodGet, "/api/rolebinding/details", openapi.Route{Summary: "Get a role binding", Query: []openapi.Param{nameParam, namespaceParam}, Response: rbacv1.RoleBinding{}})
+
+	describe(http.MethodGet, "/api/clusterroles", openapi.Route{Summary: "List cluster roles", Query: params(managedFilter, listParams), Response: rbacv1.ClusterRoleList{}})
+	describe(http.MethodPost, "/api/clusterroles", openapi.Route{Summary: "Create a cluster role", Query: []openapi.Param{overrideProtection}, Body: rbacv1.ClusterRole{}, Response: rbacv1.ClusterRole{}})
+	describe(http.MethodPut, "/api/clusterroles", openapi.Route{Summary: "Update a cluster role", Query: []openapi.Param{overrideProtection}, Body: rbacv1.ClusterRole{}, Response: rbacv1.ClusterRole{}})
+	describe(http.MethodDelete, "/api/clusterroles", openapi.Route{Summary: "Delete a cluster role", Query: []openapi.Param{nameParam, overrideProtection}, Response: message{}})
+	describe(http.MethodGet, "/api/clusterroles/details", openapi.Route{Summary: "Get a cluster role and the bindings that reference it", Query: []openapi.Param{{Name: "clusterRoleName", Required: true}}, Response: rbac.ClusterRoleDetailsResponse{}})
+
+	describe(http.MethodGet, "/api/clusterrolebindings", openapi.Route{Summary: "List cluster role bindings", Query: params(bindingFilter, managedFilter, listParams), Response: rbac.BindingList[rbac.ClusterRoleBindingWithStatus]{}})
+	describe(http.MethodPost, "/api/clusterrolebindings", openapi.Route{Summary: "Create a cluster role binding", Query: params([]openapi.Param{dryRunParam}, expiryParams), Body: rbacv1.ClusterRoleBinding{}, Response: rbacv1.ClusterRoleBinding{}})
+	describe(http.MethodPut, "/api/clusterrolebindings", openapi.Route{Summary: "Update a cluster role binding", Query: []openapi.Param{dryRunParam, overrideProtection}, Body: rbacv1.ClusterRoleBinding{}, Response: rbacv1.ClusterRoleBinding{}})
+	describe(http.MethodDelete, "/api/clusterrolebindings", openapi.Route{Summary: "Delete a cluster role binding", Query: []openapi.Param{nameParam, dryRunParam, overrideProtection}, Response: message{}})
+	describe(http.MethodGet, "/api/clusterrolebinding/details", openapi.Route{Summary: "Get a cluster role binding", Query: []openapi.Param{nameParam}, Response: rbacv1.ClusterRoleBinding{}})
+
+	describe(http.MethodGet, "/api/bindings/expiring", openapi.Route{Summary: "List temporary bindings, soonest expiry first", Query: []openapi.Param{{Name: "within", Description: "Only bindings expiring within this duration"}}, Response: []rbac.ExpiringBinding{}})
+
+	describe(http.MethodGet, "/api/templates", openapi.Route{Summary: "List role templates", Response: []templates.Template{}})
+	describe(http.MethodGet, "/api/templates/:id", openapi.Route{Summary: "Get a role template", Response: templates.Template{}})
+	describe(http.MethodPost, "/api/templates/:id/render", openapi.Route{Summary: "Render a template without creating anything", Body: rbac.TemplateRequest{}, Response: templates.Rendered{}})
+	describe(http.MethodPost, "/api/templates/:id/apply", openapi.Route{Summary: "Create the role and binding of a template", Body: rbac.TemplateRequest{}, Response: templates.Rendered{}})
+
+	describe(http.MethodGet, "/api/serviceaccounts", openapi.Route{Summary: "List service accounts", Query: params([]openapi.Param{{Name: "namespace", Description: "Namespace, or all for every namespace"}}, managedFilter, listParams), Response: corev1.ServiceAccountList{}})
+	describe(http.MethodPost, "/api/serviceaccounts", openapi.Route{Summary: "Create a service account", Query: []openapi.Param{namespaceParam}, Body: corev1.ServiceAccount{}, Response: corev1.ServiceAccount{}})
+	describe(http.MethodDelete, "/api/serviceaccounts", openapi.Route{Summary: "Delete a service account", Query: []openapi.Param{namespaceParam, nameParam, overrideProtection}, Response: message{}})
+	describe(http.MethodGet, "/api/serviceaccount-details", openapi.Route{Summary: "Get the bindings naming a service account and the pods running as it", Query: []openapi.Param{{Name: "serviceAccountName", Required: true}, namespaceParam}, Response: rbac.ServiceAccountDetailsResponse{}})
+	describe(http.MethodGet, "/api/serviceaccounts/usage", openapi.Route{Summary: "List the pods and workloads running as service accounts", Query: []openapi.Param{namespaceParam, {Name: "name", Description: "Only this service account"}}, Response: rbac.ServiceAccountUsageResponse{}})
+
+	describe(http.MethodGet, "/api/resources", openapi.Route{Summary: "List the resource names the cluster serves", Response: map[string][]string{}})
+	describe(http.MethodGet, "/api/discovery/resources", openapi.Route{Summary: "List API groups, resources and verbs for the role editor", Query: []openapi.Param{{Name: "refresh", Enum: []string{"true"}}}, Response: discovery.Catalog{}})
+
+	describe(http.MethodGet, "/api/users", openapi.Route{Summary: "List users named in bindings", Response: []string{}})
+	describe(http.MethodGet, "/api/userroles", openapi.Route{Summary: "List the roles bound to a user", Query: []openapi.Param{{Name: "userName", Required: true}}, Response: []string{}})
+	describe(http.MethodGet, "/api/users/details", openapi.Route{Summary: "Get the bindings naming a user and the roles they reference", Query: []openapi.Param{{Name: "userName", Required: true}}, Response: rbac.UserDetailsResponse{}})
+
+	describe(http.MethodGet, "/api/groups", openapi.Route{Summary: "List groups named in bindings; with detail=true, as summaries", Query: []openapi.Param{
+		{Name: "detail", Enum: []string{"true"}}, {Name: "contains"}, {Name: "prefix"}, {Name: "regex"},
+		{Name: "caseInsensitive", Enum: []string{"true"}}, {Name: "namespace"}, {Name: "sort", Enum: []string{"name", "bindingCount"}},
+	}, Response: []rbac.GroupSummary{}})
+	describe(http.MethodGet, "/api/groupdetails", openapi.Route{Summary: "Get the bindings naming a group", Query: []openapi.Param{{Name: "groupName", Required: true}}, Response: rbac.GroupDetailsResponse{}})
+
+	describe(http.MethodGet, "/api/subjects/search", openapi.Route{Summary: "Search users, groups and service accounts named in bindings", Query: []openapi.Param{{Name: "q", Required: true}, {Name: "kinds"}, {Name: "limit"}}, Response: []rbac.SubjectMatch{}})
+	describe(http.MethodGet, "/api/subjects/:kind/:name/permissions", openapi.Route{Summary: "Get the flattened permissions a subject's bindings grant", Query: []openapi.Param{{Name: "namespace", Description: "Namespace of a service account"}, {Name: "groups", Description: "Comma-separated groups a user belongs to"}}, Response: rbac.SubjectPermissionsResponse{}})
+	describe(http.MethodGet, "/api/matrix", openapi.Route{Summary: "Grid of subjects against verbs for a resource", Query: []openapi.Param{{Name: "resource", Required: true}, {Name: "namespace"}, {Name: "apiGroup"}, {Name: "subjectKind"}, {Name: "subjects"}}, Response: rbac.PermissionMatrix{}})
+	describe(http.MethodGet, "/api/who-can", openapi.Route{Summary: "List the subjects allowed an action", Query: []openapi.Param{
+		{Name: "verb", Required: true}, {Name: "resource", Description: "Resource, optionally with a subresource such as pods/log"}, {Name: "apiGroup"},
+		{Name: "resourceName", Description: "Only access to this object"}, {Name: "nonResourceURL", Description: "API server path asked about instead of a resource"},
+		{Name: "namespace", Description: "Namespace, or cluster-wide access only when omitted"}, {Name: "format", Enum: []string{"json", "csv"}},
+	}, Response: rbac.WhoCan{}})
+	describe(http.MethodPost, "/api/simulate", openapi.Route{Summary: "Ask the API server whether a subject may perform an action, with the rules allowing it", Body: rbac.SimulationRequest{}, Response: rbac.SimulationResult{}})
+	describe(http.MethodGet, "/api/access/effective", openapi.Route{Summary: "Get the merged rules a user is granted directly and through their groups", Query: []openapi.Param{{Name: "user", Required: true}, {Name: "groups", Description: "Comma-separated groups the user belongs to"}, {Name: "namespace", Description: "Only role bindings in this namespace"}}, Response: rbac.EffectiveAccessResponse{}})
+	describe(http.MethodGet, "/api/graph", openapi.Route{Summary: "Get the graph of subjects, roles, namespaces and the bindings between them", Query: []openapi.Param{{Name: "subject", Description: "Centre the graph on subjects with this name"}, {Name: "subjectKind", Enum: []string{"User", "Group", "ServiceAccount"}}, {Name: "role", Description: "Centre the graph on roles with this name"}, {Name: "roleKind", Enum: []string{"Role", "ClusterRole"}}, {Name: "depth", Description: "Edges to follow from the centre, 2 by default"}, {Name: "namespace", Description: "Only the roles and role bindings of this namespace"}, {Name: "limit", Description: "Maximum number of nodes, 500 by default"}, {Name: "format", Enum: []string{"json", "dot", "graphml"}}}, Response: graph.Graph{}})
+
+	describe(http.MethodGet, "/api/suggestions/consolidation", openapi.Route{Summary: "Suggest merges of roles granting the same permissions as another, or a subset of them", Response: []consolidation.Suggestion{}})
+	describe(http.MethodPost, "/api/suggestions/consolidation/:id/apply", openapi.Route{Summary: "Re-point the bindings of the merged roles at the role that stays and delete the merged roles", Query: []openapi.Param{{Name: "dryRun", Description: "Check the merge with server-side dry runs without changing anything"}}, Response: rbac.ConsolidationResult{}})
+	describe(http.MethodGet, "/api/reports/namespace-admins", openapi.Route{Summary: "Report who administers each namespace", Query: []openapi.Param{{Name: "namespace", Description: "Only this namespace"}, includeSystem, {Name: "format", Enum: []string{"json", "csv"}}}, Response: rbac.NamespaceAdminsReport{}})
+	describe(http.MethodGet, "/api/export/terraform", openapi.Route{Summary: "Export the roles and role bindings of a namespace as Terraform configuration", Query: params([]openapi.Param{namespaceParam, includeSystem}, managedFilter), Response: "", ContentType: "text/plain"})
+	describe(http.MethodGet, "/api/export/terraform/cluster", openapi.Route{Summary: "Export the cluster roles and cluster role bindings as Terraform configuration", Query: params([]openapi.Param{includeSystem}, managedFilter), Response: "", ContentType: "text/plain"})
+	describe(http.MethodGet, "/api/search", openapi.Route{Summary: "Search RBAC objects by name, labels, subjects and rule contents", Query: params([]openapi.Param{{Name: "q", Required: true}, {Name: "kinds"}}, pageParams), Response: rbac.SearchResults{}})
+
+	describe(http.MethodGet, "/api/admin/read-only", openapi.Route{Summary: "Get the read-only mode", Response: readonly.State{}})
+	describe(http.MethodPost, "/api/admin/read-only", openapi.Route{Summary: "Switch the read-only mode", Body: admin.ReadOnlyRequest{}, Response: readonly.State{}})
+	describe(http.MethodPost, "/api/cache/flush", openapi.Route{Summary: "Drop every cached LIST response", Response: admin.FlushCacheResponse{}})
+	describe(http.MethodGet, "/api/git/status", openapi.Route{Summary: "Get the state of the git mirror", Response: gitops.Status{}})
+	describe(http.MethodPost, "/api/git/sync", openapi.Route{Summary: "Export every RBAC object to the git mirror", Response: admin.GitSyncResponse{}})
+
+	describe(http.MethodGet, "/api/directory/groups", openapi.Route{Summary: "Suggest identity provider groups", Query: []openapi.Param{{Name: "query"}}, Response: lookup.GroupsResponse{}})
+
+	describe(http.MethodGet, "/api/watch", openapi.Route{Summary: "Stream changes to RBAC objects as server-sent events, or over a WebSocket when the request upgrades", Query: []openapi.Param{{Name: "kinds"}}, Response: watch.Event{}, ContentType: "text/event-stream"})
+	describe(http.MethodGet, "/api/watch/rbac", openapi.Route{Summary: "Stream changes to RBAC objects as server-sent events", Query: []openapi.Param{{Name: "kinds"}}, Response: watch.Event{}, ContentType: "text/event-stream"})
+	describe(http.MethodGet, "/api/ws", openapi.Route{Summary: "Stream a snapshot and changes of RBAC objects over a WebSocket", Query: []openapi.Param{{Name: "kinds"}}, Response: rbac.SnapshotMessage{}})
+
+	describe(http.MethodGet, "/api/audit-logs", openapi.Route{Summary: "List retained audit log entries, newest first", Query: params(auditFilter, pageParams), Response: auditlogs.Page{}})
+	describe(http.MethodGet, "/api/audit-logs/stream", openapi.Route{Summary: "Stream audit log entries as server-sent events", Query: auditFilter, Response: audit.Entry{}, ContentType: "text/event-stream"})
+	describe(http.MethodGet, "/api/audit-logs/forwarder-status", openapi.Route{Summary: "Get the state of audit log forwarding", Response: audit.ForwarderStatus{}})
+
+	// The version 2 list routes take the same parameters and wrap the same items
+	describeV2 := func(path string, response interface{}) {
+		route := spec.Route(http.MethodGet, "/api"+path)
+		route.Response = response
+		describe(http.MethodGet, "/api/v2"+path, route)
+	}
+	describeV2("/namespaces", listing.List[corev1.Namespace]{})
+	describeV2("/roles", listing.List[rbac.RoleWithStatus]{})
+	describeV2("/rolebindings", listing.List[rbac.RoleBindingWithStatus]{})
+	describeV2("/clusterroles", listing.List[rbacv1.ClusterRole]{})
+	describeV2("/clusterrolebindings", listing.List[rbac.ClusterRoleBindingWithStatus]{})
+	describeV2("/bindings/expiring", listing.List[rbac.ExpiringBinding]{})
+	describeV2("/templates", listing.List[templates.Template]{})
+	describeV2("/serviceaccounts", listing.List[corev1.ServiceAccount]{})
+	describeV2("/users", listing.List[string]{})
+	describeV2("/userroles", listing.List[string]{})
+	describeV2("/groups", listing.List[rbac.GroupSummary]{})
+	describeV2("/subjects/search", listing.List[rbac.SubjectMatch]{})
+
+	describe(http.MethodGet, "/api/openapi.json", openapi.Route{Summary: "This document"})
+	describe(http.MethodGet, "/api/docs", openapi.Route{Summary: "Swagger UI for this document", ContentType: "text/html"})
+
+	describe(http.MethodGet, "/health", openapi.Route{Summary: "Legacy health check"})
+	describe(http.MethodGet, "/healthz", openapi.Route{Summary: "Liveness"})
+	describe(http.MethodGet, "/readyz", openapi.Route{Summary: "Readiness, including whether the Kubernetes API is reachable", Response: health.Report{}})
+	describe(http.MethodGet, "/", openapi.Route{Summary: "Welcome message", Response: message{}})
+
+	describe(http.MethodGet, "/metrics", openapi.Route{Summary: "Prometheus metrics", ContentType: "text/plain"})
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/cmdline", "/debug/pprof/profile", "/debug/pprof/symbol", "/debug/pprof/trace", "/debug/pprof/:profile"} {
+		describe(http.MethodGet, path, openapi.Route{Summary: "Go runtime profiling, with the admin token"})
+	}
+	describe(http.MethodPost, "/debug/pprof/symbol", openapi.Route{Summary: "Go runtime profiling, with the admin token"})
+}
+
+// newSpec returns the spec of the API with every route described.
+func newSpec() *openapi.Spec {
+	spec := openapi.New("Kubeberus", version.Version, httperror.Response{})
+	describeRoutes(spec)
+	return spec
+}
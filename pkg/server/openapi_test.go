@@ -0,0 +1,173 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"rbac/pkg/openapi"
+
+	"github.com/labstack/echo/v4"
+)
+
+// documentedMethods are the methods the document covers; Echo also registers internal pseudo-methods.
+var documentedMethods = map[string]bool{
+	http.MethodGet: true, http.MethodPost: true, http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+}
+
+// schemaTypes are the types an OpenAPI 3.0 schema may declare.
+var schemaTypes = map[string]bool{"": true, "string": true, "number": true, "integer": true, "boolean": true, "array": true, "object": true}
+
+var (
+	// templateParam matches the parameters of an OpenAPI path template.
+	templateParam = regexp.MustCompile(`\{([^}]+)\}`)
+	// routeParam matches the parameters of an Echo path.
+	routeParam = regexp.MustCompile(`:(\w+)`)
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	e, _ := testServer(t, func(c *Config) {
+		c.MetricsEnabled = true
+		c.DebugPprof = true
+	})
+	if missing := newSpec().Undocumented(e.Routes()); len(missing) > 0 {
+		t.Errorf("routes without documentation: %v", missing)
+	}
+
+	rec := serve(e, http.MethodGet, "/api/openapi.json", "", nil)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	var doc openapi.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, route := range e.Routes() {
+		if !documentedMethods[route.Method] {
+			continue
+		}
+		path := routeParam.ReplaceAllString(route.Path, "{$1}")
+		path = strings.Replace(path, "*", "{path}", 1)
+		if doc.Paths[path][strings.ToLower(route.Method)] == nil {
+			t.Errorf("%s %s missing from the document as %s", route.Method, route.Path, path)
+		}
+	}
+	if _, ok := doc.Components.Schemas["httperror.Response"]; !ok {
+		t.Error("error envelope missing from the components")
+	}
+}
+
+func TestOpenAPIDocumentIsValid(t *testing.T) {
+	e, _ := testServer(t, nil)
+	rec := serve(e, http.MethodGet, "/api/openapi.json", "", nil)
+	var doc openapi.Document
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.0.") || doc.Info.Title == "" || doc.Info.Version == "" {
+		t.Errorf("openapi = %q, info = %+v", doc.OpenAPI, doc.Info)
+	}
+
+	// checkSchema checks a schema and those it contains, and that every reference resolves.
+	var checkSchema func(where string, schema *openapi.Schema)
+	checkSchema = func(where string, schema *openapi.Schema) {
+		if schema == nil {
+			t.Errorf("%s: missing schema", where)
+			return
+		}
+		if schema.Ref != "" {
+			name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/")
+			if _, exists := doc.Components.Schemas[name]; !ok || !exists {
+				t.Errorf("%s: unresolved reference %s", where, schema.Ref)
+			}
+		}
+		if !schemaTypes[schema.Type] {
+			t.Errorf("%s: invalid type %q", where, schema.Type)
+		}
+		if schema.Type == "array" && schema.Items == nil {
+			t.Errorf("%s: array without items", where)
+		}
+		if schema.Items != nil {
+			checkSchema(where+"[]", schema.Items)
+		}
+		for name, property := range schema.Properties {
+			checkSchema(where+"."+name, property)
+		}
+		if schema.AdditionalProperties != nil {
+			checkSchema(where+"{}", schema.AdditionalProperties)
+		}
+	}
+	for name, schema := range doc.Components.Schemas {
+		checkSchema(name, schema)
+	}
+
+	for path, operations := range doc.Paths {
+		if !strings.HasPrefix(path, "/") {
+			t.Errorf("path %q doesn't start with /", path)
+		}
+		templated := make(map[string]bool)
+		for _, match := range templateParam.FindAllStringSubmatch(path, -1) {
+			templated[match[1]] = true
+		}
+		for method, op := range operations {
+			where := strings.ToUpper(method) + " " + path
+			if !documentedMethods[strings.ToUpper(method)] {
+				t.Errorf("%s: unknown method", where)
+			}
+			if _, ok := op.Responses["200"]; !ok || op.Responses["default"].Content == nil {
+				t.Errorf("%s: responses = %v, want 200 and the default error", where, op.Responses)
+			}
+			for status, response := range op.Responses {
+				if response.Description == "" {
+					t.Errorf("%s: response %s has no description", where, status)
+				}
+				for contentType, media := range response.Content {
+					checkSchema(where+" "+status+" "+contentType, media.Schema)
+				}
+			}
+			if op.RequestBody != nil {
+				for contentType, media := range op.RequestBody.Content {
+					checkSchema(where+" body "+contentType, media.Schema)
+				}
+			}
+
+			declared := make(map[string]bool)
+			for _, param := range op.Parameters {
+				key := param.In + " " + param.Name
+				if declared[key] {
+					t.Errorf("%s: parameter %s declared twice", where, key)
+				}
+				declared[key] = true
+				switch param.In {
+				case "path":
+					if !templated[param.Name] || !param.Required {
+						t.Errorf("%s: path parameter %s must appear in the path and be required", where, param.Name)
+					}
+				case "query":
+				default:
+					t.Errorf("%s: parameter %s in %q", where, param.Name, param.In)
+				}
+				checkSchema(where+" parameter "+param.Name, param.Schema)
+			}
+			for name := range templated {
+				if !declared["path "+name] {
+					t.Errorf("%s: path parameter %s not declared", where, name)
+				}
+			}
+		}
+	}
+}
+
+func TestOpenAPIDocsPage(t *testing.T) {
+	e, _ := testServer(t, nil)
+	rec := serve(e, http.MethodGet, "/api/docs", "", nil)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "/api/openapi.json") {
+		t.Errorf("/api/docs = %d, want a page loading /api/openapi.json", rec.Code)
+	}
+	if contentType := rec.Header().Get(echo.HeaderContentType); !strings.HasPrefix(contentType, echo.MIMETextHTML) {
+		t.Errorf("Content-Type = %q, want HTML", contentType)
+	}
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"time"
+
+	"rbac/pkg/audit"
+	"rbac/pkg/auth"
+
+	"github.com/labstack/echo/v4"
+	"golang.org/x/time/rate"
+)
+
+// registerPprof mounts the net/http/pprof handlers under /debug/pprof behind the admin token, refusals of
+// which are recorded by auditor.
+// Profiling requests are rate limited so an accidental load test cannot starve the server.
+func registerPprof(e *echo.Echo, adminToken string, auditor *audit.Auditor) {
+	limiter := rate.NewLimiter(rate.Every(5*time.Second), 2)
+	limit := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if !limiter.Allow() {
+				return echo.NewHTTPError(http.StatusTooManyRequests, "Too many profiling requests")
+			}
+			return next(c)
+		}
+	}
+
+	debug := e.Group("/debug/pprof", auditor.Attach(), auth.RequireBearerToken(adminToken), limit)
+	debug.GET("/", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+	debug.GET("/cmdline", echo.WrapHandler(http.HandlerFunc(pprof.Cmdline)))
+	debug.GET("/profile", echo.WrapHandler(http.HandlerFunc(pprof.Profile)))
+	debug.GET("/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	debug.POST("/symbol", echo.WrapHandler(http.HandlerFunc(pprof.Symbol)))
+	debug.GET("/trace", echo.WrapHandler(http.HandlerFunc(pprof.Trace)))
+	debug.GET("/:profile", echo.WrapHandler(http.HandlerFunc(pprof.Index)))
+}
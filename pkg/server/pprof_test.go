@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestPprofDisabled(t *testing.T) {
+	e, _ := testServer(t, nil)
+	admin := http.Header{echo.HeaderAuthorization: {"Bearer admin-token"}}
+	for _, path := range []string{"/debug/pprof/", "/debug/pprof/heap", "/debug/pprof/profile"} {
+		if rec := serve(e, http.MethodGet, path, "", admin); rec.Code != http.StatusNotFound {
+			t.Errorf("%s with profiling disabled = %d, want %d", path, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestPprofRequiresAdminToken(t *testing.T) {
+	config := DefaultConfig()
+	config.DebugPprof = true
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "debugPprof") {
+		t.Errorf("Validate() = %v, want debugPprof refused without an admin token", err)
+	}
+
+	e, _ := testServer(t, func(c *Config) { c.DebugPprof = true })
+	tests := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"no token", nil, http.StatusUnauthorized},
+		{"wrong token", http.Header{echo.HeaderAuthorization: {"Bearer admin-token-2"}}, http.StatusUnauthorized},
+		{"admin token", http.Header{echo.HeaderAuthorization: {"Bearer admin-token"}}, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := serve(e, http.MethodGet, "/debug/pprof/cmdline", "", tt.header); rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestPprofRateLimited(t *testing.T) {
+	e, _ := testServer(t, func(c *Config) { c.DebugPprof = true })
+	admin := http.Header{echo.HeaderAuthorization: {"Bearer admin-token"}}
+
+	// refused requests don't use up the budget of the admin
+	for i := 0; i < 5; i++ {
+		serve(e, http.MethodGet, "/debug/pprof/cmdline", "", nil)
+	}
+	for i := 0; i < 2; i++ {
+		if rec := serve(e, http.MethodGet, "/debug/pprof/cmdline", "", admin); rec.Code != http.StatusOK {
+			t.Fatalf("request %d = %d, want %d", i+1, rec.Code, http.StatusOK)
+		}
+	}
+	if rec := serve(e, http.MethodGet, "/debug/pprof/heap", "", admin); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("request beyond the burst = %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+}
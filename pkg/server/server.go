@@ -1,38 +1,185 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
+	"time"
 
+	"rbac/pkg/audit"
+	"rbac/pkg/auth"
+	"rbac/pkg/cache"
+	"rbac/pkg/deadline"
+	"rbac/pkg/directory"
+	"rbac/pkg/discovery"
+	"rbac/pkg/expiry"
+	"rbac/pkg/frontend"
+	"rbac/pkg/gitops"
+	"rbac/pkg/handlers/admin"
+	"rbac/pkg/handlers/auditlogs"
+	"rbac/pkg/handlers/lookup"
 	"rbac/pkg/handlers/rbac"
+	"rbac/pkg/health"
+	"rbac/pkg/listcache"
+	"rbac/pkg/listing"
+	"rbac/pkg/logging"
+	"rbac/pkg/managed"
+	"rbac/pkg/metrics"
+	"rbac/pkg/protection"
+	"rbac/pkg/ratelimit"
+	"rbac/pkg/readonly"
+	"rbac/pkg/tracing"
+	"rbac/pkg/watch"
 
 	"github.com/labstack/echo/v4"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 )
 
-// Config holds the configuration for the server.
-type Config struct {
-	Port string
-}
+const (
+	// readinessTimeout bounds each readiness dependency check.
+	readinessTimeout = 2 * time.Second
+	// readinessCacheTTL is how long a readiness report is reused across probes.
+	readinessCacheTTL = 2 * time.Second
+)
 
-// NewConfig creates a new configuration with environment variables.
-func NewConfig() *Config {
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+// registerRoutes registers all the routes for the server.
+func (s *Server) registerRoutes(clientset kubernetes.Interface) error {
+	e, config := s.echo, s.config
+	e.HTTPErrorHandler = httpErrorHandler
+	e.IPExtractor = clientIPExtractor(config.TrustedProxies)
+	e.Use(logging.Middleware())
+	e.Use(tracing.Middleware())
+	if config.TLSClientCAFile != "" {
+		e.Use(requireClientCert())
+	}
+	if cors := corsMiddleware(config); cors != nil {
+		e.Use(cors)
 	}
 
-	return &Config{Port: port}
-}
+	// The audit trail records mutations made through the API and failed authentications on any route
+	auditStream := audit.NewStream(config.AuditStreamBacklog)
+	auditSinks := []audit.Sink{audit.NewLogSink(os.Stdout), auditStream, metrics.AuditSink{}}
+
+	var auditForwarder *audit.Forwarder
+	if config.AuditForwardAddress != "" {
+		forwarder, err := audit.NewForwarder(config.AuditForwardAddress, config.AuditForwardFormat, config.AuditForwardQueue)
+		if err != nil {
+			return fmt.Errorf("configuring audit forwarder: %w", err)
+		}
+		s.goWorker(forwarder.Run)
+		auditForwarder = forwarder
+		auditSinks = append(auditSinks, forwarder)
+	}
+
+	// Changes are mirrored into the GitOps repository, when one is configured
+	var gitMirror *gitops.Mirror
+	if config.GitRepoURL != "" {
+		mirror, err := gitops.New(config.gitConfig(), clientset)
+		if err != nil {
+			return fmt.Errorf("configuring git mirror: %w", err)
+		}
+		s.goWorker(mirror.Run)
+		gitMirror = mirror
+		auditSinks = append(auditSinks, mirror)
+	}
+
+	auditor := audit.New(auditSinks...)
+
+	// Metrics are registered first so the middleware observes every route
+	if config.MetricsEnabled {
+		e.Use(metrics.Middleware())
+		e.GET("/metrics", metrics.Handler(config.MetricsToken), auditor.Attach())
+	}
+
+	// Profiling is only ever exposed behind the admin token; Validate refuses DebugPprof without one
+	if config.DebugPprof {
+		registerPprof(e, config.AdminToken, auditor)
+	}
 
-// RegisterRoutes registers all the routes for the server.
-func RegisterRoutes(e *echo.Echo, clientset *kubernetes.Clientset, config *Config) {
 	api := e.Group("/api")
 
+	// Every API request has a time budget, longer for the routes assigned to the list and report classes
+	// below; streams are assigned none
+	deadlines := deadline.New(config.budgets(), config.SlowRequestThreshold.Duration)
+	api.Use(deadlines.Middleware())
+
+	// One set of RBAC informers serves the handler cache, the watch streams and the metrics. The cache's
+	// subject index must be added before they start
+	informerFactory := informers.NewSharedInformerFactory(clientset, 0)
+	var informerCache *cache.Cache
+	if config.InformerCache {
+		informerCache = cache.New(informerFactory)
+		informerFactory.Start(s.workerCtx.Done())
+		s.goWorker(informerCache.Run)
+	}
+	s.goWorker(func(ctx context.Context) {
+		<-ctx.Done()
+		informerFactory.Shutdown()
+	})
+
+	// Long-lived streams are stopped when the server begins shutting down
+	hub := watch.NewHub(s.streamCtx, informerFactory)
+
+	if config.MetricsEnabled {
+		// Without the informer cache the service may not be allowed to watch, so the gauges come from lists
+		source := metrics.ListSource(clientset)
+		if informerCache != nil {
+			source = metrics.InformerSource(hub)
+		}
+		s.goWorker(func(ctx context.Context) {
+			metrics.RunRBACStateCollector(ctx, source, config.MetricsRefreshInterval.Duration)
+		})
+	}
+
+	// Audit every successful mutation made through the API
+	api.Use(auditor.Middleware())
+
+	// Temporary bindings are deleted, and audited, once they expire
+	if config.BindingReaperInterval.Duration > 0 {
+		s.goWorker(expiry.NewReaper(clientset, auditor, config.BindingReaperInterval.Duration).Run)
+	}
+
+	// Every API request counts against the client's default bucket; endpoints that aggregate
+	// across the whole cluster also count against a stricter one
+	api.Use(ratelimit.Middleware(ratelimit.New(config.RateLimitRPS, config.RateLimitBurst)))
+	expensive := ratelimit.Middleware(ratelimit.New(config.RateLimitExpensiveRPS, config.RateLimitExpensiveBurst))
+
+	// Read-only mode refuses every mutation except switching the mode itself, and the renders and
+	// validations that only look like mutations
+	readOnly := readonly.New(config.ReadOnly)
+	api.Use(readOnly.Middleware("/api/admin/read-only", "/api/cache/flush", "/api/git/sync", "/api/templates/:id/render", "/api/roles/validate", "/api/validate", "/api/simulate"))
+
+	// Objects owned by another manager, such as a GitOps controller, are changed with a warning or not at all
+	api.Use(managed.Middleware(config.RefuseForeignManaged))
+
+	// System objects can only be changed by an admin who explicitly overrides the protection
+	guard, err := protection.New(config.ProtectedNamePatterns, config.AdminToken)
+	if err != nil {
+		return fmt.Errorf("configuring protected objects: %w", err)
+	}
+	api.Use(guard.Middleware())
+
+	// Role rules are checked against what the cluster serves, so typos come back as warnings
+	discoveryCache := discovery.NewCache(clientset.Discovery(), config.DiscoveryCacheTTL.Duration)
+	api.Use(discoveryCache.Middleware())
+
+	// Handlers needing every role or binding read them from informers once they have synced
+	if informerCache != nil {
+		api.Use(informerCache.Middleware())
+	}
+
+	// ?noCache=true sends the LIST calls of a request to the API server instead of the list and informer
+	// caches
+	api.Use(listcache.Middleware())
+
 	// Namespace routes
 	api.GET("/namespaces", rbac.NamespacesHandler(clientset))
 	api.POST("/namespaces", rbac.NamespacesHandler(clientset))
 	api.DELETE("/namespaces", rbac.NamespacesHandler(clientset))
+	api.GET("/namespaces/details", rbac.NamespaceDetailsHandler(clientset))
 
 	// Role routes
 	api.GET("/roles", rbac.RolesHandler(clientset))
@@ -40,6 +187,11 @@ func RegisterRoutes(e *echo.Echo, clientset *kubernetes.Clientset, config *Confi
 	api.PUT("/roles", rbac.RolesHandler(clientset))
 	api.DELETE("/roles", rbac.RolesHandler(clientset))
 	api.GET("/roles/details", rbac.RoleDetailsHandler(clientset))
+	deadlines.Assign(deadline.List, api.GET("/roles/all", rbac.RolesOverviewHandler(clientset, config.ScanConcurrency), expensive))
+	api.POST("/roles/validate", rbac.ValidateRulesHandler(discoveryCache))
+
+	// Manifest validation routes; dry runs still reach the API server
+	deadlines.Assign(deadline.Report, api.POST("/validate", rbac.ValidateManifestsHandler(clientset, discoveryCache), expensive))
 
 	// Role binding routes
 	api.GET("/rolebindings", rbac.RoleBindingsHandler(clientset))
@@ -62,30 +214,148 @@ func RegisterRoutes(e *echo.Echo, clientset *kubernetes.Clientset, config *Confi
 	api.DELETE("/clusterrolebindings", rbac.ClusterRoleBindingsHandler(clientset))
 	api.GET("/clusterrolebinding/details", rbac.ClusterRoleBindingDetailsHandler(clientset))
 
+	// Temporary binding routes
+	api.GET("/bindings/expiring", rbac.ExpiringBindingsHandler(clientset))
+
+	// Role template routes
+	api.GET("/templates", rbac.TemplatesHandler())
+	api.GET("/templates/:id", rbac.TemplateHandler())
+	api.POST("/templates/:id/render", rbac.RenderTemplateHandler())
+	api.POST("/templates/:id/apply", rbac.ApplyTemplateHandler(clientset))
+
 	// Service account routes
 	api.GET("/serviceaccounts", rbac.ServiceAccountsHandler(clientset))
 	api.POST("/serviceaccounts", rbac.ServiceAccountsHandler(clientset))
 	api.DELETE("/serviceaccounts", rbac.ServiceAccountsHandler(clientset))
 	api.GET("/serviceaccount-details", rbac.ServiceAccountDetailsHandler(clientset))
+	deadlines.Assign(deadline.Report, api.GET("/serviceaccounts/usage", rbac.ServiceAccountUsageHandler(clientset), expensive))
 
 	// Resource routes
 	api.GET("/resources", rbac.APIResourcesHandler(clientset))
+	api.GET("/discovery/resources", rbac.DiscoveryResourcesHandler(discoveryCache))
 
 	// User routes
-	api.GET("/users", rbac.UsersHandler(clientset))
-	api.GET("/userroles", rbac.UserRolesHandler(clientset))
+	deadlines.Assign(deadline.List,
+		api.GET("/users", rbac.UsersHandler(clientset), expensive),
+		api.GET("/userroles", rbac.UserRolesHandler(clientset), expensive),
+		api.GET("/users/details", rbac.UserDetailsHandler(clientset), expensive),
+	)
 
 	// Group routes
-	api.GET("/groups", rbac.GroupsHandler(clientset))
-	api.GET("/groupdetails", rbac.GroupDetailsHandler(clientset))
+	deadlines.Assign(deadline.List,
+		api.GET("/groups", rbac.GroupsHandler(clientset), expensive),
+		api.GET("/groupdetails", rbac.GroupDetailsHandler(clientset), expensive),
+	)
+
+	// Subject routes
+	deadlines.Assign(deadline.List, api.GET("/subjects/search", rbac.SubjectSearchHandler(clientset), expensive))
+	deadlines.Assign(deadline.Report, api.GET("/subjects/:kind/:name/permissions", rbac.SubjectPermissionsHandler(clientset), expensive))
+
+	// Access analysis routes
+	deadlines.Assign(deadline.Report,
+		api.GET("/matrix", rbac.MatrixHandler(clientset, discoveryCache), expensive),
+		api.GET("/access/effective", rbac.EffectiveAccessHandler(clientset), expensive),
+		api.GET("/who-can", rbac.WhoCanHandler(clientset, discoveryCache), expensive),
+		api.GET("/graph", rbac.GraphHandler(clientset), expensive),
+	)
+	api.POST("/simulate", rbac.SimulateHandler(clientset), expensive)
+
+	// Suggestion routes
+	deadlines.Assign(deadline.Report,
+		api.GET("/suggestions/consolidation", rbac.ConsolidationSuggestionsHandler(clientset), expensive),
+		api.POST("/suggestions/consolidation/:id/apply", rbac.ApplyConsolidationHandler(clientset), expensive),
+	)
+
+	// Report routes
+	deadlines.Assign(deadline.Report, api.GET("/reports/namespace-admins", rbac.NamespaceAdminsHandler(clientset), expensive))
 
-	// Health check endpoint
+	// Export routes
+	deadlines.Assign(deadline.Report,
+		api.GET("/export/terraform", rbac.TerraformExportHandler(clientset), expensive),
+		api.GET("/export/terraform/cluster", rbac.ClusterTerraformExportHandler(clientset), expensive),
+	)
+
+	// Search routes
+	deadlines.Assign(deadline.List, api.GET("/search", rbac.SearchHandler(clientset), expensive))
+
+	// Version 2 list routes answer the same queries wrapped in an envelope with totals, continue tokens and
+	// warnings; the routes above keep returning bare arrays for the current frontend
+	v2 := api.Group("/v2", listing.Middleware())
+	v2.GET("/namespaces", rbac.NamespacesHandler(clientset))
+	v2.GET("/roles", rbac.RolesHandler(clientset))
+	v2.GET("/rolebindings", rbac.RoleBindingsHandler(clientset))
+	v2.GET("/clusterroles", rbac.ClusterRolesHandler(clientset))
+	v2.GET("/clusterrolebindings", rbac.ClusterRoleBindingsHandler(clientset))
+	v2.GET("/bindings/expiring", rbac.ExpiringBindingsHandler(clientset))
+	v2.GET("/templates", rbac.TemplatesHandler())
+	v2.GET("/serviceaccounts", rbac.ServiceAccountsHandler(clientset))
+	deadlines.Assign(deadline.List,
+		v2.GET("/users", rbac.UsersHandler(clientset), expensive),
+		v2.GET("/userroles", rbac.UserRolesHandler(clientset), expensive),
+		v2.GET("/groups", rbac.GroupsHandler(clientset), expensive),
+		v2.GET("/subjects/search", rbac.SubjectSearchHandler(clientset), expensive),
+	)
+
+	// Admin routes
+	adminAPI := api.Group("/admin", auth.RequireBearerToken(config.AdminToken))
+	adminAPI.GET("/read-only", admin.ReadOnlyStatusHandler(readOnly))
+	adminAPI.POST("/read-only", admin.ReadOnlyHandler(readOnly))
+	api.POST("/cache/flush", admin.FlushCacheHandler(s.listCache), auth.RequireBearerToken(config.AdminToken))
+	api.GET("/git/status", admin.GitStatusHandler(gitMirror))
+	api.POST("/git/sync", admin.GitSyncHandler(gitMirror), auth.RequireBearerToken(config.AdminToken))
+
+	// Directory routes
+	directoryClient, err := directory.New(config.directoryConfig())
+	if err != nil {
+		return fmt.Errorf("configuring directory lookup: %w", err)
+	}
+	api.GET("/directory/groups", lookup.DirectoryGroupsHandler(directoryClient))
+
+	// Watch routes
+	watchSSE := rbac.WatchRBACHandler(hub)
+	watchWS := rbac.WebSocketHandler(hub, config.WSMaxConnsPerClient)
+	deadlines.Assign(deadline.Unbounded,
+		api.GET("/watch", s.trackStream(rbac.WatchHandler(watchSSE, watchWS))),
+		api.GET("/watch/rbac", s.trackStream(watchSSE)),
+		api.GET("/ws", s.trackStream(watchWS)),
+	)
+
+	// Audit log routes
+	api.GET("/audit-logs", auditlogs.ListHandler(auditStream))
+	deadlines.Assign(deadline.Unbounded, api.GET("/audit-logs/stream", s.trackStream(auditlogs.StreamHandler(auditStream, s.streamCtx.Done()))))
+	api.GET("/audit-logs/forwarder-status", auditlogs.ForwarderStatusHandler(auditForwarder))
+
+	// Health check endpoints. /health is kept for existing probes; /healthz reports liveness
+	// and /readyz reports whether the Kubernetes API is reachable with our credentials.
 	e.GET("/health", func(c echo.Context) error {
 		return c.String(http.StatusOK, "OK")
 	})
+	readiness := health.NewChecker(readinessTimeout, readinessCacheTTL, health.KubernetesCheck(clientset))
+	e.GET("/healthz", health.LivenessHandler())
+	e.GET("/readyz", readiness.ReadinessHandler())
 
-	// Root URL handler
-	e.GET("/", func(c echo.Context) error {
-		return c.JSON(http.StatusOK, map[string]string{"message": "Welcome to the Kubeberus"})
-	})
+	// The frontend, when served, takes every path no route matches, the root included; the API's own
+	// unmatched paths still get a 404 from their group
+	if config.StaticDir != "" {
+		site, err := frontend.New(os.DirFS(config.StaticDir))
+		if err != nil {
+			return fmt.Errorf("configuring frontend: %w", err)
+		}
+		e.RouteNotFound("/*", site.Handler())
+	} else {
+		// Root URL handler
+		e.GET("/", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, map[string]string{"message": "Welcome to the Kubeberus"})
+		})
+	}
+
+	// API documentation, generated from the routes above the first time it is requested
+	spec := newSpec()
+	api.GET("/openapi.json", spec.Handler(e))
+	api.GET("/docs", spec.DocsHandler("/api/openapi.json"))
+	for _, route := range spec.Undocumented(e.Routes()) {
+		slog.Warn("Route is missing from the OpenAPI document", "route", route)
+	}
+
+	return nil
 }
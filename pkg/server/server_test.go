@@ -0,0 +1,303 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"rbac/pkg/listcache"
+
+	"github.com/labstack/echo/v4"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// testServer builds a server over a fake cluster holding a role and a binding, with the defaults changed
+// by configure, and returns its router.
+func testServer(t *testing.T, configure func(*Config)) (*echo.Echo, *fake.Clientset) {
+	t.Helper()
+	s, clientset := newTestServer(t, configure)
+	return s.echo, clientset
+}
+
+// newTestServer builds the server behind testServer.
+func newTestServer(t *testing.T, configure func(*Config)) (*Server, *fake.Clientset) {
+	t.Helper()
+	config := DefaultConfig()
+	config.AdminToken = "admin-token"
+	if configure != nil {
+		configure(config)
+	}
+	clientset := fake.NewSimpleClientset(
+		&rbacv1.Role{
+			ObjectMeta: metav1.ObjectMeta{Name: "deployer", Namespace: "default"},
+			Rules:      []rbacv1.PolicyRule{{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get"}}},
+		},
+		&rbacv1.RoleBinding{
+			ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "default"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "deployer"},
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.UserKind, Name: "alice"}},
+		},
+	)
+
+	s, err := New(echo.New(), clientset, listcache.New(0), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.stopStreams()
+		s.stopWorkers()
+		s.workers.Wait()
+	})
+	return s, clientset
+}
+
+// serve sends a request to e and returns the response.
+func serve(e *echo.Echo, method, target, body string, header http.Header) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// verbs lists the verbs clientset received for resource.
+func verbs(clientset *fake.Clientset, resource string) []string {
+	var verbs []string
+	for _, action := range clientset.Actions() {
+		if action.GetResource().Resource == resource {
+			verbs = append(verbs, action.GetVerb())
+		}
+	}
+	return verbs
+}
+
+func TestEveryRouteResponds(t *testing.T) {
+	e, _ := testServer(t, func(c *Config) {
+		c.MetricsEnabled = true
+		c.DebugPprof = true
+	})
+	var mu sync.Mutex
+	var matched string
+	e.Use(func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			mu.Lock()
+			matched = c.Path()
+			mu.Unlock()
+			return next(c)
+		}
+	})
+	// Streams and the WebSocket need a real connection, and end when the client gives up on them
+	server := httptest.NewServer(e)
+	defer server.Close()
+	client := &http.Client{Timeout: 500 * time.Millisecond}
+
+	params := strings.NewReplacer(":id", "namespace-viewer", ":kind", "user", ":name", "alice", ":profile", "heap")
+	for _, route := range e.Routes() {
+		// The readiness probe asks a live API server for its version, which the fake clientset can't serve
+		if route.Method == echo.RouteNotFound || route.Path == "/readyz" {
+			continue
+		}
+		t.Run(route.Method+" "+route.Path, func(t *testing.T) {
+			mu.Lock()
+			matched = ""
+			mu.Unlock()
+			req, err := http.NewRequest(route.Method, server.URL+params.Replace(route.Path), strings.NewReader("{}"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			resp, err := client.Do(req)
+			if err == nil {
+				resp.Body.Close()
+			} else if !errors.Is(err, context.DeadlineExceeded) && !os.IsTimeout(err) {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if matched != route.Path {
+				t.Errorf("request matched %q", matched)
+			}
+			if resp != nil && (resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusMethodNotAllowed) {
+				t.Errorf("status = %d", resp.StatusCode)
+			}
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	t.Run("rate limit answers before the handler", func(t *testing.T) {
+		e, clientset := testServer(t, func(c *Config) {
+			c.RateLimitRPS = 0.01
+			c.RateLimitBurst = 1
+		})
+		if rec := serve(e, http.MethodGet, "/api/roles?namespace=default", "", nil); rec.Code != http.StatusOK {
+			t.Fatalf("first request status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+		rec := serve(e, http.MethodGet, "/api/roles?namespace=default", "", nil)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Fatalf("second request status = %d, want %d", rec.Code, http.StatusTooManyRequests)
+		}
+		if rec.Header().Get("Retry-After") == "" {
+			t.Error("429 has no Retry-After header")
+		}
+		// Logging runs on the whole router, so even a rejected request can be traced
+		if rec.Header().Get(echo.HeaderXRequestID) == "" {
+			t.Error("429 has no X-Request-ID header")
+		}
+		if lists := verbs(clientset, "roles"); len(lists) != 1 {
+			t.Errorf("roles received %v, want one list", lists)
+		}
+	})
+
+	t.Run("CORS preflight answers before the rate limit", func(t *testing.T) {
+		e, _ := testServer(t, func(c *Config) {
+			c.CORSAllowedOrigins = []string{"https://rbac.example.com"}
+			c.RateLimitRPS = 0.01
+			c.RateLimitBurst = 1
+		})
+		preflight := http.Header{
+			echo.HeaderOrigin:                     {"https://rbac.example.com"},
+			echo.HeaderAccessControlRequestMethod: {http.MethodDelete},
+		}
+		for i := 0; i < 3; i++ {
+			rec := serve(e, http.MethodOptions, "/api/roles", "", preflight)
+			if rec.Code != http.StatusNoContent || rec.Header().Get(echo.HeaderAccessControlAllowOrigin) == "" {
+				t.Fatalf("preflight %d status = %d, allowed origin %q", i, rec.Code, rec.Header().Get(echo.HeaderAccessControlAllowOrigin))
+			}
+		}
+		if rec := serve(e, http.MethodGet, "/api/roles?namespace=default", "", nil); rec.Code != http.StatusOK {
+			t.Errorf("request after preflights status = %d, want %d; preflights used up the rate limit", rec.Code, http.StatusOK)
+		}
+	})
+
+	t.Run("read-only mode refuses changes before the handler", func(t *testing.T) {
+		e, clientset := testServer(t, func(c *Config) { c.ReadOnly = true })
+		role := `{"metadata":{"name":"viewer","namespace":"default"},"rules":[{"apiGroups":[""],"resources":["pods"],"verbs":["get"]}]}`
+		if rec := serve(e, http.MethodPost, "/api/roles?namespace=default", role, nil); rec.Code != http.StatusLocked {
+			t.Errorf("status = %d, want %d: %s", rec.Code, http.StatusLocked, rec.Body)
+		}
+		if changes := verbs(clientset, "roles"); len(changes) != 0 {
+			t.Errorf("roles received %v in read-only mode", changes)
+		}
+		// Checks that don't change the cluster stay open
+		if rec := serve(e, http.MethodPost, "/api/roles/validate", role, nil); rec.Code != http.StatusOK {
+			t.Errorf("validate status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+		}
+	})
+
+	t.Run("admin routes need the admin token", func(t *testing.T) {
+		e, _ := testServer(t, nil)
+		token := http.Header{echo.HeaderAuthorization: {"Bearer admin-token"}}
+		for _, route := range []struct{ method, path string }{
+			{http.MethodPost, "/api/cache/flush"},
+			{http.MethodGet, "/api/admin/read-only"},
+		} {
+			if rec := serve(e, route.method, route.path, "", nil); rec.Code != http.StatusUnauthorized {
+				t.Errorf("%s %s status without token = %d, want %d", route.method, route.path, rec.Code, http.StatusUnauthorized)
+			}
+			if rec := serve(e, route.method, route.path, "", token); rec.Code != http.StatusOK {
+				t.Errorf("%s %s status with token = %d, want %d: %s", route.method, route.path, rec.Code, http.StatusOK, rec.Body)
+			}
+		}
+	})
+
+	t.Run("errors use the envelope", func(t *testing.T) {
+		e, _ := testServer(t, nil)
+		rec := serve(e, http.MethodGet, "/api/roles/details?namespace=default&roleName=missing", "", nil)
+		if rec.Code != http.StatusNotFound {
+			t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusNotFound, rec.Body)
+		}
+		var envelope struct {
+			Code      string `json:"code"`
+			Message   string `json:"message"`
+			RequestID string `json:"requestId"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &envelope); err != nil {
+			t.Fatal(err)
+		}
+		if envelope.Code == "" || envelope.Message == "" || envelope.RequestID != rec.Header().Get(echo.HeaderXRequestID) {
+			t.Errorf("envelope = %+v, request ID header %q", envelope, rec.Header().Get(echo.HeaderXRequestID))
+		}
+	})
+}
+
+func TestAuthFailuresOutsideAPIAudited(t *testing.T) {
+	e, _ := testServer(t, func(c *Config) {
+		c.MetricsEnabled = true
+		c.MetricsToken = "metrics-token"
+		c.DebugPprof = true
+	})
+	wrong := http.Header{echo.HeaderAuthorization: {"Bearer wrong"}}
+	if rec := serve(e, http.MethodGet, "/metrics", "", nil); rec.Code != http.StatusUnauthorized {
+		t.Errorf("/metrics without token = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := serve(e, http.MethodGet, "/debug/pprof/heap", "", wrong); rec.Code != http.StatusUnauthorized {
+		t.Errorf("/debug/pprof/heap with a wrong token = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+	if rec := serve(e, http.MethodGet, "/metrics", "", http.Header{echo.HeaderAuthorization: {"Bearer metrics-token"}}); rec.Code != http.StatusOK {
+		t.Errorf("/metrics with token = %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	rec := serve(e, http.MethodGet, "/api/audit-logs?category=auth", "", nil)
+	var page struct {
+		Entries []struct {
+			Action string `json:"action"`
+			Route  string `json:"route"`
+			Reason string `json:"reason"`
+		} `json:"entries"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]string)
+	for _, entry := range page.Entries {
+		if entry.Action == "auth_failed" {
+			found[entry.Route] = entry.Reason
+		}
+	}
+	if found["/metrics"] != "missing_token" || found["/debug/pprof/:profile"] != "invalid_token" || len(found) != 2 {
+		t.Errorf("auth failures recorded = %v, want /metrics missing_token and /debug/pprof/:profile invalid_token", found)
+	}
+}
+
+func TestFrontendDoesNotShadowServerRoutes(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "index.html"), []byte("<html>index</html>"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	e, _ := testServer(t, func(c *Config) { c.StaticDir = dir })
+
+	tests := []struct {
+		target      string
+		wantStatus  int
+		wantContent string
+	}{
+		{"/", http.StatusOK, echo.MIMETextHTML},
+		{"/roles/default/deployer", http.StatusOK, echo.MIMETextHTML},
+		{"/api/roles?namespace=default", http.StatusOK, echo.MIMEApplicationJSON},
+		{"/api/no-such-route", http.StatusNotFound, echo.MIMEApplicationJSON},
+		{"/healthz", http.StatusOK, echo.MIMEApplicationJSON},
+		{"/health", http.StatusOK, echo.MIMETextPlain},
+		{"/metrics", http.StatusNotFound, echo.MIMEApplicationJSON},
+	}
+	for _, tt := range tests {
+		rec := serve(e, http.MethodGet, tt.target, "", nil)
+		if rec.Code != tt.wantStatus || !strings.HasPrefix(rec.Header().Get(echo.HeaderContentType), tt.wantContent) {
+			t.Errorf("%s = %d %s, want %d %s", tt.target, rec.Code, rec.Header().Get(echo.HeaderContentType), tt.wantStatus, tt.wantContent)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"rbac/pkg/listcache"
+
+	"github.com/labstack/echo/v4"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+// keyPair is a certificate and its key.
+type keyPair struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	tls  tls.Certificate
+}
+
+// issue creates a certificate for name signed by parent, or self-signed as a CA when parent is nil.
+func issue(t *testing.T, name string, parent *keyPair) *keyPair {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{name},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &keyPair{cert: cert, key: key, tls: tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}}
+}
+
+// write stores the pair as PEM files in dir and returns their paths.
+func (p *keyPair) write(t *testing.T, dir, name string) (string, string) {
+	t.Helper()
+	keyDER, err := x509.MarshalECPrivateKey(p.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.cert.Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
+
+// serving returns the serial number of the certificate r serves.
+func serving(t *testing.T, r *certReloader) *big.Int {
+	t.Helper()
+	cert, err := r.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber
+}
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	first := issue(t, "rbac.example.com", nil)
+	certFile, keyFile := first.write(t, dir, "server")
+
+	r, err := newCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serving(t, r).Cmp(first.cert.SerialNumber) != 0 {
+		t.Fatal("reloader doesn't serve the loaded certificate")
+	}
+
+	// A rotation is picked up at the next check, not before
+	second := issue(t, "rbac.example.com", nil)
+	second.write(t, dir, "server")
+	later := time.Now().Add(time.Minute)
+	for _, file := range []string{certFile, keyFile} {
+		if err := os.Chtimes(file, later, later); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if serving(t, r).Cmp(first.cert.SerialNumber) != 0 {
+		t.Error("certificate reloaded before the check interval")
+	}
+	r.lastCheck = time.Time{}
+	if serving(t, r).Cmp(second.cert.SerialNumber) != 0 {
+		t.Error("rotated certificate not reloaded")
+	}
+
+	// A broken rotation keeps the previous certificate
+	if err := os.WriteFile(keyFile, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	evenLater := later.Add(time.Minute)
+	if err := os.Chtimes(keyFile, evenLater, evenLater); err != nil {
+		t.Fatal(err)
+	}
+	r.lastCheck = time.Time{}
+	if serving(t, r).Cmp(second.cert.SerialNumber) != 0 {
+		t.Error("failed reload dropped the previous certificate")
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := issue(t, "rbac.example.com", nil).write(t, dir, "server")
+	caFile, _ := issue(t, "clients", nil).write(t, dir, "ca")
+	emptyCA := filepath.Join(dir, "empty.crt")
+	if err := os.WriteFile(emptyCA, []byte("no certificates here"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		config     Config
+		wantErr    bool
+		clientAuth tls.ClientAuthType
+	}{
+		{"server only", Config{TLSCertFile: certFile, TLSKeyFile: keyFile}, false, tls.NoClientCert},
+		{"client CA", Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCAFile: caFile}, false, tls.VerifyClientCertIfGiven},
+		{"missing key", Config{TLSCertFile: certFile}, true, 0},
+		{"unreadable key pair", Config{TLSCertFile: certFile, TLSKeyFile: filepath.Join(dir, "missing.key")}, true, 0},
+		{"CA without certificates", Config{TLSCertFile: certFile, TLSKeyFile: keyFile, TLSClientCAFile: emptyCA}, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tlsConfig, err := NewTLSConfig(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && tlsConfig.ClientAuth != tt.clientAuth {
+				t.Errorf("ClientAuth = %v, want %v", tlsConfig.ClientAuth, tt.clientAuth)
+			}
+		})
+	}
+}
+
+func TestClientCertRequiredExceptProbes(t *testing.T) {
+	dir := t.TempDir()
+	ca := issue(t, "clients", nil)
+	caFile, _ := ca.write(t, dir, "ca")
+	certFile, keyFile := issue(t, "127.0.0.1", nil).write(t, dir, "server")
+
+	config := DefaultConfig()
+	config.TLSCertFile, config.TLSKeyFile, config.TLSClientCAFile = certFile, keyFile, caFile
+	e := echo.New()
+	s, err := New(e, fake.NewSimpleClientset(), listcache.New(0), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		s.stopStreams()
+		s.stopWorkers()
+		s.workers.Wait()
+	})
+	server := httptest.NewUnstartedServer(e)
+	server.TLS = e.TLSServer.TLSConfig
+	server.StartTLS()
+	defer server.Close()
+
+	// client presents cert whether or not the server lists its issuer as acceptable.
+	client := func(cert *tls.Certificate) *http.Client {
+		tlsConfig := &tls.Config{InsecureSkipVerify: true}
+		if cert != nil {
+			tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) { return cert, nil }
+		}
+		return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	}
+	get := func(client *http.Client, path string) int {
+		t.Helper()
+		resp, err := client.Get(server.URL + path)
+		if err != nil {
+			return 0
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	anonymous := client(nil)
+	for _, probe := range []string{"/health", "/healthz"} {
+		if code := get(anonymous, probe); code != http.StatusOK {
+			t.Errorf("%s without a client certificate = %d, want %d", probe, code, http.StatusOK)
+		}
+	}
+	if code := get(anonymous, "/api/roles"); code != http.StatusUnauthorized {
+		t.Errorf("/api/roles without a client certificate = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code := get(client(&issue(t, "alice", ca).tls), "/api/roles"); code != http.StatusOK {
+		t.Errorf("/api/roles with a client certificate = %d, want %d", code, http.StatusOK)
+	}
+	// A certificate from another CA fails the handshake
+	if code := get(client(&issue(t, "mallory", issue(t, "other", nil)).tls), "/healthz"); code != 0 {
+		t.Errorf("/healthz with an untrusted client certificate = %d, want a failed handshake", code)
+	}
+}
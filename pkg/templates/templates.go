@@ -0,0 +1,187 @@
+package templates
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// placeholder matches a ${name} placeholder in a template.
+var placeholder = regexp.MustCompile(`\$\{(\w+)\}`)
+
+// Parameter is a value a template needs before it can be rendered.
+type Parameter struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Template is a role and a binding granting it, with ${name} placeholders in their string fields.
+type Template struct {
+	ID          string             `json:"id"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	BuiltIn     bool               `json:"builtIn"`
+	Parameters  []Parameter        `json:"parameters"`
+	Role        rbacv1.Role        `json:"role"`
+	RoleBinding rbacv1.RoleBinding `json:"roleBinding"`
+}
+
+// Rendered holds the objects a template produces for a set of parameters.
+type Rendered struct {
+	Role        *rbacv1.Role        `json:"role"`
+	RoleBinding *rbacv1.RoleBinding `json:"roleBinding"`
+}
+
+// subjectParameters are shared by every built-in template, which binds its role to a single subject.
+var subjectParameters = []Parameter{
+	{Name: "namespace", Description: "Namespace the role and binding are created in"},
+	{Name: "subjectKind", Description: "User, Group or ServiceAccount"},
+	{Name: "subjectName", Description: "Name of the user, group or service account in the namespace"},
+}
+
+// builtIns are the templates shipped with the tool. They cannot be changed or deleted.
+var builtIns = []Template{
+	{
+		ID:          "namespace-viewer",
+		Name:        "Namespace viewer",
+		Description: "Read-only access to the common workload resources of a namespace, excluding secrets",
+		Parameters:  subjectParameters,
+		Role: newRole("namespace-viewer", []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"pods", "pods/log", "services", "endpoints", "configmaps", "persistentvolumeclaims", "events"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{"apps"}, Resources: []string{"deployments", "replicasets", "statefulsets", "daemonsets"}, Verbs: []string{"get", "list", "watch"}},
+			{APIGroups: []string{"batch"}, Resources: []string{"jobs", "cronjobs"}, Verbs: []string{"get", "list", "watch"}},
+		}),
+	},
+	{
+		ID:          "deployer",
+		Name:        "Deployer",
+		Description: "Manage deployments, services and configuration in a namespace, as a CI pipeline needs",
+		Parameters:  subjectParameters,
+		Role: newRole("deployer", []rbacv1.PolicyRule{
+			{APIGroups: []string{"apps"}, Resources: []string{"deployments", "replicasets"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete"}},
+			{APIGroups: []string{""}, Resources: []string{"services", "configmaps"}, Verbs: []string{"get", "list", "watch", "create", "update", "patch", "delete"}},
+			{APIGroups: []string{""}, Resources: []string{"pods", "pods/log"}, Verbs: []string{"get", "list", "watch"}},
+		}),
+	},
+	{
+		ID:          "secrets-reader",
+		Name:        "Secrets reader",
+		Description: "Read a single named secret in a namespace",
+		Parameters: append(append([]Parameter{}, subjectParameters...),
+			Parameter{Name: "secretName", Description: "Name of the secret that may be read"}),
+		Role: newRole("secrets-reader-${secretName}", []rbacv1.PolicyRule{
+			{APIGroups: []string{""}, Resources: []string{"secrets"}, ResourceNames: []string{"${secretName}"}, Verbs: []string{"get"}},
+		}),
+	},
+}
+
+func init() {
+	for i := range builtIns {
+		t := &builtIns[i]
+		t.BuiltIn = true
+		t.RoleBinding = rbacv1.RoleBinding{
+			TypeMeta:   metav1.TypeMeta{Kind: "RoleBinding", APIVersion: rbacv1.SchemeGroupVersion.String()},
+			ObjectMeta: metav1.ObjectMeta{Name: t.Role.Name + "-${subjectName}", Namespace: "${namespace}"},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: t.Role.Name},
+			Subjects:   []rbacv1.Subject{{Kind: "${subjectKind}", Name: "${subjectName}"}},
+		}
+	}
+}
+
+// newRole returns a templated role called name in the ${namespace} namespace.
+func newRole(name string, rules []rbacv1.PolicyRule) rbacv1.Role {
+	return rbacv1.Role{
+		TypeMeta:   metav1.TypeMeta{Kind: "Role", APIVersion: rbacv1.SchemeGroupVersion.String()},
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "${namespace}"},
+		Rules:      rules,
+	}
+}
+
+// List returns every template.
+func List() []Template {
+	return builtIns
+}
+
+// Get returns the template with id.
+func Get(id string) (Template, bool) {
+	for _, t := range builtIns {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Template{}, false
+}
+
+// Render fills the template's placeholders with params. Every declared parameter must be supplied and no
+// others may be.
+func Render(t Template, params map[string]string) (*Rendered, error) {
+	declared := make(map[string]bool, len(t.Parameters))
+	var missing []string
+	for _, p := range t.Parameters {
+		declared[p.Name] = true
+		if params[p.Name] == "" {
+			missing = append(missing, p.Name)
+		}
+	}
+	var unknown []string
+	for name := range params {
+		if !declared[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	switch {
+	case len(missing) > 0:
+		return nil, fmt.Errorf("missing parameters: %s", strings.Join(missing, ", "))
+	case len(unknown) > 0:
+		return nil, fmt.Errorf("unknown parameters: %s", strings.Join(unknown, ", "))
+	}
+
+	role := &rbacv1.Role{}
+	if err := fill(t.Role, params, role); err != nil {
+		return nil, err
+	}
+	binding := &rbacv1.RoleBinding{}
+	if err := fill(t.RoleBinding, params, binding); err != nil {
+		return nil, err
+	}
+	if err := completeSubjects(binding); err != nil {
+		return nil, err
+	}
+	return &Rendered{Role: role, RoleBinding: binding}, nil
+}
+
+// fill substitutes params into the string fields of in and decodes the result into out.
+func fill(in interface{}, params map[string]string, out interface{}) error {
+	data, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	data = placeholder.ReplaceAllFunc(data, func(match []byte) []byte {
+		// the values land inside JSON strings, so they are escaped as such
+		value, _ := json.Marshal(params[string(placeholder.FindSubmatch(match)[1])])
+		return value[1 : len(value)-1]
+	})
+	return json.Unmarshal(data, out)
+}
+
+// completeSubjects fills in the API group or namespace each subject kind requires.
+func completeSubjects(binding *rbacv1.RoleBinding) error {
+	for i := range binding.Subjects {
+		subject := &binding.Subjects[i]
+		switch subject.Kind {
+		case rbacv1.UserKind, rbacv1.GroupKind:
+			subject.APIGroup = rbacv1.GroupName
+		case rbacv1.ServiceAccountKind:
+			subject.Namespace = binding.Namespace
+		default:
+			return fmt.Errorf("subjectKind must be %s, %s or %s", rbacv1.UserKind, rbacv1.GroupKind, rbacv1.ServiceAccountKind)
+		}
+	}
+	return nil
+}
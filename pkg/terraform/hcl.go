@@ -0,0 +1,247 @@
+package terraform
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// indentUnit is the indentation of one nesting level, as terraform fmt writes it.
+const indentUnit = "  "
+
+// attr is an attribute and its rendered value; an empty value omits the attribute.
+type attr struct {
+	name  string
+	value string
+}
+
+// block writes the body of an HCL block.
+type block struct {
+	out   strings.Builder
+	depth int
+}
+
+func newBlock() *block {
+	return &block{depth: 1}
+}
+
+func (b *block) String() string {
+	return b.out.String()
+}
+
+func (b *block) line(text string) {
+	b.out.WriteString(strings.Repeat(indentUnit, b.depth) + text + "\n")
+}
+
+func (b *block) comment(text string) {
+	b.line("# " + text)
+}
+
+func (b *block) open(name string) {
+	b.line(name + " {")
+	b.depth++
+}
+
+func (b *block) close() {
+	b.depth--
+	b.line("}")
+}
+
+// attrs writes consecutive attributes with their equals signs aligned, as terraform fmt does.
+func (b *block) attrs(attrs ...attr) {
+	width := 0
+	for _, a := range attrs {
+		if a.value != "" && len(a.name) > width {
+			width = len(a.name)
+		}
+	}
+	for _, a := range attrs {
+		if a.value != "" {
+			b.line(a.name + strings.Repeat(" ", width-len(a.name)) + " = " + a.value)
+		}
+	}
+}
+
+// quote renders s as an HCL string, escaping the template sequences ${ and %{ as well as quotes, backslashes
+// and control characters.
+func quote(s string) string {
+	var out strings.Builder
+	out.WriteByte('"')
+	for i, r := range s {
+		switch {
+		case r == '"' || r == '\\':
+			out.WriteByte('\\')
+			out.WriteRune(r)
+		case r == '\n':
+			out.WriteString(`\n`)
+		case r == '\r':
+			out.WriteString(`\r`)
+		case r == '\t':
+			out.WriteString(`\t`)
+		case r < 0x20 || r == 0x7f:
+			fmt.Fprintf(&out, `\u%04x`, r)
+		case (r == '$' || r == '%') && strings.HasPrefix(s[i+1:], "{"):
+			out.WriteRune(r)
+			out.WriteRune(r)
+		default:
+			out.WriteRune(r)
+		}
+	}
+	out.WriteByte('"')
+	return out.String()
+}
+
+// list renders values as a list of strings.
+func list(values []string) string {
+	quoted := make([]string, len(values))
+	for i, v := range values {
+		quoted[i] = quote(v)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// optionalList renders values as a list, or omits the attribute when there are none.
+func optionalList(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return list(values)
+}
+
+// optionalMap renders values as a map for an attribute at depth, or omits the attribute when there are none.
+func optionalMap(values map[string]string, depth int) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return value(values, depth)
+}
+
+// value renders a decoded JSON value for an attribute at depth. The keys of string maps, such as labels, are
+// always quoted since keys such as app.kubernetes.io/name are not identifiers.
+func value(v interface{}, depth int) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return object(v, depth+1, false)
+	case map[string]string:
+		generic := make(map[string]interface{}, len(v))
+		for k, s := range v {
+			generic[k] = s
+		}
+		return object(generic, depth+1, true)
+	case []interface{}:
+		if scalars(v) {
+			rendered := make([]string, len(v))
+			for i, item := range v {
+				rendered[i] = value(item, depth)
+			}
+			return "[" + strings.Join(rendered, ", ") + "]"
+		}
+		inner := strings.Repeat(indentUnit, depth+1)
+		var out strings.Builder
+		out.WriteString("[\n")
+		for _, item := range v {
+			out.WriteString(inner + value(item, depth+1) + ",\n")
+		}
+		out.WriteString(strings.Repeat(indentUnit, depth) + "]")
+		return out.String()
+	case string:
+		return quote(v)
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return "null"
+	}
+	return "null"
+}
+
+// scalars reports whether values holds no objects or lists, so it fits on one line.
+func scalars(values []interface{}) bool {
+	for _, v := range values {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+// object renders an HCL object whose keys are indented to depth, with sorted keys aligned.
+func object(fields map[string]interface{}, depth int, quoteKeys bool) string {
+	if len(fields) == 0 {
+		return "{}"
+	}
+	keys := make([]string, 0, len(fields))
+	for k := range fields {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rendered := make([]string, len(keys))
+	width := 0
+	for i, k := range keys {
+		if quoteKeys || !isIdentifier(k) {
+			rendered[i] = quote(k)
+		} else {
+			rendered[i] = k
+		}
+		if len(rendered[i]) > width {
+			width = len(rendered[i])
+		}
+	}
+
+	inner := strings.Repeat(indentUnit, depth)
+	var out strings.Builder
+	out.WriteString("{\n")
+	for i, k := range keys {
+		out.WriteString(inner + rendered[i] + strings.Repeat(" ", width-len(rendered[i])) + " = " + value(fields[k], depth) + "\n")
+	}
+	out.WriteString(strings.Repeat(indentUnit, depth-1) + "}")
+	return out.String()
+}
+
+// isIdentifier reports whether s can be written as a bare HCL identifier.
+func isIdentifier(s string) bool {
+	if s == "" || !isIdentifierStart(rune(s[0])) {
+		return false
+	}
+	for _, r := range s {
+		if !isIdentifierChar(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// identifier turns s into a valid Terraform resource name by replacing invalid characters with underscores
+// and prefixing an underscore when it doesn't start with a letter.
+func identifier(s string) string {
+	var out strings.Builder
+	for _, r := range s {
+		if isIdentifierChar(r) {
+			out.WriteRune(r)
+		} else {
+			out.WriteByte('_')
+		}
+	}
+	name := out.String()
+	if name == "" || !isIdentifierStart(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+func isIdentifierStart(r rune) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+func isIdentifierChar(r rune) bool {
+	return isIdentifierStart(r) || r == '-' || r >= '0' && r <= '9'
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,324 @@
+// Package terraform renders RBAC objects as HCL for the kubernetes Terraform provider, so objects created by
+// hand can be brought under Terraform without writing their configuration from scratch.
+package terraform
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// lastAppliedAnnotation is kubectl's copy of the applied configuration, meaningless once Terraform manages
+// the object.
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Objects are the RBAC objects to render.
+type Objects struct {
+	Roles               []rbacv1.Role
+	RoleBindings        []rbacv1.RoleBinding
+	ClusterRoles        []rbacv1.ClusterRole
+	ClusterRoleBindings []rbacv1.ClusterRoleBinding
+}
+
+// resource is one rendered resource block and the command importing its object into state.
+type resource struct {
+	body          string
+	importCommand string
+}
+
+// Render returns the HCL of objects: a comment listing the terraform import commands, then one resource per
+// object, each kind sorted by namespace and name. Objects the provider's typed resources can't express are
+// rendered as kubernetes_manifest.
+func Render(objects Objects) []byte {
+	r := renderer{names: make(map[string]map[string]bool)}
+
+	roles := append([]rbacv1.Role(nil), objects.Roles...)
+	sort.Slice(roles, func(i, j int) bool { return less(roles[i].ObjectMeta, roles[j].ObjectMeta) })
+	for _, role := range roles {
+		r.role(role)
+	}
+	bindings := append([]rbacv1.RoleBinding(nil), objects.RoleBindings...)
+	sort.Slice(bindings, func(i, j int) bool { return less(bindings[i].ObjectMeta, bindings[j].ObjectMeta) })
+	for _, binding := range bindings {
+		r.roleBinding(binding)
+	}
+	clusterRoles := append([]rbacv1.ClusterRole(nil), objects.ClusterRoles...)
+	sort.Slice(clusterRoles, func(i, j int) bool { return less(clusterRoles[i].ObjectMeta, clusterRoles[j].ObjectMeta) })
+	for _, role := range clusterRoles {
+		r.clusterRole(role)
+	}
+	clusterBindings := append([]rbacv1.ClusterRoleBinding(nil), objects.ClusterRoleBindings...)
+	sort.Slice(clusterBindings, func(i, j int) bool { return less(clusterBindings[i].ObjectMeta, clusterBindings[j].ObjectMeta) })
+	for _, binding := range clusterBindings {
+		r.clusterRoleBinding(binding)
+	}
+
+	var out strings.Builder
+	out.WriteString("# Generated by k-rbac. Import the existing objects into state before the first apply:\n")
+	if len(r.resources) == 0 {
+		out.WriteString("#   (no objects)\n")
+	}
+	for _, res := range r.resources {
+		out.WriteString("#   " + res.importCommand + "\n")
+	}
+	for _, res := range r.resources {
+		out.WriteString("\n" + res.body)
+	}
+	return []byte(out.String())
+}
+
+// renderer accumulates resources, keeping their names unique per resource type.
+type renderer struct {
+	resources []resource
+	names     map[string]map[string]bool
+}
+
+func (r *renderer) role(role rbacv1.Role) {
+	if reason := roleRulesInexpressible(role.Rules); reason != "" {
+		r.manifest("Role", role.ObjectMeta, role, reason)
+		return
+	}
+	b := newBlock()
+	metadata(b, role.ObjectMeta)
+	for _, rule := range role.Rules {
+		b.open("rule")
+		b.attrs(
+			attr{"api_groups", list(rule.APIGroups)},
+			attr{"resources", list(rule.Resources)},
+			attr{"resource_names", optionalList(rule.ResourceNames)},
+			attr{"verbs", list(rule.Verbs)},
+		)
+		b.close()
+	}
+	r.add("kubernetes_role_v1", role.ObjectMeta, b)
+}
+
+func (r *renderer) clusterRole(role rbacv1.ClusterRole) {
+	if reason := clusterRoleInexpressible(role); reason != "" {
+		r.manifest("ClusterRole", role.ObjectMeta, role, reason)
+		return
+	}
+	b := newBlock()
+	metadata(b, role.ObjectMeta)
+	if role.AggregationRule != nil {
+		// the aggregation controller fills in the rules, so Terraform must not manage them
+		b.open("aggregation_rule")
+		for _, selector := range role.AggregationRule.ClusterRoleSelectors {
+			b.open("cluster_role_selectors")
+			b.attrs(attr{"match_labels", optionalMap(selector.MatchLabels, b.depth)})
+			for _, expression := range selector.MatchExpressions {
+				b.open("match_expressions")
+				b.attrs(
+					attr{"key", quote(expression.Key)},
+					attr{"operator", quote(string(expression.Operator))},
+					attr{"values", optionalList(expression.Values)},
+				)
+				b.close()
+			}
+			b.close()
+		}
+		b.close()
+	} else {
+		for _, rule := range role.Rules {
+			b.open("rule")
+			b.attrs(
+				attr{"api_groups", optionalList(rule.APIGroups)},
+				attr{"resources", optionalList(rule.Resources)},
+				attr{"resource_names", optionalList(rule.ResourceNames)},
+				attr{"non_resource_urls", optionalList(rule.NonResourceURLs)},
+				attr{"verbs", list(rule.Verbs)},
+			)
+			b.close()
+		}
+	}
+	r.add("kubernetes_cluster_role_v1", role.ObjectMeta, b)
+}
+
+func (r *renderer) roleBinding(binding rbacv1.RoleBinding) {
+	if len(binding.Subjects) == 0 {
+		r.manifest("RoleBinding", binding.ObjectMeta, binding, "it has no subjects, which kubernetes_role_binding_v1 requires")
+		return
+	}
+	b := newBlock()
+	metadata(b, binding.ObjectMeta)
+	bindingBody(b, binding.RoleRef, binding.Subjects)
+	r.add("kubernetes_role_binding_v1", binding.ObjectMeta, b)
+}
+
+func (r *renderer) clusterRoleBinding(binding rbacv1.ClusterRoleBinding) {
+	if len(binding.Subjects) == 0 {
+		r.manifest("ClusterRoleBinding", binding.ObjectMeta, binding, "it has no subjects, which kubernetes_cluster_role_binding_v1 requires")
+		return
+	}
+	b := newBlock()
+	metadata(b, binding.ObjectMeta)
+	bindingBody(b, binding.RoleRef, binding.Subjects)
+	r.add("kubernetes_cluster_role_binding_v1", binding.ObjectMeta, b)
+}
+
+// manifest renders object as a kubernetes_manifest, explaining why in a comment.
+func (r *renderer) manifest(kind string, meta metav1.ObjectMeta, object interface{}, reason string) {
+	var fields map[string]interface{}
+	data, _ := json.Marshal(object)
+	_ = json.Unmarshal(data, &fields)
+	fields["apiVersion"] = rbacv1.SchemeGroupVersion.String()
+	fields["kind"] = kind
+	fields["metadata"] = manifestMetadata(meta)
+
+	b := newBlock()
+	b.comment("Rendered as a manifest because " + reason + ".")
+	b.attrs(attr{"manifest", value(fields, b.depth)})
+
+	id := "apiVersion=" + rbacv1.SchemeGroupVersion.String() + ",kind=" + kind
+	if meta.Namespace != "" {
+		id += ",namespace=" + meta.Namespace
+	}
+	id += ",name=" + meta.Name
+	r.addWithID("kubernetes_manifest", meta, b, id)
+}
+
+func (r *renderer) add(resourceType string, meta metav1.ObjectMeta, b *block) {
+	id := meta.Name
+	if meta.Namespace != "" {
+		id = meta.Namespace + "/" + meta.Name
+	}
+	r.addWithID(resourceType, meta, b, id)
+}
+
+// addWithID closes the resource block of b under a name derived from the object's namespace and name.
+func (r *renderer) addWithID(resourceType string, meta metav1.ObjectMeta, b *block, id string) {
+	name := r.uniqueName(resourceType, meta)
+	var out strings.Builder
+	out.WriteString("resource " + quote(resourceType) + " " + quote(name) + " {\n")
+	out.WriteString(b.String())
+	out.WriteString("}\n")
+	r.resources = append(r.resources, resource{
+		body:          out.String(),
+		importCommand: "terraform import " + shellQuote(resourceType+"."+name) + " " + shellQuote(id),
+	})
+}
+
+// uniqueName derives a Terraform resource name from the object's namespace and name, numbering names that
+// collide once invalid characters are replaced.
+func (r *renderer) uniqueName(resourceType string, meta metav1.ObjectMeta) string {
+	base := meta.Name
+	if meta.Namespace != "" {
+		base = meta.Namespace + "_" + meta.Name
+	}
+	base = identifier(base)
+
+	if r.names[resourceType] == nil {
+		r.names[resourceType] = make(map[string]bool)
+	}
+	name := base
+	for n := 2; r.names[resourceType][name]; n++ {
+		name = base + "_" + strconv.Itoa(n)
+	}
+	r.names[resourceType][name] = true
+	return name
+}
+
+// roleRulesInexpressible explains why kubernetes_role_v1 can't express rules, or returns "".
+func roleRulesInexpressible(rules []rbacv1.PolicyRule) string {
+	for i, rule := range rules {
+		switch {
+		case len(rule.NonResourceURLs) > 0:
+			return fmt.Sprintf("rule %d has nonResourceURLs, which kubernetes_role_v1 does not support", i)
+		case len(rule.APIGroups) == 0 || len(rule.Resources) == 0 || len(rule.Verbs) == 0:
+			return fmt.Sprintf("rule %d lacks apiGroups, resources or verbs, which kubernetes_role_v1 requires", i)
+		}
+	}
+	return ""
+}
+
+// clusterRoleInexpressible explains why kubernetes_cluster_role_v1 can't express role, or returns "".
+func clusterRoleInexpressible(role rbacv1.ClusterRole) string {
+	if role.AggregationRule != nil {
+		return ""
+	}
+	for i, rule := range role.Rules {
+		if len(rule.Verbs) == 0 {
+			return fmt.Sprintf("rule %d has no verbs, which kubernetes_cluster_role_v1 requires", i)
+		}
+	}
+	return ""
+}
+
+// metadata writes the metadata block of an object.
+func metadata(b *block, meta metav1.ObjectMeta) {
+	b.open("metadata")
+	attrs := []attr{{"name", quote(meta.Name)}}
+	if meta.Namespace != "" {
+		attrs = append(attrs, attr{"namespace", quote(meta.Namespace)})
+	}
+	attrs = append(attrs,
+		attr{"labels", optionalMap(meta.Labels, b.depth)},
+		attr{"annotations", optionalMap(annotations(meta), b.depth)},
+	)
+	b.attrs(attrs...)
+	b.close()
+}
+
+// manifestMetadata is the metadata of a manifest, without the fields the API server sets.
+func manifestMetadata(meta metav1.ObjectMeta) map[string]interface{} {
+	out := map[string]interface{}{"name": meta.Name}
+	if meta.Namespace != "" {
+		out["namespace"] = meta.Namespace
+	}
+	if len(meta.Labels) > 0 {
+		out["labels"] = meta.Labels
+	}
+	if a := annotations(meta); len(a) > 0 {
+		out["annotations"] = a
+	}
+	return out
+}
+
+// annotations returns the annotations worth keeping under Terraform.
+func annotations(meta metav1.ObjectMeta) map[string]string {
+	if _, ok := meta.Annotations[lastAppliedAnnotation]; !ok {
+		return meta.Annotations
+	}
+	out := make(map[string]string, len(meta.Annotations))
+	for k, v := range meta.Annotations {
+		if k != lastAppliedAnnotation {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// bindingBody writes the role_ref and subject blocks shared by both binding kinds.
+func bindingBody(b *block, ref rbacv1.RoleRef, subjects []rbacv1.Subject) {
+	b.open("role_ref")
+	b.attrs(
+		attr{"api_group", quote(ref.APIGroup)},
+		attr{"kind", quote(ref.Kind)},
+		attr{"name", quote(ref.Name)},
+	)
+	b.close()
+	for _, subject := range subjects {
+		b.open("subject")
+		attrs := []attr{{"kind", quote(subject.Kind)}, {"name", quote(subject.Name)}}
+		if subject.Namespace != "" {
+			attrs = append(attrs, attr{"namespace", quote(subject.Namespace)})
+		}
+		if subject.APIGroup != "" {
+			attrs = append(attrs, attr{"api_group", quote(subject.APIGroup)})
+		}
+		b.attrs(attrs...)
+		b.close()
+	}
+}
+
+func less(a, b metav1.ObjectMeta) bool {
+	if a.Namespace != b.Namespace {
+		return a.Namespace < b.Namespace
+	}
+	return a.Name < b.Name
+}
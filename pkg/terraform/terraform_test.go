@@ -0,0 +1,159 @@
+package terraform
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// fixture has an object of each kind, names that collide once made identifiers, a template sequence to escape
+// and objects only kubernetes_manifest can express.
+func fixture() Objects {
+	ref := func(kind, name string) rbacv1.RoleRef {
+		return rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: kind, Name: name}
+	}
+	return Objects{
+		Roles: []rbacv1.Role{
+			{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "deployer",
+					Namespace: "prod",
+					Labels:    map[string]string{"app.kubernetes.io/name": "ci", "team": "platform"},
+					Annotations: map[string]string{
+						lastAppliedAnnotation: `{"kind":"Role"}`,
+						"description":         "deploys ${app}",
+					},
+				},
+				Rules: []rbacv1.PolicyRule{
+					{APIGroups: []string{"apps"}, Resources: []string{"deployments"}, Verbs: []string{"get", "update"}},
+					{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{"settings"}, Verbs: []string{"get"}},
+				},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "a.b", Namespace: "prod"},
+				Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"list"}}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "a_b", Namespace: "prod"},
+				Rules:      []rbacv1.PolicyRule{{APIGroups: []string{""}, Resources: []string{"pods"}, Verbs: []string{"get"}}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "legacy", Namespace: "prod"},
+				Rules:      []rbacv1.PolicyRule{{Resources: []string{"pods"}, Verbs: []string{"get"}}},
+			},
+		},
+		RoleBindings: []rbacv1.RoleBinding{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "ci", Namespace: "prod"},
+				RoleRef:    ref("Role", "deployer"),
+				Subjects: []rbacv1.Subject{
+					{Kind: rbacv1.ServiceAccountKind, Name: "builder", Namespace: "prod"},
+					{Kind: rbacv1.UserKind, APIGroup: rbacv1.GroupName, Name: "alice@example.com"},
+				},
+			},
+			{ObjectMeta: metav1.ObjectMeta{Name: "empty", Namespace: "prod"}, RoleRef: ref("Role", "deployer")},
+		},
+		ClusterRoles: []rbacv1.ClusterRole{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "monitoring"},
+				AggregationRule: &rbacv1.AggregationRule{ClusterRoleSelectors: []metav1.LabelSelector{{
+					MatchLabels: map[string]string{"rbac.example.com/aggregate-to-monitoring": "true"},
+					MatchExpressions: []metav1.LabelSelectorRequirement{
+						{Key: "tier", Operator: metav1.LabelSelectorOpIn, Values: []string{"metrics"}},
+					},
+				}}},
+			},
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "health"},
+				Rules:      []rbacv1.PolicyRule{{NonResourceURLs: []string{"/healthz", "/readyz"}, Verbs: []string{"get"}}},
+			},
+		},
+		ClusterRoleBindings: []rbacv1.ClusterRoleBinding{{
+			ObjectMeta: metav1.ObjectMeta{Name: "ops:monitoring"},
+			RoleRef:    ref("ClusterRole", "monitoring"),
+			Subjects:   []rbacv1.Subject{{Kind: rbacv1.GroupKind, APIGroup: rbacv1.GroupName, Name: `team "ops"`}},
+		}},
+	}
+}
+
+// checkGolden compares got with testdata/name, or rewrites the file when -update is set.
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("%s differs from the golden file; rerun with -update if the change is intended\ngot:\n%s", name, got)
+	}
+}
+
+func TestRender(t *testing.T) {
+	checkGolden(t, "rbac.tf.golden", Render(fixture()))
+}
+
+func TestRenderEmpty(t *testing.T) {
+	checkGolden(t, "empty.tf.golden", Render(Objects{}))
+}
+
+func TestRenderIsStable(t *testing.T) {
+	objects := fixture()
+	reversed := Objects{ClusterRoles: objects.ClusterRoles, ClusterRoleBindings: objects.ClusterRoleBindings}
+	for i := len(objects.Roles) - 1; i >= 0; i-- {
+		reversed.Roles = append(reversed.Roles, objects.Roles[i])
+	}
+	for i := len(objects.RoleBindings) - 1; i >= 0; i-- {
+		reversed.RoleBindings = append(reversed.RoleBindings, objects.RoleBindings[i])
+	}
+	if got, want := string(Render(reversed)), string(Render(objects)); got != want {
+		t.Errorf("output depends on the order of the objects\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"plain", `"plain"`},
+		{`say "hi" \ bye`, `"say \"hi\" \\ bye"`},
+		{"line\nbreak\ttab", `"line\nbreak\ttab"`},
+		{"${var} and %{if}", `"$${var} and %%{if}"`},
+		{"$5 and 100%", `"$5 and 100%"`},
+		{"bell\x07", `"bell\u0007"`},
+	}
+	for _, tt := range tests {
+		if got := quote(tt.in); got != tt.want {
+			t.Errorf("quote(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"prod_deployer", "prod_deployer"},
+		{"system:controller:job", "system_controller_job"},
+		{"1password", "_1password"},
+		{"a.b-c", "a_b-c"},
+	}
+	for _, tt := range tests {
+		if got := identifier(tt.in); got != tt.want {
+			t.Errorf("identifier(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package utils
+
+import (
+	"encoding/csv"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CSVContentType is the media type of CSV downloads.
+const CSVContentType = "text/csv; charset=utf-8"
+
+// csvFlushRows is how many rows are buffered before they are sent to the client.
+const csvFlushRows = 500
+
+// CSVWriter streams the rows of a CSV download to the client as they are written, so a large report is
+// never held in memory as a whole. Fields are quoted as needed, so commas, quotes and newlines in names
+// are safe.
+type CSVWriter struct {
+	res       *echo.Response
+	w         *csv.Writer
+	unflushed int
+}
+
+// StartCSV writes the headers of a CSV download named after report and today's date, such as
+// namespace-admins-2024-05-01.csv, followed by the header row.
+func StartCSV(res *echo.Response, report string, header []string) (*CSVWriter, error) {
+	filename := report + "-" + time.Now().UTC().Format(time.DateOnly) + ".csv"
+	res.Header().Set(echo.HeaderContentType, CSVContentType)
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	res.WriteHeader(http.StatusOK)
+
+	w := &CSVWriter{res: res, w: csv.NewWriter(res)}
+	return w, w.Write(header)
+}
+
+// Write writes one row.
+func (w *CSVWriter) Write(row []string) error {
+	if err := w.w.Write(row); err != nil {
+		return err
+	}
+	if w.unflushed++; w.unflushed >= csvFlushRows {
+		return w.flush()
+	}
+	return nil
+}
+
+// Close sends the rows not yet sent.
+func (w *CSVWriter) Close() error {
+	return w.flush()
+}
+
+// flush sends the buffered rows to the client.
+func (w *CSVWriter) flush() error {
+	w.w.Flush()
+	if err := w.w.Error(); err != nil {
+		return err
+	}
+	w.unflushed = 0
+	w.res.Flush()
+	return nil
+}
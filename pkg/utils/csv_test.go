@@ -0,0 +1,81 @@
+package utils
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestCSVWriter(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w, err := StartCSV(echo.NewResponse(rec, echo.New()), "report", []string{"name", "note"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]string{
+		{"plain", ""},
+		{"a,b", `say "hi"`},
+		{"multi\nline", " padded "},
+	}
+	for _, row := range rows {
+		if err := w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if got := rec.Header().Get(echo.HeaderContentType); got != CSVContentType {
+		t.Errorf("Content-Type = %q, want %q", got, CSVContentType)
+	}
+	want := `attachment; filename="report-` + time.Now().UTC().Format(time.DateOnly) + `.csv"`
+	if got := rec.Header().Get(echo.HeaderContentDisposition); got != want {
+		t.Errorf("Content-Disposition = %q, want %q", got, want)
+	}
+
+	wantBody := "name,note\nplain,\n\"a,b\",\"say \"\"hi\"\"\"\n\"multi\nline\",\" padded \"\n"
+	if got := rec.Body.String(); got != wantBody {
+		t.Errorf("body = %q, want %q", got, wantBody)
+	}
+	parsed, err := csv.NewReader(strings.NewReader(rec.Body.String())).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.EqualFunc(parsed[1:], rows, slices.Equal) {
+		t.Errorf("rows read back = %q, want %q", parsed[1:], rows)
+	}
+}
+
+func TestCSVWriterStreams(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w, err := StartCSV(echo.NewResponse(rec, echo.New()), "report", []string{"n"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the header row counts towards the first batch
+	for i := 1; i < csvFlushRows-1; i++ {
+		if err := w.Write([]string{strconv.Itoa(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("%d bytes sent before a full batch", rec.Body.Len())
+	}
+	if err := w.Write([]string{"last"}); err != nil {
+		t.Fatal(err)
+	}
+	if !rec.Flushed || !strings.HasSuffix(rec.Body.String(), "\nlast\n") {
+		t.Errorf("a full batch of %d rows was not sent", csvFlushRows)
+	}
+}
@@ -1,68 +1,132 @@
 package utils
 
 import (
+	"errors"
 	"net/http"
+	"rbac/pkg/httperror"
+	"rbac/pkg/listing"
+	"rbac/pkg/managed"
 
 	"github.com/labstack/echo/v4"
+	apimeta "k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes"
 )
 
 // HandleHTTPMethod handles different HTTP methods for a given handler function.
-func HandleHTTPMethod(c echo.Context, clientset *kubernetes.Clientset, namespace string, handlers map[string]func(echo.Context, *kubernetes.Clientset, string) error) error {
+func HandleHTTPMethod(c echo.Context, clientset kubernetes.Interface, namespace string, handlers map[string]func(echo.Context, kubernetes.Interface, string) error) error {
 	if handler, exists := handlers[c.Request().Method]; exists {
 		return handler(c, clientset, namespace)
 	}
 	return echo.NewHTTPError(http.StatusMethodNotAllowed, "Method not allowed")
 }
 
-// ListResources lists resources in a specific namespace.
-func ListResources(c echo.Context, clientset *kubernetes.Clientset, namespace string, listFunc func(string, metav1.ListOptions) (interface{}, error)) error {
-	resources, err := listFunc(namespace, metav1.ListOptions{})
+// ListResources lists resources in a specific namespace, honouring the managed-by filters, paging, label
+// selector and order of the request.
+func ListResources(c echo.Context, clientset kubernetes.Interface, namespace string, listFunc func(string, metav1.ListOptions) (interface{}, error)) error {
+	opts, order, err := ListOptions(c)
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Error listing resources: "+err.Error())
+		return err
+	}
+
+	resources, err := listFunc(namespace, opts)
+	if err != nil {
+		return httperror.Wrap(err, "Error listing resources: ")
+	}
+	list, ok := resources.(runtime.Object)
+	if !ok {
+		return c.JSON(http.StatusOK, resources)
+	}
+	if err := listing.SortList(list, order); err != nil {
+		return httperror.Wrap(err, "Error sorting list: ")
+	}
+	if listing.Enveloped(c) {
+		return respondList(c, list)
 	}
 	return c.JSON(http.StatusOK, resources)
 }
 
+// ListOptions reads the managed-by filters, ?limit=, ?continue=, ?labelSelector= and ?sort= of a list
+// request.
+func ListOptions(c echo.Context) (metav1.ListOptions, listing.Order, error) {
+	opts, err := managed.ListOptions(c)
+	if err != nil {
+		return opts, listing.Order{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid filter: "+err.Error())
+	}
+	if opts, err = listing.ListOptions(c, opts); err != nil {
+		return opts, listing.Order{}, err
+	}
+	order, err := listing.ParseOrder(c)
+	return opts, order, err
+}
+
+// respondList writes the items of a Kubernetes list in the list envelope, passing on its continue token.
+func respondList(c echo.Context, list runtime.Object) error {
+	items, err := apimeta.ExtractList(list)
+	if err != nil {
+		return httperror.Wrap(err, "Error reading list: ")
+	}
+	accessor, err := apimeta.ListAccessor(list)
+	if err != nil {
+		return httperror.Wrap(err, "Error reading list: ")
+	}
+
+	meta := listing.Meta{Continue: accessor.GetContinue()}
+	if remaining := accessor.GetRemainingItemCount(); remaining != nil {
+		meta.Total = len(items) + int(*remaining)
+	}
+	return listing.Respond(c, items, meta)
+}
+
 // CreateResource creates a new resource in a specific namespace.
-func CreateResource(c echo.Context, clientset *kubernetes.Clientset, namespace string, resource interface{}, createFunc func(string, interface{}, metav1.CreateOptions) (interface{}, error)) error {
+func CreateResource(c echo.Context, clientset kubernetes.Interface, namespace string, resource interface{}, createFunc func(string, interface{}, metav1.CreateOptions) (interface{}, error)) error {
 	if err := c.Bind(resource); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Failed to decode request body: "+err.Error())
 	}
 
 	createdResource, err := createFunc(namespace, resource, metav1.CreateOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to create resource: "+err.Error())
+		return resourceError(err, "Failed to create resource: ")
 	}
 
 	return c.JSON(http.StatusOK, createdResource)
 }
 
 // UpdateResource updates an existing resource in a specific namespace.
-func UpdateResource(c echo.Context, clientset *kubernetes.Clientset, namespace string, resource interface{}, updateFunc func(string, interface{}, metav1.UpdateOptions) (interface{}, error)) error {
+func UpdateResource(c echo.Context, clientset kubernetes.Interface, namespace string, resource interface{}, updateFunc func(string, interface{}, metav1.UpdateOptions) (interface{}, error)) error {
 	if err := c.Bind(resource); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, "Failed to decode request body: "+err.Error())
 	}
 
 	updatedResource, err := updateFunc(namespace, resource, metav1.UpdateOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to update resource: "+err.Error())
+		return resourceError(err, "Failed to update resource: ")
 	}
 
 	return c.JSON(http.StatusOK, updatedResource)
 }
 
 // DeleteResource deletes a resource by name in a specific namespace.
-func DeleteResource(c echo.Context, clientset *kubernetes.Clientset, namespace, name string, deleteFunc func(string, string, metav1.DeleteOptions) error) error {
+func DeleteResource(c echo.Context, clientset kubernetes.Interface, namespace, name string, deleteFunc func(string, string, metav1.DeleteOptions) error) error {
 	if name == "" {
 		return echo.NewHTTPError(http.StatusBadRequest, "Resource name is required")
 	}
 
 	err := deleteFunc(namespace, name, metav1.DeleteOptions{})
 	if err != nil {
-		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to delete resource: "+err.Error())
+		return resourceError(err, "Failed to delete resource: ")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Resource deleted successfully"})
 }
+
+// resourceError reports a failed change. HTTP errors raised by the callback, such as a refused conflict,
+// keep their status; anything else is an internal error.
+func resourceError(err error, message string) error {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+	return httperror.Wrap(err, message)
+}
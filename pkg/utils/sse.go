@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SSEHeartbeatInterval is how often streams send a keep-alive so proxies don't drop idle connections.
+const SSEHeartbeatInterval = 15 * time.Second
+
+// StartSSE writes the headers that open a server-sent events stream.
+func StartSSE(res *echo.Response) {
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set(echo.HeaderConnection, "keep-alive")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+}
+
+// WriteSSEEvent writes a single named server-sent event with a JSON payload and flushes it.
+func WriteSSEEvent(res *echo.Response, name string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", name, data); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
+
+// WriteSSEHeartbeat writes a comment line that keeps idle streams alive through proxies.
+func WriteSSEHeartbeat(res *echo.Response) error {
+	if _, err := fmt.Fprint(res, ": heartbeat\n\n"); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
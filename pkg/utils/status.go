@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"errors"
+
+	"rbac/pkg/httperror"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ResponseStatus returns the status that is or will be sent for the request,
+// accounting for handler errors that the error handler has not written yet.
+// It agrees with the status the error handler derives from Kubernetes API errors.
+func ResponseStatus(c echo.Context, err error) int {
+	if err == nil {
+		return c.Response().Status
+	}
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.Code
+	}
+	return httperror.Status(err)
+}
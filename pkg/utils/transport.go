@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RoundTripperFunc adapts a function to http.RoundTripper.
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+// RoundTrip calls the function.
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// KubernetesResource extracts the resource type from a Kubernetes API path such as
+// /apis/rbac.authorization.k8s.io/v1/namespaces/default/roles/foo, returning "roles".
+func KubernetesResource(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		segments = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		segments = segments[3:]
+	default:
+		return "other"
+	}
+
+	if len(segments) == 0 {
+		return "discovery"
+	}
+	if segments[0] == "namespaces" && len(segments) >= 3 {
+		return segments[2]
+	}
+	return segments[0]
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"errors"
+	"fmt"
 
 	rbacv1 "k8s.io/api/rbac/v1"
 )
@@ -25,10 +26,10 @@ func ValidateRoleBinding(roleBinding *rbacv1.RoleBinding) error {
 	if roleBinding.RoleRef.Name == "" {
 		return errors.New("role reference name is required")
 	}
-	if len(roleBinding.Subjects) == 0 {
-		return errors.New("at least one subject is required")
+	if kind := roleBinding.RoleRef.Kind; kind != "Role" && kind != "ClusterRole" {
+		return fmt.Errorf("role reference kind %q is not Role or ClusterRole", kind)
 	}
-	return nil
+	return validateSubjects(roleBinding.Subjects, true)
 }
 
 // ValidateClusterRoleBinding ensures that the cluster role binding is valid.
@@ -39,8 +40,30 @@ func ValidateClusterRoleBinding(clusterRoleBinding *rbacv1.ClusterRoleBinding) e
 	if clusterRoleBinding.RoleRef.Name == "" {
 		return errors.New("role reference name is required")
 	}
-	if len(clusterRoleBinding.Subjects) == 0 {
+	if kind := clusterRoleBinding.RoleRef.Kind; kind != "ClusterRole" {
+		return fmt.Errorf("role reference kind %q is not ClusterRole", kind)
+	}
+	return validateSubjects(clusterRoleBinding.Subjects, false)
+}
+
+// validateSubjects ensures that a binding has subjects, each a named User, Group or ServiceAccount.
+// Service accounts of a role binding default to its namespace; those of a cluster role binding must name theirs.
+func validateSubjects(subjects []rbacv1.Subject, namespaced bool) error {
+	if len(subjects) == 0 {
 		return errors.New("at least one subject is required")
 	}
+	for i, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.UserKind, rbacv1.GroupKind, rbacv1.ServiceAccountKind:
+		default:
+			return fmt.Errorf("subject %d has kind %q, not User, Group or ServiceAccount", i, subject.Kind)
+		}
+		if subject.Name == "" {
+			return fmt.Errorf("subject %d has no name", i)
+		}
+		if subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == "" && !namespaced {
+			return fmt.Errorf("service account subject %d has no namespace", i)
+		}
+	}
 	return nil
 }
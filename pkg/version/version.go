@@ -0,0 +1,5 @@
+package version
+
+// Version is the application version, overridden at build time with
+// -ldflags "-X rbac/pkg/version.Version=<version>".
+var Version = "dev"
@@ -0,0 +1,306 @@
+package watch
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Kinds of RBAC objects the hub watches.
+const (
+	KindRole               = "Role"
+	KindClusterRole        = "ClusterRole"
+	KindRoleBinding        = "RoleBinding"
+	KindClusterRoleBinding = "ClusterRoleBinding"
+)
+
+// AllKinds lists every kind the hub watches.
+var AllKinds = []string{KindRole, KindClusterRole, KindRoleBinding, KindClusterRoleBinding}
+
+// Event types emitted by the hub.
+const (
+	EventAdded    = "ADDED"
+	EventModified = "MODIFIED"
+	EventDeleted  = "DELETED"
+)
+
+// subscriberBuffer is the number of events buffered per subscriber before it is dropped.
+const subscriberBuffer = 64
+
+// ObjectLite is a compact projection of an RBAC object sent to watchers.
+type ObjectLite struct {
+	Kind              string              `json:"kind"`
+	Name              string              `json:"name"`
+	Namespace         string              `json:"namespace,omitempty"`
+	ResourceVersion   string              `json:"resourceVersion"`
+	CreationTimestamp metav1.Time         `json:"creationTimestamp"`
+	Labels            map[string]string   `json:"labels,omitempty"`
+	Rules             []rbacv1.PolicyRule `json:"rules,omitempty"`
+	RoleRef           *rbacv1.RoleRef     `json:"roleRef,omitempty"`
+	Subjects          []rbacv1.Subject    `json:"subjects,omitempty"`
+}
+
+// Event represents a change to an RBAC object.
+type Event struct {
+	Type      string     `json:"type"`
+	Kind      string     `json:"kind"`
+	Namespace string     `json:"namespace,omitempty"`
+	Name      string     `json:"name"`
+	Object    ObjectLite `json:"object"`
+}
+
+// Hub fans the events of the shared RBAC informers out to subscribers.
+type Hub struct {
+	factory informers.SharedInformerFactory
+	ctx     context.Context
+
+	startOnce sync.Once
+	informers map[string]cache.SharedIndexInformer
+
+	mu          sync.Mutex
+	subscribers map[chan Event]map[string]bool
+}
+
+// NewHub creates a hub publishing the events of factory's RBAC informers until ctx is cancelled.
+// Informers not yet started by another user of factory are started on the first subscription; the
+// caller shuts factory down.
+func NewHub(ctx context.Context, factory informers.SharedInformerFactory) *Hub {
+	return &Hub{
+		factory:     factory,
+		ctx:         ctx,
+		subscribers: make(map[chan Event]map[string]bool),
+	}
+}
+
+// Done returns a channel that is closed when the hub is stopped.
+func (h *Hub) Done() <-chan struct{} {
+	return h.ctx.Done()
+}
+
+// Subscribe registers a subscriber for the given kinds and returns its event channel
+// together with a function that cancels the subscription. The channel is closed when
+// the subscription is cancelled or when the subscriber falls too far behind.
+func (h *Hub) Subscribe(kinds map[string]bool) (<-chan Event, func()) {
+	h.start()
+
+	ch := make(chan Event, subscriberBuffer)
+	h.mu.Lock()
+	h.subscribers[ch] = kinds
+	h.mu.Unlock()
+
+	return ch, func() { h.unsubscribe(ch) }
+}
+
+// Subscribers returns the number of open subscriptions.
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subscribers)
+}
+
+// Snapshot returns the current state of the given kinds from the informer caches.
+func (h *Hub) Snapshot(kinds map[string]bool) []ObjectLite {
+	h.start()
+
+	var objects []ObjectLite
+	for _, kind := range AllKinds {
+		if !kinds[kind] {
+			continue
+		}
+		informer := h.informers[kind]
+		if !cache.WaitForCacheSync(h.ctx.Done(), informer.HasSynced) {
+			return objects
+		}
+		for _, obj := range informer.GetStore().List() {
+			if lite, ok := ToLite(obj); ok {
+				objects = append(objects, lite)
+			}
+		}
+	}
+	return objects
+}
+
+// WaitForSync starts the informers if needed and waits for those of the given kinds to sync. It returns
+// false if ctx is cancelled first.
+func (h *Hub) WaitForSync(ctx context.Context, kinds map[string]bool) bool {
+	h.start()
+
+	var synced []cache.InformerSynced
+	for _, kind := range AllKinds {
+		if kinds[kind] {
+			synced = append(synced, h.informers[kind].HasSynced)
+		}
+	}
+	return cache.WaitForCacheSync(ctx.Done(), synced...)
+}
+
+// start subscribes to the informers, and runs those that aren't running yet, once.
+func (h *Hub) start() {
+	h.startOnce.Do(func() {
+		rbac := h.factory.Rbac().V1()
+
+		h.informers = map[string]cache.SharedIndexInformer{
+			KindRole:               rbac.Roles().Informer(),
+			KindClusterRole:        rbac.ClusterRoles().Informer(),
+			KindRoleBinding:        rbac.RoleBindings().Informer(),
+			KindClusterRoleBinding: rbac.ClusterRoleBindings().Informer(),
+		}
+		for _, informer := range h.informers {
+			informer.AddEventHandler(cache.ResourceEventHandlerDetailedFuncs{
+				AddFunc: func(obj interface{}, isInInitialList bool) {
+					if !isInInitialList {
+						h.publish(EventAdded, obj)
+					}
+				},
+				UpdateFunc: func(_, obj interface{}) {
+					h.publish(EventModified, obj)
+				},
+				DeleteFunc: func(obj interface{}) {
+					if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+						obj = tombstone.Obj
+					}
+					h.publish(EventDeleted, obj)
+				},
+			})
+		}
+
+		h.factory.Start(h.ctx.Done())
+		go func() {
+			<-h.ctx.Done()
+			h.closeAll()
+		}()
+	})
+}
+
+// publish delivers an event to every subscriber interested in its kind.
+func (h *Hub) publish(eventType string, obj interface{}) {
+	lite, ok := ToLite(obj)
+	if !ok {
+		return
+	}
+	event := Event{
+		Type:      eventType,
+		Kind:      lite.Kind,
+		Namespace: lite.Namespace,
+		Name:      lite.Name,
+		Object:    lite,
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch, kinds := range h.subscribers {
+		if !kinds[event.Kind] {
+			continue
+		}
+		select {
+		case ch <- event:
+		default:
+			// Drop subscribers that cannot keep up so they reconnect and resync.
+			delete(h.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// unsubscribe removes a subscriber and closes its channel.
+func (h *Hub) unsubscribe(ch chan Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.subscribers[ch]; exists {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// closeAll closes every subscriber channel.
+func (h *Hub) closeAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subscribers {
+		delete(h.subscribers, ch)
+		close(ch)
+	}
+}
+
+// ToLite converts an RBAC object into its compact projection.
+// It reports false for nil objects and for types that are not RBAC objects.
+func ToLite(obj interface{}) (ObjectLite, bool) {
+	switch o := obj.(type) {
+	case *rbacv1.Role:
+		if o == nil {
+			break
+		}
+		lite := liteMeta(KindRole, o.ObjectMeta)
+		lite.Rules = o.Rules
+		return lite, true
+	case *rbacv1.ClusterRole:
+		if o == nil {
+			break
+		}
+		lite := liteMeta(KindClusterRole, o.ObjectMeta)
+		lite.Rules = o.Rules
+		return lite, true
+	case *rbacv1.RoleBinding:
+		if o == nil {
+			break
+		}
+		lite := liteMeta(KindRoleBinding, o.ObjectMeta)
+		lite.RoleRef = &o.RoleRef
+		lite.Subjects = o.Subjects
+		return lite, true
+	case *rbacv1.ClusterRoleBinding:
+		if o == nil {
+			break
+		}
+		lite := liteMeta(KindClusterRoleBinding, o.ObjectMeta)
+		lite.RoleRef = &o.RoleRef
+		lite.Subjects = o.Subjects
+		return lite, true
+	}
+	return ObjectLite{}, false
+}
+
+// liteMeta copies the metadata fields shared by all projections.
+func liteMeta(kind string, meta metav1.ObjectMeta) ObjectLite {
+	return ObjectLite{
+		Kind:              kind,
+		Name:              meta.Name,
+		Namespace:         meta.Namespace,
+		ResourceVersion:   meta.ResourceVersion,
+		CreationTimestamp: meta.CreationTimestamp,
+		Labels:            meta.Labels,
+	}
+}
+
+// ParseKinds parses a comma-separated list of kinds, case-insensitively.
+// An empty list selects every kind.
+func ParseKinds(param string) (map[string]bool, error) {
+	kinds := make(map[string]bool)
+	if strings.TrimSpace(param) == "" {
+		for _, kind := range AllKinds {
+			kinds[kind] = true
+		}
+		return kinds, nil
+	}
+
+	for _, requested := range strings.Split(param, ",") {
+		requested = strings.TrimSpace(requested)
+		matched := false
+		for _, kind := range AllKinds {
+			if strings.EqualFold(requested, kind) {
+				kinds[kind] = true
+				matched = true
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("unknown kind %q", requested)
+		}
+	}
+	return kinds, nil
+}